@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"testCustomType/customtype"
+)
+
+// describe prints how the server defines a type.  With -catalog it prints
+// the catalog rows of the types named, one or more, and those they refer to
+// as JSON instead, for the code generator's tests to use as a fixture.
+func describe(ctx context.Context, args []string) error {
+	f := newFlags("describe")
+	catalog := f.Bool("catalog", false, "print the type's catalog rows as JSON, as the generator's test fixtures are")
+	args, err := f.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 && !(*catalog && len(args) > 1) {
+		f.Usage()
+		return fmt.Errorf("describe needs the name of a type")
+	}
+
+	conn, err := f.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if *catalog {
+		rows, err := customtype.ReadCatalog(ctx, conn, args...)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	desc, err := customtype.Describe(ctx, conn, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is a %s type, oid %d, array oid %d\n", desc.Name, desc.Kind, desc.OID, desc.ArrayOID)
+	for i, field := range desc.Fields {
+		fmt.Printf("  %d. %s %s\n", i+1, field.Name, field.Type)
+	}
+	for _, label := range desc.Labels {
+		fmt.Printf("  %s\n", label)
+	}
+	if desc.BaseType != "" {
+		fmt.Printf("  over %s\n", desc.BaseType)
+	}
+	if desc.Subtype != "" {
+		fmt.Printf("  of %s\n", desc.Subtype)
+	}
+	return nil
+}
+
+// generate writes the Go code for the types, from the config file if there
+// is one, so that the code and the registry agree.
+func generate(ctx context.Context, args []string) error {
+	f := newFlags("generate")
+	pkg := f.String("package", "customtype", "the package of the generated code")
+	out := f.String("o", "", "the file to write, instead of standard output")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+
+	config, err := f.typesConfig()
+	if err != nil {
+		return err
+	}
+	src, err := customtype.Generate(*pkg, config)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0o644)
+}
+
+// sqlc prints the overrides for sqlc.yaml that map the types to the Go code
+// generate writes for them, from the config file if there is one.  It needs
+// to know where that code is, with -import.
+func sqlc(ctx context.Context, args []string) error {
+	f := newFlags("sqlc")
+	importPath := f.String("import", "", "the import path of the package generate wrote the code to")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+	if *importPath == "" {
+		f.Usage()
+		return fmt.Errorf("sqlc needs the -import path of the generated code")
+	}
+
+	config, err := f.typesConfig()
+	if err != nil {
+		return err
+	}
+	overrides, err := customtype.SqlcOverrides(config, *importPath)
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]interface{}{"overrides": overrides}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// verify reports any drift between the definitions and the database.  It
+// returns errDrift if there is any, so that CI fails.
+func verify(ctx context.Context, args []string) error {
+	f := newFlags("verify")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+
+	registry, err := f.registry()
+	if err != nil {
+		return err
+	}
+
+	conn, err := f.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	drift, err := registry.Verify(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, d := range drift {
+		slog.Warn("Drift", "drift", d)
+	}
+	if len(drift) > 0 {
+		return errDrift
+	}
+
+	slog.Info("No drift")
+	return nil
+}
+
+// health checks the database and its types the way a readiness probe
+// would, and fails if they aren't healthy.
+func health(ctx context.Context, args []string) error {
+	f := newFlags("health")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+	connString, err := f.connString()
+	if err != nil {
+		return err
+	}
+	registry, err := f.registry()
+	if err != nil {
+		return err
+	}
+
+	pool, err := customtype.Connect(ctx, connString, registry)
+	if err != nil {
+		return fmt.Errorf("no database connection: %w", err)
+	}
+	defer pool.Close()
+
+	if err := registry.HealthCheck(ctx, pool); err != nil {
+		return err
+	}
+	slog.Info("Healthy")
+	return nil
+}
+
+// listen prints the resolutions sent on a channel, as a trigger might with
+// pg_notify('resolutions', new.res::text), until it is interrupted.
+func listen(ctx context.Context, args []string) error {
+	f := newFlags("listen")
+	channel := f.String("channel", "resolutions", "the channel to listen on")
+	jsonPayloads := f.Bool("json", false, "the payloads are JSON rather than the text of a resolution")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+	connString, err := f.connString()
+	if err != nil {
+		return err
+	}
+	registry, err := f.registry()
+	if err != nil {
+		return err
+	}
+
+	pool, err := customtype.Connect(ctx, connString, registry)
+	if err != nil {
+		return fmt.Errorf("no database connection: %w", err)
+	}
+	defer pool.Close()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	sub := customtype.Subscription{Channel: *channel, Type: "resolution"}
+	if *jsonPayloads {
+		sub.Type = ""
+	}
+	for n := range customtype.Listen[customtype.Option[customtype.ResolutionDTO]](ctx, pool, sub) {
+		switch {
+		case n.Err != nil:
+			slog.Warn("Bad notification", "channel", n.Channel, "err", n.Err)
+		case !n.Value.IsSome():
+			slog.Info("No resolution", "channel", n.Channel)
+		default:
+			slog.Info("Got a resolution", "channel", n.Channel, "resolution", n.Value.Unwrap().AsResolution())
+		}
+	}
+	return nil
+}
+
+// serve serves the rows of foo over HTTP as JSON until it is interrupted,
+// with customtype.FooHandler under /foos and the health check at /healthz.
+// A posted resolution gets the database's defaults when the config has them,
+// and DefaultResolutionPolicies otherwise.
+func serve(ctx context.Context, args []string) error {
+	f := newFlags("serve")
+	addr := f.String("addr", "localhost:8080", "the address to listen on")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+	connString, err := f.connString()
+	if err != nil {
+		return err
+	}
+	registry, err := f.registry()
+	if err != nil {
+		return err
+	}
+
+	pool, err := customtype.Connect(ctx, connString, registry)
+	if err != nil {
+		return fmt.Errorf("no database connection: %w", err)
+	}
+	defer pool.Close()
+
+	policies, ok := registry.NullPolicies("resolution")
+	if !ok {
+		policies = customtype.DefaultResolutionPolicies()
+	}
+	foos := customtype.FooHandler(pool, policies)
+	mux := http.NewServeMux()
+	mux.Handle("/foos", foos)
+	mux.Handle("/foos/", foos)
+	mux.Handle("GET /healthz", registry.HealthHandler(pool))
+	srv := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Serving", "addr", *addr)
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	// The requests in flight get a little while to finish before the pool
+	// is closed under them.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	slog.Info("Stopped serving")
+	return nil
+}
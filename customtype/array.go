@@ -0,0 +1,298 @@
+package customtype
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgio"
+	"github.com/jackc/pgtype"
+)
+
+// arrayType is pgtype's ArrayType, which we register the arrays of our types
+// with, but checking the binary format before decoding it.  ArrayType trusts
+// the lengths in the header and before each element, and reads past the end
+// of src, or allocates however many elements the header says, when they're
+// wrong.
+//
+// It is also Set from more than ArrayType is, so that a []Resolution, a
+// [][]Resolution or a [2]Resolution can be a query parameter, as in
+// WHERE res = ANY($1).  ArrayType has a single dimension, even when it's
+// set to nothing, which the text format can't write.
+type arrayType struct {
+	*pgtype.ArrayType
+	elementOID uint32
+	newElement func() pgtype.ValueTranscoder
+
+	// param is the array as Set, when it's empty or has more than one
+	// dimension, which is what's encoded rather than ArrayType.
+	param *arrayParam
+}
+
+type arrayParam struct {
+	set        bool
+	elements   []pgtype.ValueTranscoder
+	dimensions []pgtype.ArrayDimension
+}
+
+func newArrayType(name string, elementOID uint32, newElement func() pgtype.ValueTranscoder) arrayType {
+	return arrayType{
+		ArrayType:  pgtype.NewArrayType(name, elementOID, newElement),
+		elementOID: elementOID,
+		newElement: newElement,
+		param:      &arrayParam{},
+	}
+}
+
+// NewTypeValue keeps the check on the copies the ConnInfo makes.
+func (at arrayType) NewTypeValue() pgtype.Value {
+	return arrayType{
+		ArrayType:  at.ArrayType.NewTypeValue().(*pgtype.ArrayType),
+		elementOID: at.elementOID,
+		newElement: at.newElement,
+		param:      &arrayParam{},
+	}
+}
+
+func (at arrayType) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	*at.param = arrayParam{}
+	if err := checkBinaryArray(src); err != nil {
+		return err
+	}
+	return at.ArrayType.DecodeBinary(ci, src)
+}
+
+func (at arrayType) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	*at.param = arrayParam{}
+	return at.ArrayType.DecodeText(ci, src)
+}
+
+// Set accepts a slice or array of anything an element can be set to, nil
+// for a null element, or of slices or arrays of them, to as many dimensions
+// as postgres allows, as long as they're all the same length.  Get and
+// AssignTo see it in one dimension.
+func (at arrayType) Set(src interface{}) error {
+	*at.param = arrayParam{}
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if src == nil || v.Kind() == reflect.Ptr || (v.Kind() == reflect.Slice && v.IsNil()) {
+		return at.ArrayType.Set(nil)
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("cannot convert %T to %s", src, at.TypeName())
+	}
+
+	dimensions := arrayDimensions(v)
+	if len(dimensions) > maxArrayDimensions {
+		return fmt.Errorf("cannot convert %T to %s: %d dimensions, no more than %d are allowed", src, at.TypeName(), len(dimensions), maxArrayDimensions)
+	}
+	var values []interface{}
+	if err := flattenArray(v, dimensions, &values); err != nil {
+		return fmt.Errorf("cannot convert %T to %s: %w", src, at.TypeName(), err)
+	}
+	if err := at.ArrayType.Set(values); err != nil {
+		return err
+	}
+	if len(dimensions) == 1 && len(values) > 0 {
+		return nil
+	}
+
+	param := arrayParam{set: true, elements: make([]pgtype.ValueTranscoder, len(values))}
+	for i, value := range values {
+		param.elements[i] = at.newElement()
+		if err := param.elements[i].Set(value); err != nil {
+			return err
+		}
+	}
+	if len(values) > 0 {
+		param.dimensions = dimensions
+	}
+	*at.param = param
+	return nil
+}
+
+// arrayDimensions are the dimensions of v, following its first elements
+// down for as long as they're slices or arrays themselves.
+func arrayDimensions(v reflect.Value) []pgtype.ArrayDimension {
+	var dimensions []pgtype.ArrayDimension
+	for {
+		dimensions = append(dimensions, pgtype.ArrayDimension{Length: int32(v.Len()), LowerBound: 1})
+		if v.Len() == 0 {
+			return dimensions
+		}
+		next, ok := arrayDimension(v.Index(0))
+		if !ok {
+			return dimensions
+		}
+		v = next
+	}
+}
+
+// arrayDimension is v, if it's another dimension of an array rather than an
+// element: a slice or array, other than the []interface{} a composite can
+// be set from.
+func arrayDimension(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Interface || (v.Kind() == reflect.Ptr && !v.IsNil()) {
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Interface:
+		return v, false
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v, false
+	case v.Kind() == reflect.Slice, v.Kind() == reflect.Array:
+		return v, true
+	}
+	return v, false
+}
+
+// flattenArray appends the elements of v, which has the dimensions, to
+// values in order.
+func flattenArray(v reflect.Value, dimensions []pgtype.ArrayDimension, values *[]interface{}) error {
+	if v.Len() != int(dimensions[0].Length) {
+		return fmt.Errorf("sub-arrays have lengths %d and %d, they must all be the same", dimensions[0].Length, v.Len())
+	}
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		next, ok := arrayDimension(e)
+		switch {
+		case len(dimensions) > 1 && !ok:
+			return fmt.Errorf("%T is an element where a sub-array of %d should be", e.Interface(), dimensions[1].Length)
+		case len(dimensions) > 1:
+			if err := flattenArray(next, dimensions[1:], values); err != nil {
+				return err
+			}
+		case ok:
+			return fmt.Errorf("%T is a sub-array where an element should be", e.Interface())
+		default:
+			*values = append(*values, e.Interface())
+		}
+	}
+	return nil
+}
+
+func (at arrayType) EncodeBinary(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	if !at.param.set {
+		return at.ArrayType.EncodeBinary(ci, buf)
+	}
+
+	header := pgtype.ArrayHeader{Dimensions: at.param.dimensions, ElementOID: int32(at.elementOID)}
+	for _, e := range at.param.elements {
+		if e.Get() == nil {
+			header.ContainsNull = true
+			break
+		}
+	}
+	buf = header.EncodeBinary(ci, buf)
+
+	for _, e := range at.param.elements {
+		sp := len(buf)
+		buf = pgio.AppendInt32(buf, -1)
+		elemBuf, err := e.(pgtype.BinaryEncoder).EncodeBinary(ci, buf)
+		if err != nil {
+			return nil, err
+		}
+		if elemBuf != nil {
+			buf = elemBuf
+			pgio.SetInt32(buf[sp:], int32(len(buf[sp:])-4))
+		}
+	}
+	return buf, nil
+}
+
+func (at arrayType) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	if !at.param.set {
+		return at.ArrayType.EncodeText(ci, buf)
+	}
+	if len(at.param.dimensions) == 0 {
+		return append(buf, '{', '}'), nil
+	}
+
+	// As in ArrayType, an element opens every dimension it's the first of
+	// and closes every one it's the last of.
+	dimensions := at.param.dimensions
+	stride := make([]int, len(dimensions))
+	stride[len(dimensions)-1] = int(dimensions[len(dimensions)-1].Length)
+	for i := len(dimensions) - 2; i >= 0; i-- {
+		stride[i] = int(dimensions[i].Length) * stride[i+1]
+	}
+
+	for i, e := range at.param.elements {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		for _, n := range stride {
+			if i%n == 0 {
+				buf = append(buf, '{')
+			}
+		}
+		elemBuf, err := e.EncodeText(ci, nil)
+		if err != nil {
+			return nil, err
+		}
+		if elemBuf == nil {
+			buf = append(buf, "NULL"...)
+		} else {
+			buf = append(buf, pgtype.QuoteArrayElementIfNeeded(string(elemBuf))...)
+		}
+		for _, n := range stride {
+			if (i+1)%n == 0 {
+				buf = append(buf, '}')
+			}
+		}
+	}
+	return buf, nil
+}
+
+// maxArrayDimensions is the most dimensions postgres allows an array.
+const maxArrayDimensions = 6
+
+// checkBinaryArray checks that the lengths in a binary array add up, before
+// ArrayType relies on them.
+func checkBinaryArray(src []byte) error {
+	if src == nil {
+		return nil
+	}
+	var header pgtype.ArrayHeader
+	if len(src) >= 4 && binary.BigEndian.Uint32(src) > maxArrayDimensions {
+		return fmt.Errorf("array has %d dimensions, no more than %d are allowed", binary.BigEndian.Uint32(src), maxArrayDimensions)
+	}
+	rp, err := header.DecodeBinary(nil, src)
+	if err != nil {
+		return err
+	}
+	if len(header.Dimensions) == 0 {
+		return nil
+	}
+
+	// Every element takes four bytes for its length at least, which bounds
+	// how many there can be before multiplying the dimensions overflows.
+	remaining := len(src) - rp
+	count := 1
+	for _, d := range header.Dimensions {
+		if d.Length < 0 {
+			return fmt.Errorf("array dimension has negative length %d", d.Length)
+		}
+		count *= int(d.Length)
+		if count > remaining/4 {
+			return fmt.Errorf("array of %d elements doesn't fit in %d bytes", count, remaining)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if len(src)-rp < 4 {
+			return fmt.Errorf("array ends before element %d", i)
+		}
+		elemLen := int(int32(binary.BigEndian.Uint32(src[rp:])))
+		rp += 4
+		if elemLen > len(src)-rp {
+			return fmt.Errorf("array element %d of %d bytes runs past the end", i, elemLen)
+		}
+		if elemLen > 0 {
+			rp += elemLen
+		}
+	}
+	return nil
+}
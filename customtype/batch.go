@@ -0,0 +1,126 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// pgx.Batch sends any number of queries in one round trip, but leaves their
+// results as rows to scan in the order the queries were queued.  A Batch
+// remembers what each query's rows are to be decoded into, so that a
+// latency sensitive path can ask for several sets of composites at once and
+// get them back typed:
+//
+//	var b customtype.Batch
+//	resolutions := customtype.QueueAll[customtype.Resolution](&b, "SELECT res FROM foo WHERE res IS NOT NULL")
+//	display := customtype.QueueOne[customtype.Display](&b, "SELECT disp FROM bar WHERE id = $1", 1)
+//	if err := b.Send(ctx, pool); err != nil {
+//		...
+//	}
+//	res, err := resolutions.Get()
+//
+// Every query has a result and an error of its own.  The server runs a
+// batch as one transaction, unless it's inside one already, so an error
+// undoes the statements before it and the queries after it fail as well,
+// but the queries before it still have their rows.
+
+// Batch is a set of queries to send together, each with a Result to decode
+// its rows into.  The zero Batch is empty and ready to use.  A Batch is sent
+// once.
+type Batch struct {
+	batch   pgx.Batch
+	readers []func(pgx.BatchResults) error
+}
+
+// Result is what one query of a Batch gave, once the batch has been sent.
+type Result[T any] struct {
+	value T
+	err   error
+	done  bool
+}
+
+// Get is the query's value and error.  Before the batch is sent, it is an
+// error.
+func (r *Result[T]) Get() (T, error) {
+	if !r.done {
+		var zero T
+		return zero, errors.New("the batch hasn't been sent")
+	}
+	return r.value, r.err
+}
+
+// QueueAll queues sql, whose rows are scanned into a []T with ScanAll.
+func QueueAll[T any](b *Batch, sql string, args ...interface{}) *Result[[]T] {
+	result := &Result[[]T]{}
+	b.queue(sql, args, func(results pgx.BatchResults) error {
+		rows, err := results.Query()
+		if err == nil {
+			result.value, err = ScanAll[T](rows)
+		}
+		result.err, result.done = err, true
+		return err
+	})
+	return result
+}
+
+// QueueOne queues sql, whose only row is scanned into a T with ScanOne.
+func QueueOne[T any](b *Batch, sql string, args ...interface{}) *Result[T] {
+	result := &Result[T]{}
+	b.queue(sql, args, func(results pgx.BatchResults) error {
+		rows, err := results.Query()
+		if err == nil {
+			result.value, err = ScanOne[T](rows)
+		}
+		result.err, result.done = err, true
+		return err
+	})
+	return result
+}
+
+// QueueExec queues sql, a statement that returns no rows, for its command
+// tag.
+func QueueExec(b *Batch, sql string, args ...interface{}) *Result[pgconn.CommandTag] {
+	result := &Result[pgconn.CommandTag]{}
+	b.queue(sql, args, func(results pgx.BatchResults) error {
+		result.value, result.err = results.Exec()
+		result.done = true
+		return result.err
+	})
+	return result
+}
+
+func (b *Batch) queue(sql string, args []interface{}, read func(pgx.BatchResults) error) {
+	b.batch.Queue(sql, args...)
+	b.readers = append(b.readers, read)
+}
+
+// Len is the number of queries queued.
+func (b *Batch) Len() int {
+	return len(b.readers)
+}
+
+// Send sends the queries to the database and decodes the rows of each into
+// its Result.  The error is that of the first query to fail, if one did,
+// with its place in the batch, counting from zero; every Result has its
+// own.
+func (b *Batch) Send(ctx context.Context, batcher Batcher) error {
+	if len(b.readers) == 0 {
+		return nil
+	}
+
+	results := batcher.SendBatch(ctx, &b.batch)
+	var first error
+	for i, read := range b.readers {
+		if err := read(results); err != nil && first == nil {
+			first = fmt.Errorf("query %d of the batch failed: %w", i, err)
+		}
+	}
+	if err := results.Close(); err != nil && first == nil {
+		first = fmt.Errorf("batch failed: %w", err)
+	}
+	return first
+}
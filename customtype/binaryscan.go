@@ -0,0 +1,79 @@
+package customtype
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// compositeBinaryScanner reads the fields of a composite in the binary format,
+// as pgtype's CompositeBinaryScanner does.  pgtype's comes back as a pointer,
+// which costs an allocation for every composite decoded, where ours is a
+// value the decoder keeps on its stack.
+type compositeBinaryScanner struct {
+	src        []byte
+	rp         int
+	fieldCount int
+	fieldOID   uint32
+	fieldBytes []byte
+	err        error
+}
+
+func newCompositeBinaryScanner(src []byte) compositeBinaryScanner {
+	if len(src) < 4 {
+		return compositeBinaryScanner{err: fmt.Errorf("record incomplete %v", src)}
+	}
+	return compositeBinaryScanner{
+		src:        src,
+		rp:         4,
+		fieldCount: int(int32(binary.BigEndian.Uint32(src))),
+	}
+}
+
+// Next reads the next field, reporting false once there are none left or
+// the binary is malformed, which Err tells apart.  A null field's Bytes are
+// nil.
+func (s *compositeBinaryScanner) Next() bool {
+	if s.err != nil || s.rp == len(s.src) {
+		return false
+	}
+
+	if len(s.src)-s.rp < 8 {
+		s.err = fmt.Errorf("record incomplete %v", s.src)
+		return false
+	}
+	s.fieldOID = binary.BigEndian.Uint32(s.src[s.rp:])
+	fieldLen := int(int32(binary.BigEndian.Uint32(s.src[s.rp+4:])))
+	s.rp += 8
+
+	if fieldLen < 0 {
+		s.fieldBytes = nil
+		return true
+	}
+	if len(s.src)-s.rp < fieldLen {
+		s.err = fmt.Errorf("record incomplete rp=%d src=%v", s.rp, s.src)
+		return false
+	}
+	s.fieldBytes = s.src[s.rp : s.rp+fieldLen]
+	s.rp += fieldLen
+	return true
+}
+
+// FieldCount is how many fields the composite says it has.
+func (s *compositeBinaryScanner) FieldCount() int {
+	return s.fieldCount
+}
+
+// OID is the type of the field Next read.
+func (s *compositeBinaryScanner) OID() uint32 {
+	return s.fieldOID
+}
+
+// Bytes are the field Next read.
+func (s *compositeBinaryScanner) Bytes() []byte {
+	return s.fieldBytes
+}
+
+// Err is why Next stopped, if it wasn't the end of the fields.
+func (s *compositeBinaryScanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,188 @@
+package customtype
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Getting at a field of a composite column takes parentheses, (res).width
+// rather than res.width, which postgres would take for column width of table
+// res.  Rather than write those by hand, where they're easy to get wrong and
+// drift from the structs when a field is renamed, FieldRef builds them from
+// the Go fields and their pg tags, and Query puts them in a where or order by
+// clause:
+//
+//	res := customtype.Column[customtype.Resolution]("res")
+//	sql, args, err := customtype.NewQuery("SELECT res FROM foo").
+//		Where(res.Field("Width"), ">", 10).
+//		OrderBy(res.Field("Height")).
+//		Build()
+//
+// gives SELECT res FROM foo WHERE ("res")."width" > $1 ORDER BY ("res")."height".
+
+// FieldRef is a composite column, or a field of one, in SQL.  An error, such
+// as a field the struct doesn't have, is kept until the SQL is asked for.
+type FieldRef struct {
+	sql    string
+	goType reflect.Type
+	err    error
+}
+
+// Column refers to the column of a composite type that T maps, named by its
+// parts as a pgx.Identifier is, so that Column[Resolution]("foo", "res") is
+// foo.res.
+func Column[T any](name ...string) FieldRef {
+	ref := FieldRef{sql: pgx.Identifier(name).Sanitize(), goType: reflect.TypeOf((*T)(nil)).Elem()}
+	if len(name) == 0 {
+		ref.err = fmt.Errorf("a column needs a name")
+	}
+	return ref
+}
+
+// Field refers to the field of the composite with the Go name name, which
+// is the attribute its pg tag names.  Fields of a nested composite are
+// reached the same way, disp.Field("Res").Field("Width").
+func (f FieldRef) Field(name string) FieldRef {
+	if f.err != nil {
+		return f
+	}
+
+	t := f.goType
+	for {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+			continue
+		}
+		if option, ok := reflect.Zero(t).Interface().(optionSource); ok {
+			t = option.optionType()
+			continue
+		}
+		break
+	}
+	if t.Kind() != reflect.Struct {
+		return FieldRef{err: fmt.Errorf("%s is a %s, which has no field %s", f.sql, f.goType, name)}
+	}
+
+	sf, ok := t.FieldByName(name)
+	if !ok || sf.PkgPath != "" {
+		return FieldRef{err: fmt.Errorf("%s has no field %s", t, name)}
+	}
+	attribute, _ := pgTag(sf)
+	return FieldRef{
+		sql:    "(" + f.sql + ")." + pgx.Identifier{attribute}.Sanitize(),
+		goType: sf.Type,
+	}
+}
+
+// SQL is the reference as SQL.
+func (f FieldRef) SQL() (string, error) {
+	return f.sql, f.err
+}
+
+// operators are the comparisons Where accepts.
+var operators = map[string]bool{
+	"=": true, "<>": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"LIKE": true, "ILIKE": true, "IS DISTINCT FROM": true, "IS NOT DISTINCT FROM": true,
+}
+
+// Query adds where and order by clauses on composite fields to a query.  The
+// values compared with are sent as parameters, numbered after any the query
+// already has.
+type Query struct {
+	sql   string
+	where []string
+	order []string
+	args  []interface{}
+	err   error
+}
+
+// NewQuery starts a query from sql, which has args for its own parameters.
+// The clauses are added to the end, so sql must not have a where or order by
+// of its own.
+func NewQuery(sql string, args ...interface{}) *Query {
+	return &Query{sql: sql, args: args}
+}
+
+// Where adds the condition that f compares with value by op, such as ">" or
+// "IS DISTINCT FROM".  Conditions are joined by AND.
+func (q *Query) Where(f FieldRef, op string, value interface{}) *Query {
+	if !operators[strings.ToUpper(op)] {
+		q.fail(fmt.Errorf("unknown operator %s", op))
+		return q
+	}
+	q.args = append(q.args, value)
+	q.condition(f, strings.ToUpper(op)+" $"+strconv.Itoa(len(q.args)))
+	return q
+}
+
+// WhereNull adds the condition that f is null.
+func (q *Query) WhereNull(f FieldRef) *Query {
+	q.condition(f, "IS NULL")
+	return q
+}
+
+// WhereNotNull adds the condition that f is not null.
+func (q *Query) WhereNotNull(f FieldRef) *Query {
+	q.condition(f, "IS NOT NULL")
+	return q
+}
+
+func (q *Query) condition(f FieldRef, rest string) {
+	sql, err := f.SQL()
+	if err != nil {
+		q.fail(err)
+		return
+	}
+	q.where = append(q.where, sql+" "+rest)
+}
+
+// OrderBy orders the rows by f, ascending.
+func (q *Query) OrderBy(f FieldRef) *Query {
+	return q.orderBy(f, "")
+}
+
+// OrderByDesc orders the rows by f, descending.
+func (q *Query) OrderByDesc(f FieldRef) *Query {
+	return q.orderBy(f, " DESC")
+}
+
+func (q *Query) orderBy(f FieldRef, direction string) *Query {
+	sql, err := f.SQL()
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+	q.order = append(q.order, sql+direction)
+	return q
+}
+
+// fail keeps the first error, for Build.
+func (q *Query) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// Build gives the SQL and its arguments, for Query or QueryRow, or the first
+// error in building it.
+func (q *Query) Build() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, fmt.Errorf("failed to build query: %w", q.err)
+	}
+
+	var sql strings.Builder
+	sql.WriteString(q.sql)
+	if len(q.where) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(q.where, " AND "))
+	}
+	if len(q.order) > 0 {
+		sql.WriteString(" ORDER BY ")
+		sql.WriteString(strings.Join(q.order, ", "))
+	}
+	return sql.String(), q.args, nil
+}
@@ -0,0 +1,155 @@
+package customtype
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decoding a large result of composites is most of what a read heavy
+// endpoint spends its time on, when it runs the same query with the same
+// arguments over and over and the rows barely change.  A ResultCache keeps
+// the decoded results of CachedQueryAll for a while, so that the query is
+// run and decoded once in its TTL rather than once per request:
+//
+//	cache := customtype.NewResultCache(500, 30*time.Second)
+//	...
+//	res, err := customtype.CachedQueryAll[customtype.ResolutionDTO](ctx, cache, pool,
+//		"SELECT res FROM foo WHERE (res).width > $1", 5)
+//
+// The cache knows nothing of what changes the rows, so a result can be up to
+// the TTL out of date; Clear throws every result away, after a write that
+// must be seen straight away say.
+
+// ResultCache holds the results of queries, each for at most its TTL, and at
+// most Size of them, the least recently used going first.  It is safe to
+// share between goroutines.
+type ResultCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// cacheEntry is a result in the cache, the front of the list being the most
+// recently used.
+type cacheEntry struct {
+	key     string
+	result  interface{}
+	expires time.Time
+}
+
+// NewResultCache makes a cache keeping at most size results, each for ttl.
+// A zero ttl keeps results until they're pushed out by newer ones, and a zero
+// size keeps 1000 of them.
+func NewResultCache(size int, ttl time.Duration) *ResultCache {
+	if size <= 0 {
+		size = 1000
+	}
+	return &ResultCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// CachedQueryAll is QueryAll through cache: a result of the same query, with
+// the same arguments and into the same T, that the cache still has is
+// returned without running the query again.  Errors aren't cached.  The
+// slice is the caller's, but what its elements point to is shared with every
+// other caller that gets the result, and mustn't be changed.
+//
+// Arguments are told apart by their type and their JSON, so an argument
+// that can't be marshalled, or marshals the same for different values,
+// shouldn't go through the cache.
+func CachedQueryAll[T any](ctx context.Context, cache *ResultCache, q Querier, sql string, args ...interface{}) ([]T, error) {
+	key, err := cacheKey(reflect.TypeOf((*T)(nil)).Elem(), sql, args)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := cache.get(key); ok {
+		return append([]T(nil), cached.([]T)...), nil
+	}
+
+	results, err := QueryAll[T](ctx, q, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	cache.put(key, results)
+	return append([]T(nil), results...), nil
+}
+
+// Clear throws away every result in the cache.
+func (c *ResultCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Len is the number of results in the cache, some of which may have
+// expired without being looked for since.
+func (c *ResultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *ResultCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry.result, true
+}
+
+func (c *ResultCache) put(key string, result interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, result: result, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey is what a query's results are cached by: the type they're
+// decoded into, the statement, and the type and JSON of each argument.
+func cacheKey(t reflect.Type, sql string, args []interface{}) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%s", t, sql)
+	for i, arg := range args {
+		data, err := json.Marshal(arg)
+		if err != nil {
+			return "", fmt.Errorf("cannot cache a query by argument %d: %w", i+1, err)
+		}
+		fmt.Fprintf(&b, "\x00%T\x00%s", arg, data)
+	}
+	return b.String(), nil
+}
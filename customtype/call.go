@@ -0,0 +1,98 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Composites are often what functions return, one, a set of them, or a row
+// of OUT parameters, and each takes different SQL to get at.  A call in the
+// select list covers them all: a composite comes back as one column, null if
+// the function returned null, a set of them as a row each, and OUT parameters
+// as an anonymous record, which scans into a struct field by field.
+// Selecting from the function instead explodes a composite into a column per
+// field, which CallFuncColumns scans by name, with nothing to register.
+
+// CallFunc calls the function name with args and scans what it returns into
+// a T per row, as ScanAll does.  name may be schema-qualified and is quoted
+// as a type name would be, so MySchema.Best_Resolution is
+// myschema.best_resolution.
+func CallFunc[T any](ctx context.Context, q Querier, name string, args ...interface{}) ([]T, error) {
+	fn, err := parseTypeName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid function name %s: %w", name, err)
+	}
+
+	sql := fmt.Sprintf("SELECT %s(%s)", fn.Sanitize(), placeholders(len(args)))
+	ctx, span := startQuerySpan[T](ctx, "customtype.CallFunc", sql)
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, endSpan(span, fmt.Errorf("call to %s failed: %w", name, err))
+	}
+
+	results, err := ScanAll[T](rows)
+	span.SetAttributes(attrRows.Int(len(results)))
+	return results, endSpan(span, err)
+}
+
+// CallFuncColumns selects every column from the function name, called with
+// args, and scans them into a struct T per row by name, as ScanAllByName
+// does.  For a function returning setof resolution, that's a row per
+// resolution and a column per field:
+//
+//	resolutions, err := customtype.CallFuncColumns[customtype.ResolutionDTO](ctx, pool, "wider_than", 5)
+//
+// The columns are of the built in types, so this works even where the
+// composite isn't registered.  A function returning a composite that is
+// null gives a row of nulls rather than no row.
+func CallFuncColumns[T any](ctx context.Context, q Querier, name string, args ...interface{}) ([]T, error) {
+	fn, err := parseTypeName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid function name %s: %w", name, err)
+	}
+
+	sql := fmt.Sprintf("SELECT * FROM %s(%s)", fn.Sanitize(), placeholders(len(args)))
+	ctx, span := startQuerySpan[T](ctx, "customtype.CallFuncColumns", sql)
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, endSpan(span, fmt.Errorf("call to %s failed: %w", name, err))
+	}
+
+	results, err := ScanAllByName[T](rows)
+	span.SetAttributes(attrRows.Int(len(results)))
+	return results, endSpan(span, err)
+}
+
+// CallProcedure calls the procedure name with args and scans its OUT
+// parameters into the fields of T, as ScanOne does.  As CALL requires, the
+// OUT parameters take an argument too, which should be nil.  A procedure
+// without any has nothing to scan, and is better run with Exec.
+func CallProcedure[T any](ctx context.Context, q Querier, name string, args ...interface{}) (T, error) {
+	var zero T
+	proc, err := parseTypeName(name)
+	if err != nil {
+		return zero, fmt.Errorf("invalid procedure name %s: %w", name, err)
+	}
+
+	sql := fmt.Sprintf("CALL %s(%s)", proc.Sanitize(), placeholders(len(args)))
+	ctx, span := startQuerySpan[T](ctx, "customtype.CallProcedure", sql)
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return zero, endSpan(span, fmt.Errorf("call to %s failed: %w", name, err))
+	}
+	span.SetAttributes(attrFields.Int(len(rows.FieldDescriptions())))
+
+	result, err := ScanOne[T](rows)
+	return result, endSpan(span, err)
+}
+
+// placeholders are the parameters $1 to $n.
+func placeholders(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = "$" + strconv.Itoa(i+1)
+	}
+	return strings.Join(params, ", ")
+}
@@ -0,0 +1,339 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Catalog is the rows of pg_type, pg_attribute, pg_enum and pg_range that
+// define some types, and every type they refer to.  ReadCatalog captures one
+// from a database, and it marshals to JSON with the catalog's own column
+// names, so that a captured catalog can stand in for the database: the code
+// generator's tests run on catalogs kept in testdata.
+type Catalog struct {
+	Types      []CatalogType      `json:"pg_type"`
+	Attributes []CatalogAttribute `json:"pg_attribute,omitempty"`
+	Enums      []CatalogEnum      `json:"pg_enum,omitempty"`
+	Ranges     []CatalogRange     `json:"pg_range,omitempty"`
+}
+
+// CatalogType is a row of pg_type, with the name of its schema.
+type CatalogType struct {
+	OID       uint32 `json:"oid"`
+	Namespace string `json:"nspname"`
+	Name      string `json:"typname"`
+	Kind      string `json:"typtype"`
+	RelID     uint32 `json:"typrelid,omitempty"`
+	Elem      uint32 `json:"typelem,omitempty"`
+	BaseType  uint32 `json:"typbasetype,omitempty"`
+}
+
+// CatalogAttribute is a row of pg_attribute.
+type CatalogAttribute struct {
+	RelID  uint32 `json:"attrelid"`
+	Name   string `json:"attname"`
+	TypeID uint32 `json:"atttypid"`
+	Num    int16  `json:"attnum"`
+}
+
+// CatalogEnum is a row of pg_enum.
+type CatalogEnum struct {
+	TypeID    uint32  `json:"enumtypid"`
+	Label     string  `json:"enumlabel"`
+	SortOrder float32 `json:"enumsortorder"`
+}
+
+// CatalogRange is a row of pg_range.
+type CatalogRange struct {
+	TypeID       uint32 `json:"rngtypid"`
+	Subtype      uint32 `json:"rngsubtype"`
+	MultirangeID uint32 `json:"rngmultitypid,omitempty"`
+}
+
+// ReadCatalog captures the catalog rows of the types called names, looked up
+// as a cast to them would be, and of the types they refer to, their fields'
+// types, the elements of arrays, the bases of domains and the subtypes of
+// ranges, all the way down.
+func ReadCatalog(ctx context.Context, conn *pgx.Conn, names ...string) (Catalog, error) {
+	var pending []uint32
+	for _, name := range names {
+		var oid uint32
+		if err := conn.QueryRow(ctx, "select $1::text::regtype::oid", name).Scan(&oid); err != nil {
+			return Catalog{}, fmt.Errorf("failed to look up %s: %w", name, err)
+		}
+		pending = append(pending, oid)
+	}
+
+	var catalog Catalog
+	seen := make(map[uint32]bool)
+	seenRanges := make(map[uint32]bool)
+	for len(pending) > 0 {
+		var next []uint32
+		refer := func(oid uint32) {
+			if oid != 0 && !seen[oid] {
+				seen[oid] = true
+				next = append(next, oid)
+			}
+		}
+		for _, oid := range pending {
+			seen[oid] = true
+		}
+
+		types, err := readCatalogTypes(ctx, conn, pending)
+		if err != nil {
+			return Catalog{}, err
+		}
+		catalog.Types = append(catalog.Types, types...)
+
+		var relids, enums, ranges []uint32
+		for _, t := range types {
+			refer(t.Elem)
+			refer(t.BaseType)
+			switch t.Kind {
+			case "c":
+				relids = append(relids, t.RelID)
+			case "e":
+				enums = append(enums, t.OID)
+			case "r", "m":
+				ranges = append(ranges, t.OID)
+			}
+		}
+
+		attributes, err := readCatalogRows(ctx, conn, `select attrelid, attname, atttypid, attnum from pg_attribute
+			where attrelid = any($1) and attnum > 0 and not attisdropped`, relids,
+			func(rows pgx.Rows) (a CatalogAttribute, err error) {
+				err = rows.Scan(&a.RelID, &a.Name, &a.TypeID, &a.Num)
+				return a, err
+			})
+		if err != nil {
+			return Catalog{}, err
+		}
+		for _, a := range attributes {
+			refer(a.TypeID)
+		}
+		catalog.Attributes = append(catalog.Attributes, attributes...)
+
+		labels, err := readCatalogRows(ctx, conn, `select enumtypid, enumlabel, enumsortorder from pg_enum
+			where enumtypid = any($1)`, enums,
+			func(rows pgx.Rows) (e CatalogEnum, err error) {
+				err = rows.Scan(&e.TypeID, &e.Label, &e.SortOrder)
+				return e, err
+			})
+		if err != nil {
+			return Catalog{}, err
+		}
+		catalog.Enums = append(catalog.Enums, labels...)
+
+		// A multirange's row is its range's.
+		subtypes, err := readCatalogRows(ctx, conn, `select rngtypid, rngsubtype, rngmultitypid from pg_range
+			where rngtypid = any($1) or rngmultitypid = any($1)`, ranges,
+			func(rows pgx.Rows) (r CatalogRange, err error) {
+				err = rows.Scan(&r.TypeID, &r.Subtype, &r.MultirangeID)
+				return r, err
+			})
+		if err != nil {
+			return Catalog{}, err
+		}
+		for _, r := range subtypes {
+			if !seenRanges[r.TypeID] {
+				seenRanges[r.TypeID] = true
+				refer(r.TypeID)
+				refer(r.Subtype)
+				catalog.Ranges = append(catalog.Ranges, r)
+			}
+		}
+
+		pending = next
+	}
+
+	catalog.sort()
+	return catalog, nil
+}
+
+func readCatalogTypes(ctx context.Context, conn *pgx.Conn, oids []uint32) ([]CatalogType, error) {
+	return readCatalogRows(ctx, conn, `select t.oid, n.nspname, t.typname, t.typtype::text, t.typrelid, t.typelem, t.typbasetype
+		from pg_type t join pg_namespace n on n.oid = t.typnamespace
+		where t.oid = any($1)`, oids,
+		func(rows pgx.Rows) (t CatalogType, err error) {
+			err = rows.Scan(&t.OID, &t.Namespace, &t.Name, &t.Kind, &t.RelID, &t.Elem, &t.BaseType)
+			return t, err
+		})
+}
+
+// readCatalogRows runs a query of the catalog for the rows of oids, scanning
+// each with scan.
+func readCatalogRows[T any](ctx context.Context, conn *pgx.Conn, sql string, oids []uint32, scan func(pgx.Rows) (T, error)) ([]T, error) {
+	if len(oids) == 0 {
+		return nil, nil
+	}
+	rows, err := conn.Query(ctx, sql, oids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the catalog: %w", err)
+	}
+	defer rows.Close()
+
+	var results []T
+	for rows.Next() {
+		row, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan the catalog: %w", err)
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the catalog: %w", err)
+	}
+	return results, nil
+}
+
+// sort puts the rows in a fixed order, so that the same types always give
+// the same catalog.
+func (c *Catalog) sort() {
+	sort.Slice(c.Types, func(i, j int) bool { return c.Types[i].OID < c.Types[j].OID })
+	sort.Slice(c.Attributes, func(i, j int) bool {
+		a, b := c.Attributes[i], c.Attributes[j]
+		return a.RelID < b.RelID || a.RelID == b.RelID && a.Num < b.Num
+	})
+	sort.Slice(c.Enums, func(i, j int) bool {
+		a, b := c.Enums[i], c.Enums[j]
+		return a.TypeID < b.TypeID || a.TypeID == b.TypeID && a.SortOrder < b.SortOrder
+	})
+	sort.Slice(c.Ranges, func(i, j int) bool { return c.Ranges[i].TypeID < c.Ranges[j].TypeID })
+}
+
+// Definitions are the definitions of the composites, enums, domains, ranges
+// and multiranges in the catalog, other than postgres's own, sorted by name
+// whatever order the rows are in.  Types in public are named without their
+// schema, and the rest with it.
+func (c Catalog) Definitions() ([]TypeDefinition, error) {
+	byOID := make(map[uint32]CatalogType, len(c.Types))
+	for _, t := range c.Types {
+		byOID[t.OID] = t
+	}
+
+	var name func(oid uint32) (string, error)
+	name = func(oid uint32) (string, error) {
+		t, ok := byOID[oid]
+		if !ok {
+			return "", fmt.Errorf("type %d is not in the catalog", oid)
+		}
+		// An array's name is its element's with an underscore, which might
+		// have been shortened to fit, so we make it up again the way the
+		// registry names arrays.
+		if t.Kind == "b" && t.Elem != 0 && len(t.Name) > 0 && t.Name[0] == '_' {
+			elem, err := name(t.Elem)
+			if err != nil {
+				return "", err
+			}
+			return ArrayTypeName(elem), nil
+		}
+		switch t.Namespace {
+		case "pg_catalog", "public":
+			return writtenName(typeName{name: t.Name}), nil
+		}
+		return writtenName(typeName{schema: t.Namespace, name: t.Name}), nil
+	}
+
+	ranges := make(map[uint32]CatalogRange, len(c.Ranges))
+	multiranges := make(map[uint32]uint32, len(c.Ranges))
+	for _, r := range c.Ranges {
+		ranges[r.TypeID] = r
+		multiranges[r.MultirangeID] = r.TypeID
+	}
+
+	var defs []TypeDefinition
+	for _, t := range c.Types {
+		if t.Namespace == "pg_catalog" || t.Namespace == "information_schema" {
+			continue
+		}
+		defName, err := name(t.OID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t.Kind {
+		case "c":
+			var attributes []CatalogAttribute
+			for _, a := range c.Attributes {
+				if a.RelID == t.RelID {
+					attributes = append(attributes, a)
+				}
+			}
+			sort.Slice(attributes, func(i, j int) bool { return attributes[i].Num < attributes[j].Num })
+
+			def := CompositeDefinition{Name: defName}
+			for _, a := range attributes {
+				fieldType, err := name(a.TypeID)
+				if err != nil {
+					return nil, fmt.Errorf("cannot define %s.%s: %w", defName, a.Name, err)
+				}
+				def.Fields = append(def.Fields, CompositeField{Name: a.Name, Type: fieldType})
+			}
+			defs = append(defs, def)
+
+		case "e":
+			var labels []CatalogEnum
+			for _, e := range c.Enums {
+				if e.TypeID == t.OID {
+					labels = append(labels, e)
+				}
+			}
+			sort.Slice(labels, func(i, j int) bool { return labels[i].SortOrder < labels[j].SortOrder })
+
+			def := EnumDefinition{Name: defName}
+			for _, e := range labels {
+				def.Labels = append(def.Labels, e.Label)
+			}
+			defs = append(defs, def)
+
+		case "d":
+			base, err := name(t.BaseType)
+			if err != nil {
+				return nil, fmt.Errorf("cannot define %s: %w", defName, err)
+			}
+			defs = append(defs, DomainDefinition{Name: defName, BaseType: base})
+
+		case "r":
+			r, ok := ranges[t.OID]
+			if !ok {
+				return nil, fmt.Errorf("cannot define %s, its pg_range row is not in the catalog", defName)
+			}
+			subtype, err := name(r.Subtype)
+			if err != nil {
+				return nil, fmt.Errorf("cannot define %s: %w", defName, err)
+			}
+			defs = append(defs, RangeDefinition{Name: defName, Subtype: subtype})
+
+		case "m":
+			rangeOID, ok := multiranges[t.OID]
+			if !ok {
+				return nil, fmt.Errorf("cannot define %s, its range is not in the catalog", defName)
+			}
+			rangeName, err := name(rangeOID)
+			if err != nil {
+				return nil, fmt.Errorf("cannot define %s: %w", defName, err)
+			}
+			defs = append(defs, MultirangeDefinition{Name: defName, Range: rangeName})
+		}
+	}
+
+	sort.Slice(defs, func(i, j int) bool { return defs[i].TypeName() < defs[j].TypeName() })
+	return defs, nil
+}
+
+// writtenName is how we write tn in a definition: as it is, unless it would
+// read back as something else without quotes, as MyType would.  The quotes
+// are best avoided, since the code generator puts type names in struct tags.
+func writtenName(tn typeName) string {
+	plain := tn.name
+	if tn.schema != "" {
+		plain = tn.schema + "." + tn.name
+	}
+	if parsed, err := parseTypeName(plain); err == nil && parsed == tn {
+		return plain
+	}
+	return tn.Sanitize()
+}
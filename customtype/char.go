@@ -0,0 +1,222 @@
+package customtype
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgtype"
+)
+
+// Postgres pads a bpchar, char(n) or character(n), with blanks to its
+// length, and the char fields of our composites are usually char(1), a
+// single letter like Resolution's scan.  A rune field gets the letter,
+// however many bytes UTF-8 takes for it: the one character left once the
+// padding is trimmed, or zero for a blank or empty field.  A zero rune is
+// sent as an empty string, which postgres can store where it can't store a
+// zero byte, so it comes back as it went.  A field with more than one
+// character is an error rather than its first letter.  A text or varchar
+// field decodes into a rune the same way, without the trimming.
+//
+// A string field gets the text as postgres sends it, padding and all, unless
+// its tag says to trim it, as in pg:"code,bpchar,trim".  A field of a type of
+// our own whose values are letters, an enum of sorts, such as
+//
+//	type ScanMode rune
+//
+//	const (
+//		Progressive ScanMode = 'P'
+//		Interlaced  ScanMode = 'I'
+//	)
+//
+// decodes as a rune does, or a string type as a trimmed string, and with a
+// CharEnum converter among the registry's only into one of its values.  In a
+// config, a bpchar field's chars key says which the generator writes: rune,
+// the default, string or trimmed.
+
+// charModes are the values of a field's chars key in a config.
+var charModes = []string{"rune", "string", "trimmed"}
+
+// checkChars makes sure a field's chars key is one of charModes, and only on
+// a character field.
+func (f FieldConfig) checkChars(typeName string) error {
+	if f.Chars == "" {
+		return nil
+	}
+	if !isCharType(f.Type) {
+		return fmt.Errorf("field %s of %s has chars, but is %s rather than a bpchar", f.Name, typeName, f.Type)
+	}
+	for _, mode := range charModes {
+		if f.Chars == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("field %s of %s has chars %s, which is not one of %s", f.Name, typeName, f.Chars, strings.Join(charModes, ", "))
+}
+
+// assignChar assigns a character field to dst when dst points to a rune, or
+// to anything else whose kind a rune's is, and reports whether it did.
+func assignChar(src pgtype.Value, dst interface{}) (bool, error) {
+	var text string
+	padded := false
+	switch src := src.(type) {
+	case *pgtype.BPChar:
+		if src.Status != pgtype.Present {
+			return false, nil
+		}
+		text, padded = src.String, true
+	case *pgtype.Text:
+		if src.Status != pgtype.Present {
+			return false, nil
+		}
+		text = src.String
+	case *pgtype.Varchar:
+		if src.Status != pgtype.Present {
+			return false, nil
+		}
+		text = src.String
+	default:
+		return false, nil
+	}
+
+	// A DTO's *rune field is as much a rune as a rune field.
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return false, nil
+	}
+	if elem := target.Type().Elem(); elem.Kind() == reflect.Ptr && elem.Elem().Kind() == reflect.Int32 {
+		target.Elem().Set(reflect.New(elem.Elem()))
+		target = target.Elem()
+	}
+	if target.Elem().Kind() != reflect.Int32 {
+		return false, nil
+	}
+	r, err := charRune(text, padded)
+	if err != nil {
+		return true, err
+	}
+	target.Elem().SetInt(int64(r))
+	return true, nil
+}
+
+// charRune is the single character in text, or zero if it is empty, or
+// blank when it is padded.
+func charRune(text string, padded bool) (rune, error) {
+	if padded {
+		text = strings.TrimRight(text, " ")
+	}
+	if !utf8.ValidString(text) {
+		return 0, fmt.Errorf("cannot decode %q into a rune, it is not UTF-8", text)
+	}
+	switch n := utf8.RuneCountInString(text); n {
+	case 0:
+		return 0, nil
+	case 1:
+		r, _ := utf8.DecodeRuneInString(text)
+		return r, nil
+	default:
+		return 0, fmt.Errorf("cannot decode %q into a rune, it is %d characters", text, n)
+	}
+}
+
+// runeText is what a rune is sent as to a character field.
+func runeText(r rune) string {
+	if r == 0 {
+		return ""
+	}
+	return string(r)
+}
+
+// trimChars trims the padding off the string field v, or the string it
+// points to.
+func trimChars(v reflect.Value) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(strings.TrimRight(v.String(), " "))
+	}
+}
+
+// CharEnum is a converter for fields of T, a type of our own whose values are
+// letters, kept in a bpchar.  The field must be one of values going either
+// way, so that a letter the Go code doesn't know is caught as it's read.
+// The padding is trimmed, and T can be a string type as well as a rune one:
+//
+//	registry.Converters = append(registry.Converters,
+//		customtype.CharEnum(Progressive, Interlaced))
+func CharEnum[T ~rune | ~string](values ...T) FieldConverter {
+	return &charEnum[T]{values: values}
+}
+
+type charEnum[T ~rune | ~string] struct {
+	values []T
+}
+
+func (c *charEnum[T]) GoType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (c *charEnum[T]) ToDatabase(v interface{}) (interface{}, error) {
+	value, ok := v.(T)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %T, the converter is for %s", v, c.GoType())
+	}
+	text := c.text(value)
+	if !c.known(value) {
+		return nil, fmt.Errorf("%q is not a %s", text, c.GoType())
+	}
+	return text, nil
+}
+
+func (c *charEnum[T]) FromDatabase(src pgtype.Value, dst interface{}) error {
+	target, ok := dst.(*T)
+	if !ok {
+		return fmt.Errorf("cannot convert into %T, the converter is for %s", dst, c.GoType())
+	}
+
+	var text string
+	if err := assignField(src, &text); err != nil {
+		return err
+	}
+	text = strings.TrimRight(text, " ")
+
+	var value T
+	v := reflect.ValueOf(&value).Elem()
+	if v.Kind() == reflect.Int32 {
+		r, err := charRune(text, false)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(r))
+	} else {
+		v.SetString(text)
+	}
+	if !c.known(value) {
+		return fmt.Errorf("%q is not a %s", text, c.GoType())
+	}
+	*target = value
+	return nil
+}
+
+// text is what value is sent as.
+func (c *charEnum[T]) text(value T) string {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Int32 {
+		return runeText(rune(v.Int()))
+	}
+	return v.String()
+}
+
+func (c *charEnum[T]) known(value T) bool {
+	for _, v := range c.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package customtype
+
+import "github.com/jackc/pgtype"
+
+// CitextDefinition registers the citext type, the case insensitive text of
+// the extension of that name, which like hstore has a different OID in
+// every database.  A registry with a composite that has a citext field adds
+// it by itself, so it's only needed for a citext in a schema that isn't on
+// the search path, such as extensions.citext.  A citext field is a string,
+// and compares without case in the database, not in Go.
+type CitextDefinition struct {
+	Name string
+}
+
+// TypeName is the postgres name of the citext type.
+func (def CitextDefinition) TypeName() string {
+	return def.Name
+}
+
+// dependencies is empty, citext doesn't refer to other types.
+func (def CitextDefinition) dependencies() []string {
+	return nil
+}
+
+// register registers citext, and its array type, with the ConnInfo.  Its
+// binary format is text's.
+func (def CitextDefinition) register(ci *pgtype.ConnInfo, oids typeOIDs) error {
+	registerDataType(ci, def.Name, &pgtype.Text{}, oids)
+	return nil
+}
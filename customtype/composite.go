@@ -0,0 +1,880 @@
+package customtype
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// CompositeField is a single attribute of a composite type.  The attribute's
+// type is referenced by its postgres name rather than its OID, because the
+// OID of a custom type (and therefore of a nested composite) is only known
+// once we've asked the server.
+type CompositeField struct {
+	Name string
+	Type string
+}
+
+// CompositeDefinition describes a composite type we want to register with a
+// connection.  Every table also has a composite row type, named after the
+// table, so a definition with the table's columns as fields lets a whole row
+// be scanned into a struct: select foo from foo.
+type CompositeDefinition struct {
+	Name   string
+	Fields []CompositeField
+
+	// FieldCount decides what happens when the composite in the database,
+	// the definition and the Go struct don't have the same number of fields.
+	FieldCount FieldCountMode
+
+	// Versions are the fields the composite had before Fields, for the
+	// databases that haven't been migrated yet, as versions.go describes.
+	Versions [][]CompositeField
+
+	// converters, metrics and logger are the registry's, set as it
+	// registers the composite.
+	converters converters
+	metrics    *metrics
+	logger     logger
+}
+
+// FieldCountMode is how a composite deals with a mismatched number of fields.
+type FieldCountMode int
+
+const (
+	// StrictFieldCount makes a mismatch an error, so that a type changed in
+	// the database without changing the Go code is caught on first use.
+	StrictFieldCount FieldCountMode = iota
+
+	// LenientFieldCount ignores extra fields and leaves missing ones null,
+	// or zero in a struct, so that fields can be added to the type in the
+	// database before the Go code knows about them.
+	LenientFieldCount
+)
+
+// TypeName is the postgres name of the composite.
+func (def CompositeDefinition) TypeName() string {
+	return def.Name
+}
+
+// dependencies are the field types, some of which may be other custom types
+// that must be registered first.
+func (def CompositeDefinition) dependencies() []string {
+	deps := make([]string, len(def.Fields))
+	for i, f := range def.Fields {
+		deps[i] = f.Type
+	}
+	return deps
+}
+
+// register registers the composite type, and its array type, with the
+// ConnInfo using OIDs already looked up from the server.  Every field type
+// must already be registered.
+func (def CompositeDefinition) register(ci *pgtype.ConnInfo, oids typeOIDs) error {
+	fields := make([]pgtype.CompositeTypeField, len(def.Fields))
+	values := make([]pgtype.ValueTranscoder, len(def.Fields))
+	for i, f := range def.Fields {
+		dt, ok := ci.DataTypeForName(f.Type)
+		if !ok {
+			return fmt.Errorf("field %s of %s has type %s: %w", f.Name, def.Name, f.Type, ErrTypeNotFound)
+		}
+		value, ok := pgtype.NewValue(dt.Value).(pgtype.ValueTranscoder)
+		if !ok {
+			return fmt.Errorf("field %s of %s has type %s, which cannot be transcoded", f.Name, def.Name, f.Type)
+		}
+		fields[i] = pgtype.CompositeTypeField{Name: f.Name, OID: dt.OID}
+		values[i] = value
+	}
+
+	cv := newCompositeValue(def.Name, fields, values)
+	cv.fieldNames = fieldNames(fields)
+	cv.lenient = def.FieldCount == LenientFieldCount
+	if len(def.Versions) > 0 {
+		layouts, err := def.layouts(ci)
+		if err != nil {
+			return err
+		}
+		cv.layouts = layouts
+		if oids.version > 0 && oids.version <= len(layouts) {
+			cv.sent = layouts[oids.version-1]
+		}
+	}
+	cv.converters = def.converters
+	if cv.converters == nil {
+		cv.converters = newConverters(nil)
+	}
+	m := def.metrics
+	if m == nil {
+		m = defaultMetrics()
+	}
+	cv.metrics = newCompositeMetrics(m, def.Name)
+	cv.logger = def.logger
+	registerDataType(ci, def.Name, cv, oids)
+	return nil
+}
+
+// FieldDecodeError is a failure to decode one field of a composite, or to
+// assign it to the field of a struct.  Position counts from one, like attnum
+// in pg_attribute.  For a nested composite, Cause is the FieldDecodeError of
+// the nested field.  DumpValue shows what the server sent in its place.
+type FieldDecodeError struct {
+	Type     string
+	Field    string
+	Position int
+	Cause    error
+}
+
+func (e *FieldDecodeError) Error() string {
+	return fmt.Sprintf("failed to decode field %s (%d) of %s: %v", e.Field, e.Position, e.Type, e.Cause)
+}
+
+func (e *FieldDecodeError) Unwrap() error {
+	return e.Cause
+}
+
+// compositeValue is our own version of pgtype.CompositeType.  CompositeType
+// can only be Set from []interface{}, which means a []Resolution can be
+// scanned out of a resolution[] but not sent back, and it doesn't let us at
+// the field values, so we can't decode and assign them ourselves.
+type compositeValue struct {
+	typeName string
+	fields   []pgtype.CompositeTypeField
+	values   []pgtype.ValueTranscoder
+	status   pgtype.Status
+	lenient  bool
+
+	// received is how many of the values were actually there, when we're
+	// lenient and some were missing.
+	received int
+
+	// layouts are the composite's older versions, and sent is the one the
+	// database has, if it isn't the latest.  absent says which fields a
+	// value in an older one didn't have, and is empty for the latest.
+	layouts []*compositeLayout
+	sent    *compositeLayout
+	absent  []bool
+
+	// textBuf is where the text format's quoted fields were unescaped last
+	// time, kept to unescape the next composite's into.  The field values
+	// that keep their bytes, such as json, are decoded again by then, as
+	// they would be over pgx's own buffer in the binary format.
+	textBuf []byte
+
+	converters converters
+	metrics    *compositeMetrics
+	logger     logger
+
+	// fieldNames are the fields' names for checkAligned's cache, which
+	// the copies keep.
+	fieldNames string
+}
+
+func newCompositeValue(name string, fields []pgtype.CompositeTypeField, values []pgtype.ValueTranscoder) *compositeValue {
+	return &compositeValue{typeName: name, fields: fields, values: values}
+}
+
+// TypeName is the postgres name of the composite.
+func (cv *compositeValue) TypeName() string {
+	return cv.typeName
+}
+
+// Fields are the composite's fields, in order.
+func (cv *compositeValue) Fields() []pgtype.CompositeTypeField {
+	return cv.fields
+}
+
+// NewTypeValue makes sure copies made by the ConnInfo keep the wrapper, and
+// that the copy decodes into field values of its own.
+func (cv *compositeValue) NewTypeValue() pgtype.Value {
+	values := make([]pgtype.ValueTranscoder, len(cv.values))
+	for i, v := range cv.values {
+		values[i] = pgtype.NewValue(v).(pgtype.ValueTranscoder)
+	}
+	copied := newCompositeValue(cv.typeName, cv.fields, values)
+	copied.lenient = cv.lenient
+	copied.layouts = cv.layouts
+	copied.sent = cv.sent
+	copied.converters = cv.converters
+	copied.metrics = cv.metrics
+	copied.logger = cv.logger
+	copied.fieldNames = cv.fieldNames
+	return copied
+}
+
+// Get returns the fields by name, as CompositeType does.
+func (cv *compositeValue) Get() interface{} {
+	switch cv.status {
+	case pgtype.Present:
+		results := make(map[string]interface{}, len(cv.values))
+		for i, v := range cv.values {
+			results[cv.fields[i].Name] = v.Get()
+		}
+		return results
+	case pgtype.Null:
+		return nil
+	default:
+		return cv.status
+	}
+}
+
+// Set accepts a struct, or a pointer to one, with an exported field per
+// composite field in order, an Option of one, or the field values as
+// []interface{}.
+func (cv *compositeValue) Set(src interface{}) error {
+	if option, ok := src.(optionSource); ok {
+		value, some := option.optionValue()
+		if !some {
+			cv.status = pgtype.Null
+			return nil
+		}
+		src = value
+	}
+
+	switch value := src.(type) {
+	case nil:
+		cv.status = pgtype.Null
+		return nil
+	case []interface{}:
+		return cv.setValues(value)
+	case *[]interface{}:
+		if value == nil {
+			cv.status = pgtype.Null
+			return nil
+		}
+		return cv.setValues(*value)
+	}
+
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			cv.status = pgtype.Null
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot convert %T to %s", src, cv.typeName)
+	}
+
+	if err := cv.checkAligned(v.Type()); err != nil {
+		return err
+	}
+	values, err := structValues(v, cv.fields, cv.converters)
+	if err != nil {
+		return fmt.Errorf("cannot convert %T to %s: %w", src, cv.typeName, err)
+	}
+	return cv.setValues(values)
+}
+
+func (cv *compositeValue) setValues(values []interface{}) error {
+	cv.received = min(len(values), len(cv.values))
+	if len(values) != len(cv.values) {
+		if !cv.lenient {
+			return fmt.Errorf("cannot set %s with %d fields from %d values: %w", cv.typeName, len(cv.values), len(values), ErrFieldCountMismatch)
+		}
+		adjusted := make([]interface{}, len(cv.values))
+		copy(adjusted, values)
+		values = adjusted
+	}
+
+	for i, v := range values {
+		if err := setField(cv.values[i], v); err != nil {
+			return fmt.Errorf("cannot set field %s of %s: %w", cv.fields[i].Name, cv.typeName, err)
+		}
+	}
+
+	cv.status = pgtype.Present
+	return nil
+}
+
+// AssignTo assigns to a pointer to a struct, allocating it if it's a pointer
+// to a pointer, by exported field in order, or to an Option of one.  Option
+// fields are None for a null field, other fields are assigned as pgtype would.
+// It also assigns to []interface{} as CompositeType does.
+func (cv *compositeValue) AssignTo(dst interface{}) error {
+	// An Option of the whole composite is None for a null composite, which
+	// is not the same as Some with every field null.
+	if target, ok := dst.(optionTarget); ok {
+		return target.assignOption(cv)
+	}
+
+	switch cv.status {
+	case pgtype.Null:
+		if err := pgtype.NullAssignTo(dst); err != nil {
+			return fmt.Errorf("cannot assign NULL %s to %T: %w", cv.typeName, dst, ErrNullComposite)
+		}
+		return nil
+	case pgtype.Undefined:
+		return fmt.Errorf("cannot assign undefined %s to %T", cv.typeName, dst)
+	}
+
+	switch value := dst.(type) {
+	case []interface{}:
+		return cv.assignToValues(value)
+	case *[]interface{}:
+		if value == nil {
+			return fmt.Errorf("cannot assign %s to nil %T", cv.typeName, dst)
+		}
+		return cv.assignToValues(*value)
+	}
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot assign %s to %T", cv.typeName, dst)
+	}
+
+	v = v.Elem()
+	switch {
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		// As with encoding/json, a pointer that's already set is assigned
+		// to where it points, so a value scanned into again doesn't
+		// allocate.
+		if !v.IsNil() {
+			return cv.AssignTo(v.Interface())
+		}
+		target := reflect.New(v.Type().Elem())
+		if err := cv.AssignTo(target.Interface()); err != nil {
+			return err
+		}
+		v.Set(target)
+		return nil
+	case v.Kind() == reflect.Struct:
+		return cv.assignToStruct(v)
+	}
+
+	if next, retry := pgtype.GetAssignToDstType(dst); retry {
+		return cv.AssignTo(next)
+	}
+	return fmt.Errorf("cannot assign %s to %T", cv.typeName, dst)
+}
+
+func (cv *compositeValue) assignToValues(dst []interface{}) error {
+	if len(dst) != len(cv.values) {
+		return fmt.Errorf("cannot assign %s with %d fields to %d values: %w", cv.typeName, len(cv.values), len(dst), ErrFieldCountMismatch)
+	}
+
+	for i, target := range dst {
+		if target == nil || cv.isAbsent(i) {
+			continue
+		}
+		if err := assignField(cv.values[i], target); err != nil {
+			return cv.fieldError(i, err)
+		}
+	}
+
+	return nil
+}
+
+func (cv *compositeValue) assignToStruct(v reflect.Value) error {
+	exported := exportedFields(v.Type())
+	if len(exported) != len(cv.values) && !cv.lenient {
+		return fmt.Errorf("cannot assign %s with %d fields to %s with %d exported fields: %w",
+			cv.typeName, len(cv.values), v.Type(), len(exported), ErrFieldCountMismatch)
+	}
+	if err := cv.checkAligned(v.Type()); err != nil {
+		return err
+	}
+
+	for i, field := range exported {
+		fv := v.FieldByIndex(field.index)
+		if cv.isAbsent(i) {
+			fv.Set(reflect.Zero(fv.Type()))
+			continue
+		}
+		src, err := field.adapt(cv.values[i])
+		if err != nil {
+			return cv.fieldError(i, err)
+		}
+
+		if converted, err := cv.converters.fromDatabase(src, fv); converted {
+			if err != nil {
+				return cv.fieldError(i, err)
+			}
+			continue
+		}
+
+		// A pointer that's already set is assigned to where it points, as
+		// AssignTo does.  A null can't be, and leaves it to the usual way,
+		// which sets the pointer to nil.
+		if fv.Kind() != reflect.Ptr || fv.IsNil() || assignField(src, fv.Interface()) != nil {
+			if err := assignField(src, fv.Addr().Interface()); err != nil {
+				return cv.fieldError(i, err)
+			}
+		}
+		if field.trim {
+			trimChars(fv)
+		}
+	}
+
+	return nil
+}
+
+// exportedFieldIndexes caches exportedFields, which every row of a struct
+// would otherwise work out again.
+var exportedFieldIndexes sync.Map
+
+// structField is an exported field of a struct that holds an attribute of a
+// composite.  Its index is the path to it, through the embedded structs that
+// are flattened, and prefix is what their tags put before its name.  Its
+// options are the ones its tag has after the type.
+type structField struct {
+	index  []int
+	prefix string
+	fieldOptions
+	reflect.StructField
+}
+
+// attribute is the name and type of the field's attribute, as its pg tag
+// says, with the prefix.
+func (f structField) attribute() (name, pgType string) {
+	name, pgType = pgTag(f.StructField)
+	return f.prefix + name, pgType
+}
+
+// exportedFields are the exported fields of the struct type t, in order, with
+// the fields of an embedded struct in its place.  An embedded struct is
+// flattened as encoding/json flattens one, unless its pg tag makes it an
+// attribute of its own, a nested composite; pg:"res_,flatten" flattens it
+// with a prefix on the names of its fields.  A field tagged pg:"-" is left
+// out, as if it weren't exported.
+func exportedFields(t reflect.Type) []structField {
+	if known, ok := exportedFieldIndexes.Load(t); ok {
+		return known.([]structField)
+	}
+
+	exported := appendExportedFields(nil, t, nil, "")
+	exportedFieldIndexes.Store(t, exported)
+	return exported
+}
+
+func appendExportedFields(fields []structField, t reflect.Type, index []int, prefix string) []structField {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("pg") == "-" {
+			continue
+		}
+		path := append(index[:len(index):len(index)], i)
+		if embedded, ok := flattened(sf); ok {
+			fields = appendExportedFields(fields, sf.Type, path, prefix+embedded)
+			continue
+		}
+		if sf.PkgPath == "" {
+			_, tagType, _ := strings.Cut(sf.Tag.Get("pg"), ",")
+			_, options := tagOptions(tagType)
+			fields = append(fields, structField{index: path, prefix: prefix, fieldOptions: options, StructField: sf})
+		}
+	}
+	return fields
+}
+
+// flattened reports whether sf is an embedded struct whose fields are
+// attributes, and the prefix of their names.
+func flattened(sf reflect.StructField) (string, bool) {
+	if !sf.Anonymous || sf.Type.Kind() != reflect.Struct || scalarStruct(sf.Type) {
+		return "", false
+	}
+	if _, ok := reflect.Zero(sf.Type).Interface().(optionSource); ok {
+		return "", false
+	}
+	tag, ok := sf.Tag.Lookup("pg")
+	if !ok {
+		return "", true
+	}
+	prefix, option, _ := strings.Cut(tag, ",")
+	return prefix, option == "flatten"
+}
+
+// alignedStructs caches what checkAligned finds for each composite and struct
+// type.  A composite is registered again on every connection, and on every
+// refresh, so it's keyed by the names of its fields rather than by the
+// registration, which would leave an entry behind for each one.
+var alignedStructs sync.Map
+
+type alignedKey struct {
+	typeName string
+	fields   string
+	t        reflect.Type
+}
+
+// fieldNames are the names of fields, apart, as alignedKey has them.
+func fieldNames(fields []pgtype.CompositeTypeField) string {
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f.Name)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// checkAligned makes sure that the fields of the struct type t whose pg tags
+// name their attribute are in the attribute's place, since a composite is
+// assigned to the fields of a struct by position, whatever they're called.
+// Fields without a name in their tag, or without a tag, are the attribute
+// in their place by definition.
+func (cv *compositeValue) checkAligned(t reflect.Type) error {
+	if len(cv.fields) == 0 {
+		return nil
+	}
+	if cv.fieldNames == "" {
+		cv.fieldNames = fieldNames(cv.fields)
+	}
+	key := alignedKey{typeName: cv.typeName, fields: cv.fieldNames, t: t}
+	if known, ok := alignedStructs.Load(key); ok {
+		err, _ := known.(error)
+		return err
+	}
+
+	var err error
+	for i, field := range exportedFields(t) {
+		if i >= len(cv.fields) {
+			break
+		}
+		tagName, _, _ := strings.Cut(field.Tag.Get("pg"), ",")
+		if tagName == "" {
+			continue
+		}
+		if name, _ := field.attribute(); name != cv.fields[i].Name {
+			err = fmt.Errorf("field %s of %s is attribute %s, but attribute %d of %s is %s",
+				field.Name, t, name, i+1, cv.typeName, cv.fields[i].Name)
+			break
+		}
+	}
+
+	// A nil error can't be told from a missing one in the map, so we store
+	// false for one.
+	var stored interface{} = false
+	if err != nil {
+		stored = err
+	}
+	alignedStructs.Store(key, stored)
+	return err
+}
+
+// assignField assigns a field value to a target the way CompositeType does,
+// except that an Option target takes care of its own nulls.
+func assignField(src pgtype.Value, dst interface{}) error {
+	if target, ok := dst.(optionTarget); ok {
+		return target.assignOption(src)
+	}
+	if assigned, err := assignChar(src, dst); assigned {
+		return err
+	}
+
+	err := src.AssignTo(dst)
+	if err == nil {
+		return nil
+	}
+
+	if setter, ok := dst.(pgtype.Value); ok && setter.Set(src.Get()) == nil {
+		return nil
+	}
+
+	// Types from other packages, such as decimals and UUIDs, usually scan
+	// from their text.
+	if scanner, ok := dst.(sql.Scanner); ok {
+		if src.Get() == nil {
+			return scanner.Scan(nil)
+		}
+		if text, ok := fieldText(src); ok && scanner.Scan(text) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// fieldText is the text of a field value, as the server would write it.
+// pgtype writes a numeric with an exponent, which is valid but not what a
+// decimal package expects, so we write that ourselves.
+func fieldText(src pgtype.Value) (string, bool) {
+	if n, ok := src.Get().(pgtype.Numeric); ok && !n.NaN {
+		return numericText(n), true
+	}
+
+	encoder, ok := src.(pgtype.TextEncoder)
+	if !ok {
+		return "", false
+	}
+	text, err := encoder.EncodeText(nil, nil)
+	return string(text), err == nil
+}
+
+// setField sets a field value from v, falling back to copying v if it is a
+// value of the field's own type, or to what v's Value gives.
+func setField(dst pgtype.Value, v interface{}) error {
+	err := dst.Set(v)
+	if err == nil {
+		return nil
+	}
+
+	// Some pgtype values, like Box, can't be Set at all, not even to null,
+	// so a converter gives us one of our own to copy, and a null is decoded.
+	if v == nil {
+		if decoder, ok := dst.(pgtype.TextDecoder); ok && decoder.DecodeText(nil, nil) == nil {
+			return nil
+		}
+	}
+	if target := reflect.ValueOf(dst); target.Kind() == reflect.Ptr && reflect.TypeOf(v) == target.Type().Elem() {
+		target.Elem().Set(reflect.ValueOf(v))
+		return nil
+	}
+
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, valueErr := valuer.Value()
+		if valueErr != nil {
+			return valueErr
+		}
+		if dst.Set(value) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (cv *compositeValue) fieldError(i int, err error) error {
+	if cv.metrics != nil {
+		cv.metrics.recordFieldError(cv.fields[i].Name, err)
+	}
+	// A nested composite has logged the field that failed already.
+	var nested *FieldDecodeError
+	if !errors.As(err, &nested) {
+		cv.logger.log(context.Background(), pgx.LogLevelDebug, "failed to decode field", map[string]interface{}{
+			"type":     cv.typeName,
+			"field":    cv.fields[i].Name,
+			"position": i + 1,
+			"err":      err,
+		})
+	}
+	return &FieldDecodeError{Type: cv.typeName, Field: cv.fields[i].Name, Position: i + 1, Cause: err}
+}
+
+// DecodeBinary decodes each field in turn.
+func (cv *compositeValue) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		cv.status = pgtype.Null
+		cv.recordDecoded(true)
+		return nil
+	}
+
+	if cv.layouts != nil {
+		if layout := cv.binaryLayout(src); layout != nil {
+			return cv.decodeLayoutBinary(ci, src, layout)
+		}
+	}
+
+	cv.status = pgtype.Undefined
+	cv.absent = cv.absent[:0]
+	s := newCompositeBinaryScanner(src)
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", cv.typeName, err)
+	}
+	if err := cv.checkFieldCount(s.FieldCount()); err != nil {
+		return err
+	}
+	cv.received = min(s.FieldCount(), len(cv.values))
+
+	for i, value := range cv.values {
+		var field []byte
+		if s.Next() {
+			field = s.Bytes()
+		} else if err := s.Err(); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", cv.typeName, err)
+		}
+
+		if err := value.DecodeBinary(ci, field); err != nil {
+			if s.OID() != cv.fields[i].OID {
+				err = fmt.Errorf("%w: server sent oid %d rather than %d: %w", ErrOIDMismatch, s.OID(), cv.fields[i].OID, err)
+			}
+			return cv.fieldError(i, err)
+		}
+	}
+
+	cv.status = pgtype.Present
+	cv.recordDecoded(false)
+	return nil
+}
+
+// DecodeText decodes each field in turn, in the same way as DecodeBinary.
+func (cv *compositeValue) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		cv.status = pgtype.Null
+		cv.recordDecoded(true)
+		return nil
+	}
+
+	if cv.layouts != nil {
+		if layout := cv.textLayout(src); layout != nil {
+			return cv.decodeLayoutText(ci, src, layout)
+		}
+	}
+
+	// The text format doesn't say how many fields there are, so we count
+	// them as we go.
+	cv.status = pgtype.Undefined
+	cv.absent = cv.absent[:0]
+	s := newCompositeTextScanner(src)
+	s.buf = cv.textBuf[:0]
+	count := 0
+	for i, value := range cv.values {
+		var field []byte
+		if s.Next() {
+			field = s.Bytes()
+			count++
+		} else if err := s.Err(); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", cv.typeName, err)
+		}
+
+		if err := value.DecodeText(ci, field); err != nil {
+			return cv.fieldError(i, err)
+		}
+	}
+	cv.textBuf = s.buf
+	for s.Next() {
+		count++
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", cv.typeName, err)
+	}
+	if err := cv.checkFieldCount(count); err != nil {
+		return err
+	}
+	cv.received = min(count, len(cv.values))
+
+	cv.status = pgtype.Present
+	cv.recordDecoded(false)
+	return nil
+}
+
+// recordDecoded counts a composite that has been decoded.
+func (cv *compositeValue) recordDecoded(null bool) {
+	if cv.metrics != nil {
+		cv.metrics.recordDecoded(null)
+	}
+}
+
+// isAbsent reports whether field i wasn't in the value decoded, because it
+// was lenient about a missing field or in an older layout.
+func (cv *compositeValue) isAbsent(i int) bool {
+	return i >= cv.received || i < len(cv.absent) && cv.absent[i]
+}
+
+// checkFieldCount makes sure the server has sent the fields we expect, unless
+// we're lenient.
+func (cv *compositeValue) checkFieldCount(count int) error {
+	if count != len(cv.values) && !cv.lenient {
+		return fmt.Errorf("%s has %d fields in the database but %d in its definition: %w", cv.typeName, count, len(cv.values), ErrFieldCountMismatch)
+	}
+	return nil
+}
+
+func (cv *compositeValue) EncodeBinary(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	switch cv.status {
+	case pgtype.Null:
+		return nil, nil
+	case pgtype.Undefined:
+		return nil, fmt.Errorf("cannot encode undefined %s", cv.typeName)
+	}
+
+	if cv.sent != nil {
+		return cv.encodeLayoutBinary(ci, buf)
+	}
+	b := pgtype.NewCompositeBinaryBuilder(ci, buf)
+	for i, value := range cv.values {
+		b.AppendEncoder(cv.fields[i].OID, value)
+	}
+	return b.Finish()
+}
+
+func (cv *compositeValue) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	switch cv.status {
+	case pgtype.Null:
+		return nil, nil
+	case pgtype.Undefined:
+		return nil, fmt.Errorf("cannot encode undefined %s", cv.typeName)
+	}
+
+	if cv.sent != nil {
+		return cv.encodeLayoutText(ci, buf)
+	}
+	b := pgtype.NewCompositeTextBuilder(ci, buf)
+	for _, value := range cv.values {
+		b.AppendEncoder(value)
+	}
+	return b.Finish()
+}
+
+// structValues collects the exported fields of a struct as field values for a
+// composite.  Nil pointers and None options become nulls.  Since a rune is
+// just an int32 to reflection, it, or anything else of its kind, is turned
+// into a string when the field is a character type.
+func structValues(v reflect.Value, fields []pgtype.CompositeTypeField, conv converters) ([]interface{}, error) {
+	exported := exportedFields(v.Type())
+	values := make([]interface{}, 0, len(exported))
+	for _, field := range exported {
+		fv := v.FieldByIndex(field.index)
+		value, converted, err := conv.toDatabase(fv)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert field %s: %w", field.Name, err)
+		}
+		if converted {
+			values = append(values, value)
+			continue
+		}
+
+		if option, ok := fv.Interface().(optionSource); ok {
+			value, some := option.optionValue()
+			if !some {
+				values = append(values, nil)
+				continue
+			}
+			fv = reflect.ValueOf(value)
+			if !fv.IsValid() {
+				values = append(values, nil)
+				continue
+			}
+		}
+
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				values = append(values, nil)
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		// A pointer to a converted type is converted once we know it isn't
+		// nil.
+		value, converted, err = conv.toDatabase(fv)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert field %s: %w", field.Name, err)
+		}
+		if converted {
+			values = append(values, value)
+			continue
+		}
+
+		value = fv.Interface()
+		if fv.Kind() == reflect.Int32 && len(values) < len(fields) && isCharacterOID(fields[len(values)].OID) {
+			value = runeText(rune(fv.Int()))
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func isCharacterOID(oid uint32) bool {
+	switch oid {
+	case pgtype.BPCharOID, pgtype.VarcharOID, pgtype.TextOID:
+		return true
+	}
+	return false
+}
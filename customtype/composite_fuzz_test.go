@@ -0,0 +1,177 @@
+package customtype
+
+import (
+	"testing"
+
+	"github.com/jackc/pgtype"
+)
+
+// The fuzz targets give the composite decoder whatever the fuzzer makes up as
+// the binary or text of a resolution, a display, which nests one, an array
+// of them, and a multirange, whose count of ranges is as untrusted as the
+// rest, looking for panics, hangs and huge allocations rather than wrong
+// answers:
+// anything that decodes must also assign to the Go types and encode again.
+// They run their seeds as ordinary tests, and fuzz with, for instance,
+//
+//	go test -run '^$' -fuzz FuzzDecodeCompositeBinary ./customtype
+
+// fuzzDefinitions are Definitions and a multirange.
+var fuzzDefinitions = append([]TypeDefinition{
+	RangeDefinition{Name: "floatrange", Subtype: "float8"},
+	MultirangeDefinition{Name: "floatmultirange", Range: "floatrange"},
+}, Definitions...)
+
+// definitionsConnInfo registers fuzzDefinitions with made up OIDs, strictly
+// or leniently about the number of fields.
+func definitionsConnInfo(tb testing.TB, lenient bool) *pgtype.ConnInfo {
+	registry, err := NewTypeRegistry(fuzzDefinitions...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	ci := pgtype.NewConnInfo()
+	for i, def := range registry.snapshot().definitions {
+		if composite, ok := def.(CompositeDefinition); ok && lenient {
+			composite.FieldCount = LenientFieldCount
+			def = composite
+		}
+		oid := uint32(200000 + 2*i)
+		if err := def.register(ci, typeOIDs{oid: oid, arrayOID: oid + 1}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return ci
+}
+
+// fuzzTargets are the types the targets decode into, each with the Go values
+// to assign the result to.
+var fuzzTargets = []struct {
+	name string
+	dst  func() []interface{}
+}{
+	{"resolution", func() []interface{} {
+		return []interface{}{&Resolution{}, &ResolutionDTO{}, &Option[ResolutionDTO]{}, new(*ResolutionDTO)}
+	}},
+	{"display", func() []interface{} {
+		return []interface{}{&Display{}, &DisplayDTO{}, new(*DisplayDTO)}
+	}},
+	{"_resolution", func() []interface{} {
+		return []interface{}{&[]Option[ResolutionDTO]{}, &[]*ResolutionDTO{}}
+	}},
+	{"floatmultirange", func() []interface{} {
+		return []interface{}{&[]Range[float64]{}}
+	}},
+}
+
+// fuzzSeeds are encodings of values worth starting from, in format.
+func fuzzSeeds(tb testing.TB, format int16) [][]byte {
+	ci := definitionsConnInfo(tb, false)
+	width, scan := 1920, 'I'
+	values := []struct {
+		name  string
+		value interface{}
+	}{
+		{"resolution", Resolution{Width: 1920, Height: 1080, Scan: 'P'}},
+		{"resolution", ResolutionDTO{Width: &width, Scan: &scan}},
+		{"resolution", ResolutionDTO{}},
+		{"display", Display{Res: Resolution{Width: 640, Height: 480, Scan: 'P'}, Label: "VGA"}},
+		{"display", DisplayDTO{}},
+		{"_resolution", []Option[ResolutionDTO]{Some(ResolutionDTO{Width: &width}), None[ResolutionDTO]()}},
+		{"floatmultirange", []Range[float64]{{Lower: 1, Upper: 2, LowerInclusive: true}, {Empty: true}}},
+	}
+
+	var seeds [][]byte
+	for _, v := range values {
+		dt, ok := ci.DataTypeForName(v.name)
+		if !ok {
+			tb.Fatalf("%s is not registered", v.name)
+		}
+		src := encodeValue(tb, ci, dt, v.value, format)
+		seeds = append(seeds, src)
+
+		// A value cut short is the likeliest way to read past the end.
+		if len(src) > 1 {
+			seeds = append(seeds, src[:len(src)/2], src[:len(src)-1])
+		}
+	}
+	// The last is a count of four billion ranges in eight bytes, which is
+	// an error rather than room made for them.
+	return append(seeds, []byte{}, []byte("()"), []byte("(,,)"), []byte{0, 0, 0, 3}, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+}
+
+// encodeValue encodes v as the type dt, in format.
+func encodeValue(tb testing.TB, ci *pgtype.ConnInfo, dt *pgtype.DataType, v interface{}, format int16) []byte {
+	value := pgtype.NewValue(dt.Value)
+	if err := value.Set(v); err != nil {
+		tb.Fatalf("failed to set %s to %v: %v", dt.Name, v, err)
+	}
+
+	var src []byte
+	var err error
+	if format == pgtype.BinaryFormatCode {
+		src, err = value.(pgtype.BinaryEncoder).EncodeBinary(ci, nil)
+	} else {
+		src, err = value.(pgtype.TextEncoder).EncodeText(ci, nil)
+	}
+	if err != nil {
+		tb.Fatalf("failed to encode %v: %v", v, err)
+	}
+	return src
+}
+
+// fuzzDecode decodes src as each target, and assigns and encodes whatever
+// decodes.
+func fuzzDecode(t *testing.T, cis []*pgtype.ConnInfo, format int16, src []byte) {
+	for _, ci := range cis {
+		for _, target := range fuzzTargets {
+			dt, ok := ci.DataTypeForName(target.name)
+			if !ok {
+				t.Fatalf("%s is not registered", target.name)
+			}
+			value := pgtype.NewValue(dt.Value)
+
+			var err error
+			if format == pgtype.BinaryFormatCode {
+				err = value.(pgtype.BinaryDecoder).DecodeBinary(ci, src)
+			} else {
+				err = value.(pgtype.TextDecoder).DecodeText(ci, src)
+			}
+			if err != nil {
+				continue
+			}
+
+			for _, dst := range target.dst() {
+				// Assigning can fail, a null into a Resolution for one,
+				// but mustn't panic.
+				_ = value.AssignTo(dst)
+			}
+			if encoder, ok := value.(pgtype.BinaryEncoder); ok {
+				_, _ = encoder.EncodeBinary(ci, nil)
+			}
+			if encoder, ok := value.(pgtype.TextEncoder); ok {
+				_, _ = encoder.EncodeText(ci, nil)
+			}
+		}
+	}
+}
+
+func FuzzDecodeCompositeBinary(f *testing.F) {
+	for _, seed := range fuzzSeeds(f, pgtype.BinaryFormatCode) {
+		f.Add(seed)
+	}
+	cis := []*pgtype.ConnInfo{definitionsConnInfo(f, false), definitionsConnInfo(f, true)}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		fuzzDecode(t, cis, pgtype.BinaryFormatCode, src)
+	})
+}
+
+func FuzzDecodeCompositeText(f *testing.F) {
+	for _, seed := range fuzzSeeds(f, pgtype.TextFormatCode) {
+		f.Add(seed)
+	}
+	cis := []*pgtype.ConnInfo{definitionsConnInfo(f, false), definitionsConnInfo(f, true)}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		fuzzDecode(t, cis, pgtype.TextFormatCode, src)
+	})
+}
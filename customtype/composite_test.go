@@ -0,0 +1,157 @@
+package customtype
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgtype"
+)
+
+// TestCheckAligned checks which structs line up with resolution's fields by
+// position, as a composite is assigned to them.
+func TestCheckAligned(t *testing.T) {
+	type skipped struct {
+		Width  int    `pg:"width"`
+		Note   string `pg:"-"`
+		Height int    `pg:"height"`
+		Scan   rune   `pg:"scan"`
+	}
+	type untagged struct {
+		W, H int
+		S    rune
+	}
+	type swapped struct {
+		Height int  `pg:"height"`
+		Width  int  `pg:"width"`
+		Scan   rune `pg:"scan"`
+	}
+	type shown struct {
+		Width  int    `pg:"width"`
+		Note   string `pg:"note"`
+		Height int    `pg:"height"`
+	}
+
+	tests := []struct {
+		name    string
+		t       reflect.Type
+		wantErr string
+	}{
+		{name: "tagged", t: reflect.TypeOf(Resolution{})},
+		{name: "pg:\"-\" left out", t: reflect.TypeOf(skipped{})},
+		{name: "untagged", t: reflect.TypeOf(untagged{})},
+		{name: "swapped", t: reflect.TypeOf(swapped{}), wantErr: "field Height of customtype.swapped is attribute height, but attribute 1 of resolution is width"},
+		{name: "extra field", t: reflect.TypeOf(shown{}), wantErr: "field Note of customtype.shown is attribute note, but attribute 2 of resolution is height"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := resolutionValue().checkAligned(tt.t)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("got %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("got %v, want %s", err, tt.wantErr)
+			}
+
+			// The cached answer is the same.
+			if again := resolutionValue().checkAligned(tt.t); (again == nil) != (err == nil) {
+				t.Errorf("got %v the second time, want %v", again, err)
+			}
+		})
+	}
+}
+
+// TestCheckAlignedCache checks that registering a composite again, as every
+// connection and refresh does, reuses its entry in the cache rather than
+// adding one.
+func TestCheckAlignedCache(t *testing.T) {
+	type once struct {
+		Width  int  `pg:"width"`
+		Height int  `pg:"height"`
+		Scan   rune `pg:"scan"`
+	}
+	entries := func() int {
+		n := 0
+		alignedStructs.Range(func(key, _ interface{}) bool {
+			if key.(alignedKey).t == reflect.TypeOf(once{}) {
+				n++
+			}
+			return true
+		})
+		return n
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := resolutionValue().NewTypeValue().(*compositeValue).checkAligned(reflect.TypeOf(once{})); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := entries(); n != 1 {
+		t.Errorf("got %d entries for the struct, want 1", n)
+	}
+}
+
+// TestCompositeAssignToValues checks assigning a composite to a slice of
+// destinations for its fields, or a pointer to one.
+func TestCompositeAssignToValues(t *testing.T) {
+	var width, height int
+	var scan rune
+	var skipped *[]interface{}
+
+	tests := []struct {
+		name    string
+		dst     interface{}
+		wantErr bool
+	}{
+		{name: "values", dst: []interface{}{&width, &height, &scan}},
+		{name: "pointer to values", dst: &[]interface{}{&width, &height, &scan}},
+		{name: "left out", dst: []interface{}{&width, nil, nil}},
+		{name: "too few", dst: []interface{}{&width, &height}, wantErr: true},
+		{name: "nil pointer", dst: skipped, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, scan = 0, 0, 0
+			cv := resolutionValue()
+			if err := cv.Set(Resolution{Width: 640, Height: 480, Scan: 'P'}); err != nil {
+				t.Fatal(err)
+			}
+			err := cv.AssignTo(tt.dst)
+			switch {
+			case tt.wantErr && err == nil:
+				t.Fatal("got no error")
+			case !tt.wantErr && err != nil:
+				t.Fatal(err)
+			case !tt.wantErr && width != 640:
+				t.Errorf("got width %d, want 640", width)
+			}
+		})
+	}
+}
+
+// resolutionValue is resolution as register makes it, with fields of its
+// own, as each registration has.
+func resolutionValue() *compositeValue {
+	def := CompositeDefinition{
+		Name:   "resolution",
+		Fields: []CompositeField{{Name: "width", Type: "int4"}, {Name: "height", Type: "int4"}, {Name: "scan", Type: "bpchar"}},
+	}
+	ci := pgtype.NewConnInfo()
+	if err := def.register(ci, typeOIDs{oid: 16001, arrayOID: 16000}); err != nil {
+		panic(err)
+	}
+	dt, ok := ci.DataTypeForName("resolution")
+	if !ok {
+		panic("resolution is not registered")
+	}
+	return dt.Value.(*compositeValue)
+}
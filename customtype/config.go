@@ -0,0 +1,542 @@
+package customtype
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes the registry in a file, usually types.yaml, so that a
+// deployment can change its types without recompiling, and the code
+// generator and the running application read the same definitions:
+//
+//	timeout: 5s
+//	schemas: [public]
+//	types:
+//	  - name: resolution
+//	    go: Resolution
+//	    fields:
+//	      - {name: width, type: int4}
+//	      - {name: height, type: int4}
+//	      - {name: scan, type: bpchar, on_null: default, default: P}
+//	  - name: mood
+//	    enum: [sad, ok, happy]
+//	  - name: posint
+//	    domain: int4
+//	  - name: floatrange
+//	    range: float8
+//
+// A type is a composite when it has fields, and otherwise an enum, domain,
+// range or multirange by whichever of those keys it has.  With defaults:
+// true, the registry reads the defaults of the composites from the database
+// as well, as ReadDefaults describes.  A retry section says how to retry
+// registering types that aren't in the database yet, as Retry does:
+//
+//	retry: {wait: true, max_backoff: 10s}
+//
+// With create_missing: true, the types missing from the database are
+// created, as CreateMissing describes.
+//
+// A composite whose fields include another's, one after the other and
+// perhaps with a prefix on their names, can embed the other's Go struct
+// rather than repeat its fields, as in
+//
+//	types:
+//	  - name: screen
+//	    embed: [{type: resolution, prefix: res_}]
+//	    fields:
+//	      - {name: res_width, type: int4}
+//	      - {name: res_height, type: int4}
+//	      - {name: res_scan, type: bpchar}
+//	      - {name: label, type: text}
+//
+// where Screen embeds Resolution, and ScreenDTO embeds ResolutionDTO, with
+// a pg:"res_,flatten" tag.
+//
+// A composite's versions are the fields it had before a migration, so that
+// a database yet to be migrated still works; see CompositeDefinition:
+//
+//	types:
+//	  - name: resolution
+//	    fields: [...]
+//	    versions:
+//	      - [{name: width, type: int4}, {name: height, type: int4}]
+type Config struct {
+	Timeout       time.Duration `yaml:"timeout"`
+	Schemas       []string      `yaml:"schemas"`
+	PgBouncer     bool          `yaml:"pgbouncer"`
+	Lazy          bool          `yaml:"lazy"`
+	Defaults      bool          `yaml:"defaults"`
+	Retry         Retry         `yaml:"retry"`
+	CreateMissing bool          `yaml:"create_missing"`
+	Types         []TypeConfig  `yaml:"types"`
+}
+
+// TypeConfig is one type in a Config.
+type TypeConfig struct {
+	Name string `yaml:"name"`
+
+	// Go is the name of the Go struct a composite maps to.  It defaults to
+	// the type name in Go's style, so resolution is Resolution.
+	Go string `yaml:"go"`
+
+	Fields  []FieldConfig `yaml:"fields"`
+	Embed   []EmbedConfig `yaml:"embed"`
+	Lenient bool          `yaml:"lenient"`
+
+	// Versions are the fields a composite had before, oldest first, as
+	// CompositeDefinition's Versions are.
+	Versions [][]FieldConfig `yaml:"versions"`
+
+	// Null is the null policy for the fields that don't have one.
+	Null string `yaml:"on_null"`
+
+	Enum       []string `yaml:"enum"`
+	Domain     string   `yaml:"domain"`
+	Range      string   `yaml:"range"`
+	Multirange string   `yaml:"multirange"`
+}
+
+// FieldConfig is one field of a composite in a Config.
+type FieldConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+
+	// Go is the name of the Go field, which defaults to the field name in
+	// Go's style, so frame_rate is FrameRate.
+	Go string `yaml:"go"`
+
+	// Null is the field's null policy: zero, error, keep or default, with
+	// default taking its value from Default.
+	Null    string      `yaml:"on_null"`
+	Default interface{} `yaml:"default"`
+
+	// Chars is the Go type generated for a bpchar or char field: rune, the
+	// default, string, or trimmed for a string without the padding.
+	Chars string `yaml:"chars"`
+
+	// Interval is what an interval field's time.Duration makes of months
+	// and days: months, the default, days or exact.  Location is the
+	// location a timestamptz field's time.Time is in, such as UTC.
+	Interval string `yaml:"interval"`
+	Location string `yaml:"location"`
+}
+
+// EmbedConfig is a composite whose fields are among another's, with Prefix
+// on their names, and whose Go struct the other's embeds.
+type EmbedConfig struct {
+	Type   string `yaml:"type"`
+	Prefix string `yaml:"prefix"`
+}
+
+// ConfigFor is the config of compiled in definitions, for the code generator
+// to work from when there is no file.
+func ConfigFor(defs ...TypeDefinition) *Config {
+	config := &Config{}
+	for _, def := range defs {
+		t := TypeConfig{Name: def.TypeName()}
+		switch def := def.(type) {
+		case CompositeDefinition:
+			t.Lenient = def.FieldCount == LenientFieldCount
+			for _, f := range def.Fields {
+				t.Fields = append(t.Fields, FieldConfig{Name: f.Name, Type: f.Type})
+			}
+			for _, fields := range def.Versions {
+				version := make([]FieldConfig, len(fields))
+				for i, f := range fields {
+					version[i] = FieldConfig{Name: f.Name, Type: f.Type}
+				}
+				t.Versions = append(t.Versions, version)
+			}
+		case EnumDefinition:
+			t.Enum = def.Labels
+		case DomainDefinition:
+			t.Domain = def.BaseType
+		case RangeDefinition:
+			t.Range = def.Subtype
+		case MultirangeDefinition:
+			t.Multirange = def.Range
+		}
+		config.Types = append(config.Types, t)
+	}
+	return config
+}
+
+// LoadConfig reads the config in the YAML file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig parses a config in YAML.  Every type's definition and null
+// policies are checked, so that a mistake is found at startup rather than at
+// the first null.
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	seen := make(map[string]bool, len(config.Types))
+	for _, t := range config.Types {
+		if t.Name == "" {
+			return nil, fmt.Errorf("there is a type without a name")
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("type %s is in the config twice", t.Name)
+		}
+		seen[t.Name] = true
+
+		if _, err := t.definition(); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range config.Types {
+		if _, err := config.embedRuns(t); err != nil {
+			return nil, err
+		}
+		if _, err := config.NullPolicies(t.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return &config, nil
+}
+
+// Definitions are the definitions of the types in the config, in the order
+// they are listed.
+func (c *Config) Definitions() ([]TypeDefinition, error) {
+	defs := make([]TypeDefinition, len(c.Types))
+	for i, t := range c.Types {
+		def, err := t.definition()
+		if err != nil {
+			return nil, err
+		}
+		defs[i] = def
+	}
+	return defs, nil
+}
+
+// Registry creates a registry with the config's types and settings.
+func (c *Config) Registry() (*TypeRegistry, error) {
+	defs, err := c.Definitions()
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := NewTypeRegistry(defs...)
+	if err != nil {
+		return nil, err
+	}
+	registry.Timeout = c.Timeout
+	registry.Schemas = c.Schemas
+	registry.PgBouncer = c.PgBouncer
+	registry.Lazy = c.Lazy
+	registry.Defaults = c.Defaults
+	registry.Retry = c.Retry
+	registry.CreateMissing = c.CreateMissing
+	return registry, nil
+}
+
+// Type is the config of the type called name.
+func (c *Config) Type(name string) (TypeConfig, bool) {
+	for _, t := range c.Types {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return TypeConfig{}, false
+}
+
+// NullPolicies are the null policies of the composite called name, for
+// ConvertDTO, including those of any composites nested in it.
+func (c *Config) NullPolicies(name string) (NullPolicies, error) {
+	return c.nullPolicies(name, nil)
+}
+
+func (c *Config) nullPolicies(name string, seen []string) (NullPolicies, error) {
+	for _, s := range seen {
+		if s == name {
+			return NullPolicies{}, fmt.Errorf("type %s contains itself", name)
+		}
+	}
+	seen = append(seen, name)
+
+	t, ok := c.Type(name)
+	if !ok {
+		return NullPolicies{}, fmt.Errorf("type %s is not in the config", name)
+	}
+
+	var policies NullPolicies
+	var err error
+	if policies.Default, err = nullPolicy(t.Null, nil, ""); err != nil {
+		return NullPolicies{}, fmt.Errorf("type %s: %w", name, err)
+	}
+	goNames, err := c.fieldGoNames(t)
+	if err != nil {
+		return NullPolicies{}, err
+	}
+
+	for i, f := range t.Fields {
+		goName := goNames[i]
+		if f.Null == "" {
+			f.Null, f.Default = c.embeddedNull(t, goName)
+		}
+		if f.Null != "" {
+			pgType := f.Type
+			if f.Chars == "string" || f.Chars == "trimmed" {
+				// A string's default is a string, even of one letter.
+				pgType = ""
+			}
+			policy, err := nullPolicy(f.Null, f.Default, pgType)
+			if err != nil {
+				return NullPolicies{}, fmt.Errorf("field %s of %s: %w", f.Name, name, err)
+			}
+			if policies.Fields == nil {
+				policies.Fields = make(map[string]NullPolicy)
+			}
+			policies.Fields[goName] = policy
+		}
+
+		if nested, ok := c.Type(f.Type); ok && len(nested.Fields) > 0 {
+			np, err := c.nullPolicies(f.Type, seen)
+			if err != nil {
+				return NullPolicies{}, err
+			}
+			if policies.Nested == nil {
+				policies.Nested = make(map[string]NullPolicies)
+			}
+			policies.Nested[goName] = np
+		}
+	}
+
+	return policies, nil
+}
+
+// GoName is the name of the Go struct a composite maps to.
+func (t TypeConfig) GoName() string {
+	if t.Go != "" {
+		return t.Go
+	}
+	name := t.Name
+	if tn, err := parseTypeName(name); err == nil {
+		name = tn.name
+	}
+	return goIdentifier(name)
+}
+
+// GoName is the name of the Go field the field maps to.
+func (f FieldConfig) GoName() string {
+	if f.Go != "" {
+		return f.Go
+	}
+	return goIdentifier(f.Name)
+}
+
+// embedRun is where the fields of an embedded composite are among the fields
+// of the composite that embeds it.
+type embedRun struct {
+	start  int
+	embed  TypeConfig
+	prefix string
+}
+
+// embedRuns finds the fields of each of t's embedded composites, in the
+// order they come in t.
+func (c *Config) embedRuns(t TypeConfig) ([]embedRun, error) {
+	var runs []embedRun
+	taken := make([]bool, len(t.Fields))
+	for _, e := range t.Embed {
+		embed, ok := c.Type(e.Type)
+		if !ok || len(embed.Fields) == 0 {
+			return nil, fmt.Errorf("type %s embeds %s, which is not a composite in the config", t.Name, e.Type)
+		}
+		if len(embed.Embed) > 0 {
+			return nil, fmt.Errorf("type %s embeds %s, which embeds another itself", t.Name, e.Type)
+		}
+
+		start := -1
+		for i, f := range t.Fields {
+			if f.Name == e.Prefix+embed.Fields[0].Name {
+				start = i
+				break
+			}
+		}
+		if start < 0 || start+len(embed.Fields) > len(t.Fields) {
+			return nil, fmt.Errorf("type %s embeds %s, but doesn't have its fields with prefix %q", t.Name, e.Type, e.Prefix)
+		}
+		for j, ef := range embed.Fields {
+			f := t.Fields[start+j]
+			if f.Name != e.Prefix+ef.Name || f.Type != ef.Type {
+				return nil, fmt.Errorf("field %s of %s is not field %s of the %s it embeds", f.Name, t.Name, ef.Name, e.Type)
+			}
+			if taken[start+j] {
+				return nil, fmt.Errorf("field %s of %s is in two embedded composites", f.Name, t.Name)
+			}
+			taken[start+j] = true
+		}
+		runs = append(runs, embedRun{start: start, embed: embed, prefix: e.Prefix})
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].start < runs[j].start })
+	return runs, nil
+}
+
+// fieldGoNames are the names of t's fields in Go, which for the fields of an
+// embedded composite are the names they're promoted from.
+func (c *Config) fieldGoNames(t TypeConfig) ([]string, error) {
+	runs, err := c.embedRuns(t)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(t.Fields))
+	for i, f := range t.Fields {
+		names[i] = f.GoName()
+	}
+	for _, run := range runs {
+		for j, ef := range run.embed.Fields {
+			names[run.start+j] = ef.GoName()
+		}
+	}
+	return names, nil
+}
+
+// embeddedNull is the null policy of the field goName of a composite t
+// embeds, for when t doesn't give one itself.
+func (c *Config) embeddedNull(t TypeConfig, goName string) (string, interface{}) {
+	for _, e := range t.Embed {
+		embed, _ := c.Type(e.Type)
+		for _, ef := range embed.Fields {
+			if ef.GoName() == goName {
+				return ef.Null, ef.Default
+			}
+		}
+	}
+	return "", nil
+}
+
+func (t TypeConfig) definition() (TypeDefinition, error) {
+	var kinds []string
+	if len(t.Fields) > 0 {
+		kinds = append(kinds, "fields")
+	}
+	if len(t.Enum) > 0 {
+		kinds = append(kinds, "enum")
+	}
+	if t.Domain != "" {
+		kinds = append(kinds, "domain")
+	}
+	if t.Range != "" {
+		kinds = append(kinds, "range")
+	}
+	if t.Multirange != "" {
+		kinds = append(kinds, "multirange")
+	}
+	if len(kinds) != 1 {
+		return nil, fmt.Errorf("type %s needs exactly one of fields, enum, domain, range or multirange", t.Name)
+	}
+
+	switch kinds[0] {
+	case "enum":
+		return EnumDefinition{Name: t.Name, Labels: t.Enum}, nil
+	case "domain":
+		return DomainDefinition{Name: t.Name, BaseType: t.Domain}, nil
+	case "range":
+		return RangeDefinition{Name: t.Name, Subtype: t.Range}, nil
+	case "multirange":
+		return MultirangeDefinition{Name: t.Name, Range: t.Multirange}, nil
+	}
+
+	def := CompositeDefinition{Name: t.Name}
+	if t.Lenient {
+		def.FieldCount = LenientFieldCount
+	}
+	for _, f := range t.Fields {
+		if f.Name == "" || f.Type == "" {
+			return nil, fmt.Errorf("every field of %s needs a name and a type", t.Name)
+		}
+		if err := f.checkChars(t.Name); err != nil {
+			return nil, err
+		}
+		if err := f.checkTemporal(t.Name); err != nil {
+			return nil, err
+		}
+		def.Fields = append(def.Fields, CompositeField{Name: f.Name, Type: f.Type})
+	}
+	for v, fields := range t.Versions {
+		version := make([]CompositeField, len(fields))
+		for i, f := range fields {
+			if f.Name == "" || f.Type == "" {
+				return nil, fmt.Errorf("every field of version %d of %s needs a name and a type", v+1, t.Name)
+			}
+			version[i] = CompositeField{Name: f.Name, Type: f.Type}
+		}
+		def.Versions = append(def.Versions, version)
+	}
+	return def, nil
+}
+
+// nullPolicy is the policy a config names.  YAML has no characters, so the
+// default of a bpchar or char field given as a one letter string is taken as
+// a rune.
+func nullPolicy(name string, value interface{}, pgType string) (NullPolicy, error) {
+	switch name {
+	case "", "zero":
+		return ZeroValue, nil
+	case "error":
+		return ErrorOnNull, nil
+	case "keep":
+		return KeepPointer, nil
+	case "default":
+	default:
+		return NullPolicy{}, fmt.Errorf("unknown null policy %q, it must be zero, error, keep or default", name)
+	}
+
+	if value == nil {
+		return NullPolicy{}, fmt.Errorf("null policy default needs a default")
+	}
+	if s, ok := value.(string); ok && (pgType == "bpchar" || pgType == "char") && utf8.RuneCountInString(s) == 1 {
+		r, _ := utf8.DecodeRuneInString(s)
+		return DefaultValue(r), nil
+	}
+	return DefaultValue(value), nil
+}
+
+// initialisms are the words Go writes in capitals.
+var initialisms = map[string]bool{
+	"api": true, "html": true, "http": true, "id": true, "ip": true, "json": true,
+	"oid": true, "sql": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// goIdentifier turns a postgres name like frame_rate into FrameRate, and
+// user_id into UserID.
+func goIdentifier(name string) string {
+	var b strings.Builder
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' '
+	})
+	for _, word := range words {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(word)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(word[size:])
+	}
+	return b.String()
+}
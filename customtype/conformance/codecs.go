@@ -0,0 +1,187 @@
+package conformance
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	v4 "github.com/jackc/pgtype"
+	v5 "github.com/jackc/pgx/v5/pgtype"
+
+	"testCustomType/customtype"
+)
+
+// V4 is the codec of pgx v4, with the resolution registered on ci, as it is
+// on a connection after AfterConnect, or on a Fake.
+func V4(ci *v4.ConnInfo, format Format) Codec {
+	return v4Codec{ci: ci, format: format}
+}
+
+type v4Codec struct {
+	ci     *v4.ConnInfo
+	format Format
+}
+
+func (c v4Codec) Format() Format {
+	return c.format
+}
+
+func (c v4Codec) dataType() (*v4.DataType, error) {
+	dt, ok := c.ci.DataTypeForName("resolution")
+	if !ok {
+		return nil, fmt.Errorf("resolution is not registered")
+	}
+	return dt, nil
+}
+
+func (c v4Codec) Encode(v interface{}) (Format, []byte, error) {
+	dt, err := c.dataType()
+	if err != nil {
+		return c.format, nil, err
+	}
+	value := v4.NewValue(dt.Value)
+	if err := value.Set(v); err != nil {
+		return c.format, nil, err
+	}
+	var buf []byte
+	if c.format == Binary {
+		buf, err = value.(v4.BinaryEncoder).EncodeBinary(c.ci, nil)
+	} else {
+		buf, err = value.(v4.TextEncoder).EncodeText(c.ci, nil)
+	}
+	return c.format, buf, err
+}
+
+func (c v4Codec) Decode(src []byte, dst interface{}) error {
+	dt, err := c.dataType()
+	if err != nil {
+		return err
+	}
+	return c.ci.Scan(dt.OID, formatCode(c.format), src, dst)
+}
+
+// V5 is the codec of pgx v5, with the resolution registered on m, as it is
+// on a connection after pgx5.RegisterTypes.  Like a query's parameters, a
+// value is encoded in the other format if it can't be in format, which for
+// the types in customtype, sent through their Value methods, is text.
+func V5(m *v5.Map, format Format) Codec {
+	return v5Codec{m: m, format: format}
+}
+
+type v5Codec struct {
+	m      *v5.Map
+	format Format
+}
+
+func (c v5Codec) Format() Format {
+	return c.format
+}
+
+func (c v5Codec) oid() (uint32, error) {
+	t, ok := c.m.TypeForName("resolution")
+	if !ok {
+		return 0, fmt.Errorf("resolution is not registered")
+	}
+	return t.OID, nil
+}
+
+func (c v5Codec) Encode(v interface{}) (Format, []byte, error) {
+	oid, err := c.oid()
+	if err != nil {
+		return c.format, nil, err
+	}
+	buf, err := c.m.Encode(oid, formatCode(c.format), v, nil)
+	if err == nil {
+		return c.format, buf, nil
+	}
+
+	other := Text
+	if c.format == Text {
+		other = Binary
+	}
+	if buf, otherErr := c.m.Encode(oid, formatCode(other), v, nil); otherErr == nil {
+		return other, buf, nil
+	}
+	return c.format, nil, err
+}
+
+func (c v5Codec) Decode(src []byte, dst interface{}) error {
+	oid, err := c.oid()
+	if err != nil {
+		return err
+	}
+	return c.m.Scan(oid, formatCode(c.format), src, dst)
+}
+
+func formatCode(format Format) int16 {
+	if format == Binary {
+		return v4.BinaryFormatCode
+	}
+	return v4.TextFormatCode
+}
+
+// SQL is the codec of database/sql: the types' Value methods, and the
+// SQLResolution and SQLResolutionDTO adapters.
+var SQL Codec = sqlCodec{}
+
+type sqlCodec struct{}
+
+func (sqlCodec) Format() Format {
+	return Text
+}
+
+func (sqlCodec) Encode(v interface{}) (Format, []byte, error) {
+	if rdto, ok := v.(*customtype.ResolutionDTO); ok {
+		v = customtype.SQLResolutionDTO(&rdto)
+	}
+	valuer, ok := v.(driver.Valuer)
+	if !ok {
+		return Text, nil, fmt.Errorf("cannot send %T through database/sql", v)
+	}
+	value, err := valuer.Value()
+	if err != nil || value == nil {
+		return Text, nil, err
+	}
+	switch value := value.(type) {
+	case string:
+		return Text, []byte(value), nil
+	case []byte:
+		return Text, value, nil
+	}
+	return Text, nil, fmt.Errorf("database/sql was sent a %T for a resolution", value)
+}
+
+func (sqlCodec) Decode(src []byte, dst interface{}) error {
+	var scanner interface{ Scan(src interface{}) error }
+	switch dst := dst.(type) {
+	case *customtype.Resolution:
+		scanner = customtype.SQLResolution(dst)
+	case **customtype.ResolutionDTO:
+		scanner = customtype.SQLResolutionDTO(dst)
+	default:
+		return fmt.Errorf("cannot scan a resolution into %T through database/sql", dst)
+	}
+	if src == nil {
+		return scanner.Scan(nil)
+	}
+	return scanner.Scan(src)
+}
+
+// JSONCodec is the codec of the JSON a query falls back on, as QueryJSON
+// decodes it.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Format() Format {
+	return JSON
+}
+
+func (jsonCodec) Encode(v interface{}) (Format, []byte, error) {
+	buf, err := json.Marshal(v)
+	return JSON, buf, err
+}
+
+func (jsonCodec) Decode(src []byte, dst interface{}) error {
+	return json.Unmarshal(src, dst)
+}
@@ -0,0 +1,349 @@
+// Package conformance is the suite of cases every way of encoding and
+// decoding a resolution has to agree on: pgx v4 through the registry, pgx v5
+// through its composite codec, database/sql through the text format, and
+// the JSON a query falls back on.  The cases are the four rows of the demo's
+// sample data: a resolution, a NULL resolution, one with a negative width,
+// and one with a NULL scan; and one with a zero scan, which is how a
+// Resolution without one is sent: as an empty char, since postgres won't take
+// a NUL in one.
+//
+// A codec passes if it decodes each case's wire form into what the case
+// says, encodes what the case says into its wire form, and gives the same
+// resolution whichever null policy is applied to what it decoded, with any
+// resolution it gave surviving being encoded and decoded again:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, conformance.V4(conn.ConnInfo(), conformance.Binary))
+//	}
+//
+// The null policies are every combination of ZeroValue, DefaultValue,
+// ErrorOnNull and KeepPointer over the three fields, so that a codec which
+// makes a NULL field zero, or a zero field NULL, fails on the way.
+package conformance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"testCustomType/customtype"
+)
+
+// Format is the form a codec puts a resolution in.
+type Format int
+
+const (
+	// Binary is postgres' binary format: the field count, then each field's
+	// OID, length and value.
+	Binary Format = iota
+	// Text is postgres' text format: (10,10,P).
+	Text
+	// JSON is what to_json makes of a resolution:
+	// {"width":10,"height":10,"scan":"P"}.
+	JSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case Binary:
+		return "binary"
+	case Text:
+		return "text"
+	case JSON:
+		return "json"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Codec decodes resolutions in one format, and encodes them in it unless it
+// can't.
+type Codec interface {
+	Format() Format
+
+	// Encode gives the wire form of v, a Resolution, a ResolutionDTO or a
+	// *ResolutionDTO, which is NULL if nil, and the format it's in.  That's
+	// the codec's own unless, like pgx v5, it falls back on the other for a
+	// value it can't send in its own.
+	Encode(v interface{}) (Format, []byte, error)
+
+	// Decode decodes src into dst, a *Resolution or a **ResolutionDTO.
+	Decode(src []byte, dst interface{}) error
+}
+
+// Case is a resolution and its wire form in each format.  A NULL resolution
+// has a nil DTO, and is nil in the binary and text formats.
+type Case struct {
+	Name   string
+	DTO    *customtype.ResolutionDTO
+	Binary []byte
+	Text   []byte
+	JSON   []byte
+}
+
+// Wire is the case in format.
+func (c Case) Wire(format Format) []byte {
+	switch format {
+	case Binary:
+		return c.Binary
+	case Text:
+		return c.Text
+	}
+	return c.JSON
+}
+
+// Cases are the sample data, in the order the demo inserts it, with the zero
+// scan before the NULL one.
+var Cases = []Case{
+	{
+		Name:   "resolution",
+		DTO:    dto(10, 10, 'P'),
+		Binary: unhex("00000003 00000017 00000004 0000000a 00000017 00000004 0000000a 00000412 00000001 50"),
+		Text:   []byte("(10,10,P)"),
+		JSON:   []byte(`{"width":10,"height":10,"scan":"P"}`),
+	},
+	{
+		Name: "null resolution",
+		JSON: []byte("null"),
+	},
+	{
+		Name:   "negative width",
+		DTO:    dto(-10, 10, 'P'),
+		Binary: unhex("00000003 00000017 00000004 fffffff6 00000017 00000004 0000000a 00000412 00000001 50"),
+		Text:   []byte("(-10,10,P)"),
+		JSON:   []byte(`{"width":-10,"height":10,"scan":"P"}`),
+	},
+	{
+		Name:   "zero scan",
+		DTO:    dto(640, 480, 0),
+		Binary: unhex("00000003 00000017 00000004 00000280 00000017 00000004 000001e0 00000412 00000000"),
+		Text:   []byte(`(640,480,"")`),
+		JSON:   []byte(`{"width":640,"height":480,"scan":""}`),
+	},
+	{
+		Name:   "null scan",
+		DTO:    &customtype.ResolutionDTO{Width: ptr(10), Height: ptr(10)},
+		Binary: unhex("00000003 00000017 00000004 0000000a 00000017 00000004 0000000a 00000412 ffffffff"),
+		Text:   []byte("(10,10,)"),
+		JSON:   []byte(`{"width":10,"height":10,"scan":null}`),
+	},
+}
+
+// Run runs the cases against codec, a subtest per case.
+func Run(t *testing.T, codec Codec) {
+	for _, c := range Cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			wire := c.Wire(codec.Format())
+
+			var got *customtype.ResolutionDTO
+			if err := codec.Decode(wire, &got); err != nil {
+				t.Fatalf("failed to decode %s: %v", wire, err)
+			}
+			if !reflect.DeepEqual(got, c.DTO) {
+				t.Fatalf("decoded %s as %s, want %s", wire, show(got), show(c.DTO))
+			}
+
+			format, encoded, err := codec.Encode(c.DTO)
+			if err != nil {
+				t.Fatalf("failed to encode %s: %v", show(c.DTO), err)
+			}
+			if want := c.Wire(format); !sameWire(format, encoded, want) {
+				t.Errorf("encoded %s as %s in %s, want %s", show(c.DTO), encoded, format, want)
+			}
+
+			if c.DTO == nil {
+				return
+			}
+			if c.DTO.Scan != nil {
+				runExact(t, codec, c, wire)
+			}
+			for _, p := range policies() {
+				runPolicy(t, codec, *c.DTO, p)
+			}
+		})
+	}
+}
+
+// runExact checks that a case without nulls goes to and from a Resolution
+// as it does a DTO.
+func runExact(t *testing.T, codec Codec, c Case, wire []byte) {
+	want := c.DTO.AsResolution()
+
+	var got customtype.Resolution
+	if err := codec.Decode(wire, &got); err != nil {
+		t.Errorf("failed to decode %s as a Resolution: %v", wire, err)
+	} else if got != want {
+		t.Errorf("decoded %s as %v, want %v", wire, got, want)
+	}
+
+	format, encoded, err := codec.Encode(want)
+	if err != nil {
+		t.Errorf("failed to encode %v: %v", want, err)
+	} else if !sameWire(format, encoded, c.Wire(format)) {
+		t.Errorf("encoded %v as %s in %s, want %s", want, encoded, format, c.Wire(format))
+	}
+}
+
+// runPolicy checks what the policy makes of the DTO, and that what it makes
+// is encoded and decoded without losing anything.
+func runPolicy(t *testing.T, codec Codec, rdto customtype.ResolutionDTO, p policy) {
+	res, err := rdto.AsResolutionWith(p.policies)
+	want, wantErr := p.resolve(rdto)
+	switch {
+	case wantErr && err == nil:
+		t.Errorf("%s: made %v of %s, want an error", p.name, res, show(&rdto))
+		return
+	case wantErr:
+		return
+	case err != nil:
+		t.Errorf("%s: failed to resolve %s: %v", p.name, show(&rdto), err)
+		return
+	case res != want:
+		t.Errorf("%s: made %v of %s, want %v", p.name, res, show(&rdto), want)
+		return
+	}
+
+	format, encoded, err := codec.Encode(res)
+	if err != nil {
+		t.Errorf("%s: failed to encode %v: %v", p.name, res, err)
+		return
+	}
+	if format != Binary && bytes.IndexByte(encoded, 0) >= 0 {
+		// A zero scan is an empty char, postgres won't take a NUL.
+		t.Errorf("%s: encoded %v as %q, which has a NUL", p.name, res, encoded)
+		return
+	}
+	if format != codec.Format() {
+		// The codec can't decode what it sent.
+		return
+	}
+	var got *customtype.ResolutionDTO
+	if err := codec.Decode(encoded, &got); err != nil {
+		t.Errorf("%s: failed to decode %s: %v", p.name, encoded, err)
+		return
+	}
+	if got == nil || got.Width == nil || got.Height == nil || got.Scan == nil || got.AsResolution() != res {
+		t.Errorf("%s: %v came back as %s", p.name, res, show(got))
+	}
+}
+
+// policy is one of a null policy for each field, with what the policy makes
+// of a null field spelled out to check ConvertDTO against.
+type policy struct {
+	name     string
+	policies customtype.NullPolicies
+	kinds    [3]string
+}
+
+// fields are the fields of a resolution, with the value their DefaultValue
+// policies give.
+var fields = []struct {
+	name  string
+	value interface{}
+}{
+	{"Width", 640},
+	{"Height", 480},
+	{"Scan", 'I'},
+}
+
+var nullPolicies = map[string]func(v interface{}) customtype.NullPolicy{
+	"zero":    func(interface{}) customtype.NullPolicy { return customtype.ZeroValue },
+	"default": customtype.DefaultValue,
+	"error":   func(interface{}) customtype.NullPolicy { return customtype.ErrorOnNull },
+	"keep":    func(interface{}) customtype.NullPolicy { return customtype.KeepPointer },
+}
+
+// policies are every combination of policies over the fields.
+func policies() []policy {
+	kinds := []string{"zero", "default", "error", "keep"}
+	var all []policy
+	for _, w := range kinds {
+		for _, h := range kinds {
+			for _, s := range kinds {
+				p := policy{kinds: [3]string{w, h, s}}
+				p.policies.Fields = make(map[string]customtype.NullPolicy)
+				names := make([]string, len(fields))
+				for i, f := range fields {
+					p.policies.Fields[f.name] = nullPolicies[p.kinds[i]](f.value)
+					names[i] = f.name + " " + p.kinds[i]
+				}
+				p.name = strings.Join(names, ", ")
+				all = append(all, p)
+			}
+		}
+	}
+	return all
+}
+
+// resolve is what the policy should make of rdto: a null field is zero or
+// its default, and an error if it's to stay null, which a Resolution can't
+// hold, or is one.
+func (p policy) resolve(rdto customtype.ResolutionDTO) (customtype.Resolution, bool) {
+	values := []interface{}{rdto.Width, rdto.Height, rdto.Scan}
+	res := reflect.New(reflect.TypeOf(customtype.Resolution{})).Elem()
+	for i, f := range fields {
+		field := res.FieldByName(f.name)
+		if v := reflect.ValueOf(values[i]); !v.IsNil() {
+			field.Set(v.Elem().Convert(field.Type()))
+			continue
+		}
+		switch p.kinds[i] {
+		case "default":
+			field.Set(reflect.ValueOf(f.value).Convert(field.Type()))
+		case "error", "keep":
+			return customtype.Resolution{}, true
+		}
+	}
+	return res.Interface().(customtype.Resolution), false
+}
+
+// sameWire is whether got is want, which for JSON is whether they're the
+// same value, whatever the spacing and order of the keys.
+func sameWire(format Format, got, want []byte) bool {
+	if format != JSON {
+		return reflect.DeepEqual(got, want)
+	}
+	var g, w interface{}
+	if json.Unmarshal(got, &g) != nil || json.Unmarshal(want, &w) != nil {
+		return false
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+// show is rdto with its fields rather than their addresses.
+func show(rdto *customtype.ResolutionDTO) string {
+	if rdto == nil {
+		return "NULL"
+	}
+	field := func(v interface{}) string {
+		rv := reflect.ValueOf(v)
+		if rv.IsNil() {
+			return ""
+		}
+		if r, ok := rv.Elem().Interface().(rune); ok {
+			return string(r)
+		}
+		return fmt.Sprint(rv.Elem().Interface())
+	}
+	return "(" + field(rdto.Width) + "," + field(rdto.Height) + "," + field(rdto.Scan) + ")"
+}
+
+func dto(width, height int, scan rune) *customtype.ResolutionDTO {
+	return &customtype.ResolutionDTO{Width: &width, Height: &height, Scan: &scan}
+}
+
+func ptr(v int) *int {
+	return &v
+}
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
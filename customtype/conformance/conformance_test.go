@@ -0,0 +1,55 @@
+package conformance_test
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"testCustomType/customtype"
+	"testCustomType/customtype/conformance"
+	"testCustomType/customtype/pgx5"
+)
+
+func TestConformance(t *testing.T) {
+	registry, err := customtype.NewTypeRegistry(customtype.Definitions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake, err := customtype.NewFake(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v5Map()
+
+	codecs := map[string]conformance.Codec{
+		"v4 binary":    conformance.V4(fake.ConnInfo(), conformance.Binary),
+		"v4 text":      conformance.V4(fake.ConnInfo(), conformance.Text),
+		"v5 binary":    conformance.V5(m, conformance.Binary),
+		"v5 text":      conformance.V5(m, conformance.Text),
+		"database/sql": conformance.SQL,
+		"json":         conformance.JSONCodec,
+	}
+	for name, codec := range codecs {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			conformance.Run(t, codec)
+		})
+	}
+}
+
+// v5Map has the resolution registered as pgx5.RegisterTypes would load it,
+// without the catalog.
+func v5Map() *pgtype.Map {
+	m := pgtype.NewMap()
+	m.RegisterType(&pgtype.Type{Name: "bpchar", OID: pgtype.BPCharOID, Codec: pgx5.RuneCodec{}})
+	int4, _ := m.TypeForOID(pgtype.Int4OID)
+	bpchar, _ := m.TypeForOID(pgtype.BPCharOID)
+	m.RegisterType(&pgtype.Type{Name: "resolution", OID: 16386, Codec: &pgtype.CompositeCodec{
+		Fields: []pgtype.CompositeCodecField{
+			{Name: "width", Type: int4},
+			{Name: "height", Type: int4},
+			{Name: "scan", Type: bpchar},
+		},
+	}})
+	return m
+}
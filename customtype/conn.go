@@ -0,0 +1,41 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ConnectConn opens a single connection to the database at dsn with the
+// registry's types registered, for scripts and tools that have no need of a
+// pool.
+func ConnectConn(ctx context.Context, dsn string, registry *TypeRegistry) (*pgx.Conn, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return ConnectConnConfig(ctx, config, registry)
+}
+
+// ConnectConnConfig opens a single connection using config, in the same way as
+// ConnectConn.  If the registry is in PgBouncer mode, config is changed to
+// suit.
+func ConnectConnConfig(ctx context.Context, config *pgx.ConnConfig, registry *TypeRegistry) (*pgx.Conn, error) {
+	if registry.PgBouncer {
+		forPgBouncer(config)
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if err := registry.AfterConnect(ctx, conn); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,185 @@
+package customtype
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgtype"
+)
+
+// FieldConverter converts the fields of a struct with one Go type to and from
+// what the composite field's pgtype value works with, for Go types pgtype
+// doesn't know, such as a time.Duration kept in an int8, or an enum of our
+// own kept in text.  The registry's converters are used for every composite
+// it registers, for fields of the converter's type or a pointer to it.
+//
+// Types that implement sql.Scanner and driver.Valuer, as most decimal and
+// UUID packages' do, need no converter: they are given the field's text, and
+// their Value is sent when the field can't be set from them directly.
+type FieldConverter interface {
+	// GoType is the type of struct field the converter is for.
+	GoType() reflect.Type
+
+	// ToDatabase turns the value of a field into one the composite field
+	// can be set from.
+	ToDatabase(v interface{}) (interface{}, error)
+
+	// FromDatabase assigns the composite field src to the struct field dst
+	// points to, which is never null.
+	FromDatabase(src pgtype.Value, dst interface{}) error
+}
+
+// NewConverter makes a FieldConverter for fields of type G out of a function
+// each way, with D being a type the composite field can be assigned to and
+// set from:
+//
+//	registry.Converters = append(registry.Converters, customtype.NewConverter(
+//		func(d time.Duration) (int64, error) { return int64(d), nil },
+//		func(n int64) (time.Duration, error) { return time.Duration(n), nil },
+//	))
+func NewConverter[G, D any](toDatabase func(G) (D, error), fromDatabase func(D) (G, error)) FieldConverter {
+	return &converter[G, D]{toDatabase: toDatabase, fromDatabase: fromDatabase}
+}
+
+type converter[G, D any] struct {
+	toDatabase   func(G) (D, error)
+	fromDatabase func(D) (G, error)
+}
+
+func (c *converter[G, D]) GoType() reflect.Type {
+	return reflect.TypeOf((*G)(nil)).Elem()
+}
+
+func (c *converter[G, D]) ToDatabase(v interface{}) (interface{}, error) {
+	g, ok := v.(G)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %T, the converter is for %s", v, c.GoType())
+	}
+	return c.toDatabase(g)
+}
+
+func (c *converter[G, D]) FromDatabase(src pgtype.Value, dst interface{}) error {
+	target, ok := dst.(*G)
+	if !ok {
+		return fmt.Errorf("cannot convert into %T, the converter is for %s", dst, c.GoType())
+	}
+
+	var d D
+	if err := assignField(src, &d); err != nil {
+		return err
+	}
+	g, err := c.fromDatabase(d)
+	if err != nil {
+		return err
+	}
+	*target = g
+	return nil
+}
+
+// builtinConverters are the converters every registry has, ahead of its own
+// Converters, which can replace them: big numbers for numeric fields, and the
+// geometric types.
+var builtinConverters = []FieldConverter{
+	ratConverter{},
+	bigIntConverter{},
+	pointConverter{},
+	boxConverter{},
+	circleConverter{},
+}
+
+// converters are a registry's converters by Go type, including the built in
+// ones.
+type converters map[reflect.Type]FieldConverter
+
+func newConverters(list []FieldConverter) converters {
+	c := make(converters, len(builtinConverters)+len(list))
+	for _, conv := range builtinConverters {
+		c[conv.GoType()] = conv
+	}
+	for _, conv := range list {
+		c[conv.GoType()] = conv
+	}
+	return c
+}
+
+// lookup finds the converter for fields of type t.  A struct type that
+// converts to a converter's, such as a struct of our own with X and Y fields
+// for a Point, uses that converter.
+func (c converters) lookup(t reflect.Type) (FieldConverter, bool) {
+	if conv, ok := c[t]; ok {
+		return conv, true
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	for goType, conv := range c {
+		if goType.Kind() == reflect.Struct && t.ConvertibleTo(goType) {
+			return convertedConverter{FieldConverter: conv, goType: t}, true
+		}
+	}
+	return nil, false
+}
+
+// toDatabase converts a field's value if there is a converter for its type.
+func (c converters) toDatabase(v reflect.Value) (interface{}, bool, error) {
+	conv, ok := c.lookup(v.Type())
+	if !ok {
+		return nil, false, nil
+	}
+	value, err := conv.ToDatabase(v.Interface())
+	return value, true, err
+}
+
+// fromDatabase assigns src to the field v if there is a converter for its
+// type, or the type it points to, in which case a null leaves it nil.
+func (c converters) fromDatabase(src pgtype.Value, v reflect.Value) (bool, error) {
+	if conv, ok := c.lookup(v.Type()); ok {
+		return true, conv.FromDatabase(src, v.Addr().Interface())
+	}
+
+	if v.Kind() != reflect.Ptr {
+		return false, nil
+	}
+	conv, ok := c.lookup(v.Type().Elem())
+	if !ok {
+		return false, nil
+	}
+	if src.Get() == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return true, nil
+	}
+	if !v.IsNil() {
+		return true, conv.FromDatabase(src, v.Interface())
+	}
+	target := reflect.New(v.Type().Elem())
+	if err := conv.FromDatabase(src, target.Interface()); err != nil {
+		return true, err
+	}
+	v.Set(target)
+	return true, nil
+}
+
+// convertedConverter uses a converter for fields of another type that
+// converts to the converter's.
+type convertedConverter struct {
+	FieldConverter
+	goType reflect.Type
+}
+
+func (c convertedConverter) GoType() reflect.Type {
+	return c.goType
+}
+
+func (c convertedConverter) ToDatabase(v interface{}) (interface{}, error) {
+	return c.FieldConverter.ToDatabase(reflect.ValueOf(v).Convert(c.FieldConverter.GoType()).Interface())
+}
+
+func (c convertedConverter) FromDatabase(src pgtype.Value, dst interface{}) error {
+	target := reflect.New(c.FieldConverter.GoType())
+	if err := c.FieldConverter.FromDatabase(src, target.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(dst).Elem().Set(target.Elem().Convert(c.goType))
+	return nil
+}
@@ -0,0 +1,70 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// CopyFromer is what the copy functions need to bulk load a table.  It is
+// satisfied by *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn and pgx.Tx.
+type CopyFromer interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// CopyResolutions loads resolutions into a single column of a table using
+// COPY, which is a great deal faster than inserting them one at a time.  The
+// other columns get their defaults.
+func CopyResolutions(ctx context.Context, c CopyFromer, table pgx.Identifier, column string, resolutions []Resolution) (int64, error) {
+	n, err := c.CopyFrom(ctx, table, []string{column}, pgx.CopyFromSlice(len(resolutions), func(i int) ([]interface{}, error) {
+		return []interface{}{resolutions[i]}, nil
+	}))
+	if err != nil {
+		return n, fmt.Errorf("failed to copy resolutions into %s: %w", table.Sanitize(), err)
+	}
+	return n, nil
+}
+
+// CopyRows loads rows into a table using COPY.  Each row is a struct with an
+// exported field per column in order, where a field can be any registered
+// type, composites included:
+//
+//	type fooRow struct {
+//		ID  int
+//		Res customtype.Resolution
+//	}
+//
+//	n, err := customtype.CopyRows(ctx, pool, pgx.Identifier{"foo"}, []string{"id", "res"}, rows)
+//
+// COPY uses the binary format, so every column type must be registered.
+func CopyRows[T any](ctx context.Context, c CopyFromer, table pgx.Identifier, columns []string, rows []T) (int64, error) {
+	n, err := c.CopyFrom(ctx, table, columns, pgx.CopyFromSlice(len(rows), func(i int) ([]interface{}, error) {
+		return rowValues(reflect.ValueOf(rows[i]))
+	}))
+	if err != nil {
+		return n, fmt.Errorf("failed to copy rows into %s: %w", table.Sanitize(), err)
+	}
+	return n, nil
+}
+
+// rowValues collects the exported fields of a row struct as column values.
+// Unlike structValues, a field is sent as it is, since pgx encodes it for the
+// column's type.
+func rowValues(v reflect.Value) ([]interface{}, error) {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("cannot copy a nil row")
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot copy a %s, rows must be structs", v.Type())
+	}
+
+	exported := exportedFields(v.Type())
+	values := make([]interface{}, len(exported))
+	for i, field := range exported {
+		values[i] = v.FieldByIndex(field.index).Interface()
+	}
+	return values, nil
+}
@@ -0,0 +1,78 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// A test database or a developer's own is easier to start from empty if the
+// types it needs create themselves.  With CreateMissing set, the registry runs
+// the CreateDDL of every type it finds missing before registering them, so
+// the Go definitions, and the structs DefinitionFor made them from, are all a
+// scratch database needs.  It's meant for those: a real database's types
+// belong in its migrations.
+
+// createDDL is the statement that creates def, if we know how to.  A
+// multirange is created along with its range.  hstore and citext are
+// extensions, which creating needs the privileges to.
+func createDDL(def TypeDefinition) (string, bool) {
+	switch def := def.(type) {
+	case CompositeDefinition:
+		return def.CreateDDL(), true
+	case EnumDefinition:
+		return def.CreateDDL(), true
+	case DomainDefinition:
+		return def.CreateDDL(), true
+	case RangeDefinition:
+		return def.CreateDDL(), true
+	case HstoreDefinition:
+		return "CREATE EXTENSION IF NOT EXISTS hstore;", true
+	case CitextDefinition:
+		return "CREATE EXTENSION IF NOT EXISTS citext;", true
+	}
+	return "", false
+}
+
+// createMissing creates the types that aren't in the database, in dependency
+// order, in a transaction.  So that connections made at the same time don't
+// all try, it holds an advisory lock while it does, and looks for the types
+// again once it has the lock, in case another connection created them while
+// it waited.
+func (r *TypeRegistry) createMissing(ctx context.Context, conn *pgx.Conn, types *typeSet) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin creating types: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "select pg_advisory_xact_lock(hashtext('customtype.create'))"); err != nil {
+		return fmt.Errorf("failed to lock for creating types: %w", err)
+	}
+
+	oids, _, err := r.findOIDs(ctx, conn, types)
+	if err != nil {
+		return err
+	}
+
+	log := r.logger()
+	for _, def := range types.definitions {
+		if _, ok := oids[def.TypeName()]; ok {
+			continue
+		}
+		ddl, ok := createDDL(def)
+		if !ok {
+			continue
+		}
+		if _, err := tx.Exec(ctx, ddl); err != nil {
+			return fmt.Errorf("failed to create %s: %w", def.TypeName(), err)
+		}
+		log.log(ctx, pgx.LogLevelInfo, "created type", map[string]interface{}{"type": def.TypeName(), "sql": ddl})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit creating types: %w", err)
+	}
+	return nil
+}
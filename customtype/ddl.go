@@ -0,0 +1,297 @@
+package customtype
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// DefinitionFor describes a composite from a Go struct, so that the struct can
+// be the source of truth and the DDL generated from it.  Each exported field
+// is an attribute, named and typed by a pg tag:
+//
+//	type Resolution struct {
+//		Width  int  `pg:"width,int4"`
+//		Height int  `pg:"height,int4"`
+//		Scan   rune `pg:"scan,bpchar"`
+//	}
+//
+// Without a tag the attribute is the field name in lower case, and without a
+// type in the tag it is worked out from the field: int8 for an int, text for
+// a string, interval for a time.Duration, numeric for a big.Rat, uuid for a
+// [16]byte and so on, with a nested struct being the composite named after
+// the struct in lower case.  A pointer or Option field has the type of what
+// it holds.  The fields of an embedded struct are attributes in its place,
+// their names prefixed with the name in a tag like pg:"res_,flatten", while
+// an embedded struct with any other pg tag is a nested composite like any
+// other field.  A field tagged pg:"-" isn't an attribute at all, and is left
+// for the application to fill in.  A trim after the type trims the padding
+// off a string as char.go describes, as in pg:"code,bpchar,trim", and an
+// interval mode or a location decodes a temporal field as temporal.go
+// describes, as in pg:"at,timestamptz,location=UTC".  Embedding promotes the
+// embedded struct's methods as well, so a struct embedding a Resolution
+// wants a MarshalJSON of its own, as the generated types have, and a Value
+// where it goes through database/sql.
+func DefinitionFor(name string, v interface{}) (CompositeDefinition, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return CompositeDefinition{}, fmt.Errorf("cannot define %s from %T, it must be a struct", name, v)
+	}
+
+	def := CompositeDefinition{Name: name}
+	for _, sf := range exportedFields(t) {
+		if sf.err != nil {
+			return CompositeDefinition{}, fmt.Errorf("field %s of %s: %w", sf.Name, t.Name(), sf.err)
+		}
+		var field CompositeField
+		field.Name, field.Type = sf.attribute()
+
+		if field.Type == "" {
+			pgType, ok := postgresType(sf.Type)
+			if !ok {
+				return CompositeDefinition{}, fmt.Errorf("cannot work out a postgres type for %s.%s of type %s, give it a pg tag",
+					t.Name(), sf.Name, sf.Type)
+			}
+			field.Type = pgType
+		}
+
+		def.Fields = append(def.Fields, field)
+	}
+
+	return def, nil
+}
+
+// pgTag is the attribute name and type in a field's pg tag.  The name is the
+// field's in lower case if the tag doesn't give one, and the type is empty.
+// The options after the type aren't part of it.
+func pgTag(sf reflect.StructField) (name, pgType string) {
+	name = strings.ToLower(sf.Name)
+	if tag, ok := sf.Tag.Lookup("pg"); ok {
+		tagName, tagType, _ := strings.Cut(tag, ",")
+		if tagName != "" {
+			name = tagName
+		}
+		pgType, _ = tagOptions(tagType)
+	}
+	return name, pgType
+}
+
+// fieldOptions are what a field's pg tag says after its type: trim, as
+// char.go describes, and an interval mode or a location, as temporal.go
+// does.  An option that can't be used, such as a location we can't load, is
+// kept as err for when the field is.
+type fieldOptions struct {
+	trim     bool
+	interval intervalMode
+	location *time.Location
+	err      error
+}
+
+// tagOptions is the type in what follows the name in a pg tag, and the
+// options after it.  A type can have commas of its own, as numeric(10,2)
+// does, so the options are taken off the end for as long as there are any.
+func tagOptions(tagType string) (string, fieldOptions) {
+	var options fieldOptions
+	for tagType != "" {
+		i := strings.LastIndex(tagType, ",")
+		option := tagType[i+1:]
+		if !options.setTrim(option) && !options.setInterval(option) && !options.setLocation(option) {
+			break
+		}
+		if i < 0 {
+			i = 0
+		}
+		tagType = tagType[:i]
+	}
+	if options.interval != "" && options.location != nil && options.err == nil {
+		options.err = fmt.Errorf("a pg tag can have an interval mode or a location, not both")
+	}
+	return tagType, options
+}
+
+// setTrim sets trim if option is it.
+func (o *fieldOptions) setTrim(option string) bool {
+	if option != "trim" {
+		return false
+	}
+	o.trim = true
+	return true
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	ratType      = reflect.TypeOf(big.Rat{})
+	bigIntType   = reflect.TypeOf(big.Int{})
+	addrType     = reflect.TypeOf(netip.Addr{})
+	prefixType   = reflect.TypeOf(netip.Prefix{})
+)
+
+// scalarStruct reports whether t is a struct that is a single value of a
+// postgres type, such as a time.Time for a timestamptz, rather than a
+// composite.
+func scalarStruct(t reflect.Type) bool {
+	switch t {
+	case timeType, ratType, bigIntType, addrType, prefixType:
+		return true
+	}
+	return false
+}
+
+// postgresType is the postgres type we'd use for a Go type.
+func postgresType(t reflect.Type) (string, bool) {
+	for {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+			continue
+		}
+		if option, ok := reflect.Zero(t).Interface().(optionSource); ok {
+			t = option.optionType()
+			continue
+		}
+		break
+	}
+
+	switch {
+	case t == timeType:
+		return "timestamptz", true
+	case t == durationType:
+		return "interval", true
+	case t == ratType || t == bigIntType:
+		return "numeric", true
+	case t == addrType:
+		return "inet", true
+	case t == prefixType:
+		return "cidr", true
+	case t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8:
+		return "uuid", true
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return "bytea", true
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		return "hstore", true
+	case t.Kind() == reflect.Slice:
+		elem, ok := postgresType(t.Elem())
+		return ArrayTypeName(elem), ok
+	case t.Kind() == reflect.Struct:
+		return strings.ToLower(t.Name()), t.Name() != ""
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool", true
+	case reflect.Int16:
+		return "int2", true
+	case reflect.Int32:
+		return "int4", true
+	case reflect.Int, reflect.Int64:
+		return "int8", true
+	case reflect.Float32:
+		return "float4", true
+	case reflect.Float64:
+		return "float8", true
+	case reflect.String:
+		return "text", true
+	}
+	return "", false
+}
+
+// CreateDDL is the statement that creates the composite.
+func (def CompositeDefinition) CreateDDL() string {
+	if len(def.Fields) == 0 {
+		return fmt.Sprintf("CREATE TYPE %s AS ();", typeIdentifier(def.Name))
+	}
+
+	attributes := make([]string, len(def.Fields))
+	for i, f := range def.Fields {
+		attributes[i] = fmt.Sprintf("    %s %s", pgx.Identifier{f.Name}.Sanitize(), f.Type)
+	}
+	return fmt.Sprintf("CREATE TYPE %s AS (\n%s\n);", typeIdentifier(def.Name), strings.Join(attributes, ",\n"))
+}
+
+// CreateDDL is the statement that creates the enum.
+func (def EnumDefinition) CreateDDL() string {
+	labels := make([]string, len(def.Labels))
+	for i, l := range def.Labels {
+		labels[i] = "'" + strings.ReplaceAll(l, "'", "''") + "'"
+	}
+	return fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", typeIdentifier(def.Name), strings.Join(labels, ", "))
+}
+
+// CreateDDL is the statement that creates the domain.
+func (def DomainDefinition) CreateDDL() string {
+	return fmt.Sprintf("CREATE DOMAIN %s AS %s;", typeIdentifier(def.Name), def.BaseType)
+}
+
+// CreateDDL is the statement that creates the range, which creates its
+// multirange as well.
+func (def RangeDefinition) CreateDDL() string {
+	return fmt.Sprintf("CREATE TYPE %s AS RANGE (subtype = %s);", typeIdentifier(def.Name), def.Subtype)
+}
+
+// AlterDDL is the statements that turn the composite from into def, which must
+// have the same name: attributes that are gone are dropped, new ones are
+// added at the end, and ones with a new type are altered.  Postgres can't
+// reorder the attributes of a type, so a reordered definition is an error,
+// as is a renamed type.
+func (def CompositeDefinition) AlterDDL(from CompositeDefinition) ([]string, error) {
+	if def.Name != from.Name {
+		return nil, fmt.Errorf("cannot alter %s into %s", from.Name, def.Name)
+	}
+
+	name := typeIdentifier(def.Name)
+	wanted := make(map[string]CompositeField, len(def.Fields))
+	for _, f := range def.Fields {
+		wanted[f.Name] = f
+	}
+
+	var statements []string
+	var kept []string
+	existing := make(map[string]bool, len(from.Fields))
+	for _, f := range from.Fields {
+		existing[f.Name] = true
+
+		w, ok := wanted[f.Name]
+		switch {
+		case !ok:
+			statements = append(statements, fmt.Sprintf("ALTER TYPE %s DROP ATTRIBUTE %s;", name, pgx.Identifier{f.Name}.Sanitize()))
+			continue
+		case w.Type != f.Type:
+			statements = append(statements, fmt.Sprintf("ALTER TYPE %s ALTER ATTRIBUTE %s TYPE %s;", name, pgx.Identifier{f.Name}.Sanitize(), w.Type))
+		}
+		kept = append(kept, f.Name)
+	}
+
+	// What's kept has to be in the same order, at the start, with the new
+	// attributes after it.
+	for i, f := range def.Fields {
+		if i < len(kept) {
+			if f.Name != kept[i] {
+				return nil, fmt.Errorf("cannot move attribute %s of %s, postgres can't reorder attributes", f.Name, def.Name)
+			}
+			continue
+		}
+		if existing[f.Name] {
+			return nil, fmt.Errorf("cannot move attribute %s of %s, postgres can't reorder attributes", f.Name, def.Name)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TYPE %s ADD ATTRIBUTE %s %s;", name, pgx.Identifier{f.Name}.Sanitize(), f.Type))
+	}
+
+	return statements, nil
+}
+
+// typeIdentifier quotes a type name the way it was written, schema and all.
+func typeIdentifier(name string) string {
+	tn, err := parseTypeName(name)
+	if err != nil {
+		return pgx.Identifier{name}.Sanitize()
+	}
+	return tn.Sanitize()
+}
@@ -0,0 +1,49 @@
+package customtype
+
+import "testing"
+
+// TestTagOptions checks the type and options taken from what follows the
+// name in a pg tag, a type's own commas included.
+func TestTagOptions(t *testing.T) {
+	tests := []struct {
+		tag          string
+		wantType     string
+		wantTrim     bool
+		wantInterval intervalMode
+		wantLocation string
+		wantErr      bool
+	}{
+		{tag: "", wantType: ""},
+		{tag: "int4", wantType: "int4"},
+		{tag: "numeric(10,2)", wantType: "numeric(10,2)"},
+		{tag: "numeric(10,2),trim", wantType: "numeric(10,2)", wantTrim: true},
+		{tag: "bpchar,trim", wantType: "bpchar", wantTrim: true},
+		{tag: "trim", wantType: "", wantTrim: true},
+		{tag: "interval,days", wantType: "interval", wantInterval: intervalDays},
+		{tag: "interval,exact", wantType: "interval", wantInterval: intervalExact},
+		{tag: "interval,months", wantType: "interval", wantInterval: intervalMonths},
+		{tag: "interval,weekly", wantType: "interval,weekly"},
+		{tag: "timestamptz,location=UTC", wantType: "timestamptz", wantLocation: "UTC"},
+		{tag: "location=UTC", wantType: "", wantLocation: "UTC"},
+		{tag: "timestamptz,location=Mars/Olympus", wantType: "timestamptz", wantErr: true},
+		{tag: "interval,days,location=UTC", wantType: "interval", wantInterval: intervalDays, wantLocation: "UTC", wantErr: true},
+		{tag: "text,trim,location=UTC", wantType: "text", wantTrim: true, wantLocation: "UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			gotType, options := tagOptions(tt.tag)
+			location := ""
+			if options.location != nil {
+				location = options.location.String()
+			}
+			if gotType != tt.wantType || options.trim != tt.wantTrim || options.interval != tt.wantInterval || location != tt.wantLocation {
+				t.Errorf("got %q with trim %v, interval %q and location %q, want %q with %v, %q and %q",
+					gotType, options.trim, options.interval, location, tt.wantType, tt.wantTrim, tt.wantInterval, tt.wantLocation)
+			}
+			if (options.err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want one %v", options.err, tt.wantErr)
+			}
+		})
+	}
+}
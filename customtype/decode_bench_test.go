@@ -0,0 +1,189 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// These measure a whole query's worth of decoding, through QueryAll with the
+// resolutions in binary and in text, through QueryJSON with them turned into
+// JSON, and through a ResultCache, for result sets of a few sizes.  The rows come from a Querier
+// that hands out the same encoded column however many times, so the numbers
+// are the decoding alone, which is what the choice of format changes.  Run
+// them with
+//
+//	go test -run '^$' -bench DecodeQuery -benchmem ./customtype
+//
+// Each reports rows/s as well as the usual ns/op, which is per query.
+
+var benchRowCounts = []int{1, 100, 10000}
+
+// benchRows are count rows of a single column, src, in format.
+type benchRows struct {
+	ci     *pgtype.ConnInfo
+	fields []pgproto3.FieldDescription
+	src    []byte
+	count  int
+	row    int
+}
+
+func (r *benchRows) Close()                                         {}
+func (r *benchRows) Err() error                                     { return nil }
+func (r *benchRows) CommandTag() pgconn.CommandTag                  { return nil }
+func (r *benchRows) FieldDescriptions() []pgproto3.FieldDescription { return r.fields }
+func (r *benchRows) RawValues() [][]byte                            { return [][]byte{r.src} }
+
+func (r *benchRows) Next() bool {
+	r.row++
+	return r.row <= r.count
+}
+
+func (r *benchRows) Scan(dest ...interface{}) error {
+	if len(dest) != 1 {
+		return fmt.Errorf("%d destinations for 1 column", len(dest))
+	}
+	field := r.fields[0]
+	return r.ci.Scan(field.DataTypeOID, field.Format, r.src, dest[0])
+}
+
+func (r *benchRows) Values() ([]interface{}, error) {
+	return nil, fmt.Errorf("values are not supported")
+}
+
+// benchQuerier answers every query with count rows of src.
+type benchQuerier struct {
+	ci     *pgtype.ConnInfo
+	oid    uint32
+	format int16
+	src    []byte
+	count  int
+}
+
+func (q benchQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return &benchRows{
+		ci: q.ci,
+		fields: []pgproto3.FieldDescription{
+			{Name: []byte("res"), DataTypeOID: q.oid, Format: q.format},
+		},
+		src:   q.src,
+		count: q.count,
+	}, nil
+}
+
+// benchQuery runs query over each of the row counts.
+func benchQuery(b *testing.B, q benchQuerier, query func(benchQuerier) (int, error)) {
+	for _, count := range benchRowCounts {
+		q.count = count
+		b.Run(fmt.Sprintf("rows=%d", count), func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n, err := query(q)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != count {
+					b.Fatalf("got %d rows, want %d", n, count)
+				}
+			}
+			b.ReportMetric(float64(b.N*count)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
+
+func queryAllResolutions(q benchQuerier) (int, error) {
+	results, err := QueryAll[Resolution](context.Background(), q, "SELECT res FROM foo")
+	return len(results), err
+}
+
+func BenchmarkDecodeQueryBinary(b *testing.B) {
+	ci := benchConnInfo(b)
+	q := benchQuerier{
+		ci:     ci,
+		oid:    benchResolutionOID,
+		format: pgtype.BinaryFormatCode,
+		src:    benchEncoded(b, ci, pgtype.BinaryFormatCode),
+	}
+	benchQuery(b, q, queryAllResolutions)
+}
+
+func BenchmarkDecodeQueryText(b *testing.B) {
+	ci := benchConnInfo(b)
+	q := benchQuerier{
+		ci:     ci,
+		oid:    benchResolutionOID,
+		format: pgtype.TextFormatCode,
+		src:    benchEncoded(b, ci, pgtype.TextFormatCode),
+	}
+	benchQuery(b, q, queryAllResolutions)
+}
+
+// With a cache in front, only the first query decodes anything, and the rest
+// cost a lookup and a copy of the slice.
+func BenchmarkDecodeQueryCached(b *testing.B) {
+	ci := benchConnInfo(b)
+	q := benchQuerier{
+		ci:     ci,
+		oid:    benchResolutionOID,
+		format: pgtype.BinaryFormatCode,
+		src:    benchEncoded(b, ci, pgtype.BinaryFormatCode),
+	}
+	benchQuery(b, q, func(q benchQuerier) (int, error) {
+		cache := cachedBenchResults[q.count]
+		if cache == nil {
+			cache = NewResultCache(1, 0)
+			cachedBenchResults[q.count] = cache
+		}
+		results, err := CachedQueryAll[Resolution](context.Background(), cache, q, "SELECT res FROM foo")
+		return len(results), err
+	})
+}
+
+// cachedBenchResults are the caches of BenchmarkDecodeQueryCached, one per
+// row count so that each caches its own result.
+var cachedBenchResults = map[int]*ResultCache{}
+
+// The server sends to_json in text, and QueryJSON needs nothing registered,
+// so this one runs on a bare ConnInfo.
+func BenchmarkDecodeQueryJSON(b *testing.B) {
+	q := benchQuerier{
+		ci:     pgtype.NewConnInfo(),
+		oid:    pgtype.JSONOID,
+		format: pgtype.TextFormatCode,
+		src:    []byte(`{"res":{"width":1920,"height":1080,"scan":"P"}}`),
+	}
+	benchQuery(b, q, func(q benchQuerier) (int, error) {
+		results, err := QueryJSON[Resolution](context.Background(), q, "SELECT res FROM foo")
+		return len(results), err
+	})
+}
+
+// The in place ones decode the same rows into a ResolutionDTO, whose fields
+// are all pointers, through ForEachInPlace, which should leave no
+// allocations per row once its pointers are set.
+func benchInPlace(b *testing.B, format int16) {
+	ci := benchConnInfo(b)
+	q := benchQuerier{ci: ci, oid: benchResolutionOID, format: format, src: benchEncoded(b, ci, format)}
+	benchQuery(b, q, func(q benchQuerier) (int, error) {
+		n := 0
+		err := ForEachInPlace(context.Background(), q, "SELECT res FROM foo", func(*ResolutionDTO) error {
+			n++
+			return nil
+		})
+		return n, err
+	})
+}
+
+func BenchmarkDecodeQueryInPlaceBinary(b *testing.B) {
+	benchInPlace(b, pgtype.BinaryFormatCode)
+}
+
+func BenchmarkDecodeQueryInPlaceText(b *testing.B) {
+	benchInPlace(b, pgtype.TextFormatCode)
+}
@@ -0,0 +1,166 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+// Rather than keep a default like the P of Resolution.Scan in Go and in SQL,
+// where they can disagree, we can read it from the database.  Postgres won't
+// give the attributes of a composite type defaults, but it will give them to
+// the columns of a table, so the defaults of a composite live in a companion
+// table named after it, with a column per attribute it has a default for:
+//
+//	create table resolution_defaults (scan char default 'P');
+//
+// The row type of a table, such as foo, uses the table's own defaults
+// instead.  Only constant defaults are read: one like now() or nextval()
+// would have to be run, and wouldn't be the same value twice anyway.
+
+// defaultsSuffix names the companion table of a composite.
+const defaultsSuffix = "_defaults"
+
+// attributeDefault is an attribute of a composite along with its default.
+type attributeDefault struct {
+	name      string
+	typeName  string
+	composite bool
+	expr      *string
+}
+
+// ReadDefaults reads the defaults of the composite called name from the
+// database, as null policies for ConvertDTO: DefaultValue for the attributes
+// with a default and ZeroValue for the rest, with the fields named in Go's
+// style as with Config, so width is Width.  The policies of composites nested
+// in it are read as well.
+func ReadDefaults(ctx context.Context, q Querier, name string) (NullPolicies, error) {
+	attributes, err := readAttributeDefaults(ctx, q, name)
+	if err != nil {
+		return NullPolicies{}, err
+	}
+
+	values, err := evaluateDefaults(ctx, q, name, attributes)
+	if err != nil {
+		return NullPolicies{}, err
+	}
+
+	var policies NullPolicies
+	for _, a := range attributes {
+		goName := goIdentifier(a.name)
+		if value, ok := values[a.name]; ok {
+			policy, err := nullPolicy("default", value, a.typeName)
+			if err != nil {
+				return NullPolicies{}, fmt.Errorf("default of %s.%s: %w", name, a.name, err)
+			}
+			if policies.Fields == nil {
+				policies.Fields = make(map[string]NullPolicy)
+			}
+			policies.Fields[goName] = policy
+		}
+
+		if a.composite {
+			nested, err := ReadDefaults(ctx, q, a.typeName)
+			if err != nil {
+				return NullPolicies{}, err
+			}
+			if policies.Nested == nil {
+				policies.Nested = make(map[string]NullPolicies)
+			}
+			policies.Nested[goName] = nested
+		}
+	}
+
+	return policies, nil
+}
+
+// readAttributeDefaults finds the attributes of the composite and the
+// expressions of their constant defaults, if they have any.
+func readAttributeDefaults(ctx context.Context, q Querier, name string) ([]attributeDefault, error) {
+	rows, err := q.Query(ctx, `select a.attname,
+			case when at.typtype = 'c' then a.atttypid::regtype::text else at.typname::text end,
+			at.typtype = 'c', pg_get_expr(d.adbin, d.adrelid)
+		from pg_type t
+		join pg_namespace n on n.oid = t.typnamespace
+		join pg_class c on c.oid = t.typrelid
+		join pg_attribute a on a.attrelid = t.typrelid and a.attnum > 0 and not a.attisdropped
+		join pg_type at on at.oid = a.atttypid
+		left join pg_attribute da on not da.attisdropped and da.attname = a.attname and da.attrelid =
+			case when c.relkind in ('r', 'p') then c.oid
+			else to_regclass(quote_ident(n.nspname) || '.' || quote_ident(t.typname || $2)) end
+		left join pg_attrdef d on d.adrelid = da.attrelid and d.adnum = da.attnum and d.adbin::text like '{CONST %'
+		where t.oid = $1::text::regtype
+		order by a.attnum`, name, defaultsSuffix)
+	if err != nil {
+		return nil, readDefaultsError(name, err)
+	}
+	defer rows.Close()
+
+	var attributes []attributeDefault
+	for rows.Next() {
+		var a attributeDefault
+		if err := rows.Scan(&a.name, &a.typeName, &a.composite, &a.expr); err != nil {
+			return nil, readDefaultsError(name, err)
+		}
+		attributes = append(attributes, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, readDefaultsError(name, err)
+	}
+	if len(attributes) == 0 {
+		return nil, fmt.Errorf("type %s is not a composite", name)
+	}
+
+	return attributes, nil
+}
+
+func readDefaultsError(name string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42704" {
+		return fmt.Errorf("failed to read defaults of %s: %w", name, ErrTypeNotFound)
+	}
+	return fmt.Errorf("failed to read defaults of %s: %w", name, err)
+}
+
+// evaluateDefaults has the database work out the values of the defaults, all
+// in one select, so that we get them as the Go values pgx decodes them into.
+func evaluateDefaults(ctx context.Context, q Querier, name string, attributes []attributeDefault) (map[string]interface{}, error) {
+	var names, exprs []string
+	for _, a := range attributes {
+		if a.expr != nil {
+			names = append(names, a.name)
+			exprs = append(exprs, *a.expr)
+		}
+	}
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := q.Query(ctx, "select "+strings.Join(exprs, ", "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate defaults of %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to evaluate defaults of %s: %w", name, err)
+		}
+		return nil, fmt.Errorf("failed to evaluate defaults of %s: no row", name)
+	}
+	row, err := rows.Values()
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate defaults of %s: %w", name, err)
+	}
+
+	values := make(map[string]interface{}, len(names))
+	for i, n := range names {
+		if row[i] != nil {
+			values[n] = row[i]
+		}
+	}
+	return values, nil
+}
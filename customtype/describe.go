@@ -0,0 +1,114 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// TypeDescription is how the server defines a type.
+type TypeDescription struct {
+	// Name is the type's name as the server writes it, with a schema if it
+	// isn't on the search path.
+	Name string
+
+	OID      uint32
+	ArrayOID uint32
+
+	// Kind is base, composite, domain, enum, pseudo, range or multirange.
+	Kind string
+
+	// Fields are a composite's attributes, in order, with their types as
+	// the server writes them.
+	Fields []CompositeField
+
+	// Labels are an enum's labels, in order.
+	Labels []string
+
+	// BaseType is the type a domain is over, and Subtype the type of a
+	// range's bounds.
+	BaseType string
+	Subtype  string
+}
+
+var typeKinds = map[string]string{
+	"b": "base",
+	"c": "composite",
+	"d": "domain",
+	"e": "enum",
+	"p": "pseudo",
+	"r": "range",
+	"m": "multirange",
+}
+
+// Describe asks the server how it defines the type called name, which is
+// looked up the way a cast to it would be, search path and all.
+func Describe(ctx context.Context, conn *pgx.Conn, name string) (TypeDescription, error) {
+	var desc TypeDescription
+	var kind string
+	err := conn.QueryRow(ctx, `select t.oid, t.typarray, t.typtype::text, t.oid::regtype::text,
+			case when t.typtype = 'd' then format_type(t.typbasetype, t.typtypmod) else '' end
+		from pg_type t where t.oid = $1::text::regtype`, name).
+		Scan(&desc.OID, &desc.ArrayOID, &kind, &desc.Name, &desc.BaseType)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42704" {
+			return TypeDescription{}, fmt.Errorf("failed to describe %s: %w", name, ErrTypeNotFound)
+		}
+		return TypeDescription{}, fmt.Errorf("failed to describe %s: %w", name, err)
+	}
+	desc.Kind = typeKinds[kind]
+
+	switch desc.Kind {
+	case "composite":
+		rows, err := conn.Query(ctx, `select a.attname, format_type(a.atttypid, a.atttypmod)
+			from pg_type t join pg_attribute a on a.attrelid = t.typrelid
+			where t.oid = $1 and a.attnum > 0 and not a.attisdropped
+			order by a.attnum`, desc.OID)
+		if err != nil {
+			return TypeDescription{}, fmt.Errorf("failed to look up fields of %s: %w", name, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var f CompositeField
+			if err := rows.Scan(&f.Name, &f.Type); err != nil {
+				return TypeDescription{}, fmt.Errorf("failed to scan fields of %s: %w", name, err)
+			}
+			desc.Fields = append(desc.Fields, f)
+		}
+		if err := rows.Err(); err != nil {
+			return TypeDescription{}, fmt.Errorf("failed to look up fields of %s: %w", name, err)
+		}
+
+	case "enum":
+		rows, err := conn.Query(ctx, `select enumlabel from pg_enum where enumtypid = $1 order by enumsortorder`, desc.OID)
+		if err != nil {
+			return TypeDescription{}, fmt.Errorf("failed to look up labels of %s: %w", name, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var label string
+			if err := rows.Scan(&label); err != nil {
+				return TypeDescription{}, fmt.Errorf("failed to scan labels of %s: %w", name, err)
+			}
+			desc.Labels = append(desc.Labels, label)
+		}
+		if err := rows.Err(); err != nil {
+			return TypeDescription{}, fmt.Errorf("failed to look up labels of %s: %w", name, err)
+		}
+
+	case "range":
+		err := conn.QueryRow(ctx, `select format_type(rngsubtype, null) from pg_range where rngtypid = $1`, desc.OID).
+			Scan(&desc.Subtype)
+		if err != nil {
+			return TypeDescription{}, fmt.Errorf("failed to look up subtype of %s: %w", name, err)
+		}
+	}
+
+	return desc, nil
+}
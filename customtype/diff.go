@@ -0,0 +1,249 @@
+package customtype
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Reconciliation jobs and tests compare composites a field at a time: which
+// rows of a copy differ from the original, and in what.  Diff walks two
+// values of a composite's struct as the registry does, by attribute, into
+// nested composites, Options and arrays, and reports each field that differs
+// under its attribute path:
+//
+//	diffs, err := customtype.Diff(want, got, customtype.DiffRules{
+//		Ignore:    []string{"label"},
+//		Tolerance: map[string]float64{"res.width": 1},
+//	})
+//	for _, d := range diffs {
+//		fmt.Println(d) // res.height: 1080 != 1088
+//	}
+//
+// A NULL is only equal to another NULL, so a nil field of a DTO differs from
+// a zero one, and a composite or array that's NULL on one side only is a diff
+// of its own rather than one per field.  An element of an array is under its
+// index, as in modes[2].width, but rules name fields without indexes, so that
+// a rule applies to every element.
+
+// FieldDiff is a field that differs between two composites.
+type FieldDiff struct {
+	// Field is the path of attribute names to the field, such as res.width.
+	Field string
+
+	// A and B are the field's values on each side, nil for NULL.
+	A, B interface{}
+}
+
+func (d FieldDiff) String() string {
+	return fmt.Sprintf("%s: %s != %s", d.Field, diffText(d.A), diffText(d.B))
+}
+
+// diffText is v as a FieldDiff prints it.  A value whose String method is
+// on its pointer, as a big.Rat's is, is printed by it all the same.
+func diffText(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		if s, ok := p.Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// DiffRules are what Diff leaves out and lets through, by field path.
+type DiffRules struct {
+	// Ignore are the fields not compared.  Ignoring a nested composite
+	// ignores every field of it.
+	Ignore []string
+
+	// Tolerance is how far apart a numeric field's values can be and still
+	// be equal.
+	Tolerance map[string]float64
+
+	// TimeTolerance is the same for a timestamp or interval field.
+	TimeTolerance map[string]time.Duration
+}
+
+// Diff compares a and b, a composite's struct or a pointer, Option or slice
+// of one, field by field, and returns the fields that differ in the order of
+// the struct.  It's an error for T to be anything else.
+func Diff[T any](a, b T, rules DiffRules) ([]FieldDiff, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if !diffable(t) {
+		return nil, fmt.Errorf("cannot diff %s, it is not a composite's struct", t)
+	}
+
+	d := differ{rules: rules}
+	d.value("", "", reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem())
+	return d.diffs, nil
+}
+
+// diffable reports whether t is a struct with fields to compare, under any
+// pointers, Options and slices.
+func diffable(t reflect.Type) bool {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+			continue
+		}
+		if option, ok := reflect.Zero(t).Interface().(optionSource); ok {
+			t = option.optionType()
+			continue
+		}
+		return t.Kind() == reflect.Struct && !scalarStruct(t)
+	}
+}
+
+type differ struct {
+	rules DiffRules
+	diffs []FieldDiff
+}
+
+// value compares a and b, the values at path, whose rules are under rule:
+// path without its indexes.
+func (d *differ) value(path, rule string, a, b reflect.Value) {
+	if d.ignored(rule) {
+		return
+	}
+
+	a, aNull := diffUnwrap(a)
+	b, bNull := diffUnwrap(b)
+	if aNull || bNull {
+		if !aNull || !bNull {
+			d.diffs = append(d.diffs, FieldDiff{Field: path, A: diffValue(a, aNull), B: diffValue(b, bNull)})
+		}
+		return
+	}
+
+	if !d.equal(path, rule, a, b) {
+		d.diffs = append(d.diffs, FieldDiff{Field: path, A: a.Interface(), B: b.Interface()})
+	}
+}
+
+// equal compares a and b, which aren't NULL, adding the diffs of their fields
+// and elements itself and reporting them as equal.
+func (d *differ) equal(path, rule string, a, b reflect.Value) bool {
+	t := a.Type()
+	switch {
+	case t == timeType:
+		return within(a.Interface().(time.Time).Sub(b.Interface().(time.Time)), d.rules.TimeTolerance[rule])
+	case t == durationType:
+		return within(time.Duration(a.Int()-b.Int()), d.rules.TimeTolerance[rule])
+	case t == ratType || t == bigIntType:
+		difference := new(big.Rat).Sub(diffRat(a), diffRat(b))
+		tolerance := new(big.Rat).SetFloat64(d.rules.Tolerance[rule])
+		return tolerance != nil && difference.Abs(difference).Cmp(tolerance) <= 0
+	case t.Kind() == reflect.Struct && !scalarStruct(t):
+		for _, f := range exportedFields(t) {
+			name, _ := f.attribute()
+			d.value(joinPath(path, name), joinPath(rule, name), a.FieldByIndex(f.index), b.FieldByIndex(f.index))
+		}
+		return true
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			d.value(fmt.Sprintf("%s[%d]", path, i), rule, a.Index(i), b.Index(i))
+		}
+		return true
+	}
+
+	tolerance := d.rules.Tolerance[rule]
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if tolerance == 0 {
+			return a.Int() == b.Int()
+		}
+		return math.Abs(float64(a.Int())-float64(b.Int())) <= tolerance
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if tolerance == 0 {
+			return a.Uint() == b.Uint()
+		}
+		return math.Abs(float64(a.Uint())-float64(b.Uint())) <= tolerance
+	case reflect.Float32, reflect.Float64:
+		return math.Abs(a.Float()-b.Float()) <= tolerance
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func (d *differ) ignored(rule string) bool {
+	for _, ignore := range d.rules.Ignore {
+		if rule == ignore || strings.HasPrefix(rule, ignore+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// diffUnwrap is v without its pointers and Options, and whether it's NULL on
+// the way, as a nil pointer, None, or a nil slice or map is.
+func diffUnwrap(v reflect.Value) (reflect.Value, bool) {
+	for {
+		if !v.IsValid() {
+			return v, true
+		}
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if v.IsNil() {
+				return v, true
+			}
+			v = v.Elem()
+			continue
+		case reflect.Slice, reflect.Map:
+			return v, v.IsNil()
+		}
+		if option, ok := v.Interface().(optionSource); ok {
+			value, some := option.optionValue()
+			if !some {
+				return v, true
+			}
+			v = reflect.ValueOf(value)
+			continue
+		}
+		return v, false
+	}
+}
+
+// diffValue is what a FieldDiff has of v: nil if it's NULL.
+func diffValue(v reflect.Value, null bool) interface{} {
+	if null {
+		return nil
+	}
+	return v.Interface()
+}
+
+// diffRat is v, a big.Rat or big.Int, as a big.Rat.
+func diffRat(v reflect.Value) *big.Rat {
+	switch n := v.Interface().(type) {
+	case big.Rat:
+		return &n
+	case big.Int:
+		return new(big.Rat).SetInt(&n)
+	}
+	return new(big.Rat)
+}
+
+func within(difference, tolerance time.Duration) bool {
+	if difference < 0 {
+		difference = -difference
+	}
+	return difference <= tolerance
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
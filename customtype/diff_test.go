@@ -0,0 +1,188 @@
+package customtype
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+type diffMonitor struct {
+	Label   string             `pg:"label"`
+	Res     Resolution         `pg:"res"`
+	Native  *ResolutionDTO     `pg:"native"`
+	Modes   []Resolution       `pg:"modes"`
+	Backup  Option[Resolution] `pg:"backup"`
+	Refresh float64            `pg:"refresh"`
+	Price   big.Rat            `pg:"price"`
+	Checked time.Time          `pg:"checked"`
+	Warmup  time.Duration      `pg:"warmup"`
+	Serial  []byte             `pg:"serial"`
+	Skipped int                `pg:"-"`
+}
+
+// TestDiff checks the fields Diff finds differ between two composites, under
+// their attribute paths, and what the rules leave out and let through.
+func TestDiff(t *testing.T) {
+	checked := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	width, height, zero := 1920, 1080, 0
+	base := func() diffMonitor {
+		return diffMonitor{
+			Label:   "crt",
+			Res:     Resolution{Width: 1920, Height: 1080, Scan: 'P'},
+			Native:  &ResolutionDTO{Width: &width, Height: &height},
+			Modes:   []Resolution{{Width: 640, Height: 480, Scan: 'I'}, {Width: 800, Height: 600, Scan: 'P'}},
+			Backup:  Some(Resolution{Width: 1280, Height: 720, Scan: 'P'}),
+			Refresh: 59.94,
+			Price:   *big.NewRat(19999, 100),
+			Checked: checked,
+			Warmup:  2 * time.Second,
+			Serial:  []byte{1, 2, 3},
+		}
+	}
+	changed := func(change func(m *diffMonitor)) diffMonitor {
+		m := base()
+		change(&m)
+		return m
+	}
+
+	tests := []struct {
+		name  string
+		a     *diffMonitor
+		b     diffMonitor
+		rules DiffRules
+		want  []string
+	}{
+		{name: "equal", b: base()},
+		{name: "unexported and pg:\"-\"", b: changed(func(m *diffMonitor) { m.Skipped = 1 })},
+		{name: "field", b: changed(func(m *diffMonitor) { m.Label = "lcd" }), want: []string{"label: crt != lcd"}},
+		{
+			name: "nested fields",
+			b:    changed(func(m *diffMonitor) { m.Res.Height, m.Res.Scan = 1088, 'I' }),
+			want: []string{"res.height: 1080 != 1088", "res.scan: 80 != 73"},
+		},
+		{name: "null field", b: changed(func(m *diffMonitor) { m.Native.Height = nil }), want: []string{"native.height: 1080 != NULL"}},
+		{name: "zero is not null", b: changed(func(m *diffMonitor) { m.Native.Height = &zero }), want: []string{"native.height: 1080 != 0"}},
+		{
+			name: "null composite",
+			a:    ptr(changed(func(m *diffMonitor) { m.Native = &ResolutionDTO{} })),
+			b:    changed(func(m *diffMonitor) { m.Native = nil }),
+			want: []string{"native: {<nil> <nil> <nil>} != NULL"},
+		},
+		{name: "none", b: changed(func(m *diffMonitor) { m.Backup = None[Resolution]() }), want: []string{"backup: [1280, 720] at P != NULL"}},
+		{name: "element", b: changed(func(m *diffMonitor) { m.Modes[1].Width = 1024 }), want: []string{"modes[1].width: 800 != 1024"}},
+		{
+			name: "elements",
+			b:    changed(func(m *diffMonitor) { m.Modes = m.Modes[:1] }),
+			want: []string{"modes: [[640, 480] at I [800, 600] at P] != [[640, 480] at I]"},
+		},
+		{name: "bytes", b: changed(func(m *diffMonitor) { m.Serial = []byte{1, 2, 4} }), want: []string{"serial: [1 2 3] != [1 2 4]"}},
+		{
+			name:  "ignored",
+			b:     changed(func(m *diffMonitor) { m.Label, m.Res.Width, m.Modes[0].Scan = "lcd", 1280, 'P' }),
+			rules: DiffRules{Ignore: []string{"label", "res", "modes.scan"}},
+		},
+		{
+			name:  "ignored prefix only",
+			b:     changed(func(m *diffMonitor) { m.Res.Width = 1280 }),
+			rules: DiffRules{Ignore: []string{"re"}},
+			want:  []string{"res.width: 1920 != 1280"},
+		},
+		{
+			name:  "within tolerance",
+			b:     changed(func(m *diffMonitor) { m.Res.Width, m.Modes[0].Height, m.Refresh = 1921, 479, 60 }),
+			rules: DiffRules{Tolerance: map[string]float64{"res.width": 1, "modes.height": 1, "refresh": 0.1}},
+		},
+		{
+			name:  "beyond tolerance",
+			b:     changed(func(m *diffMonitor) { m.Res.Width, m.Refresh = 1922, 60.1 }),
+			rules: DiffRules{Tolerance: map[string]float64{"res.width": 1, "refresh": 0.1}},
+			want:  []string{"res.width: 1920 != 1922", "refresh: 59.94 != 60.1"},
+		},
+		{
+			name:  "numeric tolerance",
+			b:     changed(func(m *diffMonitor) { m.Price = *big.NewRat(20000, 100) }),
+			rules: DiffRules{Tolerance: map[string]float64{"price": 0.01}},
+		},
+		{
+			name: "numeric",
+			b:    changed(func(m *diffMonitor) { m.Price = *big.NewRat(20000, 100) }),
+			want: []string{"price: 19999/100 != 200/1"},
+		},
+		{
+			name:  "time tolerance",
+			b:     changed(func(m *diffMonitor) { m.Checked, m.Warmup = checked.Add(-time.Second), 2500*time.Millisecond }),
+			rules: DiffRules{TimeTolerance: map[string]time.Duration{"checked": time.Second, "warmup": time.Second}},
+		},
+		{
+			name:  "beyond time tolerance",
+			b:     changed(func(m *diffMonitor) { m.Checked = checked.Add(time.Minute) }),
+			rules: DiffRules{TimeTolerance: map[string]time.Duration{"checked": time.Second}},
+			want:  []string{"checked: 2026-10-14 12:00:00 +0000 UTC != 2026-10-14 12:01:00 +0000 UTC"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := base()
+			if tt.a != nil {
+				a = *tt.a
+			}
+			diffs, err := Diff(a, tt.b, tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(diffs))
+			for i, d := range diffs {
+				got[i] = d.String()
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestDiffTypes checks what Diff takes besides a struct, and that it turns
+// away a T with no composite in it.
+func TestDiffTypes(t *testing.T) {
+	a := Resolution{Width: 1920, Height: 1080, Scan: 'P'}
+	b := Resolution{Width: 1280, Height: 1080, Scan: 'P'}
+
+	check := func(t *testing.T, diffs []FieldDiff, err error, want string) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diffs) != 1 || diffs[0].String() != want {
+			t.Errorf("got %v, want %s", diffs, want)
+		}
+	}
+	t.Run("pointer", func(t *testing.T) {
+		diffs, err := Diff(&a, &b, DiffRules{})
+		check(t, diffs, err, "width: 1920 != 1280")
+	})
+	t.Run("option", func(t *testing.T) {
+		diffs, err := Diff(Some(a), Some(b), DiffRules{})
+		check(t, diffs, err, "width: 1920 != 1280")
+	})
+	t.Run("slice", func(t *testing.T) {
+		diffs, err := Diff([]Resolution{a, a}, []Resolution{a, b}, DiffRules{})
+		check(t, diffs, err, "[1].width: 1920 != 1280")
+	})
+	t.Run("not a composite", func(t *testing.T) {
+		for _, err := range []error{
+			func() error { _, err := Diff(1, 2, DiffRules{}); return err }(),
+			func() error { _, err := Diff(time.Time{}, time.Now(), DiffRules{}); return err }(),
+			func() error { _, err := Diff([]string{"a"}, []string{"b"}, DiffRules{}); return err }(),
+		} {
+			if err == nil {
+				t.Error("got no error")
+			}
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package customtype
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgtype"
+)
+
+// DomainDefinition describes a domain, e.g.
+// `create domain positive_int as int check (value > 0)`.  Domains have their
+// own OIDs, so a composite with a positive_int field can't be built until the
+// domain is registered.  The base type is found in the catalog, and the domain
+// is registered with the codec of its base type; the check constraint is left
+// to the server.
+type DomainDefinition struct {
+	Name string
+
+	// BaseType optionally names the domain's base type when it is itself a
+	// custom type (another domain, a composite, ...), so that it is registered
+	// first.  It can be left empty for domains over built in types.
+	BaseType string
+}
+
+// TypeName is the postgres name of the domain.
+func (def DomainDefinition) TypeName() string {
+	return def.Name
+}
+
+// dependencies is the base type, if it was given.
+func (def DomainDefinition) dependencies() []string {
+	if def.BaseType == "" {
+		return nil
+	}
+	return []string{def.BaseType}
+}
+
+// register registers the domain, and its array type, with whatever its base
+// type is registered as.
+func (def DomainDefinition) register(ci *pgtype.ConnInfo, oids typeOIDs) error {
+	if oids.baseOID == 0 {
+		return fmt.Errorf("type %s is not a domain", def.Name)
+	}
+
+	dt, ok := ci.DataTypeForOID(oids.baseOID)
+	if !ok {
+		return fmt.Errorf("base type (oid %d) of domain %s: %w", oids.baseOID, def.Name, ErrTypeNotFound)
+	}
+
+	base, ok := pgtype.NewValue(dt.Value).(pgtype.ValueTranscoder)
+	if !ok {
+		return fmt.Errorf("base type %s of domain %s does not implement ValueTranscoder", dt.Name, def.Name)
+	}
+
+	registerDataType(ci, def.Name, &domainValue{ValueTranscoder: base, typeName: def.Name}, oids)
+	return nil
+}
+
+// domainValue gives a value of the base type the domain's name.  Registering
+// the base type's value as is would also let the ConnInfo pick the domain when
+// it looks for the data type of a plain base type value.
+type domainValue struct {
+	pgtype.ValueTranscoder
+	typeName string
+}
+
+func (dv *domainValue) NewTypeValue() pgtype.Value {
+	return &domainValue{
+		ValueTranscoder: pgtype.NewValue(dv.ValueTranscoder).(pgtype.ValueTranscoder),
+		typeName:        dv.typeName,
+	}
+}
+
+func (dv *domainValue) TypeName() string {
+	return dv.typeName
+}
+
+// PreferredResultFormat passes on the base type's preference, if it has one.
+func (dv *domainValue) PreferredResultFormat() int16 {
+	if p, ok := dv.ValueTranscoder.(pgtype.ResultFormatPreferrer); ok {
+		return p.PreferredResultFormat()
+	}
+	return pgtype.BinaryFormatCode
+}
+
+// PreferredParamFormat passes on the base type's preference, if it has one.
+func (dv *domainValue) PreferredParamFormat() int16 {
+	if p, ok := dv.ValueTranscoder.(pgtype.ParamFormatPreferrer); ok {
+		return p.PreferredParamFormat()
+	}
+	return pgtype.BinaryFormatCode
+}
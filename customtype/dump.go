@@ -0,0 +1,222 @@
+package customtype
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgtype"
+)
+
+// A composite that fails to decode says which field failed, but not what the
+// server sent instead, and the usual culprits, fields in another order or of
+// another type than the definition says, are plain to see in the bytes.
+// DumpValue writes them out a field at a time, against the definition.
+
+// dumpBytes is how many bytes of a value DumpValue writes in hex before
+// cutting it short.
+const dumpBytes = 32
+
+// DumpValue writes src, a value of the type oid in format as the server sent
+// it, to w, as RawValues gives it.  A composite registered on ci is written a
+// field at a time: its name and type in the definition, the OID the server
+// sent in the binary format where it isn't the definition's, the field's
+// length and bytes, and its value decoded, or why it failed to decode.
+// Nested composites, and the elements of composite arrays in the binary
+// format, are written the same way below their field.  Any other value is
+// written on a line of its own.
+func DumpValue(w io.Writer, ci *pgtype.ConnInfo, oid uint32, format int16, src []byte) error {
+	d := dumper{w: w, ci: ci}
+	d.value(0, "", oid, format, src)
+	return d.err
+}
+
+// dumper writes a value and what's in it, keeping the first error writing.
+type dumper struct {
+	w   io.Writer
+	ci  *pgtype.ConnInfo
+	err error
+}
+
+func (d *dumper) printf(depth int, format string, args ...interface{}) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, strings.Repeat("  ", depth)+format+"\n", args...)
+	}
+}
+
+// typeName names the type oid, with its OID.
+func (d *dumper) typeName(oid uint32) string {
+	if dt, ok := d.ci.DataTypeForOID(oid); ok {
+		return fmt.Sprintf("%s (oid %d)", dt.Name, oid)
+	}
+	return fmt.Sprintf("oid %d", oid)
+}
+
+// value writes src after label, and the fields or elements in it below.
+func (d *dumper) value(depth int, label string, oid uint32, format int16, src []byte) {
+	if src == nil {
+		d.printf(depth, "%s%s, null", label, d.typeName(oid))
+		return
+	}
+
+	if dt, ok := d.ci.DataTypeForOID(oid); ok {
+		switch value := dt.Value.(type) {
+		case *compositeValue:
+			d.printf(depth, "%s%s, %s", label, d.typeName(oid), dumpRaw(format, src))
+			if format == pgtype.BinaryFormatCode {
+				d.binaryFields(depth+1, value, src)
+			} else {
+				d.textFields(depth+1, value, src)
+			}
+			return
+		case arrayType:
+			if format == pgtype.BinaryFormatCode {
+				d.printf(depth, "%s%s, %s", label, d.typeName(oid), dumpRaw(format, src))
+				d.binaryElements(depth+1, src)
+				return
+			}
+		}
+	}
+
+	d.printf(depth, "%s%s, %s: %s", label, d.typeName(oid), dumpRaw(format, src), d.decoded(oid, format, src))
+}
+
+// binaryFields writes the fields of a composite in the binary format.
+func (d *dumper) binaryFields(depth int, cv *compositeValue, src []byte) {
+	s := newCompositeBinaryScanner(src)
+	if err := s.Err(); err != nil {
+		d.printf(depth, "failed to read: %v", err)
+		return
+	}
+	if s.FieldCount() != len(cv.fields) {
+		d.printf(depth, "the server sent %d fields, the definition has %d", s.FieldCount(), len(cv.fields))
+	}
+
+	for i := 0; s.Next(); i++ {
+		label := fmt.Sprintf("%d. ", i+1)
+		if i < len(cv.fields) {
+			field := cv.fields[i]
+			label = fmt.Sprintf("%d. %s: ", i+1, field.Name)
+			if s.OID() != field.OID {
+				label += fmt.Sprintf("defined as %s, sent as ", d.typeName(field.OID))
+			}
+		}
+		d.value(depth, label, s.OID(), pgtype.BinaryFormatCode, s.Bytes())
+	}
+	if err := s.Err(); err != nil {
+		d.printf(depth, "failed to read: %v", err)
+	}
+}
+
+// textFields writes the fields of a composite in the text format, which
+// doesn't say what type they are, so they're decoded as the definition's.
+func (d *dumper) textFields(depth int, cv *compositeValue, src []byte) {
+	s := newCompositeTextScanner(src)
+	count := 0
+	for ; s.Next(); count++ {
+		if count >= len(cv.fields) {
+			d.printf(depth, "%d. not in the definition, %s", count+1, dumpRaw(pgtype.TextFormatCode, s.Bytes()))
+			continue
+		}
+		field := cv.fields[count]
+		d.value(depth, fmt.Sprintf("%d. %s: ", count+1, field.Name), field.OID, pgtype.TextFormatCode, s.Bytes())
+	}
+	if err := s.Err(); err != nil {
+		d.printf(depth, "failed to read: %v", err)
+		return
+	}
+	if count != len(cv.fields) {
+		d.printf(depth, "the server sent %d fields, the definition has %d", count, len(cv.fields))
+	}
+}
+
+// binaryElements writes the elements of an array in the binary format.
+func (d *dumper) binaryElements(depth int, src []byte) {
+	if err := checkBinaryArray(src); err != nil {
+		d.printf(depth, "failed to read: %v", err)
+		return
+	}
+	var header pgtype.ArrayHeader
+	rp, err := header.DecodeBinary(d.ci, src)
+	if err != nil {
+		d.printf(depth, "failed to read: %v", err)
+		return
+	}
+
+	count := 0
+	if len(header.Dimensions) > 0 {
+		count = 1
+		for _, dim := range header.Dimensions {
+			count *= int(dim.Length)
+		}
+	}
+	elementOID := uint32(header.ElementOID)
+	d.printf(depth, "%d elements of %s in %d dimensions", count, d.typeName(elementOID), len(header.Dimensions))
+
+	// checkBinaryArray has made sure every element is there.
+	for i := 0; i < count; i++ {
+		elemLen := int(int32(binary.BigEndian.Uint32(src[rp:])))
+		rp += 4
+		var elem []byte
+		if elemLen >= 0 {
+			elem = src[rp : rp+elemLen]
+			rp += elemLen
+		}
+		d.value(depth, fmt.Sprintf("[%d] ", i+1), elementOID, pgtype.BinaryFormatCode, elem)
+	}
+}
+
+// decoded is src decoded as the type oid, written as text, or why it
+// couldn't be.
+func (d *dumper) decoded(oid uint32, format int16, src []byte) string {
+	dt, ok := d.ci.DataTypeForOID(oid)
+	if !ok {
+		return "unknown type"
+	}
+	value := pgtype.NewValue(dt.Value)
+
+	var err error
+	if format == pgtype.BinaryFormatCode {
+		decoder, ok := value.(pgtype.BinaryDecoder)
+		if !ok {
+			return fmt.Sprintf("%s has no binary format", dt.Name)
+		}
+		err = decoder.DecodeBinary(d.ci, src)
+	} else {
+		decoder, ok := value.(pgtype.TextDecoder)
+		if !ok {
+			return fmt.Sprintf("%s has no text format", dt.Name)
+		}
+		err = decoder.DecodeText(d.ci, src)
+	}
+	if err != nil {
+		return fmt.Sprintf("failed to decode: %v", err)
+	}
+
+	if encoder, ok := value.(pgtype.TextEncoder); ok {
+		if text, err := encoder.EncodeText(d.ci, nil); err == nil {
+			return fmt.Sprintf("%q", text)
+		}
+	}
+	return fmt.Sprintf("%v", value.Get())
+}
+
+// dumpRaw is src's length and bytes, in hex for the binary format, cut
+// short if there are a lot of them.
+func dumpRaw(format int16, src []byte) string {
+	shown, more := src, ""
+	if len(shown) > dumpBytes {
+		shown, more = shown[:dumpBytes], "..."
+	}
+
+	unit := "bytes"
+	if len(src) == 1 {
+		unit = "byte"
+	}
+	if format == pgtype.BinaryFormatCode {
+		return fmt.Sprintf("binary, %d %s %s%s", len(src), unit, hex.EncodeToString(shown), more)
+	}
+	return fmt.Sprintf("text, %d %s %q%s", len(src), unit, shown, more)
+}
@@ -0,0 +1,225 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// EnumDefinition describes a postgres enum type we want to register with a
+// connection.  Labels are the labels the Go code knows about, and they are
+// checked against the server's labels when the type is first registered.
+//
+// A string-based Go type needs nothing more, as its values are the labels.
+// An iota-based Go type is mapped by position: Labels[i] is the label of the
+// constant with value i.
+type EnumDefinition struct {
+	Name   string
+	Labels []string
+}
+
+// TypeName is the postgres name of the enum.
+func (def EnumDefinition) TypeName() string {
+	return def.Name
+}
+
+// dependencies is empty, an enum doesn't refer to other types.
+func (def EnumDefinition) dependencies() []string {
+	return nil
+}
+
+// register registers the enum type, and its array type, with the ConnInfo.
+func (def EnumDefinition) register(ci *pgtype.ConnInfo, oids typeOIDs) error {
+	etype := pgtype.NewEnumType(def.Name, def.Labels)
+	registerDataType(ci, def.Name, &enumValue{EnumType: etype, labels: def.Labels}, oids)
+	return nil
+}
+
+// enumValue wraps pgtype.EnumType so that integer Go types can be used as
+// well as strings, translating between the integer and the label at that
+// position.
+type enumValue struct {
+	*pgtype.EnumType
+	labels []string
+}
+
+// NewTypeValue makes sure copies made by the ConnInfo keep the wrapper.
+func (ev *enumValue) NewTypeValue() pgtype.Value {
+	return &enumValue{EnumType: ev.EnumType.NewTypeValue().(*pgtype.EnumType), labels: ev.labels}
+}
+
+// Set accepts an integer as the position of a label, anything else is passed
+// on unchanged.
+func (ev *enumValue) Set(src interface{}) error {
+	v := reflect.ValueOf(src)
+	if !isInteger(v.Kind()) {
+		return ev.EnumType.Set(src)
+	}
+
+	i := integerValue(v)
+	if i < 0 || i >= int64(len(ev.labels)) {
+		return fmt.Errorf("%d is not a valid value for enum %s", i, ev.TypeName())
+	}
+	return ev.EnumType.Set(ev.labels[i])
+}
+
+// AssignTo assigns the position of the label to integer destinations,
+// anything else is passed on unchanged.
+func (ev *enumValue) AssignTo(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ev.EnumType.AssignTo(dst)
+	}
+
+	elem := v.Elem()
+	label, present := ev.Get().(string)
+
+	// A pointer to a pointer to an integer is set to nil for a null, and
+	// allocated otherwise.
+	if elem.Kind() == reflect.Ptr && isInteger(elem.Type().Elem().Kind()) {
+		if !present {
+			elem.Set(reflect.Zero(elem.Type()))
+			return nil
+		}
+		elem.Set(reflect.New(elem.Type().Elem()))
+		return ev.AssignTo(elem.Interface())
+	}
+
+	if !isInteger(elem.Kind()) {
+		return ev.EnumType.AssignTo(dst)
+	}
+
+	if !present {
+		return pgtype.NullAssignTo(dst)
+	}
+
+	for i, l := range ev.labels {
+		if l == label {
+			if isUnsigned(elem.Kind()) {
+				elem.SetUint(uint64(i))
+			} else {
+				elem.SetInt(int64(i))
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("label %s of enum %s has no Go value", label, ev.TypeName())
+}
+
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return isUnsigned(k)
+}
+
+func isUnsigned(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func integerValue(v reflect.Value) int64 {
+	if isUnsigned(v.Kind()) {
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+// verifyEnums checks that the labels of every enum definition match the
+// server's labels, in one query for all of them.  A label missing on either
+// side is an error: a Go constant the server doesn't know can't be stored,
+// and a server label Go doesn't know can't be scanned.
+func (r *TypeRegistry) verifyEnums(ctx context.Context, conn *pgx.Conn, types *typeSet, oids map[string]typeOIDs) error {
+	drift, err := r.enumDrift(ctx, conn, types, oids)
+	if err != nil {
+		return err
+	}
+	if len(drift) > 0 {
+		problems := make([]string, len(drift))
+		for i, d := range drift {
+			problems[i] = d.String()
+		}
+		return fmt.Errorf("enum labels don't match: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// enumDrift finds the labels missing on either side for every enum
+// definition, sorted by type.
+func (r *TypeRegistry) enumDrift(ctx context.Context, conn *pgx.Conn, types *typeSet, oids map[string]typeOIDs) ([]Drift, error) {
+	enums := make(map[uint32]EnumDefinition)
+	for _, def := range types.definitions {
+		if enum, ok := def.(EnumDefinition); ok {
+			if o, ok := oids[enum.Name]; ok {
+				enums[o.oid] = enum
+			}
+		}
+	}
+	if len(enums) == 0 {
+		return nil, nil
+	}
+
+	enumOIDs := make([]uint32, 0, len(enums))
+	for oid := range enums {
+		enumOIDs = append(enumOIDs, oid)
+	}
+
+	rows, err := conn.Query(ctx,
+		"select enumtypid, enumlabel from pg_enum where enumtypid = any($1) order by enumtypid, enumsortorder",
+		enumOIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up enum labels: %w", err)
+	}
+	defer rows.Close()
+
+	serverLabels := make(map[uint32][]string, len(enums))
+	for rows.Next() {
+		var oid uint32
+		var label string
+		if err := rows.Scan(&oid, &label); err != nil {
+			return nil, fmt.Errorf("failed to scan enum labels: %w", err)
+		}
+		serverLabels[oid] = append(serverLabels[oid], label)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up enum labels: %w", err)
+	}
+
+	var drift []Drift
+	for oid, enum := range enums {
+		if missing := difference(enum.Labels, serverLabels[oid]); len(missing) > 0 {
+			drift = append(drift, Drift{Type: enum.Name, Problem: fmt.Sprintf("is missing labels %s on the server", strings.Join(missing, ", "))})
+		}
+		if unknown := difference(serverLabels[oid], enum.Labels); len(unknown) > 0 {
+			drift = append(drift, Drift{Type: enum.Name, Problem: fmt.Sprintf("has labels %s unknown to Go", strings.Join(unknown, ", "))})
+		}
+	}
+	sortDrift(drift)
+
+	return drift, nil
+}
+
+// difference returns the strings in a that are not in b.
+func difference(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+	}
+
+	var result []string
+	for _, s := range a {
+		if !inB[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
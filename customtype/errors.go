@@ -0,0 +1,33 @@
+package customtype
+
+import "errors"
+
+// A few failures are worth telling apart from the others: a type that isn't
+// there, an OID that isn't the one we registered, a NULL where a composite
+// can't be one, and a composite with more or fewer fields than the struct it
+// goes into.  The errors of those wrap one of these, so a caller can branch
+// with errors.Is rather than match on messages, which say more about what
+// went wrong but are free to change:
+//
+//	if errors.Is(err, customtype.ErrTypeNotFound) {
+//		// the migrations haven't run yet
+//	}
+
+var (
+	// ErrTypeNotFound is a type that isn't in the database, or isn't
+	// registered on the connection.  A *MissingTypesError is one.
+	ErrTypeNotFound = errors.New("type not found")
+
+	// ErrOIDMismatch is the server sending a field of a type other than
+	// the one registered, usually because the type was recreated since.
+	// IsOIDChange reports it.
+	ErrOIDMismatch = errors.New("oid mismatch")
+
+	// ErrNullComposite is a NULL composite assigned to something that can't
+	// be null, such as a struct rather than a pointer to one or an Option.
+	ErrNullComposite = errors.New("null composite")
+
+	// ErrFieldCountMismatch is a composite, record or row with a different
+	// number of fields from its definition or the struct it goes into.
+	ErrFieldCountMismatch = errors.New("field count mismatch")
+)
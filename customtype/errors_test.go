@@ -0,0 +1,100 @@
+package customtype
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgtype"
+)
+
+// TestSentinelErrors checks that the failures worth telling apart wrap their
+// sentinel, from each place that can fail with one without a database.
+func TestSentinelErrors(t *testing.T) {
+	// composite is the binary of a composite with a field per pair of an
+	// OID and its bytes.
+	composite := func(fields ...interface{}) []byte {
+		buf := binary.BigEndian.AppendUint32(nil, uint32(len(fields)/2))
+		for i := 0; i < len(fields); i += 2 {
+			data := fields[i+1].([]byte)
+			buf = binary.BigEndian.AppendUint32(buf, fields[i].(uint32))
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+			buf = append(buf, data...)
+		}
+		return buf
+	}
+	int4 := func(n uint32) []byte { return binary.BigEndian.AppendUint32(nil, n) }
+
+	registry, err := NewTypeRegistry(Definitions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake, err := NewFake(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.On("SELECT id, res FROM foo").Column("id", "int4").Column("res", "resolution").Row(1, Resolution{Width: 640, Height: 480, Scan: 'P'})
+
+	tests := []struct {
+		name string
+		err  func() error
+		want error
+	}{
+		{"unknown field type", func() error {
+			def := CompositeDefinition{Name: "screen", Fields: []CompositeField{{Name: "panel", Type: "no_such_type"}}}
+			return def.register(pgtype.NewConnInfo(), typeOIDs{oid: 16101, arrayOID: 16100})
+		}, ErrTypeNotFound},
+		{"unknown subtype", func() error {
+			def := RangeDefinition{Name: "widthrange", Subtype: "no_such_type"}
+			return def.register(pgtype.NewConnInfo(), typeOIDs{oid: 16103, arrayOID: 16102})
+		}, ErrTypeNotFound},
+		{"missing types", func() error {
+			return &MissingTypesError{Types: []string{"resolution"}}
+		}, ErrTypeNotFound},
+		{"set from too few values", func() error {
+			return resolutionValue().Set([]interface{}{640, 480})
+		}, ErrFieldCountMismatch},
+		{"decode too few fields", func() error {
+			return resolutionValue().DecodeBinary(pgtype.NewConnInfo(), composite(uint32(pgtype.Int4OID), int4(640)))
+		}, ErrFieldCountMismatch},
+		{"assign to too few fields", func() error {
+			cv := resolutionValue()
+			if err := cv.Set(Resolution{Width: 640, Height: 480, Scan: 'P'}); err != nil {
+				return err
+			}
+			var short struct {
+				Width  int `pg:"width"`
+				Height int `pg:"height"`
+			}
+			return cv.AssignTo(&short)
+		}, ErrFieldCountMismatch},
+		{"scan too few fields", func() error {
+			_, err := QueryAll[struct{ ID int }](context.Background(), fake, "SELECT id, res FROM foo")
+			return err
+		}, ErrFieldCountMismatch},
+		{"field of another oid", func() error {
+			src := composite(uint32(pgtype.TextOID), []byte("hd"), uint32(pgtype.Int4OID), int4(480), uint32(pgtype.BPCharOID), []byte("P"))
+			return resolutionValue().DecodeBinary(pgtype.NewConnInfo(), src)
+		}, ErrOIDMismatch},
+		{"null into a struct", func() error {
+			cv := resolutionValue()
+			if err := cv.DecodeBinary(pgtype.NewConnInfo(), nil); err != nil {
+				return err
+			}
+			return cv.AssignTo(&Resolution{})
+		}, ErrNullComposite},
+		{"null through database/sql", func() error {
+			var res Resolution
+			return SQLResolution(&res).Scan(nil)
+		}, ErrNullComposite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.err(); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want an error wrapping %v", err, tt.want)
+			}
+		})
+	}
+}
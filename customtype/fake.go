@@ -0,0 +1,390 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// Code that only reads and writes through a DB can be unit tested against a
+// Fake, which answers each statement with canned rows, without a database:
+//
+//	fake, err := customtype.NewFake(registry)
+//	...
+//	fake.On("SELECT res FROM foo ORDER BY id").
+//		Column("res", "resolution").
+//		Row(customtype.Resolution{Width: 1920, Height: 1080, Scan: 'P'}).
+//		Row(nil)
+//	fake.On("DELETE FROM foo WHERE id = $1").Affects(1)
+//
+//	res, err := customtype.QueryResolutions(ctx, fake, "SELECT res FROM foo ORDER BY id")
+//
+// The canned values are encoded as the registry's types would be by
+// postgres, with OIDs made up for them, and decoded by the same code a real
+// query is, so what the code under test gets is what it would from the
+// database, nulls and all.  Statements are matched by their SQL, with runs
+// of whitespace taken as one space, and answered the same way however many
+// times they're run.  What the fake can't do is run SQL: it knows nothing of
+// the arguments but what Calls records.
+
+// DB is what the typed query helpers and statements need of a database: a
+// *pgxpool.Pool, *pgx.Conn, pgx.Tx, Tx or Router, or a Fake in unit tests.
+type DB interface {
+	Querier
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// Fake is a DB answering statements with canned results.  It is safe to
+// share between goroutines once its results are set up.
+type Fake struct {
+	ci *pgtype.ConnInfo
+
+	mu      sync.Mutex
+	results map[string]*FakeResult
+	calls   []FakeCall
+}
+
+// FakeCall is a statement the fake was given.
+type FakeCall struct {
+	SQL  string
+	Args []interface{}
+}
+
+// FakeResult is what the fake answers a statement with, built up a column
+// and a row at a time.
+type FakeResult struct {
+	ci      *pgtype.ConnInfo
+	columns []fakeColumn
+	rows    [][]interface{}
+	tag     pgconn.CommandTag
+	err     error
+}
+
+// fakeColumn is a column of a result, with the error of a type the fake
+// doesn't have for the query to fail with.
+type fakeColumn struct {
+	name string
+	dt   *pgtype.DataType
+	err  error
+}
+
+// NewFake makes a fake with the registry's types, and postgres' own.
+func NewFake(registry *TypeRegistry) (*Fake, error) {
+	ci := pgtype.NewConnInfo()
+	registerNetwork(ci)
+	registerTemporal(ci)
+	conv := newConverters(registry.Converters)
+	for i, def := range registry.snapshot().definitions {
+		if composite, ok := def.(CompositeDefinition); ok {
+			composite.converters = conv
+			def = composite
+		}
+		oid := uint32(200000 + 2*i)
+		if err := def.register(ci, typeOIDs{oid: oid, arrayOID: oid + 1}); err != nil {
+			return nil, fmt.Errorf("failed to register %s on the fake: %w", def.TypeName(), err)
+		}
+	}
+	registerRecord(ci)
+
+	// Looking a type up by value builds a map the first time, which
+	// concurrent queries would otherwise race to.
+	ci.DataTypeForValue(nil)
+
+	return &Fake{ci: ci, results: make(map[string]*FakeResult)}, nil
+}
+
+// ConnInfo is the fake's types, for encoding and decoding values as its
+// rows do.
+func (f *Fake) ConnInfo() *pgtype.ConnInfo {
+	return f.ci
+}
+
+// On is the result of sql, replacing any it had.  It has no rows and
+// affects none until it's given them.
+func (f *Fake) On(sql string) *FakeResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := &FakeResult{ci: f.ci, tag: pgconn.CommandTag(commandVerb(sql) + " 0")}
+	f.results[normalizeSQL(sql)] = result
+	return result
+}
+
+// Column adds a column called name of the type called typeName, such as
+// resolution or int4, to the result.
+func (r *FakeResult) Column(name, typeName string) *FakeResult {
+	c := fakeColumn{name: name}
+	if dt, ok := r.ci.DataTypeForName(typeName); ok {
+		c.dt = dt
+	} else {
+		c.err = fmt.Errorf("the fake has no type called %s", typeName)
+	}
+	r.columns = append(r.columns, c)
+	return r
+}
+
+// Row adds a row to the result, with a value for each column, or nil for a
+// null.  A value is anything its column's type can be set to.
+func (r *FakeResult) Row(values ...interface{}) *FakeResult {
+	r.rows = append(r.rows, values)
+	return r.Affects(int64(len(r.rows)))
+}
+
+// Affects makes the result that of a statement affecting n rows.
+func (r *FakeResult) Affects(n int64) *FakeResult {
+	verb := strings.Fields(string(r.tag))[0]
+	if verb == "INSERT" {
+		verb += " 0"
+	}
+	r.tag = pgconn.CommandTag(fmt.Sprintf("%s %d", verb, n))
+	return r
+}
+
+// Fails makes the statement fail with err.
+func (r *FakeResult) Fails(err error) *FakeResult {
+	r.err = err
+	return r
+}
+
+// Calls are the statements the fake has been given, in order.
+func (f *Fake) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// result is the result of sql, noting the call.
+func (f *Fake) result(sql string, args []interface{}) (*FakeResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, FakeCall{SQL: sql, Args: args})
+	result, ok := f.results[normalizeSQL(sql)]
+	if !ok {
+		return nil, fmt.Errorf("the fake has no result for %q", sql)
+	}
+	return result, result.err
+}
+
+// Query answers sql with its rows.
+func (f *Fake) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result, err := f.result(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return f.rows(result)
+}
+
+// QueryRow answers sql with its first row.
+func (f *Fake) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	rows, err := f.Query(ctx, sql, args...)
+	return &fakeRow{rows: rows, err: err}
+}
+
+// Exec answers sql with the rows it affects.
+func (f *Fake) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result, err := f.result(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return result.tag, nil
+}
+
+// rows encodes the result's values, in binary where the type has it.
+func (f *Fake) rows(result *FakeResult) (*fakeRows, error) {
+	rows := &fakeRows{ci: f.ci, tag: result.tag, row: -1}
+	for i := range result.columns {
+		c := &result.columns[i]
+		if c.dt == nil {
+			return nil, c.err
+		}
+		format := int16(pgtype.TextFormatCode)
+		if _, ok := c.dt.Value.(pgtype.BinaryEncoder); ok {
+			if _, ok := c.dt.Value.(pgtype.BinaryDecoder); ok {
+				format = pgtype.BinaryFormatCode
+			}
+		}
+		rows.fields = append(rows.fields, pgproto3.FieldDescription{
+			Name:        []byte(c.name),
+			DataTypeOID: c.dt.OID,
+			Format:      format,
+		})
+	}
+
+	for n, values := range result.rows {
+		if len(values) != len(result.columns) {
+			return nil, fmt.Errorf("row %d of the fake has %d values for %d columns", n, len(values), len(result.columns))
+		}
+		encoded := make([][]byte, len(values))
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			var err error
+			if encoded[i], err = f.encode(result.columns[i].dt, rows.fields[i].Format, v); err != nil {
+				return nil, fmt.Errorf("failed to encode row %d of the fake, column %s: %w", n, result.columns[i].name, err)
+			}
+		}
+		rows.values = append(rows.values, encoded)
+	}
+	return rows, nil
+}
+
+func (f *Fake) encode(dt *pgtype.DataType, format int16, v interface{}) ([]byte, error) {
+	value := pgtype.NewValue(dt.Value)
+	if err := value.Set(v); err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	var err error
+	if format == pgtype.BinaryFormatCode {
+		buf, err = value.(pgtype.BinaryEncoder).EncodeBinary(f.ci, nil)
+	} else if encoder, ok := value.(pgtype.TextEncoder); ok {
+		buf, err = encoder.EncodeText(f.ci, nil)
+	} else {
+		err = fmt.Errorf("%s has no encoding", dt.Name)
+	}
+	if err == nil && buf == nil {
+		// The value was set to null.
+		return nil, nil
+	}
+	return buf, err
+}
+
+// normalizeSQL is sql with runs of whitespace taken as one space.
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// commandVerb is the first word of sql, as a command tag has it.
+func commandVerb(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "SELECT"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// fakeRows are the rows of a result, already encoded.
+type fakeRows struct {
+	ci     *pgtype.ConnInfo
+	fields []pgproto3.FieldDescription
+	values [][][]byte
+	tag    pgconn.CommandTag
+	row    int
+	err    error
+	closed bool
+}
+
+func (rows *fakeRows) Close() {
+	rows.closed = true
+}
+
+func (rows *fakeRows) Err() error {
+	return rows.err
+}
+
+func (rows *fakeRows) CommandTag() pgconn.CommandTag {
+	return rows.tag
+}
+
+func (rows *fakeRows) FieldDescriptions() []pgproto3.FieldDescription {
+	return rows.fields
+}
+
+func (rows *fakeRows) Next() bool {
+	if rows.closed || rows.err != nil {
+		return false
+	}
+	rows.row++
+	if rows.row >= len(rows.values) {
+		rows.closed = true
+		return false
+	}
+	return true
+}
+
+func (rows *fakeRows) Scan(dest ...interface{}) error {
+	if len(dest) != len(rows.fields) {
+		rows.err = fmt.Errorf("number of field descriptions must equal number of destinations, got %d and %d", len(rows.fields), len(dest))
+		return rows.err
+	}
+	for i, dst := range dest {
+		if dst == nil {
+			continue
+		}
+		fd := rows.fields[i]
+		src := rows.values[rows.row][i]
+		if err := rows.ci.PlanScan(fd.DataTypeOID, fd.Format, dst).Scan(rows.ci, fd.DataTypeOID, fd.Format, src, dst); err != nil {
+			rows.err = pgx.ScanArgError{ColumnIndex: i, Err: err}
+			return rows.err
+		}
+	}
+	return nil
+}
+
+func (rows *fakeRows) Values() ([]interface{}, error) {
+	values := make([]interface{}, len(rows.fields))
+	for i, fd := range rows.fields {
+		src := rows.values[rows.row][i]
+		if src == nil {
+			continue
+		}
+		dt, _ := rows.ci.DataTypeForOID(fd.DataTypeOID)
+		value := pgtype.NewValue(dt.Value)
+		var err error
+		if fd.Format == pgtype.BinaryFormatCode {
+			err = value.(pgtype.BinaryDecoder).DecodeBinary(rows.ci, src)
+		} else if decoder, ok := value.(pgtype.TextDecoder); ok {
+			err = decoder.DecodeText(rows.ci, src)
+		} else {
+			err = fmt.Errorf("%s has no decoding", dt.Name)
+		}
+		if err != nil {
+			rows.err = err
+			return nil, err
+		}
+		values[i] = value.Get()
+	}
+	return values, nil
+}
+
+func (rows *fakeRows) RawValues() [][]byte {
+	return rows.values[rows.row]
+}
+
+// fakeRow is the first of a query's rows, as QueryRow gives it.
+type fakeRow struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// pgx asks for a registered composite in the binary format, which is faster
+// to decode and names the type of every field, but only with the extended
+// protocol.  A connection that prefers the simple protocol gets
+// every column in text, as does a registry in PgBouncer mode, and so might a
+// proxy in between that rewrites the format codes.  The text decodes all the
+// same, so nothing says it happened; BinaryResults makes it an error instead.
+
+// TextFormatError is a column of a registered composite, or of an array of
+// one, that came back in the text format from a Querier that BinaryResults
+// wraps.
+type TextFormatError struct {
+	Column string
+	Type   string
+}
+
+func (e *TextFormatError) Error() string {
+	return fmt.Sprintf("column %s of type %s came back in the text format rather than binary", e.Column, e.Type)
+}
+
+// BinaryResults wraps q so that the registry's composites are fetched in the
+// binary format.  Every query is run with the extended protocol, whatever
+// the connection prefers, and fails with a TextFormatError if a column of a
+// composite, or of an array of one, comes back in text all the same.  A
+// registry in PgBouncer mode needs the simple protocol, so there only the
+// check is made, and every query with a composite column fails: wrapping q
+// is how to find out that composites are being fetched in text.
+func (r *TypeRegistry) BinaryResults(q Querier) Querier {
+	return binaryResults{q: q, registry: r}
+}
+
+type binaryResults struct {
+	q        Querier
+	registry *TypeRegistry
+}
+
+func (b binaryResults) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if !b.registry.PgBouncer {
+		args = append([]interface{}{pgx.QuerySimpleProtocol(false)}, args...)
+	}
+
+	rows, err := b.q.Query(ctx, sql, args...)
+	if err != nil {
+		return rows, err
+	}
+	if err := b.registry.checkBinary(rows.FieldDescriptions()); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// checkBinary fails on the first column of a composite that isn't in the
+// binary format.
+func (r *TypeRegistry) checkBinary(fields []pgproto3.FieldDescription) error {
+	for _, fd := range fields {
+		if fd.Format == pgtype.BinaryFormatCode {
+			continue
+		}
+		if name, ok := r.composites.Load(fd.DataTypeOID); ok {
+			return &TextFormatError{Column: string(fd.Name), Type: name.(string)}
+		}
+	}
+	return nil
+}
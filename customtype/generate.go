@@ -0,0 +1,233 @@
+package customtype
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goTypes are the Go types we generate for postgres's own types.  A bpchar is
+// a rune, as in Resolution, since the composites we map use char for a
+// single letter, unless the field's chars key says otherwise.  A numeric is a
+// big.Rat so that it keeps every digit.  An inet is a netip.Addr, as it's
+// usually a host's; one with a netmask needs a netip.Prefix field
+// instead.  An interval is a time.Duration, with its months and days taken as
+// the field's interval key says.
+var goTypes = map[string]string{
+	"bool":        "bool",
+	"int2":        "int16",
+	"int4":        "int32",
+	"int8":        "int64",
+	"float4":      "float32",
+	"float8":      "float64",
+	"text":        "string",
+	"citext":      "string",
+	"varchar":     "string",
+	"name":        "string",
+	"bpchar":      "rune",
+	"char":        "rune",
+	"bytea":       "[]byte",
+	"uuid":        "[16]byte",
+	"numeric":     "big.Rat",
+	"hstore":      "map[string]*string",
+	"date":        "time.Time",
+	"timestamp":   "time.Time",
+	"timestamptz": "time.Time",
+	"interval":    "time.Duration",
+	"inet":        "netip.Addr",
+	"cidr":        "netip.Prefix",
+}
+
+// goTypeImports are the packages of the Go types that need importing.
+var goTypeImports = map[string]string{
+	"time.Time":     "time",
+	"time.Duration": "time",
+	"big.Rat":       "math/big",
+	"netip.Addr":    "net/netip",
+	"netip.Prefix":  "net/netip",
+}
+
+// packagePath and packageName are this package's, for generated code to
+// import it by.
+var (
+	packagePath = reflect.TypeOf(Config{}).PkgPath()
+	packageName = path.Base(packagePath)
+)
+
+// Generate writes the Go code for the types in config, in package pkg.  Each
+// composite gets a struct with pg tags, so that DefinitionFor gives back its
+// definition, and a DTO with a pointer for every field that can be null,
+// both with the JSON methods of MarshalComposite and UnmarshalComposite.
+// Each enum gets a string type and a constant per label.  Domains are the Go
+// type of what they're over, and aren't generated.
+func Generate(pkg string, config *Config) ([]byte, error) {
+	var body bytes.Buffer
+	imports := make(map[string]bool)
+
+	for _, t := range config.Types {
+		def, err := t.definition()
+		if err != nil {
+			return nil, err
+		}
+
+		switch def := def.(type) {
+		case CompositeDefinition:
+			if err := generateComposite(&body, pkg, config, t, def, imports); err != nil {
+				return nil, err
+			}
+		case EnumDefinition:
+			generateEnum(&body, t, def)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by testCustomType generate; DO NOT EDIT.\n\npackage %s\n", pkg)
+	if len(imports) > 0 {
+		paths := make([]string, 0, len(imports))
+		for p := range imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		out.WriteString("\nimport (\n")
+		for _, p := range paths {
+			fmt.Fprintf(&out, "\t%q\n", p)
+		}
+		out.WriteString(")\n")
+	}
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return src, nil
+}
+
+func generateComposite(w *bytes.Buffer, pkg string, config *Config, t TypeConfig, def CompositeDefinition, imports map[string]bool) error {
+	name := t.GoName()
+	runs, err := config.embedRuns(t)
+	if err != nil {
+		return err
+	}
+
+	var fields, dtoFields, nulls []string
+	for i := 0; i < len(t.Fields); i++ {
+		// An embedded composite's fields are its struct, in their place.
+		if len(runs) > 0 && runs[0].start == i {
+			embed, tag := runs[0].embed.GoName(), ""
+			if runs[0].prefix != "" {
+				tag = fmt.Sprintf(" `pg:%s`", strconv.Quote(runs[0].prefix+",flatten"))
+			}
+			fields = append(fields, fmt.Sprintf("\t%s%s\n", embed, tag))
+			dtoFields = append(dtoFields, fmt.Sprintf("\t%sDTO%s\n", embed, tag))
+			nulls = append(nulls, fmt.Sprintf("dto.%sDTO.AllNull()", embed))
+			i += len(runs[0].embed.Fields) - 1
+			runs = runs[1:]
+			continue
+		}
+
+		f := t.Fields[i]
+		goType, dtoType, err := fieldGoTypes(config, f.Type, imports)
+		if err != nil {
+			return fmt.Errorf("cannot generate %s.%s: %w", def.Name, f.Name, err)
+		}
+		tag := f.Name + "," + f.Type
+		switch f.Chars {
+		case "string":
+			goType, dtoType = "string", "*string"
+		case "trimmed":
+			goType, dtoType = "string", "*string"
+			tag += ",trim"
+		}
+		if f.Interval != "" {
+			tag += "," + f.Interval
+		}
+		if f.Location != "" {
+			tag += ",location=" + f.Location
+		}
+		// The tag is quoted, since a type name can have quotes of its own.
+		tag = strconv.Quote(tag)
+		fields = append(fields, fmt.Sprintf("\t%s %s `pg:%s`\n", f.GoName(), goType, tag))
+		dtoFields = append(dtoFields, fmt.Sprintf("\t%s %s `pg:%s`\n", f.GoName(), dtoType, tag))
+		nulls = append(nulls, fmt.Sprintf("dto.%s == nil", f.GoName()))
+	}
+
+	fmt.Fprintf(w, "\n// %s is the postgres composite %s.\ntype %s struct {\n%s}\n", name, def.Name, name, strings.Join(fields, ""))
+	fmt.Fprintf(w, "\n// %sDTO is a %s whose fields may be null.\ntype %sDTO struct {\n%s}\n", name, name, name, strings.Join(dtoFields, ""))
+
+	if len(nulls) == 0 {
+		nulls = []string{"true"}
+	}
+	fmt.Fprintf(w, "\n// AllNull reports whether every field is null.\nfunc (dto %sDTO) AllNull() bool {\n\treturn %s\n}\n",
+		name, strings.Join(nulls, " && "))
+
+	// The JSON methods are this package's, so the generated code imports it
+	// unless it's going in here.
+	qualifier := ""
+	if pkg != packageName {
+		imports[packagePath] = true
+		qualifier = packageName + "."
+	}
+	for _, t := range []string{name, name + "DTO"} {
+		fmt.Fprintf(w, "\n// MarshalJSON writes the null fields as %[2]sDefaultJSONNulls says.\nfunc (v %[1]s) MarshalJSON() ([]byte, error) {\n\treturn %[2]sMarshalComposite(v, %[2]sDefaultJSONNulls)\n}\n", t, qualifier)
+		fmt.Fprintf(w, "\n// UnmarshalJSON sets missing and null fields to their zero value.\nfunc (v *%[1]s) UnmarshalJSON(data []byte) error {\n\treturn %[2]sUnmarshalComposite(data, v)\n}\n", t, qualifier)
+	}
+
+	// GORM's migrations give a field of either, wrapped in a GormComposite,
+	// the column type its GormDataType names.
+	for _, t := range []string{name, name + "DTO"} {
+		fmt.Fprintf(w, "\n// GormDataType is the composite's name, for GORM's migrations.\nfunc (%s) GormDataType() string {\n\treturn %q\n}\n", t, def.Name)
+	}
+	return nil
+}
+
+func generateEnum(w *bytes.Buffer, t TypeConfig, def EnumDefinition) {
+	name := t.GoName()
+	fmt.Fprintf(w, "\n// %s is the postgres enum %s.\ntype %s string\n\nconst (\n", name, def.Name, name)
+	for _, label := range def.Labels {
+		fmt.Fprintf(w, "\t%s%s %s = %q\n", name, goIdentifier(label), name, label)
+	}
+	w.WriteString(")\n")
+}
+
+// fieldGoTypes are the Go types of a field of type pgType, in the struct and
+// in the DTO.  Slices and maps can already be nil, so they aren't pointers in
+// the DTO.
+func fieldGoTypes(config *Config, pgType string, imports map[string]bool) (string, string, error) {
+	if elem, ok := arrayElement(pgType); ok {
+		goType, dtoType, err := fieldGoTypes(config, elem, imports)
+		if err != nil {
+			return "", "", err
+		}
+		return "[]" + goType, "[]" + dtoType, nil
+	}
+
+	if t, ok := config.Type(pgType); ok {
+		switch {
+		case len(t.Fields) > 0:
+			return t.GoName(), "*" + t.GoName() + "DTO", nil
+		case len(t.Enum) > 0:
+			return t.GoName(), "*" + t.GoName(), nil
+		case t.Domain != "":
+			return fieldGoTypes(config, t.Domain, imports)
+		}
+		return "", "", fmt.Errorf("there is no Go type for %s", pgType)
+	}
+
+	goType, ok := goTypes[pgType]
+	if !ok {
+		return "", "", fmt.Errorf("there is no Go type for %s", pgType)
+	}
+	if path, ok := goTypeImports[goType]; ok {
+		imports[path] = true
+	}
+	if strings.HasPrefix(goType, "[]") || strings.HasPrefix(goType, "map[") {
+		return goType, goType, nil
+	}
+	return goType, "*" + goType, nil
+}
@@ -0,0 +1,196 @@
+package customtype
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with what the generator writes now")
+
+// TestGenerateGolden generates the code for each catalog in testdata/catalog
+// and compares it with testdata/generate.  After a change to the generator,
+// go test -run TestGenerateGolden -update rewrites the golden files, and
+// their diff is the change to review.  testCustomType describe -catalog
+// captures a new catalog from a database.
+func TestGenerateGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "catalog", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no catalogs in testdata/catalog")
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var catalog Catalog
+			if err := json.Unmarshal(data, &catalog); err != nil {
+				t.Fatal(err)
+			}
+			defs, err := catalog.Definitions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Generate("models", ConfigFor(defs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "generate", name+".go.golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run with -update to create it", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("generated code differs from %s, run with -update and review the diff:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// TestGenerateDeterministic checks that the order of a catalog's rows makes
+// no difference to the code.
+func TestGenerateDeterministic(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "catalog", "schemas.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		t.Fatal(err)
+	}
+
+	generate := func() string {
+		defs, err := catalog.Definitions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := Generate("models", ConfigFor(defs...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(src)
+	}
+
+	want := generate()
+	reverse(catalog.Types)
+	reverse(catalog.Attributes)
+	reverse(catalog.Enums)
+	if got := generate(); got != want {
+		t.Errorf("reversing the rows changed the code:\n%s", got)
+	}
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// TestGenerateEmbed checks that a composite embeds the struct of another
+// whose fields it has, and that the config catches one it doesn't.
+func TestGenerateEmbed(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+types:
+  - name: resolution
+    fields:
+      - {name: width, type: int4}
+      - {name: height, type: int4}
+      - {name: scan, type: bpchar, on_null: default, default: P}
+  - name: screen
+    embed: [{type: resolution, prefix: res_}]
+    fields:
+      - {name: id, type: int4}
+      - {name: res_width, type: int4}
+      - {name: res_height, type: int4}
+      - {name: res_scan, type: bpchar}
+      - {name: label, type: text}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Generate("models", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\tResolution `pg:\"res_,flatten\"`\n",
+		"\tResolutionDTO `pg:\"res_,flatten\"`\n",
+		"return dto.ID == nil && dto.ResolutionDTO.AllNull() && dto.Label == nil",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("generated code doesn't have %q:\n%s", want, got)
+		}
+	}
+
+	// The embedded field's policy is found by the name it's promoted from.
+	policies, err := config.NullPolicies("screen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := policies.Fields["Scan"]; !ok {
+		t.Errorf("got policies %+v, want one for Scan", policies)
+	}
+
+	config.Types[1].Fields[2].Type = "int8"
+	if _, err := Generate("models", config); err == nil {
+		t.Error("generated a screen whose res_height isn't a resolution's height")
+	}
+}
+
+func TestGenerateChars(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+types:
+  - name: label
+    fields:
+      - {name: scan, type: bpchar}
+      - {name: code, type: bpchar, chars: string}
+      - {name: region, type: bpchar, chars: trimmed, on_null: default, default: X}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Generate("models", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\tScan   rune   `pg:\"scan,bpchar\"`\n",
+		"\tCode   string `pg:\"code,bpchar\"`\n",
+		"\tRegion string `pg:\"region,bpchar,trim\"`\n",
+		"\tRegion *string `pg:\"region,bpchar,trim\"`\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("generated code doesn't have %q:\n%s", want, got)
+		}
+	}
+
+	policies, err := config.NullPolicies("label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy := policies.Fields["Region"]; policy != DefaultValue("X") {
+		t.Errorf("got policy %+v for Region, want the default \"X\"", policy)
+	}
+
+	config.Types[0].Fields[0].Type = "text"
+	config.Types[0].Fields[0].Chars = "string"
+	if _, err := config.Types[0].definition(); err == nil {
+		t.Error("took chars on a text field")
+	}
+}
@@ -0,0 +1,102 @@
+package customtype
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgtype"
+)
+
+// Point, Box and Circle are postgres's geometric types, for composite fields
+// such as those of
+//
+//	create type viewport as (center point, bounds box);
+//
+// A struct of our own with the same fields, say X and Y float64s for a
+// point, works as well, since it converts to these.  They are converted by
+// built in FieldConverters.
+type Point struct {
+	X, Y float64
+}
+
+// Box is a rectangle by two opposite corners.  Postgres keeps the upper right
+// corner first, whichever order they're given in.
+type Box struct {
+	High, Low Point
+}
+
+// Circle is a circle by its center and radius.
+type Circle struct {
+	Center Point
+	Radius float64
+}
+
+type pointConverter struct{}
+
+func (pointConverter) GoType() reflect.Type {
+	return reflect.TypeOf(Point{})
+}
+
+func (pointConverter) ToDatabase(v interface{}) (interface{}, error) {
+	p := v.(Point)
+	return pgtype.Point{P: pgtype.Vec2{X: p.X, Y: p.Y}, Status: pgtype.Present}, nil
+}
+
+func (pointConverter) FromDatabase(src pgtype.Value, dst interface{}) error {
+	p, ok := src.Get().(pgtype.Point)
+	if !ok {
+		return geometryError(src, dst)
+	}
+	*dst.(*Point) = Point{X: p.P.X, Y: p.P.Y}
+	return nil
+}
+
+type boxConverter struct{}
+
+func (boxConverter) GoType() reflect.Type {
+	return reflect.TypeOf(Box{})
+}
+
+func (boxConverter) ToDatabase(v interface{}) (interface{}, error) {
+	b := v.(Box)
+	return pgtype.Box{
+		P:      [2]pgtype.Vec2{{X: b.High.X, Y: b.High.Y}, {X: b.Low.X, Y: b.Low.Y}},
+		Status: pgtype.Present,
+	}, nil
+}
+
+func (boxConverter) FromDatabase(src pgtype.Value, dst interface{}) error {
+	b, ok := src.Get().(pgtype.Box)
+	if !ok {
+		return geometryError(src, dst)
+	}
+	*dst.(*Box) = Box{High: Point{X: b.P[0].X, Y: b.P[0].Y}, Low: Point{X: b.P[1].X, Y: b.P[1].Y}}
+	return nil
+}
+
+type circleConverter struct{}
+
+func (circleConverter) GoType() reflect.Type {
+	return reflect.TypeOf(Circle{})
+}
+
+func (circleConverter) ToDatabase(v interface{}) (interface{}, error) {
+	c := v.(Circle)
+	return pgtype.Circle{P: pgtype.Vec2{X: c.Center.X, Y: c.Center.Y}, R: c.Radius, Status: pgtype.Present}, nil
+}
+
+func (circleConverter) FromDatabase(src pgtype.Value, dst interface{}) error {
+	c, ok := src.Get().(pgtype.Circle)
+	if !ok {
+		return geometryError(src, dst)
+	}
+	*dst.(*Circle) = Circle{Center: Point{X: c.P.X, Y: c.P.Y}, Radius: c.R}
+	return nil
+}
+
+func geometryError(src pgtype.Value, dst interface{}) error {
+	if src.Get() == nil {
+		return fmt.Errorf("cannot assign null to %T", dst)
+	}
+	return fmt.Errorf("cannot assign %T to %T", src.Get(), dst)
+}
@@ -0,0 +1,39 @@
+package customtype
+
+import "reflect"
+
+// GORM maps a model's fields to columns through database/sql, so a composite
+// column is an SQLComposite, which for migrations also names its column type
+// with a GormDataType method:
+//
+//	type Monitor struct {
+//		ID  uint
+//		Res customtype.SQLComposite[customtype.ResolutionDTO]
+//	}
+//
+// db.AutoMigrate(&Monitor{}) then adds a res column of type resolution, which
+// has to exist already; CreateDDL writes it.  GORM needs nothing imported
+// for this, it looks for the methods, and the types Generate writes have a
+// GormDataType method of their own naming their composite.
+
+// gormDataTyper is GORM's GormDataTypeInterface.
+type gormDataTyper interface {
+	GormDataType() string
+}
+
+// GormDataType is the composite's name, which is the column type GORM's
+// migrations give the field.  It's T's GormDataType if it has one, and
+// otherwise T's name in lower case, as DefinitionFor names a nested struct.
+func (c SQLComposite[T]) GormDataType() string {
+	return compositeTypeName(reflect.TypeOf(c.V))
+}
+
+// GormDataType names the composite, which a DTO's name in lower case doesn't.
+func (ResolutionDTO) GormDataType() string {
+	return "resolution"
+}
+
+// GormDataType names the composite, which a DTO's name in lower case doesn't.
+func (DisplayDTO) GormDataType() string {
+	return "display"
+}
@@ -0,0 +1,93 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// HealthError is a health check that reached the database but found the
+// types had changed under the registry.
+type HealthError struct {
+	Drift []Drift
+}
+
+func (e *HealthError) Error() string {
+	problems := make([]string, len(e.Drift))
+	for i, d := range e.Drift {
+		problems[i] = d.String()
+	}
+	return "unhealthy: " + strings.Join(problems, "; ")
+}
+
+// HealthCheck checks that the pool can reach the database, and that every
+// type is still there and as its definition says: with the fields Verify
+// looks for, and with the OID registered on the connections, which a type
+// dropped and created again without a Refresh no longer has.  With the
+// registry's Metadata set, the metadata is checked against the database as
+// well, by MetadataDrift.  Connectivity problems come back as they are, the
+// rest as a *HealthError.
+func (r *TypeRegistry) HealthCheck(ctx context.Context, pool *pgxpool.Pool) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire a connection: %w", err)
+	}
+	defer c.Release()
+
+	conn := c.Conn()
+	if err := conn.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to reach the database: %w", err)
+	}
+
+	drift, err := r.Verify(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	// A lazy connection may not have the types yet, which is fine, but any
+	// it has must have the OIDs the database does.
+	types := r.snapshot()
+	oids, _, err := r.findOIDs(ctx, conn, types)
+	if err != nil {
+		return err
+	}
+	ci := conn.ConnInfo()
+	for _, name := range types.names {
+		o, found := oids[name]
+		dt, registered := ci.DataTypeForName(name)
+		if found && registered && dt.OID != o.oid {
+			drift = append(drift, Drift{
+				Type:    name,
+				Problem: fmt.Sprintf("has oid %d in the database, but %d is registered", o.oid, dt.OID),
+			})
+		}
+	}
+
+	stale, err := r.MetadataDrift(ctx, conn)
+	if err != nil {
+		return err
+	}
+	drift = append(drift, stale...)
+
+	if len(drift) > 0 {
+		sortDrift(drift)
+		return &HealthError{Drift: drift}
+	}
+	return nil
+}
+
+// HealthHandler serves HealthCheck over HTTP, for a readiness probe: 200 when
+// it passes, and 503 with the reason when it doesn't.
+func (r *TypeRegistry) HealthHandler(pool *pgxpool.Pool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := r.HealthCheck(req.Context(), pool); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,92 @@
+package customtype
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgtype"
+)
+
+// HstoreDefinition registers the hstore type, which comes from an extension
+// and so has a different OID in every database.  A registry with a composite
+// that has an hstore field adds it by itself, so it's only needed for an
+// hstore in a schema that isn't on the search path, such as
+// extensions.hstore.
+type HstoreDefinition struct {
+	Name string
+}
+
+// TypeName is the postgres name of the hstore type.
+func (def HstoreDefinition) TypeName() string {
+	return def.Name
+}
+
+// dependencies is empty, hstore doesn't refer to other types.
+func (def HstoreDefinition) dependencies() []string {
+	return nil
+}
+
+// register registers hstore, and its array type, with the ConnInfo.
+func (def HstoreDefinition) register(ci *pgtype.ConnInfo, oids typeOIDs) error {
+	registerDataType(ci, def.Name, &hstoreValue{}, oids)
+	return nil
+}
+
+// hstoreValue is a pgtype.Hstore that can also be set from and assigned to a
+// map[string]*string, where a nil is a null value.  pgtype's only handles a
+// map[string]string, which has no way to hold one.
+type hstoreValue struct {
+	pgtype.Hstore
+}
+
+func (h *hstoreValue) Set(src interface{}) error {
+	switch value := src.(type) {
+	case map[string]*string:
+		if value == nil {
+			h.Hstore = pgtype.Hstore{Status: pgtype.Null}
+			return nil
+		}
+		m := make(map[string]pgtype.Text, len(value))
+		for k, v := range value {
+			if v == nil {
+				m[k] = pgtype.Text{Status: pgtype.Null}
+			} else {
+				m[k] = pgtype.Text{String: *v, Status: pgtype.Present}
+			}
+		}
+		h.Hstore = pgtype.Hstore{Map: m, Status: pgtype.Present}
+		return nil
+	case *map[string]*string:
+		if value == nil {
+			h.Hstore = pgtype.Hstore{Status: pgtype.Null}
+			return nil
+		}
+		return h.Set(*value)
+	}
+	return h.Hstore.Set(src)
+}
+
+func (h *hstoreValue) AssignTo(dst interface{}) error {
+	v, ok := dst.(*map[string]*string)
+	if !ok {
+		return h.Hstore.AssignTo(dst)
+	}
+
+	switch h.Status {
+	case pgtype.Null:
+		*v = nil
+		return nil
+	case pgtype.Undefined:
+		return fmt.Errorf("cannot assign undefined hstore to %T", dst)
+	}
+
+	*v = make(map[string]*string, len(h.Map))
+	for k, text := range h.Map {
+		if text.Status == pgtype.Present {
+			s := text.String
+			(*v)[k] = &s
+		} else {
+			(*v)[k] = nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package customtype
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ScanAll decodes every row into a T of its own, which is what most callers
+// want, but costs an allocation for the row, and one for every pointer field
+// that isn't null, however many rows there are.  A bulk read that only
+// passes each row on, to a file, say, or to sum it up, doesn't need them
+// kept: ScanEach and ForEachInPlace decode every row into the same T, and a
+// pointer already set is assigned to where it points, as encoding/json does,
+// so that once the first rows have set its pointers a row of registered
+// composites decodes without allocating.  The Ts are pooled, so the next
+// read of the same T starts with its pointers set.
+
+// ScanEach calls fn with each row scanned into the same T, in the same way as
+// ScanAll, and closes the rows.  The T, and anything it points to, is only
+// good until fn returns, so fn must copy what it keeps.  It stops at the
+// first error from fn, which is returned as it is.
+func ScanEach[T any](rows pgx.Rows, fn func(*T) error) error {
+	defer rows.Close()
+
+	d := getRowDecoder[T]()
+	defer putRowDecoder(d)
+
+	for row := 0; rows.Next(); row++ {
+		if err := d.scan(rows); err != nil {
+			return &ScanError{Row: row, Err: err}
+		}
+		if err := fn(&d.value); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+
+	return nil
+}
+
+// rowDecoder is a T that rows are scanned into again and again, with the
+// targets for the scan, which point into it, worked out once.
+type rowDecoder[T any] struct {
+	value   T
+	targets []interface{}
+}
+
+// rowDecoders are a sync.Pool of *rowDecoder[T] for each T.
+var rowDecoders sync.Map
+
+func rowDecoderPool[T any]() *sync.Pool {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if pool, ok := rowDecoders.Load(t); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := rowDecoders.LoadOrStore(t, &sync.Pool{
+		New: func() interface{} { return new(rowDecoder[T]) },
+	})
+	return pool.(*sync.Pool)
+}
+
+func getRowDecoder[T any]() *rowDecoder[T] {
+	return rowDecoderPool[T]().Get().(*rowDecoder[T])
+}
+
+func putRowDecoder[T any](d *rowDecoder[T]) {
+	rowDecoderPool[T]().Put(d)
+}
+
+// scan scans the current row into the decoder's T and validates it, as
+// scanRow does.
+func (d *rowDecoder[T]) scan(rows pgx.Rows) error {
+	columns := len(rows.FieldDescriptions())
+	if len(d.targets) != columns {
+		targets, err := d.columnTargets(columns)
+		if err != nil {
+			return err
+		}
+		d.targets = targets
+	}
+
+	if err := rows.Scan(d.targets...); err != nil {
+		return err
+	}
+	return validate(reflect.ValueOf(&d.value).Elem())
+}
+
+// columnTargets are the targets to scan a row of so many columns into the T,
+// the T itself for a single column, and its exported fields in order for
+// more.
+func (d *rowDecoder[T]) columnTargets(columns int) ([]interface{}, error) {
+	if columns == 1 {
+		return []interface{}{&d.value}, nil
+	}
+
+	v := reflect.ValueOf(&d.value).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot scan %d columns into a %s", columns, v.Type())
+	}
+	exported := exportedFields(v.Type())
+	if len(exported) != columns {
+		return nil, fmt.Errorf("cannot scan %d columns into %s with %d exported fields: %w", columns, v.Type(), len(exported), ErrFieldCountMismatch)
+	}
+
+	targets := make([]interface{}, len(exported))
+	for i, field := range exported {
+		targets[i] = v.FieldByIndex(field.index).Addr().Interface()
+	}
+	return targets, nil
+}
@@ -0,0 +1,797 @@
+package customtype_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"testCustomType/customtype"
+	"testCustomType/customtype/conformance"
+	"testCustomType/customtype/pgtest"
+	"testCustomType/customtype/pgwire"
+	"testCustomType/customtype/pgx5"
+)
+
+// TestIntegration registers the types with a real postgres and runs the
+// demo's queries, checking what they decode into.
+func TestIntegration(t *testing.T) {
+	ctx := context.Background()
+	connString := pgtest.Start(t)
+
+	registry, err := customtype.NewTypeRegistry(customtype.Definitions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := pgtest.Connect(t, connString, registry)
+
+	t.Run("resolutions", func(t *testing.T) {
+		got, err := customtype.QueryResolutions(ctx, pool, "SELECT res FROM foo ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*customtype.Resolution{
+			{Width: 10, Height: 10, Scan: 'P'},
+			nil,
+			{Width: -10, Height: 10, Scan: 'P'},
+			{Width: 10, Height: 10, Scan: 'P'},
+			{Width: 0, Height: 0, Scan: 'P'},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("array", func(t *testing.T) {
+		var all []customtype.Option[customtype.ResolutionDTO]
+		if err := pool.QueryRow(ctx, "SELECT array_agg(res ORDER BY id) FROM foo").Scan(&all); err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 5 {
+			t.Fatalf("got %d resolutions, want 5", len(all))
+		}
+		if all[1].IsSome() {
+			t.Errorf("resolution 1 is %v, want none", all[1])
+		}
+		if !all[4].IsSome() || !all[4].Unwrap().AllNull() {
+			t.Errorf("resolution 4 is %v, want only null fields", all[4])
+		}
+	})
+
+	t.Run("parameter", func(t *testing.T) {
+		progressive := customtype.Resolution{Width: 10, Height: 10, Scan: 'P'}
+		id, err := customtype.QueryOne[int](ctx, pool, "SELECT id FROM foo WHERE res = $1 ORDER BY id LIMIT 1", progressive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 1 {
+			t.Errorf("got row %d, want 1", id)
+		}
+	})
+
+	t.Run("any", func(t *testing.T) {
+		progressive := customtype.Resolution{Width: 10, Height: 10, Scan: 'P'}
+		negative := customtype.Resolution{Width: -10, Height: 10, Scan: 'P'}
+		for _, tc := range []struct {
+			name string
+			arg  interface{}
+			want []int
+		}{
+			{"resolutions", []customtype.Resolution{progressive, negative}, []int{1, 3}},
+			{"null element", []*customtype.Resolution{nil, &negative}, []int{3}},
+			{"empty", []customtype.Resolution{}, nil},
+		} {
+			got, err := customtype.QueryAll[int](ctx, pool, "SELECT id FROM foo WHERE res = ANY($1) ORDER BY id", tc.arg)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: got rows %v, want %v", tc.name, got, tc.want)
+			}
+		}
+
+		dims, err := customtype.QueryOne[string](ctx, pool, "SELECT array_dims($1::resolution[])", [][]customtype.Resolution{{progressive}, {negative}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dims != "[1:2][1:1]" {
+			t.Errorf("got dimensions %s, want [1:2][1:1]", dims)
+		}
+	})
+
+	t.Run("projection", func(t *testing.T) {
+		type size struct {
+			Width  int `pg:"width"`
+			Height int `pg:"height"`
+		}
+		sizes, err := customtype.Project[size]("res").Query(ctx, pool, customtype.NullPolicies{}, "FROM foo ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantSizes := []size{{10, 10}, {0, 0}, {-10, 10}, {10, 10}, {0, 0}}
+		if !reflect.DeepEqual(sizes, wantSizes) {
+			t.Errorf("got %v, want %v", sizes, wantSizes)
+		}
+
+		disp, err := customtype.Project[customtype.Display]("disp").Query(ctx, pool, customtype.DefaultDisplayPolicies(), "FROM bar ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantDisp := []customtype.Display{
+			{Res: customtype.Resolution{Width: 1920, Height: 1080, Scan: 'P'}, Label: "HD"},
+			{Res: customtype.Resolution{Scan: 'P'}, Label: "unknown"},
+		}
+		if !reflect.DeepEqual(disp, wantDisp) {
+			t.Errorf("got %v, want %v", disp, wantDisp)
+		}
+	})
+
+	t.Run("network", func(t *testing.T) {
+		type host struct {
+			Name  string       `pg:"name,citext"`
+			Addr  netip.Addr   `pg:"addr,inet"`
+			Net   netip.Prefix `pg:"net,cidr"`
+			Peers []netip.Addr `pg:"peers"`
+		}
+		def, err := customtype.DefinitionFor("host", host{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts, err := customtype.NewTypeRegistry(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts.CreateMissing = true
+		hostPool := pgtest.Connect(t, connString, hosts)
+
+		want := host{
+			Name:  "Web",
+			Addr:  netip.MustParseAddr("10.0.0.5"),
+			Net:   netip.MustParsePrefix("10.0.0.0/24"),
+			Peers: []netip.Addr{netip.MustParseAddr("10.0.0.6"), netip.MustParseAddr("::1")},
+		}
+		got, err := customtype.QueryOne[host](ctx, hostPool, "SELECT $1::host", want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		same, err := customtype.QueryOne[bool](ctx, hostPool, "SELECT ($1::host).name = 'WEB'", want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !same {
+			t.Error("citext compared with case")
+		}
+	})
+
+	t.Run("temporal", func(t *testing.T) {
+		type job struct {
+			Timeout time.Duration   `pg:"timeout,interval,exact"`
+			Every   time.Duration   `pg:"every,interval,days"`
+			Keep    time.Duration   `pg:"keep,interval"`
+			Backoff []time.Duration `pg:"backoff,_interval"`
+			NextRun time.Time       `pg:"next_run,timestamptz,location=UTC"`
+		}
+		def, err := customtype.DefinitionFor("job", job{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := customtype.NewTypeRegistry(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs.CreateMissing = true
+		jobPool := pgtest.Connect(t, connString, jobs)
+
+		got, err := customtype.QueryOne[job](ctx, jobPool,
+			`SELECT ROW('5 seconds', '1 day 2 hours', '1 mon', '{1s,2s}', '2024-01-02 03:04:05+02')::job`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := job{
+			Timeout: 5 * time.Second,
+			Every:   26 * time.Hour,
+			Keep:    30 * 24 * time.Hour,
+			Backoff: []time.Duration{time.Second, 2 * time.Second},
+			NextRun: time.Date(2024, 1, 2, 1, 4, 5, 0, time.UTC),
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+
+		if _, err := customtype.QueryOne[job](ctx, jobPool, `SELECT ROW('1 day', '1 day', '0', '{}', now())::job`); err == nil {
+			t.Error("an exact field took a day")
+		}
+		if _, err := customtype.QueryOne[job](ctx, jobPool, `SELECT ROW('0', '1 day', '1000 years', '{}', now())::job`); err == nil {
+			t.Error("a thousand years fit in a time.Duration")
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		rows, err := pool.Query(ctx, "SELECT res FROM foo WHERE (res).scan IS NOT NULL ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid, err := customtype.ScanAllValid[customtype.CheckedResolution](rows, customtype.SkipInvalid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []customtype.CheckedResolution{{Width: 10, Height: 10, Scan: 'P'}}
+		if !reflect.DeepEqual(valid, want) {
+			t.Errorf("got %v, want %v", valid, want)
+		}
+
+		// A plain Resolution isn't validated, so nothing is left out.
+		all, err := customtype.QueryAll[customtype.Resolution](ctx, pool, "SELECT res FROM foo WHERE (res).scan IS NOT NULL ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 2 {
+			t.Errorf("got %v, want the negative width as well", all)
+		}
+	})
+
+	t.Run("rows", func(t *testing.T) {
+		foos, err := customtype.QueryAll[customtype.Foo](ctx, pool, "SELECT foo FROM foo ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(foos) != 5 {
+			t.Fatalf("got %d rows, want 5", len(foos))
+		}
+		if foos[1].ID != 2 || foos[1].Res.IsSome() {
+			t.Errorf("row 2 is %+v, want no resolution", foos[1])
+		}
+		if got := foos[0].Res.Unwrap().AsResolution(); got != (customtype.Resolution{Width: 10, Height: 10, Scan: 'P'}) {
+			t.Errorf("row 1 has %v", got)
+		}
+	})
+
+	t.Run("columns", func(t *testing.T) {
+		type row struct {
+			ID     int
+			Width  int
+			RowRes *customtype.ResolutionDTO `pg:"res"`
+		}
+		rows, err := pool.Query(ctx, "SELECT id, (res).width, res FROM foo ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := customtype.CollectStructs[row](rows, customtype.NullPolicies{
+			Fields: map[string]customtype.NullPolicy{"Width": customtype.DefaultValue(-1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 5 || got[1].ID != 2 || got[1].Width != -1 || got[1].RowRes != nil {
+			t.Errorf("got %+v, want row 2 with the default width and no resolution", got)
+		}
+	})
+
+	t.Run("function", func(t *testing.T) {
+		wide, err := customtype.CallFunc[customtype.ResolutionDTO](ctx, pool, "wider_than", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wide) != 2 {
+			t.Errorf("got %d resolutions wider than 5, want 2", len(wide))
+		}
+
+		exploded, err := customtype.CallFuncColumns[customtype.ResolutionDTO](ctx, pool, "wider_than", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(exploded) != 2 || exploded[0].Width == nil || *exploded[0].Width != 10 {
+			t.Errorf("got %+v selecting from wider_than, want the 2 resolutions 10 wide", exploded)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		q := registry.BinaryResults(pool)
+		if _, err := customtype.QueryAll[customtype.Foo](ctx, q, "SELECT foo FROM foo"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Asking for the simple protocol after BinaryResults has asked for
+		// the extended one gets the composites in text.
+		_, err := customtype.QueryAll[customtype.Foo](ctx, q, "SELECT foo FROM foo", pgx.QuerySimpleProtocol(true))
+		var textFormat *customtype.TextFormatError
+		if !errors.As(err, &textFormat) {
+			t.Fatalf("got %v, want a TextFormatError", err)
+		}
+	})
+
+	t.Run("displays", func(t *testing.T) {
+		got, err := customtype.QueryDisplays(ctx, pool, "SELECT disp FROM bar ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*customtype.Display{
+			{Res: customtype.Resolution{Width: 1920, Height: 1080, Scan: 'P'}, Label: "HD"},
+			{Res: customtype.Resolution{Scan: 'P'}, Label: "unknown"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		got, err := customtype.QueryAll[customtype.Foo](ctx, pool, "SELECT foo FROM foo WHERE id IN (1, 3, 4) ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		width, height, scan := 10, 10, 'P'
+		res := customtype.ResolutionDTO{Width: &width, Height: &height, Scan: &scan}
+		want := []customtype.Foo{{ID: 1, Res: customtype.Some(res)}, {ID: 3, Res: customtype.Some(res)}, {ID: 4, Res: customtype.Some(res)}}
+
+		diffs, err := customtype.Diff(want, got, customtype.DiffRules{Ignore: []string{"res.scan"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantDiffs := []customtype.FieldDiff{{Field: "[1].res.width", A: 10, B: -10}}; !reflect.DeepEqual(diffs, wantDiffs) {
+			t.Errorf("got %v, want %v", diffs, wantDiffs)
+		}
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		// The rows are upserted in a transaction we roll back, so that foo is
+		// as it was for the others.
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback(ctx)
+
+		type fooRow struct {
+			ID  int
+			Res customtype.Resolution
+		}
+		rows := []fooRow{
+			{ID: 1, Res: customtype.Resolution{Width: 20, Height: 20, Scan: 'I'}},
+			{ID: 100, Res: customtype.Resolution{Width: 30, Height: 30, Scan: 'P'}},
+		}
+		n, err := customtype.UpsertAll(ctx, tx, pgx.Identifier{"foo"}, []string{"id", "res"}, []string{"id"}, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("upserted %d rows, want 2", n)
+		}
+		got, err := customtype.QueryAll[customtype.Resolution](ctx, tx, "SELECT res FROM foo WHERE id IN (1, 100) ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []customtype.Resolution{rows[0].Res, rows[1].Res}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("serve", func(t *testing.T) {
+		// As with upsert, what's posted goes in a transaction we roll back.
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback(ctx)
+
+		srv := httptest.NewServer(customtype.FooHandler(tx, customtype.DefaultResolutionPolicies()))
+		defer srv.Close()
+
+		do := func(method, path, body string, want int) []byte {
+			t.Helper()
+			req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var got json.RawMessage
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != want {
+				t.Fatalf("%s %s: got %d %s, want %d", method, path, resp.StatusCode, got, want)
+			}
+			return got
+		}
+
+		var foos []customtype.Foo
+		if err := json.Unmarshal(do("GET", "/foos", "", http.StatusOK), &foos); err != nil {
+			t.Fatal(err)
+		}
+		if len(foos) != 5 || foos[1].Res.IsSome() {
+			t.Errorf("got %v, want the five rows with the second's resolution null", foos)
+		}
+
+		// The missing scan is what the policies make it.
+		var created customtype.Foo
+		if err := json.Unmarshal(do("POST", "/foos", `{"id":6,"res":{"width":640,"height":480}}`, http.StatusCreated), &created); err != nil {
+			t.Fatal(err)
+		}
+		if res := created.Res.Unwrap(); res.Scan == nil || *res.Scan != 'P' {
+			t.Errorf("created %v, want a progressive scan", created)
+		}
+
+		var got customtype.Foo
+		if err := json.Unmarshal(do("GET", "/foos/6", "", http.StatusOK), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, created) {
+			t.Errorf("got %v, want %v", got, created)
+		}
+
+		do("POST", "/foos", `{"id":7}`, http.StatusCreated)
+		do("POST", "/foos", `{"id":8,"res":{"width":-1,"height":1}}`, http.StatusUnprocessableEntity)
+		do("GET", "/foos/99", "", http.StatusNotFound)
+		do("POST", "/foos", `{"id":6}`, http.StatusConflict)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		var b customtype.Batch
+		resolutions := customtype.QueueAll[customtype.Resolution](&b, "SELECT res FROM foo WHERE id = 1")
+		display := customtype.QueueOne[customtype.Display](&b, "SELECT disp FROM bar WHERE id = $1", 1)
+		if err := b.Send(ctx, pool); err != nil {
+			t.Fatal(err)
+		}
+		res, err := resolutions.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []customtype.Resolution{{Width: 10, Height: 10, Scan: 'P'}}; !reflect.DeepEqual(res, want) {
+			t.Errorf("got %v, want %v", res, want)
+		}
+		disp, err := display.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if disp.Label != "HD" {
+			t.Errorf("got display %v, want HD", disp)
+		}
+	})
+
+	t.Run("partitions", func(t *testing.T) {
+		partitions := customtype.SplitRange(1, 6, 3)
+		ids := make(map[int]int)
+		for row := range customtype.QueryPartitions[customtype.Foo](ctx, pool, "SELECT foo FROM foo WHERE id >= $1 AND id < $2", partitions, 2) {
+			if row.Err != nil {
+				t.Fatal(row.Err)
+			}
+			ids[row.Value.ID] = row.Partition
+		}
+		if want := map[int]int{1: 0, 2: 0, 3: 1, 4: 1, 5: 2}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("got the partitions %v, want %v", ids, want)
+		}
+
+		// A partition that fails stops the lot, with its error.
+		var errs int
+		for row := range customtype.QueryPartitions[customtype.Resolution](ctx, pool, "SELECT res FROM foo WHERE id >= $1 AND id < $2 ORDER BY id", partitions, 1) {
+			if row.Err != nil {
+				errs++
+			}
+		}
+		if errs != 1 {
+			t.Errorf("got %d errors, want 1 for the NULL resolution", errs)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		type fooRow struct {
+			ID  int
+			Res customtype.Resolution
+		}
+		res := customtype.Column[customtype.Resolution]("res")
+		id := customtype.Column[int]("id")
+		query := customtype.NewQuery("SELECT id, res FROM foo").WhereNotNull(res)
+		want, err := customtype.QueryAll[fooRow](ctx, pool, "SELECT id, res FROM foo WHERE res IS NOT NULL ORDER BY (res).width DESC, id")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := customtype.NewPaginator[fooRow](query, 2).
+			OrderByDesc(res.Field("Width"), func(r fooRow) interface{} { return r.Res.Width }).
+			OrderBy(id, func(r fooRow) interface{} { return r.ID })
+		var got []fooRow
+		cursor := ""
+		for pages := 0; pages == 0 || cursor != ""; pages++ {
+			if pages > len(want) {
+				t.Fatal("the pages never ended")
+			}
+			page, err := p.Page(ctx, pool, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, page.Rows...)
+			cursor = page.Next
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		pools := customtype.NewPools(registry)
+		main, err := pools.Connect(ctx, "main", connString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pools.Watch("main", customtype.Watcher{Interval: 10 * time.Millisecond}); err != nil {
+			t.Fatal(err)
+		}
+
+		// A connection waiting for a type that will never be created is
+		// given up on when the pools shut down.
+		waiting, err := customtype.NewTypeRegistry(customtype.EnumDefinition{Name: "never_created", Labels: []string{"a"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waiting.Retry = customtype.Retry{Wait: true}
+		lazy := customtype.NewPools(waiting)
+		config, err := pgxpool.ParseConfig(connString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.LazyConnect = true
+		stuck, err := lazy.ConnectConfig(ctx, "stuck", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acquired := make(chan error, 1)
+		go func() {
+			c, err := stuck.Acquire(ctx)
+			if err == nil {
+				c.Release()
+			}
+			acquired <- err
+		}()
+
+		held, err := main.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if err := pools.Shutdown(deadline); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v with a connection in use, want the deadline", err)
+		}
+		held.Release()
+
+		if err := lazy.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-acquired; err == nil {
+			t.Error("a connection without its types was acquired")
+		}
+	})
+
+	t.Run("sentinels", func(t *testing.T) {
+		_, err := customtype.QueryOne[customtype.Resolution](ctx, pool, "SELECT NULL::resolution")
+		if !errors.Is(err, customtype.ErrNullComposite) {
+			t.Errorf("got %v, want an ErrNullComposite", err)
+		}
+
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = customtype.Describe(ctx, c.Conn(), "no_such_type")
+		c.Release()
+		if !errors.Is(err, customtype.ErrTypeNotFound) {
+			t.Errorf("got %v, want an ErrTypeNotFound", err)
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := registry.TakeMetadata(ctx, c.Conn())
+		c.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "types.json")
+		if err := m.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+
+		offline, err := customtype.NewTypeRegistry(customtype.Definitions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offline.Metadata, err = customtype.ReadMetadataFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(offline.Metadata.Types, m.Types) {
+			t.Errorf("read %+v, wrote %+v", offline.Metadata.Types, m.Types)
+		}
+		offlinePool := pgtest.Connect(t, connString, offline)
+		if _, err := customtype.QueryResolutions(ctx, offlinePool, "SELECT res FROM foo ORDER BY id"); err != nil {
+			t.Fatal(err)
+		}
+		if err := offline.HealthCheck(ctx, offlinePool); err != nil {
+			t.Errorf("metadata just taken is stale: %v", err)
+		}
+	})
+
+	t.Run("schemas", func(t *testing.T) {
+		// Two schemas with a resolution of their own, which registries with
+		// different Schemas resolve to different types, through the one
+		// process-wide OID cache.
+		for _, schema := range []string{"billing", "shipping"} {
+			if _, err := pool.Exec(ctx, "CREATE SCHEMA "+schema+"; CREATE TYPE "+schema+".resolution AS (width int, height int, scan char)"); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pool.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE") })
+		}
+
+		oids := make(map[string]uint32)
+		for _, schema := range []string{"billing", "shipping", "billing"} {
+			r, err := customtype.NewTypeRegistry(customtype.CompositeDefinition{
+				Name:   "resolution",
+				Fields: []customtype.CompositeField{{Name: "width", Type: "int4"}, {Name: "height", Type: "int4"}, {Name: "scan", Type: "bpchar"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Schemas = []string{schema}
+			p := pgtest.Connect(t, connString, r)
+
+			var want uint32
+			if err := p.QueryRow(ctx, "SELECT $1::regtype::oid", schema+".resolution").Scan(&want); err != nil {
+				t.Fatal(err)
+			}
+			c, err := p.Acquire(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dt, ok := c.Conn().ConnInfo().DataTypeForName("resolution")
+			c.Release()
+			if !ok || dt.OID != want {
+				t.Errorf("%s: registered %v, want oid %d", schema, dt, want)
+			}
+			oids[schema] = want
+		}
+		if oids["billing"] == oids["shipping"] {
+			t.Errorf("both schemas' resolutions have oid %d", oids["billing"])
+		}
+	})
+
+	t.Run("router", func(t *testing.T) {
+		// The one database stands in for the primary and its replica.
+		router, err := customtype.NewRouter(ctx, registry, connString, connString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer router.Close()
+
+		if _, err := customtype.QueryResolutions(ctx, router, "SELECT res FROM foo ORDER BY id"); err != nil {
+			t.Fatal(err)
+		}
+		err = customtype.BeginFunc(ctx, router, func(tx customtype.Tx) error {
+			_, err := customtype.QueryAll[customtype.Display](ctx, tx, "SELECT disp FROM bar")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("wire", func(t *testing.T) {
+		// The recording and the replay register the types from metadata, so
+		// that neither looks them up, whatever the OID cache has.
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wired, err := customtype.NewTypeRegistry(customtype.Definitions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wired.Metadata, err = registry.TakeMetadata(ctx, c.Conn())
+		c.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(t.TempDir(), "wire.json")
+		queries := func(t *testing.T, config *pgx.ConnConfig) []*customtype.Resolution {
+			conn, err := pgx.ConnectConfig(ctx, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close(ctx)
+			if err := wired.AfterConnect(ctx, conn); err != nil {
+				t.Fatal(err)
+			}
+			res, err := customtype.QueryResolutions(ctx, conn, "SELECT res FROM foo ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}
+
+		var recorded []*customtype.Resolution
+		t.Run("record", func(t *testing.T) { recorded = queries(t, pgwire.Record(t, connString, path)) })
+		t.Run("replay", func(t *testing.T) {
+			if replayed := queries(t, pgwire.Replay(t, path)); !reflect.DeepEqual(replayed, recorded) {
+				t.Errorf("replayed %v, recorded %v", replayed, recorded)
+			}
+		})
+	})
+
+	// Changing the types comes last, since it changes them for the rest.
+	t.Run("conformance", func(t *testing.T) {
+		// The codecs as the connections register them, rather than by hand.
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Release()
+		v5, err := pgx5.Connect(ctx, connString, pgx5.TypeNames(customtype.Definitions...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer v5.Close()
+		c5, err := v5.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c5.Release()
+
+		for _, format := range []conformance.Format{conformance.Binary, conformance.Text} {
+			t.Run("v4 "+format.String(), func(t *testing.T) {
+				conformance.Run(t, conformance.V4(c.Conn().ConnInfo(), format))
+			})
+			t.Run("v5 "+format.String(), func(t *testing.T) {
+				conformance.Run(t, conformance.V5(c5.Conn().TypeMap(), format))
+			})
+		}
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		def, ok := registry.Definition("resolution")
+		if !ok {
+			t.Fatal("the registry has no resolution")
+		}
+		lenient := def.(customtype.CompositeDefinition)
+		lenient.FieldCount = customtype.LenientFieldCount
+		if err := registry.Replace(lenient); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := customtype.QueryResolutions(ctx, pool, "SELECT res FROM foo ORDER BY id"); err != nil {
+			t.Fatalf("after replacing resolution: %v", err)
+		}
+
+		if err := registry.Remove("resolution"); err == nil {
+			t.Error("removed resolution, which display uses")
+		}
+		if err := registry.Remove("display"); err != nil {
+			t.Fatal(err)
+		}
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Release()
+		if _, ok := c.Conn().ConnInfo().DataTypeForName("display"); ok {
+			t.Error("a connection acquired after removing display still has it")
+		}
+	})
+}
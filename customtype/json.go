@@ -0,0 +1,246 @@
+package customtype
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A composite scanned from the database can go straight out of an API as
+// JSON.  The keys are the attribute names, as in the pg tags, and a char
+// attribute held in a rune is a one letter string rather than the number of
+// the rune.
+
+// JSONNulls is how null fields are written in JSON.
+type JSONNulls int
+
+const (
+	// NullsAsNull writes a null field as null.
+	NullsAsNull JSONNulls = iota
+
+	// OmitNulls leaves null fields out.
+	OmitNulls
+)
+
+// DefaultJSONNulls is how the MarshalJSON methods of the types in this
+// package, and of generated ones, write null fields.
+var DefaultJSONNulls = NullsAsNull
+
+// MarshalComposite writes the struct v as a JSON object, with a key per
+// exported field named as in the field's pg tag, and the fields of embedded
+// structs flattened as DefinitionFor flattens them.  A field is null when it is
+// a nil pointer or a None, and is written as nulls says.
+func MarshalComposite(v interface{}, nulls JSONNulls) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return []byte("null"), nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot marshal %T as a composite, it must be a struct", v)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, sf := range exportedFields(rv.Type()) {
+		name, pgType := sf.attribute()
+		value, err := json.Marshal(rv.FieldByIndex(sf.index).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s of %s: %w", name, rv.Type(), err)
+		}
+		if string(value) == "null" && nulls == OmitNulls {
+			continue
+		}
+		if isCharType(pgType) && holdsRune(sf.Type) {
+			value = runeToJSON(value)
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalComposite reads a JSON object written by MarshalComposite into the
+// struct dst points to.  A field that is null or missing is set to its zero
+// value, which is nil for a pointer and None for an Option, and keys that
+// aren't fields are ignored.
+func UnmarshalComposite(data []byte, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot unmarshal a composite into %T, it must be a pointer to a struct", dst)
+	}
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", rv.Elem().Type(), err)
+	}
+
+	v := rv.Elem()
+	for _, sf := range exportedFields(v.Type()) {
+		name, pgType := sf.attribute()
+		field := v.FieldByIndex(sf.index)
+		raw, ok := fields[name]
+		if !ok || string(raw) == "null" {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+
+		if isCharType(pgType) && holdsRune(sf.Type) {
+			var err error
+			if raw, err = runeFromJSON(raw); err != nil {
+				return fmt.Errorf("failed to unmarshal %s of %s: %w", name, v.Type(), err)
+			}
+		}
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("failed to unmarshal %s of %s: %w", name, v.Type(), err)
+		}
+	}
+
+	return nil
+}
+
+func isCharType(pgType string) bool {
+	switch pgType {
+	case "bpchar", "char", "character", `"char"`:
+		return true
+	}
+	return false
+}
+
+// holdsRune reports whether a field of type t holds a rune, or anything else
+// of its kind, rather than a string, directly or through a pointer or an
+// Option.
+func holdsRune(t reflect.Type) bool {
+	for {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+			continue
+		}
+		if option, ok := reflect.Zero(t).Interface().(optionSource); ok {
+			t = option.optionType()
+			continue
+		}
+		return t.Kind() == reflect.Int32
+	}
+}
+
+// runeToJSON turns the number of a rune into a string holding it, with the
+// zero rune being empty.  Anything else is left as it is.
+func runeToJSON(value []byte) []byte {
+	n, err := strconv.ParseInt(string(value), 10, 32)
+	if err != nil {
+		return value
+	}
+	if n == 0 {
+		return []byte(`""`)
+	}
+	s, _ := json.Marshal(string(rune(n)))
+	return s
+}
+
+// runeFromJSON is the reverse of runeToJSON, so that the rune can be decoded
+// into whatever the field holds it in.
+func runeFromJSON(raw json.RawMessage) (json.RawMessage, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		// Not a string, perhaps already a number.
+		return raw, nil
+	}
+
+	switch utf8.RuneCountInString(s) {
+	case 0:
+		return json.RawMessage("0"), nil
+	case 1:
+		r, _ := utf8.DecodeRuneInString(s)
+		return json.RawMessage(strconv.Itoa(int(r))), nil
+	}
+	return nil, fmt.Errorf("%q is not a single character", s)
+}
+
+// MarshalJSON writes the resolution as {"width":1920,"height":1080,"scan":"P"}.
+func (r Resolution) MarshalJSON() ([]byte, error) {
+	return MarshalComposite(r, DefaultJSONNulls)
+}
+
+// UnmarshalJSON reads a resolution as it would be scanned from the database:
+// missing and null fields get DefaultResolutionPolicies.
+func (r *Resolution) UnmarshalJSON(data []byte) error {
+	var rdto ResolutionDTO
+	if err := rdto.UnmarshalJSON(data); err != nil {
+		return err
+	}
+
+	res, err := rdto.AsResolutionWith(DefaultResolutionPolicies())
+	if err != nil {
+		return err
+	}
+	*r = res
+	return nil
+}
+
+// MarshalJSON writes the null fields as DefaultJSONNulls says.
+func (rdto ResolutionDTO) MarshalJSON() ([]byte, error) {
+	return MarshalComposite(rdto, DefaultJSONNulls)
+}
+
+// UnmarshalJSON leaves missing and null fields nil.
+func (rdto *ResolutionDTO) UnmarshalJSON(data []byte) error {
+	return UnmarshalComposite(data, rdto)
+}
+
+// MarshalJSON writes the display with its resolution as an object.
+func (d Display) MarshalJSON() ([]byte, error) {
+	return MarshalComposite(d, DefaultJSONNulls)
+}
+
+// UnmarshalJSON applies DefaultDisplayPolicies in the same way as
+// Resolution.UnmarshalJSON.
+func (d *Display) UnmarshalJSON(data []byte) error {
+	var ddto DisplayDTO
+	if err := ddto.UnmarshalJSON(data); err != nil {
+		return err
+	}
+
+	disp, err := ddto.AsDisplayWith(DefaultDisplayPolicies())
+	if err != nil {
+		return err
+	}
+	*d = disp
+	return nil
+}
+
+// MarshalJSON writes the null fields as DefaultJSONNulls says.
+func (ddto DisplayDTO) MarshalJSON() ([]byte, error) {
+	return MarshalComposite(ddto, DefaultJSONNulls)
+}
+
+// UnmarshalJSON leaves missing and null fields nil.
+func (ddto *DisplayDTO) UnmarshalJSON(data []byte) error {
+	return UnmarshalComposite(data, ddto)
+}
+
+// MarshalJSON writes the row with a null resolution as DefaultJSONNulls says.
+func (f Foo) MarshalJSON() ([]byte, error) {
+	return MarshalComposite(f, DefaultJSONNulls)
+}
+
+// UnmarshalJSON leaves a missing or null resolution None.
+func (f *Foo) UnmarshalJSON(data []byte) error {
+	return UnmarshalComposite(data, f)
+}
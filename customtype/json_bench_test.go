@@ -0,0 +1,107 @@
+package customtype
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jackc/pgtype"
+)
+
+// These compare decoding a resolution the way pgx does once it's registered
+// with decoding the JSON QueryJSON has the server send instead.  They don't
+// need a database; the OID is made up.
+
+const benchResolutionOID = 100000
+
+func benchConnInfo(b *testing.B) *pgtype.ConnInfo {
+	ci := pgtype.NewConnInfo()
+	def := CompositeDefinition{
+		Name: "resolution",
+		Fields: []CompositeField{
+			{Name: "width", Type: "int4"},
+			{Name: "height", Type: "int4"},
+			{Name: "scan", Type: "bpchar"},
+		},
+	}
+	if err := def.register(ci, typeOIDs{oid: benchResolutionOID}); err != nil {
+		b.Fatal(err)
+	}
+	return ci
+}
+
+func benchEncoded(b *testing.B, ci *pgtype.ConnInfo, format int16) []byte {
+	dt, ok := ci.DataTypeForOID(benchResolutionOID)
+	if !ok {
+		b.Fatal("resolution is not registered")
+	}
+	value := pgtype.NewValue(dt.Value)
+	if err := value.Set(Resolution{Width: 1920, Height: 1080, Scan: 'P'}); err != nil {
+		b.Fatal(err)
+	}
+
+	var src []byte
+	var err error
+	if format == pgtype.BinaryFormatCode {
+		src, err = value.(pgtype.BinaryEncoder).EncodeBinary(ci, nil)
+	} else {
+		src, err = value.(pgtype.TextEncoder).EncodeText(ci, nil)
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	return src
+}
+
+func BenchmarkDecodeResolutionBinary(b *testing.B) {
+	ci := benchConnInfo(b)
+	src := benchEncoded(b, ci, pgtype.BinaryFormatCode)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var res Resolution
+		if err := ci.Scan(benchResolutionOID, pgtype.BinaryFormatCode, src, &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeResolutionText(b *testing.B) {
+	ci := benchConnInfo(b)
+	src := benchEncoded(b, ci, pgtype.TextFormatCode)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var res Resolution
+		if err := ci.Scan(benchResolutionOID, pgtype.TextFormatCode, src, &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeResolutionJSON(b *testing.B) {
+	src := []byte(`{"width":1920,"height":1080,"scan":"P"}`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var res Resolution
+		if err := json.Unmarshal(src, &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeResolutionJSONRow(b *testing.B) {
+	src := []byte(`{"res":{"width":1920,"height":1080,"scan":"P"}}`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var res Resolution
+		if err := decodeJSONRow(src, &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
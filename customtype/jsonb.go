@@ -0,0 +1,113 @@
+package customtype
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Where the types can't be registered, say behind a proxy that won't let us
+// query the catalog, or with a driver we don't control, the server can turn
+// the rows into JSON instead, and encoding/json decodes them.  A composite in
+// JSON has its attribute names as keys, which is what UnmarshalJSON expects,
+// so the types in this package read the same either way.  It costs the
+// server the conversion, and us parsing text, so registering the types is
+// the better choice where it's possible.
+
+// QueryJSON runs sql with its rows converted to JSON on the server, and
+// decodes them with encoding/json, so that nothing needs registering.  As
+// with ScanAll, a single column is decoded into T, and several into the
+// exported fields of T in order.
+//
+// The query is wrapped as select to_json(q) from (sql) q.  to_json converts
+// composites the same way as to_jsonb, but keeps the columns in order, which
+// is what lets them be assigned by position.
+func QueryJSON[T any](ctx context.Context, q Querier, sql string, args ...interface{}) (results []T, err error) {
+	sql = fmt.Sprintf("SELECT to_json(q) FROM (%s) AS q", sql)
+	ctx, span := startQuerySpan[T](ctx, "customtype.QueryJSON", sql)
+	defer func() {
+		span.SetAttributes(attrRows.Int(len(results)))
+		endSpan(span, err)
+	}()
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+
+		var v T
+		if err := decodeJSONRow(row, &v); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+		if err := validate(reflect.ValueOf(&v).Elem()); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+		results = append(results, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return results, nil
+}
+
+// decodeJSONRow decodes a row from to_json into dst.
+func decodeJSONRow(row []byte, dst interface{}) error {
+	columns, err := jsonColumns(row)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 1 {
+		return json.Unmarshal(columns[0], dst)
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode %d columns into a %s", len(columns), v.Type())
+	}
+
+	var targets []interface{}
+	for _, field := range exportedFields(v.Type()) {
+		targets = append(targets, v.FieldByIndex(field.index).Addr().Interface())
+	}
+	if len(targets) != len(columns) {
+		return fmt.Errorf("cannot decode %d columns into %s with %d exported fields: %w", len(columns), v.Type(), len(targets), ErrFieldCountMismatch)
+	}
+
+	for i, column := range columns {
+		if err := json.Unmarshal(column, targets[i]); err != nil {
+			return fmt.Errorf("failed to decode column %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// jsonColumns are the values of the object to_json makes of a row, in order.
+func jsonColumns(row []byte) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(row))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("row is not a JSON object: %s", row)
+	}
+
+	var columns []json.RawMessage
+	for dec.More() {
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("failed to decode row: %w", err)
+		}
+		var column json.RawMessage
+		if err := dec.Decode(&column); err != nil {
+			return nil, fmt.Errorf("failed to decode row: %w", err)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
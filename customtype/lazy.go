@@ -0,0 +1,51 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Lazily runs fn on conn.  If fn fails on an OID pgx doesn't know, and the
+// types aren't registered on conn yet, they are registered and fn is run once
+// more, so fn must be safe to run twice.  It is how a registry in Lazy mode
+// gets its types registered, but works in any mode.  An OID pgx doesn't know
+// is one of the errors IsOIDChange reports, so fn shouldn't hide it behind
+// an error of its own that doesn't wrap it.
+func (r *TypeRegistry) Lazily(ctx context.Context, conn *pgx.Conn, fn func(ctx context.Context, conn *pgx.Conn) error) error {
+	err := fn(ctx, conn)
+	if !IsOIDChange(err) || r.registeredOn(conn) {
+		return err
+	}
+
+	r.logger().log(ctx, pgx.LogLevelDebug, "registering types lazily", map[string]interface{}{"err": err})
+	if regErr := r.register(ctx, conn, true); regErr != nil {
+		return errors.Join(err, regErr)
+	}
+	return fn(ctx, conn)
+}
+
+// LazilyPool acquires a connection from pool and runs fn on it with Lazily.
+func (r *TypeRegistry) LazilyPool(ctx context.Context, pool *pgxpool.Pool, fn func(ctx context.Context, conn *pgx.Conn) error) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire a connection: %w", err)
+	}
+	defer c.Release()
+
+	return r.Lazily(ctx, c.Conn(), fn)
+}
+
+// registeredOn reports whether every type is registered on conn.
+func (r *TypeRegistry) registeredOn(conn *pgx.Conn) bool {
+	ci := conn.ConnInfo()
+	for _, name := range r.snapshot().names {
+		if _, ok := ci.DataTypeForName(name); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package customtype
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// A trigger can tell us about a change with the changed value as the payload
+// of a notification, either as JSON, with pg_notify('res', to_json(new.res)::text),
+// or in a type's text format, with pg_notify('res', new.res::text).  Listen
+// decodes them into the same Go types as the queries do.
+
+// Subscription is what to listen for.
+type Subscription struct {
+	// Channel is the channel to LISTEN on.
+	Channel string
+
+	// Type is the postgres type of the payloads when they are in its text
+	// format, such as resolution.  It must be registered on the pool's
+	// connections.  Without a Type the payloads are JSON.
+	Type string
+
+	// MaxBackoff is the longest to wait before connecting again after
+	// losing the connection, 30 seconds if it's zero.  The wait starts at a
+	// tenth of a second and doubles each time the connection can't be made.
+	MaxBackoff time.Duration
+}
+
+// Notification is a notification with its payload decoded, or the reason it
+// couldn't be.  Err is also how Listen reports losing its connection, after
+// which it connects again.
+type Notification[T any] struct {
+	Channel string
+	PID     uint32
+	Value   T
+	Err     error
+}
+
+// Listen listens on the subscription's channel with a connection of its own
+// from pool, and sends each notification down the channel it returns, which
+// is closed once ctx is done.  Notifications sent while it is connecting
+// again are missed, as LISTEN only hears those sent while it is listening.
+func Listen[T any](ctx context.Context, pool *pgxpool.Pool, sub Subscription) <-chan Notification[T] {
+	notifications := make(chan Notification[T])
+	go func() {
+		defer close(notifications)
+
+		wait := newBackoff(0, sub.MaxBackoff)
+		for ctx.Err() == nil {
+			err := listen(ctx, pool, sub, notifications, wait.reset)
+			if ctx.Err() != nil {
+				return
+			}
+			if !send(ctx, notifications, Notification[T]{Channel: sub.Channel, Err: err}) {
+				return
+			}
+			if !wait.wait(ctx) {
+				return
+			}
+		}
+	}()
+	return notifications
+}
+
+// listen listens on one connection until it fails, calling connected once
+// it is listening.
+func listen[T any](ctx context.Context, pool *pgxpool.Pool, sub Subscription, notifications chan<- Notification[T], connected func()) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire a connection: %w", err)
+	}
+	defer c.Release()
+
+	conn := c.Conn()
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{sub.Channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", sub.Channel, err)
+	}
+	connected()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			// The connection may still be listening, or be broken, so it
+			// mustn't go back to the pool for someone else.
+			conn.Close(context.Background())
+			return fmt.Errorf("lost the connection listening on %s: %w", sub.Channel, err)
+		}
+
+		notification := Notification[T]{Channel: n.Channel, PID: n.PID}
+		notification.Err = decodePayload(conn.ConnInfo(), sub.Type, n.Payload, &notification.Value)
+		if !send(ctx, notifications, notification) {
+			conn.Close(context.Background())
+			return ctx.Err()
+		}
+	}
+}
+
+// decodePayload decodes a payload into dst, as JSON, or in the text format
+// of the type called typeName, and validates it as a scan would.
+func decodePayload(ci *pgtype.ConnInfo, typeName, payload string, dst interface{}) error {
+	if typeName == "" {
+		if err := json.Unmarshal([]byte(payload), dst); err != nil {
+			return fmt.Errorf("failed to decode payload: %w", err)
+		}
+		return validate(reflect.ValueOf(dst).Elem())
+	}
+
+	dt, ok := ci.DataTypeForName(typeName)
+	if !ok {
+		return fmt.Errorf("failed to decode payload of %s: %w", typeName, ErrTypeNotFound)
+	}
+	value := pgtype.NewValue(dt.Value)
+	decoder, ok := value.(pgtype.TextDecoder)
+	if !ok {
+		return fmt.Errorf("type %s has no text format", typeName)
+	}
+	if err := decoder.DecodeText(ci, []byte(payload)); err != nil {
+		return fmt.Errorf("failed to decode payload as %s: %w", typeName, err)
+	}
+	if err := value.AssignTo(dst); err != nil {
+		return fmt.Errorf("failed to decode payload as %s: %w", typeName, err)
+	}
+	return validate(reflect.ValueOf(dst).Elem())
+}
+
+// send sends n unless ctx is done first.
+func send[T any](ctx context.Context, notifications chan<- Notification[T], n Notification[T]) bool {
+	select {
+	case notifications <- n:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
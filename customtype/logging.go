@@ -0,0 +1,70 @@
+package customtype
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Logger is where a registry's diagnostics go: registering the types,
+// refreshing them, and fields that fail to decode.  It has the method of
+// pgx's Logger, so any pgx.Logger is one, the adapters pgx has for zap,
+// logrus and the rest included, and NewSlogLogger makes one of a
+// *slog.Logger.
+type Logger interface {
+	Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{})
+}
+
+// NewSlogLogger makes a Logger that logs to l, with pgx's trace and debug
+// levels both at slog's debug level.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	attrs := make([]slog.Attr, 0, len(data))
+	for k, v := range data {
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	s.l.LogAttrs(ctx, slogLevel(level), msg, attrs...)
+}
+
+func slogLevel(level pgx.LogLevel) slog.Level {
+	switch level {
+	case pgx.LogLevelTrace, pgx.LogLevelDebug:
+		return slog.LevelDebug
+	case pgx.LogLevelWarn:
+		return slog.LevelWarn
+	case pgx.LogLevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// logger is a Logger along with the least severe level to pass it, which
+// does nothing without one.
+type logger struct {
+	Logger
+	level pgx.LogLevel
+}
+
+func (r *TypeRegistry) logger() logger {
+	level := r.LogLevel
+	if level == 0 {
+		level = pgx.LogLevelInfo
+	}
+	return logger{Logger: r.Logger, level: level}
+}
+
+func (l logger) log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	// pgx's levels go up as they get less severe.
+	if l.Logger == nil || level > l.level {
+		return
+	}
+	l.Log(ctx, level, msg, data)
+}
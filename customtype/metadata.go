@@ -0,0 +1,257 @@
+package customtype
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// The first connection to a database looks the types up in the catalog,
+// which a locked down production database may not let the application do,
+// or which a service starting hundreds of connections at once would rather
+// not wait on.  The metadata registering learns can be taken once instead,
+// by a job with the access, and shipped with the application:
+//
+//	m, err := registry.TakeMetadata(ctx, conn)
+//	...
+//	err = m.WriteFile("types.json")
+//
+// and read back at startup:
+//
+//	m, err := customtype.ReadMetadataFile("types.json")
+//	...
+//	registry.Metadata = m
+//
+// after which registering the types on a connection asks the database
+// nothing.  The file has the OIDs of every type, and the fields of the
+// composites as the database had them, so that MetadataDrift can tell when
+// the database has changed since, and HealthCheck with it: a type dropped
+// and created again has another OID, which the metadata goes on registering
+// wrongly, Refresh or not, until it's taken again and the application
+// restarted with it.
+
+// Metadata is what the catalog says of a registry's types, as TakeMetadata
+// found it.
+type Metadata struct {
+	// Database is the database the metadata was taken from, as host, port
+	// and name, for the people reading the file; it isn't checked.
+	Database string         `json:"database"`
+	Taken    time.Time      `json:"taken"`
+	Types    []TypeMetadata `json:"types"`
+}
+
+// TypeMetadata is what the catalog says of one type.
+type TypeMetadata struct {
+	Name     string `json:"name"`
+	OID      uint32 `json:"oid"`
+	ArrayOID uint32 `json:"array_oid"`
+	BaseOID  uint32 `json:"base_oid,omitempty"`
+
+	// Version is which of a composite's Versions the database has, from 1,
+	// or 0 for its latest Fields.
+	Version int `json:"version,omitempty"`
+
+	// Fields are a composite's fields, in order.
+	Fields []FieldMetadata `json:"fields,omitempty"`
+}
+
+// FieldMetadata is a field of a composite, with its type as format_type
+// gives it.
+type FieldMetadata struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	TypeOID uint32 `json:"type_oid"`
+}
+
+// TakeMetadata looks every type up in the database conn is connected to, as
+// registering them would, and gives what it found.  It fails as registering
+// would on a type that isn't there.
+func (r *TypeRegistry) TakeMetadata(ctx context.Context, conn *pgx.Conn) (*Metadata, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	types := r.snapshot()
+	oids, err := r.resolveOIDs(ctx, conn, types)
+	if err != nil {
+		return nil, err
+	}
+	return takeMetadata(ctx, conn, types, oids)
+}
+
+// takeMetadata is the metadata of the types with oids, reading the fields of
+// the composites among them in one query.
+func takeMetadata(ctx context.Context, conn *pgx.Conn, types *typeSet, oids map[string]typeOIDs) (*Metadata, error) {
+	composites := make(map[uint32]CompositeDefinition)
+	for _, def := range types.definitions {
+		if composite, ok := def.(CompositeDefinition); ok {
+			if o, ok := oids[composite.Name]; ok {
+				composites[o.oid] = composite
+			}
+		}
+	}
+	var attributes map[uint32][]attribute
+	if len(composites) > 0 {
+		var err error
+		if attributes, err = readAttributes(ctx, conn, composites); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Metadata{Database: databaseIdentity(conn), Taken: time.Now().UTC()}
+	for _, name := range types.names {
+		o, ok := oids[name]
+		if !ok {
+			continue
+		}
+		t := TypeMetadata{Name: name, OID: o.oid, ArrayOID: o.arrayOID, BaseOID: o.baseOID, Version: o.version}
+		for _, a := range attributes[o.oid] {
+			t.Fields = append(t.Fields, FieldMetadata{Name: a.name, Type: a.typ, TypeOID: a.typeOID})
+		}
+		m.Types = append(m.Types, t)
+	}
+	return m, nil
+}
+
+// ReadMetadataFile reads metadata WriteFile wrote.
+func ReadMetadataFile(path string) (*Metadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read type metadata: %w", err)
+	}
+	var m Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to read type metadata from %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// WriteFile writes the metadata to path as JSON.  The file is written beside
+// it and renamed into place, so that an application starting meanwhile reads
+// the old metadata or the new, and never half of it.
+func (m *Metadata) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write type metadata: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write type metadata: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write type metadata: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write type metadata: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write type metadata: %w", err)
+	}
+	return nil
+}
+
+// oids are the OIDs of the types from the metadata, which has to have every
+// one of them.
+func (m *Metadata) oids(types *typeSet) (map[string]typeOIDs, error) {
+	oids := make(map[string]typeOIDs, len(types.names))
+	var missing []string
+	for _, name := range types.names {
+		t, ok := m.typeMetadata(name)
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		oids[name] = typeOIDs{oid: t.OID, arrayOID: t.ArrayOID, baseOID: t.BaseOID, version: t.Version}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the type metadata has no %s, it needs taking again", strings.Join(missing, ", "))
+	}
+	return oids, nil
+}
+
+func (m *Metadata) typeMetadata(name string) (TypeMetadata, bool) {
+	i := slices.IndexFunc(m.Types, func(t TypeMetadata) bool { return t.Name == name })
+	if i < 0 {
+		return TypeMetadata{}, false
+	}
+	return m.Types[i], true
+}
+
+// MetadataDrift compares the registry's Metadata with the database conn is
+// connected to, and reports where it is out of date: types that have
+// another OID or array OID, or other fields, and types the metadata doesn't
+// have.  Without Metadata there is nothing to compare, and no drift.
+func (r *TypeRegistry) MetadataDrift(ctx context.Context, conn *pgx.Conn) ([]Drift, error) {
+	if r.Metadata == nil {
+		return nil, nil
+	}
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	types := r.snapshot()
+	oids, missing, err := r.findOIDs(ctx, conn, types)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.pickVersions(ctx, conn, types, oids); err != nil {
+		return nil, err
+	}
+	current, err := takeMetadata(ctx, conn, types, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Drift
+	for _, name := range missing {
+		drift = append(drift, Drift{Type: name, Problem: "is not in the database"})
+	}
+	for _, now := range current.Types {
+		then, ok := r.Metadata.typeMetadata(now.Name)
+		switch {
+		case !ok:
+			drift = append(drift, Drift{Type: now.Name, Problem: "is not in the metadata"})
+		case then.OID != now.OID || then.ArrayOID != now.ArrayOID:
+			drift = append(drift, Drift{
+				Type:    now.Name,
+				Problem: fmt.Sprintf("has oids %d and %d in the database, but %d and %d in the metadata", now.OID, now.ArrayOID, then.OID, then.ArrayOID),
+			})
+		case then.BaseOID != now.BaseOID:
+			drift = append(drift, Drift{
+				Type:    now.Name,
+				Problem: fmt.Sprintf("is over oid %d in the database, but %d in the metadata", now.BaseOID, then.BaseOID),
+			})
+		case then.Version != now.Version || !slices.Equal(then.Fields, now.Fields):
+			drift = append(drift, Drift{
+				Type:    now.Name,
+				Problem: fmt.Sprintf("has fields (%s) in the database, but (%s) in the metadata", fieldList(now.Fields), fieldList(then.Fields)),
+			})
+		}
+	}
+
+	sortDrift(drift)
+	return drift, nil
+}
+
+// fieldList is fields as a composite's definition in SQL has them.
+func fieldList(fields []FieldMetadata) string {
+	list := make([]string, len(fields))
+	for i, f := range fields {
+		list[i] = f.Name + " " + f.Type
+	}
+	return strings.Join(list, ", ")
+}
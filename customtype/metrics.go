@@ -0,0 +1,140 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	otelattribute "go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The metrics say how the mapping is doing in production, through the
+// OpenTelemetry metric API, from which the Prometheus exporter serves them
+// as counters and histograms:
+//
+//   - customtype.decoded counts the composites decoded, by type and by
+//     whether they were null, which gives the rate of null composites.
+//   - customtype.decode.errors counts the fields of composites that failed
+//     to decode or assign, by type and field.
+//   - customtype.registrations counts registering the types on a
+//     connection, by whether it was a retry, after a Refresh or for a lazy
+//     connection, and whether it failed, and customtype.registration.duration
+//     times them.
+//   - customtype.oid_cache.lookups counts the OID cache's hits and misses.
+//
+// The instruments come from the registry's MeterProvider, or the global one,
+// which records nothing until the application sets one up.
+
+const (
+	attrType   = otelattribute.Key("customtype.type")
+	attrField  = otelattribute.Key("customtype.field")
+	attrNull   = otelattribute.Key("customtype.null")
+	attrRetry  = otelattribute.Key("customtype.retry")
+	attrFailed = otelattribute.Key("customtype.failed")
+	attrHit    = otelattribute.Key("customtype.hit")
+)
+
+// metrics are the instruments of one MeterProvider.
+type metrics struct {
+	decoded              metric.Int64Counter
+	decodeErrors         metric.Int64Counter
+	registrations        metric.Int64Counter
+	registrationDuration metric.Float64Histogram
+	cacheLookups         metric.Int64Counter
+}
+
+func newMetrics(mp metric.MeterProvider) *metrics {
+	meter := mp.Meter(tracerName)
+
+	// The instruments are still usable, doing nothing, if they can't be
+	// made, which the API only does for a bad name.
+	m := &metrics{}
+	m.decoded, _ = meter.Int64Counter("customtype.decoded",
+		metric.WithDescription("Composites decoded, by type and whether they were null."))
+	m.decodeErrors, _ = meter.Int64Counter("customtype.decode.errors",
+		metric.WithDescription("Composite fields that failed to decode or assign, by type and field."))
+	m.registrations, _ = meter.Int64Counter("customtype.registrations",
+		metric.WithDescription("Types registered on a connection, by whether it was a retry and whether it failed."))
+	m.registrationDuration, _ = meter.Float64Histogram("customtype.registration.duration",
+		metric.WithDescription("How long registering the types on a connection took."), metric.WithUnit("s"))
+	m.cacheLookups, _ = meter.Int64Counter("customtype.oid_cache.lookups",
+		metric.WithDescription("OID cache lookups, by whether they hit."))
+	return m
+}
+
+var (
+	globalMetricsOnce sync.Once
+	globalMetrics     *metrics
+)
+
+// defaultMetrics are those of the global MeterProvider, for composites
+// registered without a registry.  The global provider passes them on to
+// whichever provider the application sets later.
+func defaultMetrics() *metrics {
+	globalMetricsOnce.Do(func() {
+		globalMetrics = newMetrics(otel.GetMeterProvider())
+	})
+	return globalMetrics
+}
+
+// metrics are the registry's instruments, made the first time they're
+// needed.
+func (r *TypeRegistry) metrics() *metrics {
+	if r.MeterProvider == nil {
+		return defaultMetrics()
+	}
+	r.metricsOnce.Do(func() {
+		r.instruments = newMetrics(r.MeterProvider)
+	})
+	return r.instruments
+}
+
+// recordRegistration records registering the types once.
+func (m *metrics) recordRegistration(retry bool, started time.Time, err error) {
+	attrs := metric.WithAttributes(attrRetry.Bool(retry), attrFailed.Bool(err != nil))
+	m.registrations.Add(context.Background(), 1, attrs)
+	m.registrationDuration.Record(context.Background(), time.Since(started).Seconds(), attrs)
+}
+
+func (m *metrics) recordCacheLookup(hit bool) {
+	m.cacheLookups.Add(context.Background(), 1, metric.WithAttributes(attrHit.Bool(hit)))
+}
+
+// compositeMetrics are the instruments a composite records to, with the
+// options it records with most often made up front, so that decoding doesn't
+// allocate them every time.
+type compositeMetrics struct {
+	*metrics
+	typeName      string
+	null, present []metric.AddOption
+}
+
+func newCompositeMetrics(m *metrics, typeName string) *compositeMetrics {
+	return &compositeMetrics{
+		metrics:  m,
+		typeName: typeName,
+		null:     []metric.AddOption{metric.WithAttributeSet(otelattribute.NewSet(attrType.String(typeName), attrNull.Bool(true)))},
+		present:  []metric.AddOption{metric.WithAttributeSet(otelattribute.NewSet(attrType.String(typeName), attrNull.Bool(false)))},
+	}
+}
+
+func (m *compositeMetrics) recordDecoded(null bool) {
+	if null {
+		m.decoded.Add(context.Background(), 1, m.null...)
+	} else {
+		m.decoded.Add(context.Background(), 1, m.present...)
+	}
+}
+
+// recordFieldError counts a field that failed, unless the failure was in a
+// nested composite, which has counted it against its own field already.
+func (m *compositeMetrics) recordFieldError(field string, cause error) {
+	var nested *FieldDecodeError
+	if errors.As(cause, &nested) {
+		return
+	}
+	m.decodeErrors.Add(context.Background(), 1, metric.WithAttributes(attrType.String(m.typeName), attrField.String(field)))
+}
@@ -0,0 +1,114 @@
+package customtype
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/jackc/pgtype"
+)
+
+// Infrastructure schemas are full of addresses and networks, and a composite
+// of a host is likely to have an inet or a cidr field.  pgtype maps those to
+// a *net.IPNet, which is as much as it had when it was written; netip's Addr
+// and Prefix are comparable values, which is what a struct field wants to be.
+// An inet field is a netip.Addr when it's a single host, 10.0.0.5, or a
+// netip.Prefix, 10.0.0.5/24, when it has a netmask too; a cidr field is a
+// netip.Prefix.  A *net.IPNet, net.IP or string still works as it did.
+
+// inetValue is a pgtype.Inet that can also be set from and assigned to a
+// netip.Addr or netip.Prefix.  It's registered for cidr as well, whose
+// encoding is the same.
+type inetValue struct {
+	pgtype.Inet
+}
+
+// registerNetwork replaces pgtype's inet and cidr, and their arrays, with
+// ours, before the composites that have fields of them are registered.
+func registerNetwork(ci *pgtype.ConnInfo) {
+	registerDataType(ci, "inet", &inetValue{}, typeOIDs{oid: pgtype.InetOID, arrayOID: pgtype.InetArrayOID})
+	registerDataType(ci, "cidr", &inetValue{}, typeOIDs{oid: pgtype.CIDROID, arrayOID: pgtype.CIDRArrayOID})
+}
+
+func (v *inetValue) Set(src interface{}) error {
+	switch value := src.(type) {
+	case netip.Addr:
+		if !value.IsValid() {
+			v.Inet = pgtype.Inet{Status: pgtype.Null}
+			return nil
+		}
+		bits := value.BitLen()
+		v.Inet = pgtype.Inet{IPNet: &net.IPNet{IP: value.AsSlice(), Mask: net.CIDRMask(bits, bits)}, Status: pgtype.Present}
+		return nil
+	case netip.Prefix:
+		if !value.IsValid() {
+			v.Inet = pgtype.Inet{Status: pgtype.Null}
+			return nil
+		}
+		addr := value.Addr()
+		v.Inet = pgtype.Inet{IPNet: &net.IPNet{IP: addr.AsSlice(), Mask: net.CIDRMask(value.Bits(), addr.BitLen())}, Status: pgtype.Present}
+		return nil
+	case *netip.Addr:
+		if value == nil {
+			v.Inet = pgtype.Inet{Status: pgtype.Null}
+			return nil
+		}
+		return v.Set(*value)
+	case *netip.Prefix:
+		if value == nil {
+			v.Inet = pgtype.Inet{Status: pgtype.Null}
+			return nil
+		}
+		return v.Set(*value)
+	}
+	return v.Inet.Set(src)
+}
+
+func (v *inetValue) AssignTo(dst interface{}) error {
+	switch dst.(type) {
+	case *netip.Addr, *netip.Prefix:
+	default:
+		if v.Status == pgtype.Present {
+			if next, ok := pgtype.GetAssignToDstType(dst); ok {
+				return v.AssignTo(next)
+			}
+		}
+		return v.Inet.AssignTo(dst)
+	}
+
+	switch v.Status {
+	case pgtype.Null:
+		return pgtype.NullAssignTo(dst)
+	case pgtype.Undefined:
+		return fmt.Errorf("cannot assign undefined address to %T", dst)
+	}
+
+	prefix, err := inetPrefix(v.IPNet)
+	if err != nil {
+		return err
+	}
+	switch dst := dst.(type) {
+	case *netip.Addr:
+		if !prefix.IsSingleIP() {
+			return fmt.Errorf("cannot assign %s to %T, it is a network rather than an address", prefix, dst)
+		}
+		*dst = prefix.Addr()
+	case *netip.Prefix:
+		*dst = prefix
+	}
+	return nil
+}
+
+// inetPrefix is n as a netip.Prefix.  An IPv4 address can come in the 16
+// bytes of an IPv6 one, which its netmask tells apart.
+func inetPrefix(n *net.IPNet) (netip.Prefix, error) {
+	addr, ok := netip.AddrFromSlice(n.IP)
+	ones, bits := n.Mask.Size()
+	if !ok || bits == 0 {
+		return netip.Prefix{}, fmt.Errorf("%s is not an address", n)
+	}
+	if bits == 32 {
+		addr = addr.Unmap()
+	}
+	return netip.PrefixFrom(addr, ones), nil
+}
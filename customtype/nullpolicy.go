@@ -0,0 +1,168 @@
+package customtype
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// NullPolicy decides what a null field of a DTO becomes in the application
+// type.
+type NullPolicy struct {
+	kind  nullPolicyKind
+	value interface{}
+}
+
+type nullPolicyKind int
+
+const (
+	zeroValue nullPolicyKind = iota
+	defaultValue
+	errorOnNull
+	keepPointer
+)
+
+var (
+	// ZeroValue sets the field to its zero value.  It is the policy for
+	// fields without one.
+	ZeroValue = NullPolicy{kind: zeroValue}
+
+	// ErrorOnNull makes the conversion fail.
+	ErrorOnNull = NullPolicy{kind: errorOnNull}
+
+	// KeepPointer leaves the field nil, for application types that have a
+	// pointer field and handle the nil themselves.
+	KeepPointer = NullPolicy{kind: keepPointer}
+)
+
+// DefaultValue sets the field to v, which must be convertible to the field's
+// type.
+func DefaultValue(v interface{}) NullPolicy {
+	return NullPolicy{kind: defaultValue, value: v}
+}
+
+// NullPolicies are the null policies for the fields of one type, by Go field
+// name.  Fields that aren't listed get Default, and the policies for the
+// fields of a nested composite are in Nested.
+type NullPolicies struct {
+	Default NullPolicy
+	Fields  map[string]NullPolicy
+	Nested  map[string]NullPolicies
+}
+
+func (p NullPolicies) forField(name string) NullPolicy {
+	if policy, ok := p.Fields[name]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// ConvertDTO copies src, a DTO struct with pointer fields, into dst, a pointer
+// to the application struct, applying the policies to the null fields.
+// Fields are matched by name; a nested DTO is converted into the matching
+// nested struct using the nested policies.
+func ConvertDTO(dst, src interface{}, policies NullPolicies) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ConvertDTO needs a pointer to a struct, not %T", dst)
+	}
+
+	sv := reflect.Indirect(reflect.ValueOf(src))
+	if sv.Kind() != reflect.Struct {
+		return fmt.Errorf("ConvertDTO needs a struct to convert, not %T", src)
+	}
+
+	return convertStruct(dv.Elem(), sv, policies)
+}
+
+func convertStruct(dst, src reflect.Value, policies NullPolicies) error {
+	for i := 0; i < src.NumField(); i++ {
+		sf := src.Type().Field(i)
+
+		// The fields of an embedded struct are promoted, so they're found
+		// in dst by name as they would be if they were its own.
+		if _, ok := flattened(sf); ok {
+			if err := convertStruct(dst, src.Field(i), policies); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		df := dst.FieldByName(sf.Name)
+		if !df.IsValid() {
+			continue
+		}
+
+		if err := convertField(df, src.Field(i), dst.Type().Name(), sf.Name, policies); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func convertField(dst, src reflect.Value, typeName, field string, policies NullPolicies) error {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return applyNullPolicy(dst, typeName, field, policies.forField(field))
+		}
+		src = src.Elem()
+	}
+
+	// Keep the pointer if the application type has one too.
+	if dst.Kind() == reflect.Ptr {
+		value := reflect.New(dst.Type().Elem())
+		if err := convertField(value.Elem(), src, typeName, field, policies); err != nil {
+			return err
+		}
+		dst.Set(value)
+		return nil
+	}
+
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case src.Kind() == reflect.Struct && dst.Kind() == reflect.Struct:
+		return convertStruct(dst, src, policies.Nested[field])
+	case src.Type().ConvertibleTo(dst.Type()):
+		dst.Set(src.Convert(dst.Type()))
+	default:
+		return fmt.Errorf("cannot convert %s.%s from %s to %s", typeName, field, src.Type(), dst.Type())
+	}
+
+	return nil
+}
+
+func applyNullPolicy(dst reflect.Value, typeName, field string, policy NullPolicy) error {
+	switch policy.kind {
+	case zeroValue:
+		dst.Set(reflect.Zero(dst.Type()))
+	case defaultValue:
+		v := reflect.ValueOf(policy.value)
+		target := dst.Type()
+		if target.Kind() == reflect.Ptr {
+			target = target.Elem()
+		}
+		if !v.IsValid() || !v.Type().ConvertibleTo(target) {
+			return fmt.Errorf("default value %v for %s.%s is not a %s", policy.value, typeName, field, target)
+		}
+		v = v.Convert(target)
+		if dst.Kind() == reflect.Ptr {
+			p := reflect.New(target)
+			p.Elem().Set(v)
+			v = p
+		}
+		dst.Set(v)
+	case errorOnNull:
+		return fmt.Errorf("%s.%s is null", typeName, field)
+	case keepPointer:
+		if dst.Kind() != reflect.Ptr {
+			return fmt.Errorf("%s.%s must be a pointer to keep a null", typeName, field)
+		}
+		dst.Set(reflect.Zero(dst.Type()))
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package customtype
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgtype"
+)
+
+// pgtype's Numeric only converts to and from Go's floats and integers, which
+// either lose precision or can't hold a fraction, so we add big.Rat and
+// big.Int for numeric fields.
+
+type ratConverter struct{}
+
+func (ratConverter) GoType() reflect.Type {
+	return reflect.TypeOf(big.Rat{})
+}
+
+// ToDatabase sends the rational as a decimal.  A numeric can't hold a
+// fraction like 1/3 exactly, so that's an error rather than a rounding.
+func (ratConverter) ToDatabase(v interface{}) (interface{}, error) {
+	r := v.(big.Rat)
+	digits, exact := decimalDigits(&r)
+	if !exact {
+		return nil, fmt.Errorf("%s cannot be written exactly as a numeric", r.String())
+	}
+	return r.FloatString(digits), nil
+}
+
+func (ratConverter) FromDatabase(src pgtype.Value, dst interface{}) error {
+	n, err := numericValue(src)
+	if err != nil {
+		return err
+	}
+
+	r := dst.(*big.Rat)
+	r.SetInt(n.Int)
+	exp := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n.Exp))), nil)
+	if n.Exp < 0 {
+		r.Quo(r, new(big.Rat).SetInt(exp))
+	} else {
+		r.Mul(r, new(big.Rat).SetInt(exp))
+	}
+	return nil
+}
+
+type bigIntConverter struct{}
+
+func (bigIntConverter) GoType() reflect.Type {
+	return reflect.TypeOf(big.Int{})
+}
+
+func (bigIntConverter) ToDatabase(v interface{}) (interface{}, error) {
+	i := v.(big.Int)
+	return i.String(), nil
+}
+
+// FromDatabase fails for a numeric with a fraction, rather than truncating
+// it.
+func (bigIntConverter) FromDatabase(src pgtype.Value, dst interface{}) error {
+	var r big.Rat
+	if err := (ratConverter{}).FromDatabase(src, &r); err != nil {
+		return err
+	}
+	if !r.IsInt() {
+		return fmt.Errorf("%s is not an integer", r.FloatString(decimalPlaces(&r)))
+	}
+	dst.(*big.Int).Set(r.Num())
+	return nil
+}
+
+// numericValue is the numeric a field holds, which must be a finite number.
+func numericValue(src pgtype.Value) (pgtype.Numeric, error) {
+	switch v := src.Get().(type) {
+	case nil:
+		return pgtype.Numeric{}, fmt.Errorf("cannot assign null to a big number")
+	case pgtype.Numeric:
+		if v.NaN {
+			return pgtype.Numeric{}, fmt.Errorf("cannot assign NaN to a big number")
+		}
+		return v, nil
+	default:
+		return pgtype.Numeric{}, fmt.Errorf("cannot assign %T to a big number, it must be a numeric", v)
+	}
+}
+
+// numericText writes n as a plain decimal, 12.50 rather than 1250e-2, keeping
+// the places it has.
+func numericText(n pgtype.Numeric) string {
+	if n.Exp >= 0 {
+		exp := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n.Exp)), nil)
+		return new(big.Int).Mul(n.Int, exp).String()
+	}
+
+	digits := new(big.Int).Abs(n.Int).String()
+	places := int(-n.Exp)
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+
+	sign := ""
+	if n.Int.Sign() < 0 {
+		sign = "-"
+	}
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
+
+// decimalDigits are the places after the point r needs as a decimal, and
+// whether it has an exact decimal at all, which it does when its denominator
+// has no factors but 2 and 5.
+func decimalDigits(r *big.Rat) (int, bool) {
+	d := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	two, five, zero := big.NewInt(2), big.NewInt(5), new(big.Int)
+	m := new(big.Int)
+	for m.Mod(d, two).Cmp(zero) == 0 {
+		d.Quo(d, two)
+		twos++
+	}
+	for m.Mod(d, five).Cmp(zero) == 0 {
+		d.Quo(d, five)
+		fives++
+	}
+	return max(twos, fives), d.Cmp(big.NewInt(1)) == 0
+}
+
+// decimalPlaces are enough places to show r, for an error message.
+func decimalPlaces(r *big.Rat) int {
+	if digits, exact := decimalDigits(r); exact {
+		return digits
+	}
+	return 20
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+package customtype
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// oidCache remembers type OIDs for the life of the process, so that only the
+// first connection a pool makes to a database pays for the catalog query.
+// OIDs differ between databases, so entries are keyed by the database as well
+// as the type name, and by the scope the name was resolved in: a bare name is
+// a type in the first of the registry's Schemas that has it, or on the
+// connection's search_path, and two registries, or two connections, can
+// resolve it to types in different schemas of the same database.
+type oidCache struct {
+	mu   sync.RWMutex
+	oids map[oidCacheKey]typeOIDs
+}
+
+type oidCacheKey struct {
+	database string
+	scope    string
+	typeName string
+}
+
+// sharedOIDCache is used by every TypeRegistry in the process.
+var sharedOIDCache = &oidCache{oids: make(map[oidCacheKey]typeOIDs)}
+
+// databaseIdentity identifies the database a connection is talking to.
+func databaseIdentity(conn *pgx.Conn) string {
+	config := conn.Config()
+	return fmt.Sprintf("%s:%d/%s", config.Host, config.Port, config.Database)
+}
+
+// oidScope is what the registry's bare type names are resolved by on a
+// connection with config: its Schemas when it has them, otherwise the
+// search_path, which we take from the user, who may have one of their own,
+// and the search_path and options the connection sets.  A search_path set
+// with SET after connecting isn't seen, so a pool that does that should use
+// Schemas.
+func (r *TypeRegistry) oidScope(config *pgx.ConnConfig) string {
+	if len(r.Schemas) > 0 {
+		return "schemas=" + strings.Join(r.Schemas, ",")
+	}
+	return fmt.Sprintf("user=%s search_path=%s options=%s", config.User, config.RuntimeParams["search_path"], config.RuntimeParams["options"])
+}
+
+// lookup returns the cached OIDs for all of the names, and false if any of
+// them aren't cached yet.
+func (c *oidCache) lookup(database, scope string, names []string) (map[string]typeOIDs, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	oids := make(map[string]typeOIDs, len(names))
+	for _, name := range names {
+		o, ok := c.oids[oidCacheKey{database: database, scope: scope, typeName: name}]
+		if !ok {
+			return nil, false
+		}
+		oids[name] = o
+	}
+
+	return oids, true
+}
+
+// store caches the OIDs found for a database in a scope.
+func (c *oidCache) store(database, scope string, oids map[string]typeOIDs) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, o := range oids {
+		c.oids[oidCacheKey{database: database, scope: scope, typeName: name}] = o
+	}
+}
+
+// forgetEverywhere drops the cached OIDs of the names in every database.
+func (c *oidCache) forgetEverywhere(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.oids {
+		if slices.Contains(names, key.typeName) {
+			delete(c.oids, key)
+		}
+	}
+}
+
+// forget drops the cached OIDs of a database in a scope, so that they are
+// looked up again.
+func (c *oidCache) forget(database, scope string, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		delete(c.oids, oidCacheKey{database: database, scope: scope, typeName: name})
+	}
+}
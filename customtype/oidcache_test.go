@@ -0,0 +1,83 @@
+package customtype
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// TestOIDCacheScope checks that a bare name resolved in one schema isn't
+// given the OIDs of the same name resolved in another of the same database,
+// whether the schemas are the registry's or the connection's search_path.
+func TestOIDCacheScope(t *testing.T) {
+	config := func(connString string) *pgx.ConnConfig {
+		t.Helper()
+		c, err := pgx.ParseConfig(connString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	plain := config("host=db port=5432 dbname=app user=app")
+
+	tests := []struct {
+		name           string
+		first, second  *TypeRegistry
+		firstConfig    *pgx.ConnConfig
+		secondConfig   *pgx.ConnConfig
+		wantSameScopes bool
+	}{
+		{
+			name:         "registry schemas",
+			first:        &TypeRegistry{Schemas: []string{"billing"}},
+			second:       &TypeRegistry{Schemas: []string{"shipping"}},
+			firstConfig:  plain,
+			secondConfig: plain,
+		},
+		{
+			name:         "search_path",
+			first:        &TypeRegistry{},
+			second:       &TypeRegistry{},
+			firstConfig:  config("host=db port=5432 dbname=app user=app search_path=billing"),
+			secondConfig: config("host=db port=5432 dbname=app user=app search_path=shipping"),
+		},
+		{
+			name:         "options",
+			first:        &TypeRegistry{},
+			second:       &TypeRegistry{},
+			firstConfig:  plain,
+			secondConfig: config("host=db port=5432 dbname=app user=app options='-c search_path=shipping'"),
+		},
+		{
+			name:         "user",
+			first:        &TypeRegistry{},
+			second:       &TypeRegistry{},
+			firstConfig:  plain,
+			secondConfig: config("host=db port=5432 dbname=app user=shipping"),
+		},
+		{
+			name:           "same scope",
+			first:          &TypeRegistry{Schemas: []string{"billing"}},
+			second:         &TypeRegistry{Schemas: []string{"billing"}},
+			firstConfig:    plain,
+			secondConfig:   config("host=db port=5432 dbname=app user=shipping"),
+			wantSameScopes: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &oidCache{oids: make(map[oidCacheKey]typeOIDs)}
+			names := []string{"resolution"}
+			cache.store("db:5432/app", tt.first.oidScope(tt.firstConfig), map[string]typeOIDs{"resolution": {oid: 16001, arrayOID: 16000}})
+
+			got, ok := cache.lookup("db:5432/app", tt.second.oidScope(tt.secondConfig), names)
+			if ok != tt.wantSameScopes {
+				t.Fatalf("looked up %v, %v, want a hit %v", got, ok, tt.wantSameScopes)
+			}
+			if ok && got["resolution"].oid != 16001 {
+				t.Errorf("got %v, want the stored oids", got)
+			}
+		})
+	}
+}
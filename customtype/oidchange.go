@@ -0,0 +1,87 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// When a type is dropped and recreated, or the database is restored from a
+// dump, the type comes back with a new OID, and connections that registered
+// the old one start failing in a handful of ways.  The server may no longer
+// know the OID we send, or a prepared statement may have been planned with it;
+// or pgx may not recognise the OID the server sends back.
+//
+// The server's errors have codes, but pgx's and pgtype's are only messages,
+// so for those we go by the words they use for an OID they don't know, as of
+// pgx v4.13 and pgtype v1.8:
+//
+//	unknown oid 16001 cannot be scanned into *customtype.Resolution
+//	unknown oid 16001 in binary format cannot be scanned into *string
+//	unknown oid while decoding record: 16001
+//	Cannot encode customtype.Resolution into oid 16001 - ...
+//
+// The first three are pgtype scanning a column or a record's field, which
+// pgx wraps in a ScanArgError, and the last pgx encoding an argument.
+// oidchange_test.go gets each of them from the libraries where it can, so an
+// upgrade that rewords them fails there rather than quietly here, and Lazily
+// with it.
+
+// IsOIDChange reports whether err looks like the result of a type's OID having
+// changed under a connection.
+func IsOIDChange(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrOIDMismatch) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "XX000" && strings.HasPrefix(pgErr.Message, "cache lookup failed for type"):
+			return true
+		case pgErr.Code == "42804" && strings.HasPrefix(pgErr.Message, "wrong data type"):
+			return true
+		case pgErr.Code == "0A000" && pgErr.Message == "cached plan must not change result type":
+			return true
+		}
+		return false
+	}
+
+	var serializationErr pgx.SerializationError
+	if errors.As(err, &serializationErr) {
+		return strings.Contains(string(serializationErr), " into oid ")
+	}
+	return strings.Contains(err.Error(), "unknown oid ")
+}
+
+// WithRetry runs fn, and if it fails because a type's OID has changed, it
+// refreshes the types and runs fn once more.  fn should acquire its
+// connection from the pool itself, so that the retry gets one that is up to
+// date, and must be safe to run twice.
+func (r *TypeRegistry) WithRetry(ctx context.Context, pool *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if !IsOIDChange(err) {
+		return err
+	}
+
+	if refreshErr := r.Refresh(ctx, pool); refreshErr != nil {
+		return errors.Join(err, refreshErr)
+	}
+	return fn(ctx)
+}
+
+// clearStatements forgets the statements prepared on conn, which the server
+// planned with the OIDs of the time.
+func clearStatements(ctx context.Context, conn *pgx.Conn) error {
+	if sc := conn.StatementCache(); sc != nil {
+		return sc.Clear(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package customtype
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// TestIsOIDChange checks IsOIDChange against the errors of an OID that has
+// changed, as the server, pgx v4.13 and pgtype v1.8 give them.  pgtype's are
+// got from pgtype itself, so that one rewording them fails here; pgx's
+// encoding error needs a connection, so it's written out as pgx words it.
+func TestIsOIDChange(t *testing.T) {
+	const oid = 16001
+	ci := pgtype.NewConnInfo()
+
+	// A record with a field of the OID, as the server sends a row().
+	record := make([]byte, 12)
+	binary.BigEndian.PutUint32(record, 1)
+	binary.BigEndian.PutUint32(record[4:], oid)
+	binary.BigEndian.PutUint32(record[8:], 0)
+
+	scanErr := func(formatCode int16, dst interface{}) error {
+		return ci.Scan(oid, formatCode, []byte("(640,480,P)"), dst)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"scanned into a struct", scanErr(pgtype.TextFormatCode, &Resolution{}), true},
+		{"scanned into a string in binary", scanErr(pgtype.BinaryFormatCode, new(string)), true},
+		{"scanned by pgx", pgx.ScanArgError{ColumnIndex: 1, Err: scanErr(pgtype.TextFormatCode, &Resolution{})}, true},
+		{"record field", (&pgtype.Record{}).DecodeBinary(ci, record), true},
+		{"encoded by pgx", pgx.SerializationError(fmt.Sprintf("Cannot encode %T into oid %v - %T must implement Encoder or be converted to a string", Resolution{}, oid, Resolution{})), true},
+		{"wrapped", fmt.Errorf("failed to query resolutions: %w", scanErr(pgtype.TextFormatCode, &Resolution{})), true},
+		{"oid mismatch", fmt.Errorf("failed to decode field 2: %w", ErrOIDMismatch), true},
+		{"cache lookup", &pgconn.PgError{Code: "XX000", Message: fmt.Sprintf("cache lookup failed for type %d", oid)}, true},
+		{"wrong data type", &pgconn.PgError{Code: "42804", Message: "wrong data type: 16001, expected 16005"}, true},
+		{"cached plan", &pgconn.PgError{Code: "0A000", Message: "cached plan must not change result type"}, true},
+
+		{"nil", nil, false},
+		{"other error", errors.New("connection reset by peer"), false},
+		{"other server error", &pgconn.PgError{Code: "XX000", Message: "unknown oid 16001"}, false},
+		{"other serialization error", pgx.SerializationError("Cannot encode time.Duration - out of range"), false},
+		{"known oid", ci.Scan(pgtype.Int4OID, pgtype.TextFormatCode, []byte("x"), new(int32)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.want && tt.err == nil {
+				t.Fatal("got no error to check")
+			}
+			if got := IsOIDChange(tt.err); got != tt.want {
+				t.Errorf("IsOIDChange(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
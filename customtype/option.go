@@ -0,0 +1,159 @@
+package customtype
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgtype"
+)
+
+// Option is a value that may be missing.  A struct with Option fields can be
+// scanned from, and sent as, a composite directly, so a nullable field no
+// longer needs a parallel DTO with pointer fields:
+//
+//	type Resolution struct {
+//		Width, Height customtype.Option[int]
+//		Scan          customtype.Option[rune]
+//	}
+//
+// A null field scans as None, and None is sent as a null.
+type Option[T any] struct {
+	value T
+	some  bool
+}
+
+// Some is an Option holding v.
+func Some[T any](v T) Option[T] {
+	return Option[T]{value: v, some: true}
+}
+
+// None is an Option holding nothing.  It is the same as the zero Option.
+func None[T any]() Option[T] {
+	return Option[T]{}
+}
+
+// IsSome reports whether there is a value.
+func (o Option[T]) IsSome() bool {
+	return o.some
+}
+
+// Unwrap returns the value and panics if there isn't one.
+func (o Option[T]) Unwrap() T {
+	if !o.some {
+		panic(fmt.Sprintf("unwrap of empty Option[%T]", o.value))
+	}
+	return o.value
+}
+
+// GetOr returns the value, or def if there isn't one.
+func (o Option[T]) GetOr(def T) T {
+	if !o.some {
+		return def
+	}
+	return o.value
+}
+
+// String formats the value, or "None".
+func (o Option[T]) String() string {
+	if !o.some {
+		return "None"
+	}
+	return fmt.Sprint(o.value)
+}
+
+// Value sends None as a null and the value as database/sql would.  pgx only
+// uses it when the parameter's type doesn't accept the Option itself.
+func (o Option[T]) Value() (driver.Value, error) {
+	if !o.some {
+		return nil, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(o.value)
+}
+
+// MarshalJSON writes None as null and the value as encoding/json would.
+func (o Option[T]) MarshalJSON() ([]byte, error) {
+	if !o.some {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+// UnmarshalJSON reads null as None.
+func (o *Option[T]) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		*o = Option[T]{}
+		return nil
+	}
+
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*o = Some(v)
+	return nil
+}
+
+// optionSource is what structValues looks for to send an Option field, and
+// DefinitionFor to find its type.
+type optionSource interface {
+	optionValue() (interface{}, bool)
+	optionType() reflect.Type
+}
+
+// optionTarget is what a composite looks for to scan into an Option field,
+// and what a record in the text format looks for to parse into one.
+type optionTarget interface {
+	assignOption(src pgtype.Value) error
+	scanOptionText(ci *pgtype.ConnInfo, src []byte) error
+}
+
+// optionSetter is what RowToStruct looks for to set an Option field from a
+// column.
+type optionSetter interface {
+	setSome(v reflect.Value)
+}
+
+func (o Option[T]) optionValue() (interface{}, bool) {
+	return o.value, o.some
+}
+
+func (o Option[T]) optionType() reflect.Type {
+	return reflect.TypeOf(&o.value).Elem()
+}
+
+func (o *Option[T]) setSome(v reflect.Value) {
+	*o = Some(v.Interface().(T))
+}
+
+func (o *Option[T]) assignOption(src pgtype.Value) error {
+	if src.Get() == nil {
+		*o = Option[T]{}
+		return nil
+	}
+
+	// Assigning to the value in place keeps a pointer in it that's already
+	// set, as a composite does, and keeps value from escaping.
+	o.some = false
+	if err := assignField(src, &o.value); err != nil {
+		return err
+	}
+	o.some = true
+	return nil
+}
+
+func (o *Option[T]) scanOptionText(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		*o = Option[T]{}
+		return nil
+	}
+
+	var value T
+	if err := ci.Scan(0, pgtype.TextFormatCode, src, &value); err != nil {
+		return err
+	}
+	*o = Some(value)
+	return nil
+}
@@ -0,0 +1,283 @@
+package customtype
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// An API paging through a table with OFFSET reads and throws away every row
+// before the page, and skips or repeats rows when others are inserted
+// meanwhile.  Keyset pagination carries on from the last row instead, by the
+// values of the keys the rows are ordered by, which may well be fields of a
+// composite:
+//
+//	type fooRow struct {
+//		ID  int
+//		Res customtype.Resolution
+//	}
+//
+//	res := customtype.Column[customtype.Resolution]("res")
+//	p := customtype.NewPaginator[fooRow](customtype.NewQuery("SELECT id, res FROM foo"), 20).
+//		OrderBy(res.Field("Width"), func(r fooRow) interface{} { return r.Res.Width }).
+//		OrderBy(customtype.Column[int]("id"), func(r fooRow) interface{} { return r.ID })
+//	page, err := p.Page(ctx, pool, cursor)
+//
+// gives the 20 rows after the cursor, the first 20 for an empty one, and in
+// page.Next the cursor for the page after them.  A cursor is opaque to the
+// client: the keys of the last row, in JSON and base64, with a fingerprint
+// of the query, its conditions and their arguments, so that a cursor from
+// another can't be given by mistake.
+//
+// The keys have to order the rows completely, so the last of them is
+// usually a primary key, and none of them can be null, since a null isn't
+// greater or less than anything.  Keys all ascending or all descending are
+// compared as a row, (("res")."width", "id") > ($1, $2), which an index on
+// them serves; mixed directions are spelled out key by key.
+
+// ErrBadCursor is the error of a cursor that isn't one the paginator made.
+var ErrBadCursor = errors.New("invalid cursor")
+
+// Paginator pages through the rows of a query of T in the order of its keys.
+type Paginator[T any] struct {
+	query *Query
+	limit int
+	keys  []pageKey[T]
+	err   error
+}
+
+type pageKey[T any] struct {
+	sql   string
+	desc  bool
+	value func(T) interface{}
+}
+
+// Page is a page of rows, and the cursor for the page after it, which is
+// empty after the last page.
+type Page[T any] struct {
+	Rows []T
+	Next string
+}
+
+// NewPaginator pages through the rows of q, limit at a time.  q's own
+// conditions are kept, and its order by, which the paginator's keys replace,
+// is ignored.
+func NewPaginator[T any](q *Query, limit int) *Paginator[T] {
+	p := &Paginator[T]{query: q, limit: limit}
+	if limit <= 0 {
+		p.err = fmt.Errorf("a page needs at least one row, not %d", limit)
+	}
+	return p
+}
+
+// OrderBy adds the key f, ascending, whose value in a row value gives.
+func (p *Paginator[T]) OrderBy(f FieldRef, value func(T) interface{}) *Paginator[T] {
+	return p.orderBy(f, false, value)
+}
+
+// OrderByDesc adds the key f, descending, whose value in a row value gives.
+func (p *Paginator[T]) OrderByDesc(f FieldRef, value func(T) interface{}) *Paginator[T] {
+	return p.orderBy(f, true, value)
+}
+
+func (p *Paginator[T]) orderBy(f FieldRef, desc bool, value func(T) interface{}) *Paginator[T] {
+	sql, err := f.SQL()
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	p.keys = append(p.keys, pageKey[T]{sql: sql, desc: desc, value: value})
+	return p
+}
+
+// Page runs the query for the page after cursor, the first page if it's
+// empty.
+func (p *Paginator[T]) Page(ctx context.Context, q Querier, cursor string) (Page[T], error) {
+	sql, args, err := p.build(cursor)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	rows, err := QueryAll[T](ctx, q, sql, args...)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	page := Page[T]{Rows: rows}
+	if len(rows) > p.limit {
+		page.Rows = rows[:p.limit]
+		if page.Next, err = p.cursor(page.Rows[p.limit-1]); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+// build is the SQL and arguments for the page after cursor.  It asks for a
+// row more than the page has, to tell whether there's another page.
+func (p *Paginator[T]) build(cursor string) (string, []interface{}, error) {
+	if p.err == nil && p.query.err != nil {
+		p.err = p.query.err
+	}
+	if p.err == nil && len(p.keys) == 0 {
+		p.err = errors.New("a paginator needs a key to order by")
+	}
+	if p.err != nil {
+		return "", nil, fmt.Errorf("failed to build page query: %w", p.err)
+	}
+
+	args := append([]interface{}(nil), p.query.args...)
+	where := append([]string(nil), p.query.where...)
+	if cursor != "" {
+		values, err := p.decode(cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = "$" + strconv.Itoa(len(args))
+		}
+		where = append(where, p.after(placeholders))
+	}
+
+	var sql strings.Builder
+	sql.WriteString(p.query.sql)
+	if len(where) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(where, " AND "))
+	}
+	order := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		order[i] = k.sql
+		if k.desc {
+			order[i] += " DESC"
+		}
+	}
+	fmt.Fprintf(&sql, " ORDER BY %s LIMIT %d", strings.Join(order, ", "), p.limit+1)
+	return sql.String(), args, nil
+}
+
+// after is the condition for the rows after the keys given by placeholders.
+func (p *Paginator[T]) after(placeholders []string) string {
+	uniform := true
+	for _, k := range p.keys {
+		uniform = uniform && k.desc == p.keys[0].desc
+	}
+	if uniform {
+		op := ">"
+		if p.keys[0].desc {
+			op = "<"
+		}
+		columns := make([]string, len(p.keys))
+		for i, k := range p.keys {
+			columns[i] = k.sql
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), op, strings.Join(placeholders, ", "))
+	}
+
+	// (a > $1) OR (a = $1 AND b < $2) OR ...
+	alternatives := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, p.keys[j].sql+" = "+placeholders[j])
+		}
+		op := ">"
+		if k.desc {
+			op = "<"
+		}
+		terms = append(terms, k.sql+" "+op+" "+placeholders[i])
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// fingerprint identifies the query a cursor is for, its conditions and
+// their arguments included, so that a cursor for one user's rows isn't taken
+// for another's, and its keys.  An argument goes in as JSON, which is the
+// same for a pointer as for what it points to, or as fmt prints it if it
+// has none.
+func (p *Paginator[T]) fingerprint() string {
+	h := sha256.New()
+	h.Write([]byte(p.query.sql))
+	for _, w := range p.query.where {
+		fmt.Fprintf(h, "\x00where\x00%s", w)
+	}
+	for _, arg := range p.query.args {
+		data, err := json.Marshal(arg)
+		if err != nil {
+			data = []byte(fmt.Sprint(arg))
+		}
+		fmt.Fprintf(h, "\x00arg\x00%T\x00%s", arg, data)
+	}
+	for _, k := range p.keys {
+		fmt.Fprintf(h, "\x00%s\x00%t", k.sql, k.desc)
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:8])
+}
+
+// pageCursor is what a cursor holds.
+type pageCursor struct {
+	Query string            `json:"q"`
+	Keys  []json.RawMessage `json:"k"`
+}
+
+// cursor is the cursor for the rows after row.
+func (p *Paginator[T]) cursor(row T) (string, error) {
+	c := pageCursor{Query: p.fingerprint(), Keys: make([]json.RawMessage, len(p.keys))}
+	for i, k := range p.keys {
+		value := k.value(row)
+		if v := reflect.ValueOf(value); !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", fmt.Errorf("cannot make a cursor from key %s, it is null", k.sql)
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("cannot make a cursor from key %s: %w", k.sql, err)
+		}
+		c.Keys[i] = data
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decode is the key values in cursor, each of the Go type its key's value
+// function gives.
+func (p *Paginator[T]) decode(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+	var c pageCursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+	if c.Query != p.fingerprint() || len(c.Keys) != len(p.keys) {
+		return nil, fmt.Errorf("%w: it is for another query", ErrBadCursor)
+	}
+
+	var zero T
+	values := make([]interface{}, len(p.keys))
+	for i, k := range p.keys {
+		t := reflect.TypeOf(k.value(zero))
+		if t == nil {
+			return nil, fmt.Errorf("cannot page by key %s, its value function gives an untyped nil", k.sql)
+		}
+		value := reflect.New(t)
+		if err := json.Unmarshal(c.Keys[i], value.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: key %s: %v", ErrBadCursor, k.sql, err)
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
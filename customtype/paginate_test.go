@@ -0,0 +1,168 @@
+package customtype
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type pageRow struct {
+	ID  int
+	Res Resolution
+}
+
+var (
+	pageWidth = Column[Resolution]("res").Field("Width")
+	pageID    = Column[int]("id")
+)
+
+func pageByWidth(r pageRow) interface{} { return r.Res.Width }
+func pageByID(r pageRow) interface{}    { return r.ID }
+
+// TestPaginatorAfter checks the condition for the rows after a cursor: a
+// row comparison with the keys all one way, and key by key with them mixed.
+func TestPaginatorAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		p    *Paginator[pageRow]
+		want string
+	}{
+		{
+			name: "ascending",
+			p:    NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 20).OrderBy(pageWidth, pageByWidth).OrderBy(pageID, pageByID),
+			want: `(("res")."width", "id") > ($1, $2)`,
+		},
+		{
+			name: "descending",
+			p:    NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 20).OrderByDesc(pageWidth, pageByWidth).OrderByDesc(pageID, pageByID),
+			want: `(("res")."width", "id") < ($1, $2)`,
+		},
+		{
+			name: "mixed",
+			p:    NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 20).OrderByDesc(pageWidth, pageByWidth).OrderBy(pageID, pageByID),
+			want: `((("res")."width" < $1) OR (("res")."width" = $1 AND "id" > $2))`,
+		},
+		{
+			name: "one key",
+			p:    NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 20).OrderBy(pageID, pageByID),
+			want: `("id") > ($1)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placeholders := []string{"$1", "$2"}[:len(tt.p.keys)]
+			if got := tt.p.after(placeholders); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPaginatorBuild checks the query for a page, with its own conditions
+// and arguments ahead of the cursor's.
+func TestPaginatorBuild(t *testing.T) {
+	p := NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo").Where(pageWidth, ">=", 640), 2).
+		OrderBy(pageWidth, pageByWidth).
+		OrderBy(pageID, pageByID)
+	cursor, err := p.cursor(pageRow{ID: 3, Res: Resolution{Width: 1920}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		p        *Paginator[pageRow]
+		cursor   string
+		wantSQL  string
+		wantArgs []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "first page",
+			p:        p,
+			wantSQL:  `SELECT id, res FROM foo WHERE ("res")."width" >= $1 ORDER BY ("res")."width", "id" LIMIT 3`,
+			wantArgs: []interface{}{640},
+		},
+		{
+			name:     "next page",
+			p:        p,
+			cursor:   cursor,
+			wantSQL:  `SELECT id, res FROM foo WHERE ("res")."width" >= $1 AND (("res")."width", "id") > ($2, $3) ORDER BY ("res")."width", "id" LIMIT 3`,
+			wantArgs: []interface{}{640, 1920, 3},
+		},
+		{name: "no keys", p: NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 2), wantErr: true},
+		{name: "no rows", p: NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 0).OrderBy(pageID, pageByID), wantErr: true},
+		{name: "bad field", p: NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 2).OrderBy(Column[Resolution]("res").Field("Depth"), pageByID), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := tt.p.build(tt.cursor)
+			switch {
+			case tt.wantErr && err == nil:
+				t.Fatalf("built %s, want an error", sql)
+			case !tt.wantErr && err != nil:
+				t.Fatalf("failed to build: %v", err)
+			}
+			if sql != tt.wantSQL || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got  %s %v\nwant %s %v", sql, args, tt.wantSQL, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestPaginatorDecode checks that a cursor gives back the keys it was made
+// from, as their own types, and that one the paginator didn't make, or made
+// for another query, is a bad cursor.
+func TestPaginatorDecode(t *testing.T) {
+	paginator := func(minWidth int) *Paginator[pageRow] {
+		return NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo").Where(pageWidth, ">=", minWidth), 20).
+			OrderBy(pageWidth, pageByWidth).
+			OrderBy(pageID, pageByID)
+	}
+	p := paginator(640)
+	cursor, err := p.cursor(pageRow{ID: 3, Res: Resolution{Width: 1920}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+	fingerprint := p.fingerprint()
+
+	tests := []struct {
+		name    string
+		p       *Paginator[pageRow]
+		cursor  string
+		want    []interface{}
+		wantErr bool
+	}{
+		{name: "round trip", p: p, cursor: cursor, want: []interface{}{1920, 3}},
+		{name: "same query", p: paginator(640), cursor: cursor, want: []interface{}{1920, 3}},
+		{name: "other argument", p: paginator(1024), cursor: cursor, wantErr: true},
+		{name: "other condition", p: NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo"), 20).OrderBy(pageWidth, pageByWidth).OrderBy(pageID, pageByID), cursor: cursor, wantErr: true},
+		{name: "other direction", p: NewPaginator[pageRow](NewQuery("SELECT id, res FROM foo").Where(pageWidth, ">=", 640), 20).OrderByDesc(pageWidth, pageByWidth).OrderBy(pageID, pageByID), cursor: cursor, wantErr: true},
+		{name: "not base64", p: p, cursor: "not a cursor!", wantErr: true},
+		{name: "not json", p: p, cursor: encode("[1920, 3]"), wantErr: true},
+		{name: "unknown field", p: p, cursor: encode(`{"q":"` + fingerprint + `","k":[1920,3],"offset":40}`), wantErr: true},
+		{name: "too few keys", p: p, cursor: encode(`{"q":"` + fingerprint + `","k":[1920]}`), wantErr: true},
+		{name: "wrong type", p: p, cursor: encode(`{"q":"` + fingerprint + `","k":["wide",3]}`), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.decode(tt.cursor)
+			switch {
+			case tt.wantErr && !errors.Is(err, ErrBadCursor):
+				t.Fatalf("decoded %v, %v, want a bad cursor", got, err)
+			case !tt.wantErr && err != nil:
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
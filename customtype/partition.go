@@ -0,0 +1,145 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// A big export is one query on one connection, which leaves the server's
+// other cores and the rest of the pool idle while it decodes row after row.
+// Splitting the keyspace lets it go as several queries at once instead, each
+// on a connection of its own and decoded in a goroutine of its own:
+//
+//	partitions := customtype.SplitRange(1, 10_000_001, 8)
+//	rows := customtype.QueryPartitions[customtype.Foo](ctx, pool,
+//		"SELECT foo FROM foo WHERE id >= $1 AND id < $2", partitions, 4)
+//	for row := range rows {
+//		if row.Err != nil {
+//			return row.Err
+//		}
+//		export(row.Value)
+//	}
+//
+// A partition is the arguments of a query, so the keyspace needn't be a
+// range: WHERE id % $1 = $2 with {8, 0} to {8, 7} splits it by hash.  The
+// partitions are run at most workers at a time, in the order given, which
+// the pool's MaxConns should allow for, as a worker waits on a connection
+// like any other query.  The rows of a partition come in their order, but
+// are interleaved with the others'.
+
+// Partition is the arguments of the query for one part of the keyspace.
+type Partition struct {
+	Args []interface{}
+}
+
+// PartitionRow is a row of a partitioned query, or the error that stopped
+// it, with the index of its partition.
+type PartitionRow[T any] struct {
+	Partition int
+	Value     T
+	Err       error
+}
+
+// SplitRange splits the keys from from up to but not including to into n
+// partitions of as near the same size as they can be, each with the
+// arguments $1 and $2 of the query: the first key in it and the key after
+// its last.  There are fewer than n if there are fewer keys, and none if
+// there are no keys.
+func SplitRange(from, to int64, n int) []Partition {
+	if to <= from || n <= 0 {
+		return nil
+	}
+	// The span may be more than an int64 holds, but never a uint64.
+	span := uint64(to) - uint64(from)
+	if uint64(n) > span {
+		n = int(span)
+	}
+	size, larger := span/uint64(n), span%uint64(n)
+
+	partitions := make([]Partition, n)
+	start := from
+	for i := range partitions {
+		length := size
+		if uint64(i) < larger {
+			length++
+		}
+		end := int64(uint64(start) + length)
+		partitions[i] = Partition{Args: []interface{}{start, end}}
+		start = end
+	}
+	return partitions
+}
+
+// QueryPartitions runs sql once for each partition, at most workers at a
+// time, or all at once if workers isn't positive, and sends the rows down the
+// channel it returns, decoded as ForEach decodes them.  The first partition
+// to fail sends its error and stops the others.  The channel is closed once
+// every partition is done or has stopped, or once ctx is done, so a caller
+// that stops reading early should cancel ctx to let the workers go.
+func QueryPartitions[T any](ctx context.Context, pool *pgxpool.Pool, sql string, partitions []Partition, workers int) <-chan PartitionRow[T] {
+	rows := make(chan PartitionRow[T])
+	if workers <= 0 || workers > len(partitions) {
+		workers = len(partitions)
+	}
+
+	// An error stops the others by cancelling ctx, which mustn't stop the
+	// error itself, so that's sent until the caller's ctx is done.
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range partitions {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var failed sync.Once
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				err := ForEach(ctx, pool, sql, func(value T) error {
+					if !sendRow(ctx, rows, PartitionRow[T]{Partition: i, Value: value}) {
+						return ctx.Err()
+					}
+					return nil
+				}, partitions[i].Args...)
+				if err == nil || ctx.Err() != nil {
+					continue
+				}
+				failed.Do(func() {
+					sendRow(parent, rows, PartitionRow[T]{Partition: i, Err: fmt.Errorf("partition %d failed: %w", i, err)})
+					cancel()
+				})
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(rows)
+	}()
+	return rows
+}
+
+// sendRow sends row unless ctx is done first.
+func sendRow[T any](ctx context.Context, rows chan<- PartitionRow[T], row PartitionRow[T]) bool {
+	select {
+	case rows <- row:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
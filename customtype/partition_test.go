@@ -0,0 +1,65 @@
+package customtype
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestSplitRange checks the partitions of a range of keys: as near the same
+// size as they can be, larger first, and between them every key once.
+func TestSplitRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int64
+		n        int
+		want     [][2]int64
+	}{
+		{name: "even", from: 0, to: 9, n: 3, want: [][2]int64{{0, 3}, {3, 6}, {6, 9}}},
+		{name: "uneven", from: 1, to: 11, n: 3, want: [][2]int64{{1, 5}, {5, 8}, {8, 11}}},
+		{name: "one", from: 1, to: 11, n: 1, want: [][2]int64{{1, 11}}},
+		{name: "more partitions than keys", from: 5, to: 8, n: 10, want: [][2]int64{{5, 6}, {6, 7}, {7, 8}}},
+		{name: "negative", from: -6, to: 0, n: 2, want: [][2]int64{{-6, -3}, {-3, 0}}},
+		{
+			name: "every int64", from: math.MinInt64, to: math.MaxInt64, n: 2,
+			want: [][2]int64{{math.MinInt64, 0}, {0, math.MaxInt64}},
+		},
+		{name: "no keys", from: 5, to: 5, n: 3},
+		{name: "backwards", from: 8, to: 5, n: 3},
+		{name: "no partitions", from: 0, to: 9, n: 0},
+		{name: "negative partitions", from: 0, to: 9, n: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][2]int64
+			for _, p := range SplitRange(tt.from, tt.to, tt.n) {
+				if len(p.Args) != 2 {
+					t.Fatalf("got args %v, want the first key and the key after the last", p.Args)
+				}
+				got = append(got, [2]int64{p.Args[0].(int64), p.Args[1].(int64)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSendRow checks that a row isn't waited on to be read once ctx is done.
+func TestSendRow(t *testing.T) {
+	rows := make(chan PartitionRow[int], 1)
+	if !sendRow(context.Background(), rows, PartitionRow[int]{Value: 1}) {
+		t.Fatal("a row with room for it wasn't sent")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if sendRow(ctx, rows, PartitionRow[int]{Value: 2}) {
+		t.Fatal("a row was sent to a full channel")
+	}
+	if row := <-rows; row.Value != 1 {
+		t.Errorf("got %v, want the first row", row)
+	}
+}
@@ -0,0 +1,90 @@
+// Package pgtest starts postgres in a container for integration tests, with
+// the schema of testCustomType's demo in it, so that registering the types
+// and querying them can be tested without a database set up by hand.  It
+// needs Docker, or whatever else testcontainers can run containers with, and
+// skips the tests that use it when there isn't any, or with -short.
+package pgtest
+
+import (
+	"context"
+	_ "embed"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"testCustomType/customtype"
+)
+
+// Schema is the demo's schema: resolution, display and the tables and
+// function that use them, with the rows the demo queries.
+//
+//go:embed schema.sql
+var Schema string
+
+// Image is the postgres image Start runs.
+const Image = "postgres:16-alpine"
+
+// Start starts postgres with Schema applied, for as long as t runs, and
+// returns its connection string.
+func Start(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping a test that needs a postgres container in short mode")
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	container, err := postgres.Run(ctx, Image,
+		postgres.WithDatabase("customtype"),
+		postgres.WithUsername("customtype"),
+		postgres.WithPassword("customtype"),
+		// Postgres restarts once it has run the init scripts, so it isn't
+		// ready until the second time it says it is.
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).
+			WithStartupTimeout(time.Minute)),
+	)
+	if err != nil {
+		t.Fatalf("failed to start postgres: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Errorf("failed to stop postgres: %v", err)
+		}
+	})
+
+	connString, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("failed to get the connection string: %v", err)
+	}
+
+	// Without arguments Exec uses the simple protocol, which runs the whole
+	// schema in one go.
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		t.Fatalf("failed to connect to postgres: %v", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, Schema); err != nil {
+		t.Fatalf("failed to apply the schema: %v", err)
+	}
+
+	return connString
+}
+
+// Connect connects a pool to the database at connString with the registry's
+// types registered, which is closed once t is done.
+func Connect(t *testing.T, connString string, registry *customtype.TypeRegistry) *pgxpool.Pool {
+	t.Helper()
+	pool, err := customtype.Connect(context.Background(), connString, registry)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
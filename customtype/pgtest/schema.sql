@@ -0,0 +1,29 @@
+-- The schema testCustomType's demo runs against, which pgtest applies to the
+-- databases it starts.
+
+create type resolution as (
+    width int,
+    height int,
+    scan char
+);
+
+create table resolution_defaults (scan char default 'P');
+
+create table foo (id int primary key, res resolution);
+insert into foo values (1, (10, 10, 'P'));
+insert into foo values (2, null);
+insert into foo values (3, (-10, 10, 'P'));
+insert into foo values (4, (10, 10, null));
+insert into foo values (5, (null, null, null));
+
+create function wider_than(w int) returns setof resolution
+    language sql as $$ select res from foo where (res).width > w $$;
+
+create type display as (
+    res resolution,
+    label text
+);
+
+create table bar (id int primary key, disp display);
+insert into bar values (1, ((1920, 1080, 'P'), 'HD'));
+insert into bar values (2, (null, 'unknown'));
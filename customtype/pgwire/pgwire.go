@@ -0,0 +1,229 @@
+// Package pgwire records the messages a pgx connection and postgres send
+// each other, and replays them to a connection later without postgres, so
+// that decoding composites can be tested in CI deterministically, down to
+// the bytes a NULL composite or a NULL field comes in.
+//
+// A test with a database records what it does, once:
+//
+//	config := pgwire.Record(t, connString, "testdata/wire/resolutions.json")
+//	conn, err := pgx.ConnectConfig(ctx, config)
+//	...
+//	res, err := customtype.QueryResolutions(ctx, conn, "SELECT res FROM foo ORDER BY id")
+//
+// and a test without one replays it, doing the same and getting the same:
+//
+//	config := pgwire.Replay(t, "testdata/wire/resolutions.json")
+//	conn, err := pgx.ConnectConfig(ctx, config)
+//
+// The replay checks every message the connection sends against the one
+// recorded, and answers with what postgres answered then, so it has to be
+// given the same statements, with the same arguments, in the same order.
+// A connection registering types asks for their OIDs like any other
+// statement, which is recorded and replayed with the rest, unless the
+// registry's Metadata spares it.  Both sides use one connection, without
+// TLS, which would hide the messages, and without pgx's statement cache,
+// whose statement names change from run to run.
+package pgwire
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"unicode/utf8"
+
+	"github.com/jackc/pgproto3/v2"
+)
+
+// Fixture is a conversation between a connection and postgres, after the
+// connection has started up.
+type Fixture struct {
+	Messages []Message `json:"messages"`
+}
+
+// Message is one of the messages of a fixture.
+type Message struct {
+	// Frontend is whether the connection sent it, rather than postgres.
+	Frontend bool
+	Message  pgproto3.Message
+}
+
+// ReadFixture reads the fixture at path.
+func ReadFixture(path string) (Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixture{}, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Fixture{}, fmt.Errorf("failed to read fixture %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// WriteFile writes the fixture to path, a message to a line.
+func (f Fixture) WriteFile(path string) error {
+	buf := []byte("{\"messages\": [\n")
+	for i, m := range f.Messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to write fixture: %w", err)
+		}
+		buf = append(buf, "  "...)
+		buf = append(buf, data...)
+		if i < len(f.Messages)-1 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '\n')
+	}
+	buf = append(buf, "]}\n"...)
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// message is how a Message is written: which side sent it, the name of its
+// type, and the message as pgproto3 marshals it.
+type message struct {
+	From    string          `json:"from"`
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message"`
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	data, err := marshalMessage(m.Message)
+	if err != nil {
+		return nil, err
+	}
+	from := "backend"
+	if m.Frontend {
+		from = "frontend"
+	}
+	return json.Marshal(message{From: from, Type: typeName(m.Message), Message: data})
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw message
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var kinds map[byte]func() pgproto3.Message
+	switch raw.From {
+	case "frontend":
+		kinds, m.Frontend = frontendMessages, true
+	case "backend":
+		kinds, m.Frontend = backendMessages, false
+	default:
+		return fmt.Errorf("a message is from the frontend or the backend, not %q", raw.From)
+	}
+	for _, newMessage := range kinds {
+		if msg := newMessage(); typeName(msg) == raw.Type {
+			if err := json.Unmarshal(raw.Message, msg); err != nil {
+				return fmt.Errorf("failed to read %s: %w", raw.Type, err)
+			}
+			m.Message = msg
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no %s message %s", raw.From, raw.Type)
+}
+
+// marshalMessage is msg as pgproto3 marshals it, but for a DataRow, whose
+// values pgproto3 writes as text unless they have control characters, and
+// which we write in hex unless they're valid UTF-8, so that a binary value
+// survives the JSON.
+func marshalMessage(msg pgproto3.Message) ([]byte, error) {
+	row, ok := msg.(*pgproto3.DataRow)
+	if !ok {
+		return json.Marshal(msg)
+	}
+
+	values := make([]map[string]string, len(row.Values))
+	for i, v := range row.Values {
+		switch {
+		case v == nil:
+		case printable(v):
+			values[i] = map[string]string{"text": string(v)}
+		default:
+			values[i] = map[string]string{"binary": hex.EncodeToString(v)}
+		}
+	}
+	return json.Marshal(struct {
+		Type   string
+		Values []map[string]string
+	}{Type: "DataRow", Values: values})
+}
+
+func printable(v []byte) bool {
+	for _, b := range v {
+		if b < 32 {
+			return false
+		}
+	}
+	return utf8.Valid(v)
+}
+
+func typeName(msg pgproto3.Message) string {
+	return reflect.TypeOf(msg).Elem().Name()
+}
+
+// frontendMessages and backendMessages make a message of each type the
+// connection and postgres send, by the byte the type starts with on the
+// wire.  Startup and authentication come before what's recorded and aren't
+// among them.
+var frontendMessages = map[byte]func() pgproto3.Message{
+	'B': func() pgproto3.Message { return &pgproto3.Bind{} },
+	'C': func() pgproto3.Message { return &pgproto3.Close{} },
+	'D': func() pgproto3.Message { return &pgproto3.Describe{} },
+	'E': func() pgproto3.Message { return &pgproto3.Execute{} },
+	'H': func() pgproto3.Message { return &pgproto3.Flush{} },
+	'P': func() pgproto3.Message { return &pgproto3.Parse{} },
+	'Q': func() pgproto3.Message { return &pgproto3.Query{} },
+	'S': func() pgproto3.Message { return &pgproto3.Sync{} },
+	'X': func() pgproto3.Message { return &pgproto3.Terminate{} },
+	'c': func() pgproto3.Message { return &pgproto3.CopyDone{} },
+	'd': func() pgproto3.Message { return &pgproto3.CopyData{} },
+	'f': func() pgproto3.Message { return &pgproto3.CopyFail{} },
+}
+
+var backendMessages = map[byte]func() pgproto3.Message{
+	'1': func() pgproto3.Message { return &pgproto3.ParseComplete{} },
+	'2': func() pgproto3.Message { return &pgproto3.BindComplete{} },
+	'3': func() pgproto3.Message { return &pgproto3.CloseComplete{} },
+	'A': func() pgproto3.Message { return &pgproto3.NotificationResponse{} },
+	'C': func() pgproto3.Message { return &pgproto3.CommandComplete{} },
+	'D': func() pgproto3.Message { return &pgproto3.DataRow{} },
+	'E': func() pgproto3.Message { return &pgproto3.ErrorResponse{} },
+	'G': func() pgproto3.Message { return &pgproto3.CopyInResponse{} },
+	'H': func() pgproto3.Message { return &pgproto3.CopyOutResponse{} },
+	'I': func() pgproto3.Message { return &pgproto3.EmptyQueryResponse{} },
+	'N': func() pgproto3.Message { return &pgproto3.NoticeResponse{} },
+	'S': func() pgproto3.Message { return &pgproto3.ParameterStatus{} },
+	'T': func() pgproto3.Message { return &pgproto3.RowDescription{} },
+	'Z': func() pgproto3.Message { return &pgproto3.ReadyForQuery{} },
+	'c': func() pgproto3.Message { return &pgproto3.CopyDone{} },
+	'd': func() pgproto3.Message { return &pgproto3.CopyData{} },
+	'n': func() pgproto3.Message { return &pgproto3.NoData{} },
+	't': func() pgproto3.Message { return &pgproto3.ParameterDescription{} },
+}
+
+// decodeMessage decodes the message of type kind with body, sent by the
+// connection if frontend is set.
+func decodeMessage(frontend bool, kind byte, body []byte) (pgproto3.Message, error) {
+	kinds, from := backendMessages, "backend"
+	if frontend {
+		kinds, from = frontendMessages, "frontend"
+	}
+	newMessage, ok := kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("cannot record the %s message %q", from, kind)
+	}
+	msg := newMessage()
+	if err := msg.Decode(append([]byte(nil), body...)); err != nil {
+		return nil, fmt.Errorf("failed to decode the %s message %q: %w", from, kind, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,153 @@
+package pgwire
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Record is the config of a connection to the database at connString whose
+// messages are written to a fixture at path when t ends, from the first the
+// connection sends after starting up.
+func Record(t testing.TB, connString, path string) *pgx.ConnConfig {
+	t.Helper()
+	config, err := pgx.ParseConfig(connString)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", connString, err)
+	}
+	config.TLSConfig = nil
+	config.Fallbacks = nil
+	config.BuildStatementCache = nil
+
+	rec := &recording{}
+	dial := config.DialFunc
+	config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !rec.dial() {
+			return nil, errors.New("a recording has one connection")
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &recordingConn{Conn: conn, rec: rec}, nil
+	}
+	t.Cleanup(func() {
+		fixture, err := rec.fixture()
+		if err != nil {
+			t.Errorf("failed to record %s: %v", path, err)
+			return
+		}
+		if err := fixture.WriteFile(path); err != nil {
+			t.Error(err)
+		}
+	})
+	return config
+}
+
+// recording splits what the connection sends and receives into messages.
+// What postgres sends up to its first ReadyForQuery is the connection
+// starting up, and what the connection sends meanwhile is its startup
+// message and its password, which are skipped.
+type recording struct {
+	mu       sync.Mutex
+	dialed   bool
+	ready    bool
+	started  bool
+	frontend []byte
+	backend  []byte
+	messages []Message
+	err      error
+}
+
+func (r *recording) dial() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dialed := r.dialed
+	r.dialed = true
+	return !dialed
+}
+
+// sent records what the connection sent.
+func (r *recording) sent(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frontend = append(r.frontend, p...)
+
+	// The startup message has no type, only its length.
+	if !r.started {
+		if len(r.frontend) < 4 {
+			return
+		}
+		n := int(binary.BigEndian.Uint32(r.frontend))
+		if len(r.frontend) < n {
+			return
+		}
+		r.frontend = r.frontend[n:]
+		r.started = true
+	}
+	r.frontend = r.split(r.frontend, true)
+}
+
+// received records what postgres sent.
+func (r *recording) received(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.backend = r.split(append(r.backend, p...), false)
+}
+
+// split records the whole messages at the start of buf, and gives what's
+// left of it.
+func (r *recording) split(buf []byte, frontend bool) []byte {
+	for len(buf) >= 5 {
+		n := 1 + int(binary.BigEndian.Uint32(buf[1:]))
+		if len(buf) < n {
+			break
+		}
+		kind, body := buf[0], buf[5:n]
+		buf = buf[n:]
+
+		if !r.ready {
+			// Until postgres is ready, the connection sends only its
+			// password, and postgres how it went.
+			r.ready = !frontend && kind == 'Z'
+			continue
+		}
+		msg, err := decodeMessage(frontend, kind, body)
+		if err != nil {
+			if r.err == nil {
+				r.err = err
+			}
+			continue
+		}
+		r.messages = append(r.messages, Message{Frontend: frontend, Message: msg})
+	}
+	return buf
+}
+
+func (r *recording) fixture() (Fixture, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Fixture{Messages: append([]Message(nil), r.messages...)}, r.err
+}
+
+// recordingConn is a connection to postgres whose traffic is recorded.
+type recordingConn struct {
+	net.Conn
+	rec *recording
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.rec.received(p[:n])
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.rec.sent(p)
+	return c.Conn.Write(p)
+}
@@ -0,0 +1,105 @@
+package pgwire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// Replay is the config of a connection to a server of the fixture at path,
+// rather than to postgres.  The test fails if the connection sends anything
+// but what the fixture has, or stops before the end of it.
+func Replay(t testing.TB, path string) *pgx.ConnConfig {
+	t.Helper()
+	fixture, err := ReadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := pgx.ParseConfig("sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.BuildStatementCache = nil
+
+	client, server := net.Pipe()
+	var once sync.Once
+	config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed := errors.New("a replay has one connection")
+		once.Do(func() { dialed = nil })
+		if dialed != nil {
+			return nil, dialed
+		}
+		return client, nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- replay(server, fixture) }()
+	t.Cleanup(func() {
+		client.Close()
+		if err := <-done; err != nil {
+			t.Errorf("failed to replay %s: %v", path, err)
+		}
+	})
+	return config
+}
+
+// replay serves fixture to the connection at the other end of conn.
+func replay(conn net.Conn, fixture Fixture) error {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(pgproto3.NewChunkReader(conn), conn)
+
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return fmt.Errorf("the connection never started: %w", err)
+	}
+	startup := []pgproto3.BackendMessage{
+		&pgproto3.AuthenticationOk{},
+		&pgproto3.BackendKeyData{},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	}
+	for _, msg := range startup {
+		if err := backend.Send(msg); err != nil {
+			return fmt.Errorf("failed to start the connection: %w", err)
+		}
+	}
+
+	for i, m := range fixture.Messages {
+		if !m.Frontend {
+			if _, err := conn.Write(m.Message.Encode(nil)); err != nil {
+				return fmt.Errorf("failed to send message %d, %s: %w", i, typeName(m.Message), err)
+			}
+			continue
+		}
+
+		got, err := backend.Receive()
+		if err != nil {
+			return fmt.Errorf("the connection stopped at message %d of %d, %s: %w", i, len(fixture.Messages), typeName(m.Message), err)
+		}
+		if !bytes.Equal(got.Encode(nil), m.Message.Encode(nil)) {
+			sent, _ := marshalMessage(got)
+			want, _ := marshalMessage(m.Message)
+			return fmt.Errorf("the connection sent %s as message %d, where the fixture has %s", sent, i, want)
+		}
+		if _, ok := got.(*pgproto3.Terminate); ok {
+			// The connection waits for us to hang up.
+			return nil
+		}
+	}
+
+	// After the fixture, all the connection can do is close.
+	got, err := backend.Receive()
+	if err != nil {
+		return nil
+	}
+	if _, ok := got.(*pgproto3.Terminate); ok {
+		return nil
+	}
+	sent, _ := marshalMessage(got)
+	return fmt.Errorf("the connection sent %s after the end of the fixture", sent)
+}
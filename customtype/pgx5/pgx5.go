@@ -0,0 +1,68 @@
+// Package pgx5 maps the same composite types as customtype for users of pgx
+// v5.  pgx v5 replaces ConnInfo.RegisterDataType with pgtype.Map and codecs,
+// and can load composite, array, domain, enum and range types from the
+// catalog itself, so all that's left to do here is to load the types we map
+// and teach bpchar about runes.
+package pgx5
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"testCustomType/customtype"
+)
+
+// TypeNames returns the names of the types to load for the definitions,
+// including their array types, in the same schema as their elements.
+func TypeNames(defs ...customtype.TypeDefinition) []string {
+	names := make([]string, 0, 2*len(defs))
+	for _, def := range defs {
+		names = append(names, def.TypeName(), customtype.ArrayTypeName(def.TypeName()))
+	}
+	return names
+}
+
+// RegisterTypes loads the named types, and any types they depend on, from the
+// server in a single query and registers them with the connection's type map.
+// The structs in customtype (Resolution, ResolutionDTO, ...) scan as is.
+func RegisterTypes(ctx context.Context, conn *pgx.Conn, names ...string) error {
+	m := conn.TypeMap()
+	m.RegisterType(&pgtype.Type{Name: "bpchar", OID: pgtype.BPCharOID, Codec: RuneCodec{}})
+
+	types, err := conn.LoadTypes(ctx, names)
+	if err != nil {
+		return fmt.Errorf("failed to load types: %w", err)
+	}
+	m.RegisterTypes(types)
+
+	return nil
+}
+
+// AfterConnect returns a hook for pgxpool.Config.AfterConnect that registers
+// the named types on every connection.
+func AfterConnect(names ...string) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		return RegisterTypes(ctx, conn, names...)
+	}
+}
+
+// Connect creates a pool for the database at dsn with the named types
+// registered on every connection.
+func Connect(ctx context.Context, dsn string, names ...string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	config.AfterConnect = AfterConnect(names...)
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,75 @@
+package pgx5
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"testCustomType/customtype"
+)
+
+func TestTypeNames(t *testing.T) {
+	got := TypeNames(
+		customtype.CompositeDefinition{Name: "resolution"},
+		customtype.CompositeDefinition{Name: "myschema.resolution"},
+	)
+	want := []string{"resolution", "_resolution", "myschema.resolution", "myschema._resolution"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestRuneCodec checks that a rune goes to and from a bpchar as it does with
+// customtype: the zero rune as an empty char, and the padding trimmed.
+func TestRuneCodec(t *testing.T) {
+	m := pgtype.NewMap()
+	m.RegisterType(&pgtype.Type{Name: "bpchar", OID: pgtype.BPCharOID, Codec: RuneCodec{}})
+
+	encodes := []struct {
+		r    rune
+		want string
+	}{
+		{'P', "P"},
+		{'é', "é"},
+		{0, ""},
+	}
+	for _, format := range []int16{pgtype.TextFormatCode, pgtype.BinaryFormatCode} {
+		for _, tt := range encodes {
+			got, err := m.Encode(pgtype.BPCharOID, format, tt.r, nil)
+			if err != nil {
+				t.Fatalf("failed to encode %q: %v", tt.r, err)
+			}
+			if got == nil || string(got) != tt.want {
+				t.Errorf("format %d: encoded %q as %q, want %q", format, tt.r, got, tt.want)
+			}
+		}
+	}
+
+	scans := []struct {
+		src     string
+		want    rune
+		wantErr bool
+	}{
+		{src: "P", want: 'P'},
+		{src: "P  ", want: 'P'},
+		{src: "", want: 0},
+		{src: " ", want: 0},
+		{src: "PI", wantErr: true},
+		{src: "\xff", wantErr: true},
+	}
+	for _, format := range []int16{pgtype.TextFormatCode, pgtype.BinaryFormatCode} {
+		for _, tt := range scans {
+			got := rune(-1)
+			err := m.Scan(pgtype.BPCharOID, format, []byte(tt.src), &got)
+			switch {
+			case tt.wantErr && err == nil:
+				t.Errorf("format %d: scanned %q as %q, want an error", format, tt.src, got)
+			case !tt.wantErr && err != nil:
+				t.Errorf("format %d: failed to scan %q: %v", format, tt.src, err)
+			case !tt.wantErr && got != tt.want:
+				t.Errorf("format %d: scanned %q as %q, want %q", format, tt.src, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package pgx5
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RuneCodec is the text codec with the addition of rune support, which is how
+// a char(1) such as Resolution.Scan is mapped.  pgx v4's BPChar did this out
+// of the box, v5's TextCodec does not.
+type RuneCodec struct {
+	pgtype.TextCodec
+}
+
+func (c RuneCodec) PlanEncode(m *pgtype.Map, oid uint32, format int16, value any) pgtype.EncodePlan {
+	if _, ok := value.(rune); ok {
+		return encodePlanRune{}
+	}
+	return c.TextCodec.PlanEncode(m, oid, format, value)
+}
+
+func (c RuneCodec) PlanScan(m *pgtype.Map, oid uint32, format int16, target any) pgtype.ScanPlan {
+	if _, ok := target.(*rune); ok {
+		return scanPlanRune{}
+	}
+	return c.TextCodec.PlanScan(m, oid, format, target)
+}
+
+type encodePlanRune struct{}
+
+// Encode is the same in the text and binary formats.  The zero rune is sent
+// as an empty char, as customtype sends it, since postgres won't take a NUL;
+// it's empty rather than nil, which would be NULL.
+func (encodePlanRune) Encode(value any, buf []byte) ([]byte, error) {
+	if r := value.(rune); r != 0 {
+		return utf8.AppendRune(buf, r), nil
+	}
+	if buf == nil {
+		buf = []byte{}
+	}
+	return buf, nil
+}
+
+type scanPlanRune struct{}
+
+// Scan takes the one character left once the padding is trimmed, or the
+// zero rune if there isn't one, the same in the text and binary formats and
+// as customtype does.
+func (scanPlanRune) Scan(src []byte, target any) error {
+	if src == nil {
+		return fmt.Errorf("cannot scan NULL into %T", target)
+	}
+
+	text := strings.TrimRight(string(src), " ")
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("cannot scan %q into a rune, it is not UTF-8", src)
+	}
+	switch n := utf8.RuneCountInString(text); n {
+	case 0:
+		*target.(*rune) = 0
+	case 1:
+		*target.(*rune), _ = utf8.DecodeRuneInString(text)
+	default:
+		return fmt.Errorf("cannot scan %q into a rune, it is %d characters", src, n)
+	}
+	return nil
+}
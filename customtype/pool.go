@@ -0,0 +1,166 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// RegisterTypes arranges for the registry's types to be registered on every
+// connection the pool makes, and registered again when a connection is
+// acquired after a Refresh or a change to the registry's types.  AfterConnect
+// and BeforeAcquire hooks already set on the config still run, before
+// ours.  If the registry is in PgBouncer mode, the connections are set up for
+// that too.
+func RegisterTypes(config *pgxpool.Config, registry *TypeRegistry) {
+	if registry.PgBouncer {
+		forPgBouncer(config.ConnConfig)
+	}
+
+	previous := config.AfterConnect
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if previous != nil {
+			if err := previous(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		return registry.AfterConnect(ctx, conn)
+	}
+
+	previousAcquire := config.BeforeAcquire
+	config.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		if previousAcquire != nil && !previousAcquire(ctx, conn) {
+			return false
+		}
+
+		return registry.BeforeAcquire(ctx, conn)
+	}
+}
+
+// BeforeAcquire registers the types again on a connection whose OIDs went
+// stale in a Refresh, or whose types have changed since, and forgets its
+// prepared statements.  A connection with a type that has since been removed,
+// or that can't be brought up to date, is destroyed.  It's meant to be a
+// pgxpool BeforeAcquire hook, which RegisterTypes sets up.
+func (r *TypeRegistry) BeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	if r.refreshes.Load() == 0 {
+		return true
+	}
+
+	types := r.snapshot()
+	registered, ok := r.registeredTypes(conn)
+	if ok {
+		if removed := registered.removed(types); len(removed) > 0 {
+			r.logger().log(ctx, pgx.LogLevelInfo, "destroying a connection with types the registry no longer has", map[string]interface{}{"types": removed})
+			return false
+		}
+	}
+	if (!ok || registered == types) && !r.stale(conn) {
+		return true
+	}
+
+	// A lazy connection that hasn't needed the types yet has nothing to
+	// refresh.
+	if r.Lazy && !ok && !r.registeredOn(conn) {
+		return true
+	}
+
+	if err := r.register(ctx, conn, true); err != nil {
+		r.logger().log(ctx, pgx.LogLevelWarn, "destroying a connection whose types can't be registered again", map[string]interface{}{"err": err})
+		return false
+	}
+	if err := clearStatements(ctx, conn); err != nil {
+		r.logger().log(ctx, pgx.LogLevelWarn, "destroying a connection whose prepared statements can't be cleared", map[string]interface{}{"err": err})
+		return false
+	}
+	return true
+}
+
+// stale reports whether the OIDs registered on conn aren't the ones in the
+// cache, or there's nothing in the cache to compare them with, as there
+// isn't for a type just added.
+func (r *TypeRegistry) stale(conn *pgx.Conn) bool {
+	oids, ok := sharedOIDCache.lookup(databaseIdentity(conn), r.oidScope(conn.Config()), r.snapshot().names)
+	if !ok {
+		return true
+	}
+
+	ci := conn.ConnInfo()
+	for name, o := range oids {
+		if dt, ok := ci.DataTypeForName(name); !ok || dt.OID != o.oid {
+			return true
+		}
+	}
+	return false
+}
+
+// Refresh looks the types up again and registers them on the pool's
+// connections, for after a migration has dropped and recreated some of them.
+// The connection Refresh acquires is brought up to date straight away, every
+// other one the next time it is acquired.
+func (r *TypeRegistry) Refresh(ctx context.Context, pool *pgxpool.Pool) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire a connection: %w", err)
+	}
+	defer c.Release()
+
+	database := databaseIdentity(c.Conn())
+	r.logger().log(ctx, pgx.LogLevelInfo, "refreshing types", map[string]interface{}{"database": database})
+	sharedOIDCache.forget(database, r.oidScope(c.Conn().Config()), r.snapshot().names)
+	r.refreshes.Add(1)
+	if err := r.register(ctx, c.Conn(), true); err != nil {
+		return fmt.Errorf("failed to refresh types: %w", err)
+	}
+	if err := clearStatements(ctx, c.Conn()); err != nil {
+		return fmt.Errorf("failed to clear prepared statements: %w", err)
+	}
+
+	return nil
+}
+
+// RefreshAfter runs migrate and then calls Refresh.  It suits any migration
+// tool, golang-migrate for instance:
+//
+//	err := registry.RefreshAfter(ctx, pool, func() error {
+//		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+//			return err
+//		}
+//		return nil
+//	})
+func (r *TypeRegistry) RefreshAfter(ctx context.Context, pool *pgxpool.Pool, migrate func() error) error {
+	if err := migrate(); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	return r.Refresh(ctx, pool)
+}
+
+// Connect creates a pool for the database at dsn with the registry's types
+// registered on every connection.
+func Connect(ctx context.Context, dsn string, registry *TypeRegistry) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	RegisterTypes(config, registry)
+
+	pool, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return pool, nil
+}
+
+// forPgBouncer stops a connection preparing statements, which PgBouncer in
+// transaction pooling mode could send to a server connection other than the
+// one they were prepared on.
+func forPgBouncer(config *pgx.ConnConfig) {
+	config.PreferSimpleProtocol = true
+	config.BuildStatementCache = nil
+}
@@ -0,0 +1,247 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Pools is a set of named pools sharing one registry, such as a primary and
+// its read replicas, or a database per tenant with the same schema.  The
+// definitions are shared, but every database has OIDs of its own, which the
+// registry looks up and caches per database.
+//
+// A service shutting down calls Shutdown with a deadline.  It cancels the
+// registrations waiting to retry, stops the watchers Watch started, and then
+// closes the pools, waiting until the deadline for the connections in use to
+// be released:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//	defer cancel()
+//	if err := pools.Shutdown(ctx); err != nil {
+//		log.Print(err)
+//	}
+type Pools struct {
+	registry *TypeRegistry
+
+	mu    sync.RWMutex
+	pools map[string]*poolEntry
+}
+
+// poolEntry is a pool in the set.  Its ctx is done once the pool is being
+// shut down, which cancels the registrations on its connections and its
+// watchers, and closed is closed once the pool is.
+type poolEntry struct {
+	pool     *pgxpool.Pool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	watchers sync.WaitGroup
+	closed   chan struct{}
+}
+
+// NewPools creates an empty set of pools using registry.
+func NewPools(registry *TypeRegistry) *Pools {
+	return &Pools{registry: registry, pools: make(map[string]*poolEntry)}
+}
+
+// Connect creates a pool for the database at dsn, with the registry's types
+// registered, and adds it to the set under name.
+func (p *Pools) Connect(ctx context.Context, name, dsn string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config for %s: %w", name, err)
+	}
+
+	return p.ConnectConfig(ctx, name, config)
+}
+
+// ConnectConfig creates a pool using config in the same way as Connect.
+func (p *Pools) ConnectConfig(ctx context.Context, name string, config *pgxpool.Config) (*pgxpool.Pool, error) {
+	p.mu.RLock()
+	_, exists := p.pools[name]
+	p.mu.RUnlock()
+	if exists {
+		return nil, fmt.Errorf("there is already a pool called %s", name)
+	}
+
+	entry := &poolEntry{closed: make(chan struct{})}
+	entry.ctx, entry.cancel = context.WithCancel(context.Background())
+	RegisterTypes(config, p.registry)
+	entry.bindHooks(config)
+
+	pool, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		entry.cancel()
+		return nil, fmt.Errorf("failed to connect %s: %w", name, err)
+	}
+	entry.pool = pool
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.pools[name]; exists {
+		entry.shutdown()
+		return nil, fmt.Errorf("there is already a pool called %s", name)
+	}
+	p.pools[name] = entry
+
+	return pool, nil
+}
+
+// bindHooks cancels the registering RegisterTypes set up, and any retrying
+// of it, once the pool is being shut down, whatever the context pgxpool
+// gave it.
+func (e *poolEntry) bindHooks(config *pgxpool.Config) {
+	afterConnect := config.AfterConnect
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		ctx, cancel := e.bind(ctx)
+		defer cancel()
+		return afterConnect(ctx, conn)
+	}
+
+	beforeAcquire := config.BeforeAcquire
+	config.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		ctx, cancel := e.bind(ctx)
+		defer cancel()
+		return beforeAcquire(ctx, conn)
+	}
+}
+
+// bind is ctx, done as well once the pool is being shut down.
+func (e *poolEntry) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(e.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// shutdown cancels the pool's registrations and watchers, waits for the
+// watchers to stop, and closes the pool, which waits for the connections in
+// use to be released.
+func (e *poolEntry) shutdown() {
+	e.cancel()
+	e.watchers.Wait()
+	e.pool.Close()
+	close(e.closed)
+}
+
+// Get returns the pool called name.
+func (p *Pools) Get(name string) (*pgxpool.Pool, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, ok := p.pools[name]
+	if !ok {
+		return nil, false
+	}
+	return entry.pool, true
+}
+
+// Names are the names of the pools, sorted.
+func (p *Pools) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	names := make([]string, 0, len(p.pools))
+	for name := range p.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Watch watches the types of the pool called name with w, as the registry's
+// Watch does, until the pool is removed or the set shut down.  The errors
+// from watching go to w.OnRefresh.
+func (p *Pools) Watch(name string, w Watcher) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	entry, ok := p.pools[name]
+	if !ok {
+		return fmt.Errorf("there is no pool called %s", name)
+	}
+
+	entry.watchers.Add(1)
+	go func() {
+		defer entry.watchers.Done()
+		err := p.registry.Watch(entry.ctx, entry.pool, w)
+		if err != nil && entry.ctx.Err() == nil && w.OnRefresh != nil {
+			w.OnRefresh(err)
+		}
+	}()
+	return nil
+}
+
+// Remove shuts down the pool called name and takes it out of the set.  It
+// waits for the pool's connections in use to be released.
+func (p *Pools) Remove(name string) {
+	p.mu.Lock()
+	entry, ok := p.pools[name]
+	delete(p.pools, name)
+	p.mu.Unlock()
+
+	if ok {
+		entry.shutdown()
+	}
+}
+
+// Refresh refreshes the types on every pool, for after a migration has been
+// run against each of the databases.
+func (p *Pools) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, name := range p.Names() {
+		pool, ok := p.Get(name)
+		if !ok {
+			continue
+		}
+		if err := p.registry.Refresh(ctx, pool); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown shuts every pool down and empties the set, waiting until ctx is
+// done for the connections in use to be released.  A pool whose connections
+// are still in use then goes on closing as they are released, and the error
+// says how many of them there were.
+func (p *Pools) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	pools := p.pools
+	p.pools = make(map[string]*poolEntry)
+	p.mu.Unlock()
+
+	for _, entry := range pools {
+		go entry.shutdown()
+	}
+
+	var errs []error
+	for name, entry := range pools {
+		select {
+		case <-entry.closed:
+		case <-ctx.Done():
+			if inUse := entry.pool.Stat().AcquiredConns(); inUse > 0 {
+				errs = append(errs, fmt.Errorf("failed to drain %s, %d connections are still in use: %w", name, inUse, ctx.Err()))
+			} else {
+				errs = append(errs, fmt.Errorf("failed to drain %s: %w", name, ctx.Err()))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close shuts every pool down and empties the set, as Shutdown does, but
+// waits for as long as the connections in use take to be released.
+func (p *Pools) Close() {
+	_ = p.Shutdown(context.Background())
+}
@@ -0,0 +1,141 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// lazyConfig is a pool that doesn't connect until it's used, to a port
+// nothing listens on, so a set of them can be shut down without a database.
+func lazyConfig(t *testing.T) *pgxpool.Config {
+	t.Helper()
+	config, err := pgxpool.ParseConfig("host=127.0.0.1 port=1 dbname=app user=app connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.LazyConnect = true
+	return config
+}
+
+// TestPoolsShutdown checks that shutting a set of pools down stops their
+// watchers and closes them before the deadline, and that removing one does
+// the same for it alone.
+func TestPoolsShutdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		pools  []string
+		watch  bool
+		remove string
+	}{
+		{name: "empty"},
+		{name: "idle", pools: []string{"primary", "replica"}},
+		{name: "watching", pools: []string{"primary", "replica"}, watch: true},
+		{name: "removed", pools: []string{"primary", "replica"}, watch: true, remove: "replica"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pools := NewPools(&TypeRegistry{})
+			ctx := context.Background()
+			for _, name := range tt.pools {
+				if _, err := pools.ConnectConfig(ctx, name, lazyConfig(t)); err != nil {
+					t.Fatal(err)
+				}
+				if tt.watch {
+					if err := pools.Watch(name, Watcher{Interval: 10 * time.Millisecond, OnRefresh: func(error) {}}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if tt.remove != "" {
+				entry := pools.pools[tt.remove]
+				pools.Remove(tt.remove)
+				select {
+				case <-entry.closed:
+				default:
+					t.Fatalf("%s isn't closed once removed", tt.remove)
+				}
+				if _, ok := pools.Get(tt.remove); ok {
+					t.Fatalf("%s is still in the set", tt.remove)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			if err := pools.Shutdown(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if names := pools.Names(); len(names) != 0 {
+				t.Errorf("got %v after shutting down, want none", names)
+			}
+		})
+	}
+}
+
+// TestPoolsWatch checks what Watch turns away before it starts watching.
+func TestPoolsWatch(t *testing.T) {
+	pools := NewPools(&TypeRegistry{})
+	if _, err := pools.ConnectConfig(context.Background(), "primary", lazyConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	defer pools.Shutdown(context.Background())
+
+	tests := []struct {
+		name string
+		pool string
+		w    Watcher
+	}{
+		{name: "no pool", pool: "replica", w: Watcher{Interval: time.Second}},
+		{name: "no channel or interval", pool: "primary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := pools.Watch(tt.pool, tt.w); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+// TestPoolEntryBindHooks checks that shutting a pool down cancels the
+// registering its hooks are in the middle of, whatever context pgxpool
+// gave them.
+func TestPoolEntryBindHooks(t *testing.T) {
+	entry := &poolEntry{closed: make(chan struct{})}
+	entry.ctx, entry.cancel = context.WithCancel(context.Background())
+
+	blocked := make(chan error, 2)
+	config := &pgxpool.Config{
+		AfterConnect: func(ctx context.Context, conn *pgx.Conn) error {
+			<-ctx.Done()
+			blocked <- ctx.Err()
+			return ctx.Err()
+		},
+		BeforeAcquire: func(ctx context.Context, conn *pgx.Conn) bool {
+			<-ctx.Done()
+			blocked <- ctx.Err()
+			return false
+		},
+	}
+	entry.bindHooks(config)
+
+	go config.AfterConnect(context.Background(), nil)
+	go config.BeforeAcquire(context.Background(), nil)
+	entry.cancel()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-blocked:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want the hook cancelled", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a hook wasn't cancelled by the shutdown")
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Selecting a composite column sends all of it, and with a wide composite,
+// or one big enough that postgres has TOASTed it out of line, that's a lot to
+// send and decode for a struct that only wants a couple of its fields.  A
+// Projection selects just the fields a struct has, one column each, and puts
+// the struct back together from them:
+//
+//	type Size struct {
+//		Width  int `pg:"width"`
+//		Height int `pg:"height"`
+//	}
+//
+//	sizes, err := customtype.Project[Size]("res").
+//		Query(ctx, pool, customtype.NullPolicies{}, "FROM foo WHERE id > $1", 2)
+//
+// selects ("res")."width", ("res")."height" FROM foo WHERE id > $1.  The
+// struct's fields are matched to the composite's attributes by their pg tags,
+// with embedded structs flattened as DefinitionFor flattens them, and a
+// nested composite is followed down to its own fields: a Display's
+// Res Resolution field is (("disp")."res")."width" and so on.
+//
+// A field of a NULL composite is as NULL as one that is NULL itself, so the
+// two can't be told apart, and the composite's nulls become the fields'
+// nulls, resolved by the policies.  A nested composite in a pointer or an
+// Option is selected whole instead, so that it can come back as nil or None.
+// Postgres still has to read, and detoast, the composite to get at its
+// fields; what's saved is the rest of it going over the wire.
+
+// Projection is the fields of a composite column that T, a struct, has.  An
+// error in T is kept until the SQL is asked for.
+type Projection[T any] struct {
+	fields []projectedField
+	err    error
+}
+
+// projectedField is a field of T that's a column of the projection, with its
+// path through T by index, and by name for finding its null policy.
+type projectedField struct {
+	sql   string
+	field structField
+	index []int
+	path  []string
+}
+
+// Project projects the column, named by its parts as Column names it, onto
+// T.
+func Project[T any](column ...string) *Projection[T] {
+	p := &Projection[T]{}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if len(column) == 0 {
+		p.err = fmt.Errorf("a projection needs a column")
+		return p
+	}
+	if t.Kind() != reflect.Struct {
+		p.err = fmt.Errorf("cannot project %s onto a %s, it must be a struct", pgx.Identifier(column).Sanitize(), t)
+		return p
+	}
+	p.fields = projectFields(pgx.Identifier(column).Sanitize(), t, nil, nil)
+	if len(p.fields) == 0 {
+		p.err = fmt.Errorf("%s has no fields to project", t)
+	}
+	for _, f := range p.fields {
+		if f.field.err != nil {
+			p.err = fmt.Errorf("field %s of %s: %w", strings.Join(f.path, "."), t, f.field.err)
+			break
+		}
+	}
+	return p
+}
+
+// projectFields appends the columns for the fields of t, a struct at sql.
+func projectFields(sql string, t reflect.Type, index []int, path []string) []projectedField {
+	var fields []projectedField
+	for _, f := range exportedFields(t) {
+		name, _ := f.attribute()
+		fieldSQL := "(" + sql + ")." + pgx.Identifier{name}.Sanitize()
+		fieldIndex := append(index[:len(index):len(index)], f.index...)
+		fieldPath := append(path[:len(path):len(path)], f.Name)
+		if nestedComposite(f.Type) {
+			fields = append(fields, projectFields(fieldSQL, f.Type, fieldIndex, fieldPath)...)
+			continue
+		}
+		fields = append(fields, projectedField{sql: fieldSQL, field: f, index: fieldIndex, path: fieldPath})
+	}
+	return fields
+}
+
+// nestedComposite reports whether a field of type t is a composite to
+// project the fields of, rather than a column of its own.
+func nestedComposite(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || scalarStruct(t) {
+		return false
+	}
+	return kindOfField(t) == policyField
+}
+
+// SQL is the projection's select list, a column per field.
+func (p *Projection[T]) SQL() (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	columns := make([]string, len(p.fields))
+	for i, f := range p.fields {
+		columns[i] = f.sql
+	}
+	return strings.Join(columns, ", "), nil
+}
+
+// Query runs SELECT with the projection's select list and then rest, such as
+// FROM foo WHERE id > $1, and collects the rows with Collect.
+func (p *Projection[T]) Query(ctx context.Context, q Querier, policies NullPolicies, rest string, args ...interface{}) ([]T, error) {
+	sql, err := p.SQL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build projection: %w", err)
+	}
+	rows, err := q.Query(ctx, "SELECT "+sql+" "+rest, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return p.Collect(rows, policies)
+}
+
+// Collect puts a T back together from each row, which must have the
+// projection's columns, and closes the rows.  A null field is resolved by
+// its policy in policies, by Go field name, with the fields of a nested
+// composite's in Nested, as ConvertDTO resolves them.
+func (p *Projection[T]) Collect(rows pgx.Rows, policies NullPolicies) ([]T, error) {
+	defer rows.Close()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if n := len(rows.FieldDescriptions()); n != len(p.fields) {
+		return nil, fmt.Errorf("the rows have %d columns, the projection %d: %w", n, len(p.fields), ErrFieldCountMismatch)
+	}
+
+	kinds := make([]fieldKind, len(p.fields))
+	for i, f := range p.fields {
+		kinds[i] = kindOfField(f.field.Type)
+	}
+	targets := make([]interface{}, len(p.fields))
+	scans := make([]interface{}, len(p.fields))
+
+	var results []T
+	for rows.Next() {
+		var value T
+		v := reflect.ValueOf(&value).Elem()
+		for i, f := range p.fields {
+			field := v.FieldByIndex(f.index)
+			switch kinds[i] {
+			case directField:
+				targets[i] = field.Addr().Interface()
+			case policyField:
+				targets[i] = reflect.New(field.Addr().Type()).Interface()
+			case optionField:
+				option := field.Interface().(optionSource)
+				targets[i] = reflect.New(reflect.PtrTo(option.optionType())).Interface()
+			}
+			scans[i] = f.field.scanTarget(targets[i])
+		}
+		if err := rows.Scan(scans...); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+
+		for i, f := range p.fields {
+			if kinds[i] == directField {
+				continue
+			}
+			field := v.FieldByIndex(f.index)
+			scanned := reflect.ValueOf(targets[i]).Elem()
+			switch {
+			case kinds[i] == optionField && scanned.IsNil():
+				field.Set(reflect.Zero(field.Type()))
+			case kinds[i] == optionField:
+				field.Addr().Interface().(optionSetter).setSome(scanned.Elem())
+			case scanned.IsNil():
+				if err := f.resolveNull(field, v.Type(), policies); err != nil {
+					return nil, &ScanError{Row: len(results), Err: err}
+				}
+			default:
+				field.Set(scanned.Elem())
+			}
+			if f.field.trim {
+				trimChars(field)
+			}
+		}
+		if err := validate(v); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+		results = append(results, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return results, nil
+}
+
+// resolveNull applies the policy for the field, found by following its path
+// through the nested policies.
+func (f projectedField) resolveNull(field reflect.Value, t reflect.Type, policies NullPolicies) error {
+	typeName := t.Name()
+	for _, name := range f.path[:len(f.path)-1] {
+		policies = policies.Nested[name]
+		sf, _ := t.FieldByName(name)
+		t = sf.Type
+		typeName = t.Name()
+	}
+	name := f.path[len(f.path)-1]
+	return applyNullPolicy(field, typeName, name, policies.forField(name))
+}
@@ -0,0 +1,160 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Querier is what the query functions need to run a query.  It is satisfied
+// by *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn and pgx.Tx.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// QueryResolutions runs a query returning a single resolution column.  A row
+// where the resolution is null comes back as a nil entry, otherwise the nulls
+// are resolved by AsResolution.
+func QueryResolutions(ctx context.Context, q Querier, sql string, args ...interface{}) ([]*Resolution, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	// These are pointers to the DTO - because our value might be null, in
+	// which case the entry would be nil.
+	dtos, err := ScanAll[*ResolutionDTO](rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Resolution, len(dtos))
+	for i, some := range dtos {
+		if some != nil {
+			res := some.AsResolution()
+			results[i] = &res
+		}
+	}
+
+	return results, nil
+}
+
+// QueryDisplays runs a query returning a single display column, in the same
+// way as QueryResolutions.
+func QueryDisplays(ctx context.Context, q Querier, sql string, args ...interface{}) ([]*Display, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	dtos, err := ScanAll[*DisplayDTO](rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Display, len(dtos))
+	for i, some := range dtos {
+		if some != nil {
+			disp := some.AsDisplay()
+			results[i] = &disp
+		}
+	}
+
+	return results, nil
+}
+
+// QueryAll runs a query and scans every row with ScanAll.
+func QueryAll[T any](ctx context.Context, q Querier, sql string, args ...interface{}) ([]T, error) {
+	ctx, span := startQuerySpan[T](ctx, "customtype.QueryAll", sql)
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, endSpan(span, fmt.Errorf("query failed: %w", err))
+	}
+	span.SetAttributes(attrFields.Int(len(rows.FieldDescriptions())))
+
+	results, err := ScanAll[T](rows)
+	span.SetAttributes(attrRows.Int(len(results)))
+	return results, endSpan(span, err)
+}
+
+// QueryOne runs a query and scans its only row with ScanOne.
+func QueryOne[T any](ctx context.Context, q Querier, sql string, args ...interface{}) (T, error) {
+	ctx, span := startQuerySpan[T](ctx, "customtype.QueryOne", sql)
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		var zero T
+		return zero, endSpan(span, fmt.Errorf("query failed: %w", err))
+	}
+	span.SetAttributes(attrFields.Int(len(rows.FieldDescriptions())))
+
+	result, err := ScanOne[T](rows)
+	return result, endSpan(span, err)
+}
+
+// ForEach runs a query and calls fn with each row as it is decoded, in the same
+// way as ScanAll, without keeping the rows around.  It stops at the first error
+// from fn, which is returned as it is, or when ctx is done.
+func ForEach[T any](ctx context.Context, q Querier, sql string, fn func(T) error, args ...interface{}) (err error) {
+	ctx, span := startQuerySpan[T](ctx, "customtype.ForEach", sql)
+	row := 0
+	defer func() {
+		span.SetAttributes(attrRows.Int(row))
+		endSpan(span, err)
+	}()
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+	span.SetAttributes(attrFields.Int(len(rows.FieldDescriptions())))
+
+	for ; rows.Next(); row++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("query stopped after %d rows: %w", row, err)
+		}
+
+		var value T
+		if err := scanRow(rows, &value); err != nil {
+			return &ScanError{Row: row, Err: err}
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+
+	return nil
+}
+
+// ForEachInPlace runs a query and calls fn with each row as ScanEach does,
+// decoded into the same T, which is only good until fn returns.  It is
+// ForEach for bulk reads that don't keep the rows, and stops in the same way.
+func ForEachInPlace[T any](ctx context.Context, q Querier, sql string, fn func(*T) error, args ...interface{}) (err error) {
+	ctx, span := startQuerySpan[T](ctx, "customtype.ForEachInPlace", sql)
+	row := 0
+	defer func() {
+		span.SetAttributes(attrRows.Int(row))
+		endSpan(span, err)
+	}()
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+	span.SetAttributes(attrFields.Int(len(rows.FieldDescriptions())))
+
+	return ScanEach(rows, func(value *T) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("query stopped after %d rows: %w", row, err)
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+		row++
+		return nil
+	})
+}
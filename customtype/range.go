@@ -0,0 +1,702 @@
+package customtype
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgio"
+	"github.com/jackc/pgtype"
+)
+
+// Range is a postgres range whose bounds are of type T.  The bound of an
+// unbounded side is left as the zero value, and an empty range has no bounds
+// at all.
+type Range[T any] struct {
+	Lower, Upper                   T
+	LowerInclusive, UpperInclusive bool
+	LowerUnbounded, UpperUnbounded bool
+	Empty                          bool
+}
+
+// rangeSource is implemented by Range so that a rangeValue can be Set from one
+// without knowing T.
+type rangeSource interface {
+	rangeBounds() (lower, upper interface{}, lowerType, upperType pgtype.BoundType)
+}
+
+// rangeTarget is implemented by *Range so that a rangeValue can be assigned to
+// one without knowing T.
+type rangeTarget interface {
+	assignRange(lower, upper pgtype.Value, lowerType, upperType pgtype.BoundType) error
+}
+
+func (r Range[T]) rangeBounds() (lower, upper interface{}, lowerType, upperType pgtype.BoundType) {
+	if r.Empty {
+		return nil, nil, pgtype.Empty, pgtype.Empty
+	}
+	return r.Lower, r.Upper, boundType(r.LowerInclusive, r.LowerUnbounded), boundType(r.UpperInclusive, r.UpperUnbounded)
+}
+
+func (r *Range[T]) assignRange(lower, upper pgtype.Value, lowerType, upperType pgtype.BoundType) error {
+	*r = Range[T]{}
+	if lowerType == pgtype.Empty {
+		r.Empty = true
+		return nil
+	}
+
+	r.LowerInclusive, r.LowerUnbounded = lowerType == pgtype.Inclusive, lowerType == pgtype.Unbounded
+	r.UpperInclusive, r.UpperUnbounded = upperType == pgtype.Inclusive, upperType == pgtype.Unbounded
+
+	if !r.LowerUnbounded {
+		if err := lower.AssignTo(&r.Lower); err != nil {
+			return fmt.Errorf("unable to assign lower bound: %w", err)
+		}
+	}
+	if !r.UpperUnbounded {
+		if err := upper.AssignTo(&r.Upper); err != nil {
+			return fmt.Errorf("unable to assign upper bound: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func boundType(inclusive, unbounded bool) pgtype.BoundType {
+	switch {
+	case unbounded:
+		return pgtype.Unbounded
+	case inclusive:
+		return pgtype.Inclusive
+	default:
+		return pgtype.Exclusive
+	}
+}
+
+// RangeDefinition describes a custom range type, e.g.
+// `create type floatrange as range (subtype = float8)`.  Subtype is the
+// postgres name of the bounds' type, which may be a domain registered with a
+// DomainDefinition.
+type RangeDefinition struct {
+	Name    string
+	Subtype string
+}
+
+// TypeName is the postgres name of the range.
+func (def RangeDefinition) TypeName() string {
+	return def.Name
+}
+
+// dependencies is the subtype, which may itself be a custom type.
+func (def RangeDefinition) dependencies() []string {
+	return []string{def.Subtype}
+}
+
+// register registers the range type, and its array type, with the ConnInfo.
+func (def RangeDefinition) register(ci *pgtype.ConnInfo, oids typeOIDs) error {
+	subtype, err := transcoderForName(ci, def.Subtype)
+	if err != nil {
+		return fmt.Errorf("subtype of range %s: %w", def.Name, err)
+	}
+
+	registerDataType(ci, def.Name, &rangeValue{typeName: def.Name, subtype: subtype}, oids)
+	return nil
+}
+
+// transcoderForName returns a new value of the registered type.
+func transcoderForName(ci *pgtype.ConnInfo, name string) (pgtype.ValueTranscoder, error) {
+	dt, ok := ci.DataTypeForName(name)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrTypeNotFound)
+	}
+
+	value, ok := pgtype.NewValue(dt.Value).(pgtype.ValueTranscoder)
+	if !ok {
+		return nil, fmt.Errorf("type %s does not implement ValueTranscoder", name)
+	}
+	return value, nil
+}
+
+// rangeValue is the pgtype.Value for a custom range.  pgtype only has the
+// built in ranges, each over a fixed subtype, so this decodes the bounds with
+// whatever the subtype is registered as.
+type rangeValue struct {
+	typeName string
+	subtype  pgtype.ValueTranscoder
+
+	status               pgtype.Status
+	lower, upper         pgtype.ValueTranscoder
+	lowerType, upperType pgtype.BoundType
+}
+
+func (rv *rangeValue) NewTypeValue() pgtype.Value {
+	return &rangeValue{typeName: rv.typeName, subtype: rv.subtype}
+}
+
+func (rv *rangeValue) TypeName() string {
+	return rv.typeName
+}
+
+func (rv *rangeValue) newBound() pgtype.ValueTranscoder {
+	return pgtype.NewValue(rv.subtype).(pgtype.ValueTranscoder)
+}
+
+// Set accepts a Range or a pointer to one.
+func (rv *rangeValue) Set(src interface{}) error {
+	if src == nil {
+		rv.status = pgtype.Null
+		return nil
+	}
+
+	if v := reflect.ValueOf(src); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			rv.status = pgtype.Null
+			return nil
+		}
+		src = v.Elem().Interface()
+	}
+
+	rs, ok := src.(rangeSource)
+	if !ok {
+		return fmt.Errorf("cannot convert %v to range %s", src, rv.typeName)
+	}
+
+	lower, upper, lowerType, upperType := rs.rangeBounds()
+	rv.lower, rv.upper = nil, nil
+	if lowerType == pgtype.Inclusive || lowerType == pgtype.Exclusive {
+		rv.lower = rv.newBound()
+		if err := rv.lower.Set(lower); err != nil {
+			return err
+		}
+	}
+	if upperType == pgtype.Inclusive || upperType == pgtype.Exclusive {
+		rv.upper = rv.newBound()
+		if err := rv.upper.Set(upper); err != nil {
+			return err
+		}
+	}
+
+	rv.lowerType, rv.upperType = lowerType, upperType
+	rv.status = pgtype.Present
+	return nil
+}
+
+func (rv *rangeValue) Get() interface{} {
+	switch rv.status {
+	case pgtype.Present:
+		return rv
+	case pgtype.Null:
+		return nil
+	default:
+		return rv.status
+	}
+}
+
+// AssignTo assigns to a *Range, or a **Range which is set to nil for a null.
+func (rv *rangeValue) AssignTo(dst interface{}) error {
+	switch rv.status {
+	case pgtype.Present:
+		if rt, ok := dst.(rangeTarget); ok {
+			return rt.assignRange(rv.lower, rv.upper, rv.lowerType, rv.upperType)
+		}
+		if nextDst, retry := pgtype.GetAssignToDstType(dst); retry {
+			return rv.AssignTo(nextDst)
+		}
+		return fmt.Errorf("unable to assign to %T", dst)
+	case pgtype.Null:
+		return pgtype.NullAssignTo(dst)
+	}
+
+	return fmt.Errorf("cannot decode %#v into %T", rv, dst)
+}
+
+func (rv *rangeValue) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		rv.status = pgtype.Null
+		return nil
+	}
+
+	utr, err := pgtype.ParseUntypedTextRange(string(src))
+	if err != nil {
+		return err
+	}
+
+	rv.lower, rv.upper = nil, nil
+	if utr.LowerType == pgtype.Inclusive || utr.LowerType == pgtype.Exclusive {
+		rv.lower = rv.newBound()
+		if err := rv.lower.DecodeText(ci, []byte(utr.Lower)); err != nil {
+			return err
+		}
+	}
+	if utr.UpperType == pgtype.Inclusive || utr.UpperType == pgtype.Exclusive {
+		rv.upper = rv.newBound()
+		if err := rv.upper.DecodeText(ci, []byte(utr.Upper)); err != nil {
+			return err
+		}
+	}
+
+	rv.lowerType, rv.upperType = utr.LowerType, utr.UpperType
+	rv.status = pgtype.Present
+	return nil
+}
+
+func (rv *rangeValue) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		rv.status = pgtype.Null
+		return nil
+	}
+
+	if err := checkBinaryBounds(src); err != nil {
+		return err
+	}
+	ubr, err := pgtype.ParseUntypedBinaryRange(src)
+	if err != nil {
+		return err
+	}
+
+	rv.lower, rv.upper = nil, nil
+	if ubr.LowerType == pgtype.Inclusive || ubr.LowerType == pgtype.Exclusive {
+		rv.lower = rv.newBound()
+		if err := rv.lower.DecodeBinary(ci, ubr.Lower); err != nil {
+			return err
+		}
+	}
+	if ubr.UpperType == pgtype.Inclusive || ubr.UpperType == pgtype.Exclusive {
+		rv.upper = rv.newBound()
+		if err := rv.upper.DecodeBinary(ci, ubr.Upper); err != nil {
+			return err
+		}
+	}
+
+	rv.lowerType, rv.upperType = ubr.LowerType, ubr.UpperType
+	rv.status = pgtype.Present
+	return nil
+}
+
+func (rv rangeValue) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	switch rv.status {
+	case pgtype.Null:
+		return nil, nil
+	case pgtype.Undefined:
+		return nil, fmt.Errorf("cannot encode status undefined")
+	}
+
+	switch rv.lowerType {
+	case pgtype.Exclusive, pgtype.Unbounded:
+		buf = append(buf, '(')
+	case pgtype.Inclusive:
+		buf = append(buf, '[')
+	case pgtype.Empty:
+		return append(buf, "empty"...), nil
+	default:
+		return nil, fmt.Errorf("unknown lower bound type %v", rv.lowerType)
+	}
+
+	if rv.lowerType != pgtype.Unbounded {
+		bound, err := rv.lower.EncodeText(ci, nil)
+		if err != nil {
+			return nil, err
+		} else if bound == nil {
+			return nil, fmt.Errorf("lower bound cannot be null unless it is unbounded")
+		}
+		buf = append(buf, quoteRangeBound(string(bound))...)
+	}
+
+	buf = append(buf, ',')
+
+	if rv.upperType != pgtype.Unbounded {
+		bound, err := rv.upper.EncodeText(ci, nil)
+		if err != nil {
+			return nil, err
+		} else if bound == nil {
+			return nil, fmt.Errorf("upper bound cannot be null unless it is unbounded")
+		}
+		buf = append(buf, quoteRangeBound(string(bound))...)
+	}
+
+	switch rv.upperType {
+	case pgtype.Exclusive, pgtype.Unbounded:
+		buf = append(buf, ')')
+	case pgtype.Inclusive:
+		buf = append(buf, ']')
+	default:
+		return nil, fmt.Errorf("unknown upper bound type %v", rv.upperType)
+	}
+
+	return buf, nil
+}
+
+// The flag bits are those of postgres' range_send.
+const (
+	emptyMask          = 1
+	lowerInclusiveMask = 2
+	upperInclusiveMask = 4
+	lowerUnboundedMask = 8
+	upperUnboundedMask = 16
+)
+
+// checkBinaryBounds checks that the bounds of the binary range src are as
+// long as their lengths say, which pgtype.ParseUntypedBinaryRange slices by
+// without checking.
+func checkBinaryBounds(src []byte) error {
+	if len(src) == 0 || src[0]&emptyMask != 0 {
+		return nil
+	}
+	flags, rp := src[0], 1
+	for _, unbounded := range []byte{lowerUnboundedMask, upperUnboundedMask} {
+		if flags&unbounded != 0 {
+			continue
+		}
+		if len(src[rp:]) < 4 {
+			return nil
+		}
+		length := int(int32(binary.BigEndian.Uint32(src[rp:])))
+		rp += 4
+		if length < 0 || len(src[rp:]) < length {
+			return fmt.Errorf("range too short for bound of %d bytes: %d", length, len(src))
+		}
+		rp += length
+	}
+	return nil
+}
+
+func (rv rangeValue) EncodeBinary(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	switch rv.status {
+	case pgtype.Null:
+		return nil, nil
+	case pgtype.Undefined:
+		return nil, fmt.Errorf("cannot encode status undefined")
+	}
+
+	var flags byte
+	switch rv.lowerType {
+	case pgtype.Inclusive:
+		flags |= lowerInclusiveMask
+	case pgtype.Unbounded:
+		flags |= lowerUnboundedMask
+	case pgtype.Exclusive:
+	case pgtype.Empty:
+		return append(buf, emptyMask), nil
+	default:
+		return nil, fmt.Errorf("unknown lower bound type %v", rv.lowerType)
+	}
+
+	switch rv.upperType {
+	case pgtype.Inclusive:
+		flags |= upperInclusiveMask
+	case pgtype.Unbounded:
+		flags |= upperUnboundedMask
+	case pgtype.Exclusive:
+	default:
+		return nil, fmt.Errorf("unknown upper bound type %v", rv.upperType)
+	}
+
+	buf = append(buf, flags)
+
+	var err error
+	if rv.lowerType != pgtype.Unbounded {
+		if buf, err = appendBound(ci, buf, rv.lower); err != nil {
+			return nil, fmt.Errorf("lower bound: %w", err)
+		}
+	}
+	if rv.upperType != pgtype.Unbounded {
+		if buf, err = appendBound(ci, buf, rv.upper); err != nil {
+			return nil, fmt.Errorf("upper bound: %w", err)
+		}
+	}
+
+	return buf, nil
+}
+
+// appendBound appends a length prefixed bound in binary.
+func appendBound(ci *pgtype.ConnInfo, buf []byte, bound pgtype.BinaryEncoder) ([]byte, error) {
+	sp := len(buf)
+	buf = pgio.AppendInt32(buf, -1)
+
+	buf, err := bound.EncodeBinary(ci, buf)
+	if err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("cannot be null unless it is unbounded")
+	}
+
+	pgio.SetInt32(buf[sp:], int32(len(buf[sp:])-4))
+	return buf, nil
+}
+
+// quoteRangeBound quotes a bound in the text format if it would otherwise be
+// misread, as postgres' range_out does.
+func quoteRangeBound(s string) string {
+	if s != "" && !strings.ContainsAny(s, `"\,()[] `) {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// MultirangeDefinition describes the multirange type postgres 14 creates for
+// every range, e.g. floatmultirange for floatrange.  A multirange scans into
+// and is encoded from a []Range.
+type MultirangeDefinition struct {
+	Name  string
+	Range string
+}
+
+// TypeName is the postgres name of the multirange.
+func (def MultirangeDefinition) TypeName() string {
+	return def.Name
+}
+
+// dependencies is the range, which must be registered first.
+func (def MultirangeDefinition) dependencies() []string {
+	return []string{def.Range}
+}
+
+// register registers the multirange type, and its array type, with the
+// ConnInfo.
+func (def MultirangeDefinition) register(ci *pgtype.ConnInfo, oids typeOIDs) error {
+	dt, ok := ci.DataTypeForName(def.Range)
+	if !ok {
+		return fmt.Errorf("multirange %s has unknown range type %s", def.Name, def.Range)
+	}
+	rv, ok := dt.Value.(*rangeValue)
+	if !ok {
+		return fmt.Errorf("multirange %s: %s is not a registered range", def.Name, def.Range)
+	}
+
+	registerDataType(ci, def.Name, &multirangeValue{typeName: def.Name, rangeType: rv}, oids)
+	return nil
+}
+
+// multirangeValue is the pgtype.Value for a multirange, a list of ranges.
+type multirangeValue struct {
+	typeName  string
+	rangeType *rangeValue
+
+	status pgtype.Status
+	ranges []*rangeValue
+}
+
+func (mv *multirangeValue) NewTypeValue() pgtype.Value {
+	return &multirangeValue{typeName: mv.typeName, rangeType: mv.rangeType}
+}
+
+func (mv *multirangeValue) TypeName() string {
+	return mv.typeName
+}
+
+func (mv *multirangeValue) newRange() *rangeValue {
+	return mv.rangeType.NewTypeValue().(*rangeValue)
+}
+
+// Set accepts a slice of Range.
+func (mv *multirangeValue) Set(src interface{}) error {
+	if src == nil {
+		mv.status = pgtype.Null
+		return nil
+	}
+
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			mv.status = pgtype.Null
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot convert %v to multirange %s", src, mv.typeName)
+	}
+	if v.IsNil() {
+		mv.status = pgtype.Null
+		return nil
+	}
+
+	ranges := make([]*rangeValue, v.Len())
+	for i := range ranges {
+		ranges[i] = mv.newRange()
+		if err := ranges[i].Set(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	mv.ranges = ranges
+	mv.status = pgtype.Present
+	return nil
+}
+
+func (mv *multirangeValue) Get() interface{} {
+	switch mv.status {
+	case pgtype.Present:
+		return mv.ranges
+	case pgtype.Null:
+		return nil
+	default:
+		return mv.status
+	}
+}
+
+// AssignTo assigns to a pointer to a slice of Range.
+func (mv *multirangeValue) AssignTo(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("cannot assign multirange to %T", dst)
+	}
+	slice := v.Elem()
+
+	switch mv.status {
+	case pgtype.Present:
+		result := reflect.MakeSlice(slice.Type(), len(mv.ranges), len(mv.ranges))
+		for i, rv := range mv.ranges {
+			if err := rv.AssignTo(result.Index(i).Addr().Interface()); err != nil {
+				return err
+			}
+		}
+		slice.Set(result)
+		return nil
+	case pgtype.Null:
+		slice.Set(reflect.Zero(slice.Type()))
+		return nil
+	}
+
+	return fmt.Errorf("cannot decode %#v into %T", mv, dst)
+}
+
+func (mv *multirangeValue) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		mv.status = pgtype.Null
+		return nil
+	}
+
+	elements, err := splitMultirange(string(src))
+	if err != nil {
+		return err
+	}
+
+	ranges := make([]*rangeValue, len(elements))
+	for i, element := range elements {
+		ranges[i] = mv.newRange()
+		if err := ranges[i].DecodeText(ci, []byte(element)); err != nil {
+			return err
+		}
+	}
+
+	mv.ranges = ranges
+	mv.status = pgtype.Present
+	return nil
+}
+
+// splitMultirange splits the text format of a multirange, e.g.
+// {[1,3),[5,7)}, into its ranges.
+func splitMultirange(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, fmt.Errorf("invalid multirange: %s", s)
+	}
+	s = s[1 : len(s)-1]
+
+	var elements []string
+	start, inQuotes := -1, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inQuotes && c == '\\':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case start < 0 && (c == '[' || c == '('):
+			start = i
+		case start >= 0 && (c == ']' || c == ')'):
+			elements = append(elements, s[start:i+1])
+			start = -1
+		case start < 0 && c != ',' && c != ' ':
+			return nil, fmt.Errorf("invalid multirange: {%s}", s)
+		}
+	}
+	if start >= 0 || inQuotes {
+		return nil, fmt.Errorf("invalid multirange: {%s}", s)
+	}
+
+	return elements, nil
+}
+
+func (mv *multirangeValue) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		mv.status = pgtype.Null
+		return nil
+	}
+
+	if len(src) < 4 {
+		return fmt.Errorf("multirange too short: %d", len(src))
+	}
+	count := int(binary.BigEndian.Uint32(src))
+	rp := 4
+
+	// The count is whatever the bytes say, and every range has a length
+	// word at least, so we check it against them before making room.
+	if count > len(src[rp:])/4 {
+		return fmt.Errorf("multirange too short for %d ranges: %d", count, len(src))
+	}
+	ranges := make([]*rangeValue, 0, count)
+	for i := 0; i < count; i++ {
+		if len(src[rp:]) < 4 {
+			return fmt.Errorf("multirange too short for range %d", i)
+		}
+		length := int(int32(binary.BigEndian.Uint32(src[rp:])))
+		rp += 4
+		if length < 0 || len(src[rp:]) < length {
+			return fmt.Errorf("multirange too short for range %d", i)
+		}
+
+		rv := mv.newRange()
+		if err := rv.DecodeBinary(ci, src[rp:rp+length]); err != nil {
+			return err
+		}
+		rp += length
+		ranges = append(ranges, rv)
+	}
+
+	mv.ranges = ranges
+	mv.status = pgtype.Present
+	return nil
+}
+
+func (mv multirangeValue) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	switch mv.status {
+	case pgtype.Null:
+		return nil, nil
+	case pgtype.Undefined:
+		return nil, fmt.Errorf("cannot encode status undefined")
+	}
+
+	buf = append(buf, '{')
+	for i, rv := range mv.ranges {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		var err error
+		if buf, err = rv.EncodeText(ci, buf); err != nil {
+			return nil, err
+		}
+	}
+	return append(buf, '}'), nil
+}
+
+func (mv multirangeValue) EncodeBinary(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	switch mv.status {
+	case pgtype.Null:
+		return nil, nil
+	case pgtype.Undefined:
+		return nil, fmt.Errorf("cannot encode status undefined")
+	}
+
+	buf = pgio.AppendInt32(buf, int32(len(mv.ranges)))
+	for _, rv := range mv.ranges {
+		var err error
+		if buf, err = appendBound(ci, buf, rv); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
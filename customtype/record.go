@@ -0,0 +1,151 @@
+package customtype
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgtype"
+)
+
+// Queries like select row(1, 'a') or select (select ...) return an anonymous
+// record, which has the generic record type rather than one we can register.
+// pgx reads a record in the binary format, where each field carries its own
+// type, so the fields come out typed.  The text format has no types at all,
+// so there we do our best with the type of whatever we're assigning to.
+
+// ParseRecord parses the text format of an anonymous record.  Without types
+// the fields are strings, or nil for a null.
+func ParseRecord(src []byte) ([]interface{}, error) {
+	fields, err := recordText(src)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		if f != nil {
+			values[i] = string(f)
+		}
+	}
+	return values, nil
+}
+
+// ScanRecord parses the text format of an anonymous record into the exported
+// fields of the struct dst points to, in order.  Each field is parsed as
+// pgx would parse text into the field's type, using ci, or the built-in
+// types if ci is nil.
+func ScanRecord(ci *pgtype.ConnInfo, src []byte, dst interface{}) error {
+	if ci == nil {
+		ci = pgtype.NewConnInfo()
+	}
+
+	var rv recordValue
+	if err := rv.DecodeText(ci, src); err != nil {
+		return err
+	}
+	return rv.AssignTo(dst)
+}
+
+// recordText splits the text format of a record into its fields, with nil for
+// a null.
+func recordText(src []byte) ([][]byte, error) {
+	s := newCompositeTextScanner(src)
+	var fields [][]byte
+	for s.Next() {
+		fields = append(fields, s.Bytes())
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse record: %w", err)
+	}
+	return fields, nil
+}
+
+// registerRecord replaces pgtype's record with one that can also be assigned
+// to a struct, or decoded from the text format.
+func registerRecord(ci *pgtype.ConnInfo) {
+	ci.RegisterDataType(pgtype.DataType{Value: &recordValue{}, Name: "record", OID: pgtype.RecordOID})
+}
+
+// recordValue is a pgtype.Record that keeps the raw fields when it is decoded
+// from the text format, as there is no telling what types they are until we
+// see where they're going.
+type recordValue struct {
+	pgtype.Record
+	text [][]byte
+	ci   *pgtype.ConnInfo
+}
+
+func (dst *recordValue) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	dst.text = nil
+	return dst.Record.DecodeBinary(ci, src)
+}
+
+// DecodeText keeps the fields as text values, so a record from the text format
+// still assigns to []interface{} like one from the binary format.
+func (dst *recordValue) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		*dst = recordValue{Record: pgtype.Record{Status: pgtype.Null}}
+		return nil
+	}
+
+	fields, err := recordText(src)
+	if err != nil {
+		return err
+	}
+
+	values := make([]pgtype.Value, len(fields))
+	for i, f := range fields {
+		text := &pgtype.Text{}
+		if err := text.DecodeText(ci, f); err != nil {
+			return err
+		}
+		values[i] = text
+	}
+
+	*dst = recordValue{Record: pgtype.Record{Fields: values, Status: pgtype.Present}, text: fields, ci: ci}
+	return nil
+}
+
+// AssignTo also assigns to a pointer to a struct, or an Option of one, by
+// exported field in order.
+func (src *recordValue) AssignTo(dst interface{}) error {
+	if target, ok := dst.(optionTarget); ok {
+		return target.assignOption(src)
+	}
+
+	v := reflect.ValueOf(dst)
+	if src.Status != pgtype.Present || v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return src.Record.AssignTo(dst)
+	}
+
+	v = v.Elem()
+	exported := exportedFields(v.Type())
+
+	count := len(src.Fields)
+	if src.text != nil {
+		count = len(src.text)
+	}
+	if count != len(exported) {
+		return fmt.Errorf("cannot assign record with %d fields to %s with %d exported fields: %w", count, v.Type(), len(exported), ErrFieldCountMismatch)
+	}
+
+	for i, field := range exported {
+		target := v.FieldByIndex(field.index).Addr().Interface()
+
+		var err error
+		option, isOption := target.(optionTarget)
+		switch {
+		case src.text == nil:
+			err = assignField(src.Fields[i], target)
+		case isOption:
+			err = option.scanOptionText(src.ci, src.text[i])
+		default:
+			err = src.ci.Scan(0, pgtype.TextFormatCode, src.text[i], target)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot assign field %d of record: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,523 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TypeDefinition is a custom type the registry knows how to register, such as
+// a CompositeDefinition or an EnumDefinition.
+type TypeDefinition interface {
+	// TypeName is the postgres name of the type, optionally schema-qualified.
+	TypeName() string
+
+	// dependencies names the types that must be registered before this one.
+	// Types that aren't among the registry's definitions are assumed to be
+	// built in (int4, text, ...).
+	dependencies() []string
+
+	// register registers the type with the ConnInfo using OIDs already looked
+	// up from the server.
+	register(ci *pgtype.ConnInfo, oids typeOIDs) error
+}
+
+// TypeRegistry holds the custom types to register on every new connection.
+// Rather than one regtype lookup per type, all OIDs are fetched from pg_type
+// in a single round trip.  One registry can be shared by any number of
+// pools and goroutines, and its types changed while it is, as types.go
+// describes; its settings are for before it's first used.
+type TypeRegistry struct {
+	// Timeout bounds the time spent registering types on each connection, on
+	// top of any deadline the caller's context already has.  Zero means no
+	// extra limit.
+	Timeout time.Duration
+
+	// Schemas, when set, are searched in order for types named without a
+	// schema, instead of relying on the connection's search_path.  This
+	// disambiguates a type name that exists in several schemas: the first
+	// schema that has it wins.
+	Schemas []string
+
+	// PgBouncer makes the connections RegisterTypes configures work behind
+	// PgBouncer in transaction pooling mode, where one connection to
+	// PgBouncer is served by whichever server connection is free.  The types
+	// are unaffected, since OIDs belong to the database rather than the
+	// session, but prepared statements are not, so the connections use the
+	// simple protocol and prepare nothing.  Composites then travel in the
+	// text format, and query parameters in whatever their Value gives, which
+	// BinaryResults turns into an error for code that can't have it.
+	PgBouncer bool
+
+	// Lazy skips registering the types when a connection is made, for
+	// applications that rarely use them and would rather not pay for it up
+	// front.  They are registered on a connection the first time something
+	// run through Lazily fails on it for want of them.
+	Lazy bool
+
+	// Defaults reads the defaults of every composite from the database with
+	// ReadDefaults the first time the types are registered, for
+	// NullPolicies to give out, so that the ones in Go and in SQL can't
+	// drift apart.
+	Defaults bool
+
+	// Retry retries registering the types on a connection when some of them
+	// aren't in the database yet, as when the application starts before its
+	// migrations have run.  The registry's Timeout bounds each attempt
+	// rather than all of them.
+	Retry Retry
+
+	// CreateMissing creates the types that aren't in the database from their
+	// definitions' CreateDDL, for test databases and local development,
+	// rather than failing to register them.
+	CreateMissing bool
+
+	// Metadata, when set, is where the types' OIDs come from instead of the
+	// catalog, so that registering them asks the database nothing.  Every
+	// type has to be in it.  See metadata.go.  Defaults and CreateMissing
+	// still query the database.
+	Metadata *Metadata
+
+	// TracerProvider is where the spans of registering the types go, the
+	// global provider if it's nil.
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider is where the metrics of registering and decoding the
+	// types go, the global provider if it's nil.
+	MeterProvider metric.MeterProvider
+
+	// Logger is where the registry logs registering and refreshing the
+	// types, and the fields of composites that fail to decode, nowhere if
+	// it's nil.  LogLevel is the least severe level logged, pgx.LogLevelInfo
+	// if it's zero; fields that fail to decode are logged at
+	// pgx.LogLevelDebug, since the error reaches the caller anyway.
+	Logger   Logger
+	LogLevel pgx.LogLevel
+
+	// Converters convert the fields of composites whose Go types pgtype
+	// doesn't handle itself.  See FieldConverter.
+	Converters []FieldConverter
+
+	metricsOnce sync.Once
+	instruments *metrics
+
+	// defaults are the null policies Defaults read, by type name.
+	defaultsMu sync.Mutex
+	defaults   map[string]NullPolicies
+
+	// types are the definitions, swapped whole as they change so that
+	// registering the types on a connection reads one set of them however
+	// many goroutines change them meanwhile.  typesMu is held by the
+	// changes, one at a time.
+	types   atomic.Pointer[typeSet]
+	typesMu sync.Mutex
+
+	// registered is the set of types registered on each connection, for
+	// BeforeAcquire to tell which are behind.
+	registeredMu sync.Mutex
+	registered   map[*pgx.Conn]*typeSet
+
+	// refreshes counts the calls to Refresh and the changes to the types,
+	// so that connections only need checking for stale OIDs once there has
+	// been one.
+	refreshes atomic.Uint64
+
+	// composites are the names of the composites registered, and their
+	// arrays, by OID, for BinaryResults to check the columns of.
+	composites sync.Map
+}
+
+// NewTypeRegistry creates a registry for the given definitions.  The
+// definitions are put in dependency order up front so that every connection
+// doesn't have to sort them again.
+func NewTypeRegistry(defs ...TypeDefinition) (*TypeRegistry, error) {
+	types, err := newTypeSet(defs)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &TypeRegistry{}
+	r.types.Store(types)
+	return r, nil
+}
+
+// extensionTypes are the types from extensions that composites' fields can
+// have, which have no fixed OID, so need looking up like our own.
+var extensionTypes = map[string]TypeDefinition{
+	"hstore": HstoreDefinition{Name: "hstore"},
+	"citext": CitextDefinition{Name: "citext"},
+}
+
+// withExtensions adds a definition of each of extensionTypes that a
+// composite has a field of and there isn't one of already.
+func withExtensions(defs []TypeDefinition) []TypeDefinition {
+	defined := make(map[string]bool)
+	used := make(map[string]bool)
+	for _, def := range defs {
+		defined[def.TypeName()] = true
+		if composite, ok := def.(CompositeDefinition); ok {
+			for _, f := range composite.Fields {
+				name := f.Type
+				if elem, isArray := arrayElement(f.Type); isArray {
+					name = elem
+				}
+				if _, ok := extensionTypes[name]; ok {
+					used[name] = true
+				}
+			}
+		}
+	}
+
+	// In a fixed order, so that the registry's types are the same each
+	// time.
+	for _, name := range []string{"hstore", "citext"} {
+		if used[name] && !defined[name] {
+			defs = append(defs[:len(defs):len(defs)], extensionTypes[name])
+		}
+	}
+	return defs
+}
+
+// AfterConnect registers every type with the connection.  It has the signature
+// of pgxpool.Config.AfterConnect so it can be assigned directly.  OIDs are
+// cached per database, so only the first connection queries the catalog.
+// Every query honors ctx as well as the registry's Timeout.  In Lazy mode it
+// does nothing.
+func (r *TypeRegistry) AfterConnect(ctx context.Context, conn *pgx.Conn) error {
+	if r.Lazy {
+		return nil
+	}
+	return r.register(ctx, conn, false)
+}
+
+// registerOnce is one attempt at registering the types, which the
+// registry's Timeout bounds.
+func (r *TypeRegistry) registerOnce(ctx context.Context, conn *pgx.Conn, retry bool) (err error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	types := r.snapshot()
+	database := databaseIdentity(conn)
+	ctx, span := r.tracer().Start(ctx, "customtype.register", trace.WithAttributes(
+		attrDatabase.String(database),
+		attrTypeCount.Int(len(types.names)),
+	))
+	m, started := r.metrics(), time.Now()
+	log := r.logger()
+	scope := r.oidScope(conn.Config())
+	oids, ok := sharedOIDCache.lookup(database, scope, types.names)
+	defer func() {
+		m.recordRegistration(retry, started, err)
+		if err == nil {
+			log.log(ctx, pgx.LogLevelInfo, "registered types", map[string]interface{}{
+				"database": database,
+				"types":    len(types.names),
+				"cached":   ok,
+				"retry":    retry,
+				"duration": time.Since(started),
+			})
+		}
+		endSpan(span, err)
+	}()
+
+	span.SetAttributes(attrCached.Bool(ok))
+	m.recordCacheLookup(ok)
+	if !ok && r.Metadata != nil {
+		if oids, err = r.Metadata.oids(types); err != nil {
+			return err
+		}
+		sharedOIDCache.store(database, scope, oids)
+	} else if !ok {
+		oids, err = r.resolveOIDs(ctx, conn, types)
+		var missing *MissingTypesError
+		if r.CreateMissing && errors.As(err, &missing) {
+			if err = r.createMissing(ctx, conn, types); err != nil {
+				return err
+			}
+			oids, err = r.resolveOIDs(ctx, conn, types)
+		}
+		if err != nil {
+			return err
+		}
+		sharedOIDCache.store(database, scope, oids)
+	}
+
+	if r.Defaults {
+		if err := r.readDefaults(ctx, conn, types); err != nil {
+			return err
+		}
+	}
+
+	ci := conn.ConnInfo()
+	registerNetwork(ci)
+	registerTemporal(ci)
+	conv := newConverters(r.Converters)
+	for _, def := range types.definitions {
+		o := oids[def.TypeName()]
+		if composite, ok := def.(CompositeDefinition); ok {
+			composite.converters = conv
+			composite.metrics = m
+			composite.logger = log
+			def = composite
+			r.composites.Store(o.oid, def.TypeName())
+			r.composites.Store(o.arrayOID, ArrayTypeName(def.TypeName()))
+		}
+		if err := def.register(ci, o); err != nil {
+			return err
+		}
+		log.log(ctx, pgx.LogLevelDebug, "registered type", map[string]interface{}{
+			"type":      def.TypeName(),
+			"oid":       o.oid,
+			"array_oid": o.arrayOID,
+		})
+	}
+	registerRecord(ci)
+	r.recordRegistered(conn, types)
+
+	return nil
+}
+
+// resolveOIDs looks up the OIDs of the types and checks the enums against
+// them, in a span of its own.
+func (r *TypeRegistry) resolveOIDs(ctx context.Context, conn *pgx.Conn, types *typeSet) (oids map[string]typeOIDs, err error) {
+	ctx, span := r.tracer().Start(ctx, "customtype.lookup_oids", trace.WithAttributes(attrTypes.StringSlice(types.names)))
+	defer func() { endSpan(span, err) }()
+
+	if oids, err = r.lookupOIDs(ctx, conn, types); err != nil {
+		return nil, err
+	}
+	if err = r.verifyEnums(ctx, conn, types, oids); err != nil {
+		return nil, err
+	}
+	if err = r.pickVersions(ctx, conn, types, oids); err != nil {
+		return nil, err
+	}
+	return oids, nil
+}
+
+// readDefaults reads the defaults of the composites, unless they have been
+// read already.
+func (r *TypeRegistry) readDefaults(ctx context.Context, conn *pgx.Conn, types *typeSet) error {
+	r.defaultsMu.Lock()
+	defer r.defaultsMu.Unlock()
+	if r.defaults != nil {
+		return nil
+	}
+
+	defaults := make(map[string]NullPolicies)
+	for _, def := range types.definitions {
+		if _, ok := def.(CompositeDefinition); !ok {
+			continue
+		}
+		policies, err := ReadDefaults(ctx, conn, def.TypeName())
+		if err != nil {
+			return err
+		}
+		defaults[def.TypeName()] = policies
+	}
+	r.defaults = defaults
+	return nil
+}
+
+// NullPolicies are the null policies of the composite called name, from the
+// defaults in the database.  They are only there with Defaults set, once a
+// connection has registered the types.  An application talking to several
+// databases gets the defaults of the first.
+func (r *TypeRegistry) NullPolicies(name string) (NullPolicies, bool) {
+	r.defaultsMu.Lock()
+	defer r.defaultsMu.Unlock()
+	policies, ok := r.defaults[name]
+	return policies, ok
+}
+
+// registerDataType registers value with the ConnInfo under name, along with
+// an array type whose elements are copies of value.
+func registerDataType(ci *pgtype.ConnInfo, name string, value pgtype.Value, oids typeOIDs) {
+	ci.RegisterDataType(pgtype.DataType{
+		Value: value,
+		Name:  name,
+		OID:   oids.oid,
+	})
+
+	atype := newArrayType(ArrayTypeName(name), oids.oid, func() pgtype.ValueTranscoder {
+		return pgtype.NewValue(value).(pgtype.ValueTranscoder)
+	})
+	ci.RegisterDataType(pgtype.DataType{
+		Value: atype,
+		Name:  atype.TypeName(),
+		OID:   oids.arrayOID,
+	})
+}
+
+// sortDefinitions orders the definitions so that any type used by another
+// comes before it, e.g. a composite used as a field type comes before the
+// composites that contain it.
+func sortDefinitions(defs []TypeDefinition) ([]TypeDefinition, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	byName := make(map[string]TypeDefinition, len(defs))
+	for _, def := range defs {
+		byName[def.TypeName()] = def
+	}
+
+	sorted := make([]TypeDefinition, 0, len(defs))
+	state := make(map[string]int, len(defs))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("type %s contains itself", name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dep := range byName[name].dependencies() {
+			if _, ok := byName[dep]; ok {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+
+		sorted = append(sorted, byName[name])
+		return nil
+	}
+
+	for _, def := range defs {
+		if err := visit(def.TypeName()); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// typeOIDs are what the catalog tells us about a type.  baseOID is the type
+// a domain is over, and zero for anything else.
+type typeOIDs struct {
+	oid, arrayOID, baseOID uint32
+
+	// version is which of a composite's Versions the database has, from 1,
+	// or 0 for its latest Fields.
+	version int
+}
+
+// typeCandidate is a type found in the catalog with one of the names we're
+// looking for, in whatever schema it lives.
+type typeCandidate struct {
+	schema  string
+	visible bool
+	typeOIDs
+}
+
+// lookupOIDs fetches the OID and array OID of every registered type, failing
+// with a *MissingTypesError if any of them aren't in the database.  Every
+// schema is searched in the one query, and the right candidate for each
+// definition picked after.
+func (r *TypeRegistry) lookupOIDs(ctx context.Context, conn *pgx.Conn, types *typeSet) (map[string]typeOIDs, error) {
+	oids, missing, err := r.findOIDs(ctx, conn, types)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, &MissingTypesError{Types: missing}
+	}
+
+	return oids, nil
+}
+
+// findOIDs looks up every type in one query, returning the sanitized names of
+// the types that weren't found, sorted.
+func (r *TypeRegistry) findOIDs(ctx context.Context, conn *pgx.Conn, types *typeSet) (map[string]typeOIDs, []string, error) {
+	bare := make([]string, len(types.parsed))
+	for i, tn := range types.parsed {
+		bare[i] = tn.name
+	}
+
+	rows, err := conn.Query(ctx, `select n.nspname, t.typname, t.oid, t.typarray, t.typbasetype, pg_type_is_visible(t.oid)
+		from pg_type t join pg_namespace n on n.oid = t.typnamespace
+		where t.typname = any($1)`, bare)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up type oids: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := make(map[string][]typeCandidate, len(bare))
+	for rows.Next() {
+		var name string
+		var c typeCandidate
+		if err := rows.Scan(&c.schema, &name, &c.oid, &c.arrayOID, &c.baseOID, &c.visible); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan type oids: %w", err)
+		}
+		candidates[name] = append(candidates[name], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to look up type oids: %w", err)
+	}
+
+	oids := make(map[string]typeOIDs, len(types.names))
+	var missing []string
+	for i, tn := range types.parsed {
+		c, ok := r.pick(tn, candidates[tn.name])
+		if !ok {
+			missing = append(missing, tn.Sanitize())
+			continue
+		}
+		oids[types.names[i]] = c.typeOIDs
+	}
+	sort.Strings(missing)
+
+	return oids, missing, nil
+}
+
+// pick chooses which of the types with the same name a definition refers to:
+// the one in its own schema if it names one, otherwise the first of the
+// registry's Schemas that has it, otherwise the one on the search_path.
+func (r *TypeRegistry) pick(tn typeName, candidates []typeCandidate) (typeCandidate, bool) {
+	inSchema := func(schema string) (typeCandidate, bool) {
+		for _, c := range candidates {
+			if c.schema == schema {
+				return c, true
+			}
+		}
+		return typeCandidate{}, false
+	}
+
+	if tn.schema != "" {
+		return inSchema(tn.schema)
+	}
+
+	if len(r.Schemas) > 0 {
+		for _, schema := range r.Schemas {
+			if c, ok := inSchema(schema); ok {
+				return c, true
+			}
+		}
+		return typeCandidate{}, false
+	}
+
+	for _, c := range candidates {
+		if c.visible {
+			return c, true
+		}
+	}
+	return typeCandidate{}, false
+}
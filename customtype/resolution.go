@@ -0,0 +1,164 @@
+// Package customtype maps postgres composite types onto Go structs using pgx.
+package customtype
+
+import "fmt"
+
+// Resolution is a custom type defined in postgres.  We want to map it to
+// a struct in Go.  Except... we might need to handle nulls.  In which case
+// we'll go through a data transfer object (DTO).  The tags let
+// DefinitionFor describe the type from the struct.
+type Resolution struct {
+	Width  int  `pg:"width,int4"`
+	Height int  `pg:"height,int4"`
+	Scan   rune `pg:"scan,bpchar"`
+}
+
+// CheckedResolution is a Resolution that validates itself as it's scanned,
+// for a query that would rather not have a resolution the database lets
+// through than have one with a negative side.  Resolution itself takes
+// whatever the database has.
+type CheckedResolution Resolution
+
+// Validate rejects a resolution with a negative width or height.
+func (r CheckedResolution) Validate() error {
+	if r.Width < 0 || r.Height < 0 {
+		return fmt.Errorf("%dx%d has a negative side", r.Width, r.Height)
+	}
+	return nil
+}
+
+// ResolutionDTO has nullable fields where deal with the database possibly
+// returning null.  If you can guarantee the fields will not be null, then you
+// don't need the DTO and you would just have the type above.
+type ResolutionDTO struct {
+	Width  *int  `pg:"width,int4"`
+	Height *int  `pg:"height,int4"`
+	Scan   *rune `pg:"scan,bpchar"`
+}
+
+// AllNull reports whether every field is null.  A null resolution scans into
+// a nil *ResolutionDTO, or a None Option[ResolutionDTO], so a DTO where
+// AllNull is true came from a resolution that was there but had nothing in
+// it: (,,) rather than null.
+func (rdto ResolutionDTO) AllNull() bool {
+	return rdto.Width == nil && rdto.Height == nil && rdto.Scan == nil
+}
+
+// DefaultResolutionPolicies are the null policies of AsResolution: a missing
+// width or height is zero, and a missing scan is progressive.
+func DefaultResolutionPolicies() NullPolicies {
+	return NullPolicies{
+		Fields: map[string]NullPolicy{
+			"Scan": DefaultValue('P'),
+		},
+	}
+}
+
+// AsResolution converts the DTO with its nulls into a semantically valid application type.
+func (rdto ResolutionDTO) AsResolution() Resolution {
+	// The default policies have no ErrorOnNull or KeepPointer, so they can't
+	// fail.
+	result, _ := rdto.AsResolutionWith(DefaultResolutionPolicies())
+	return result
+}
+
+// AsResolutionWith converts the DTO applying the given null policies.
+func (rdto ResolutionDTO) AsResolutionWith(policies NullPolicies) (Resolution, error) {
+	var result Resolution
+	err := ConvertDTO(&result, rdto, policies)
+	return result, err
+}
+
+// String to produce a human readable resolution.
+func (r Resolution) String() string {
+	return fmt.Sprintf("[%d, %d] at %c", r.Width, r.Height, r.Scan)
+}
+
+// Display is a composite that contains another composite.  The resolution
+// type has to be registered before display can be.
+type Display struct {
+	Res   Resolution `pg:"res"`
+	Label string     `pg:"label"`
+}
+
+// DisplayDTO is the DTO for a display, where the nested resolution may itself
+// be null.
+type DisplayDTO struct {
+	Res   *ResolutionDTO
+	Label *string
+}
+
+// AllNull reports whether every field is null, in the same way as
+// ResolutionDTO.AllNull.  A display whose resolution is (,,) is not all null.
+func (ddto DisplayDTO) AllNull() bool {
+	return ddto.Res == nil && ddto.Label == nil
+}
+
+// DefaultDisplayPolicies are the null policies of AsDisplay: a missing
+// resolution is the same as one with every field missing, and a missing label
+// is empty.  Callers that need to tell the two apart should look at the DTO,
+// or scan into a struct with an Option[Resolution] field.
+func DefaultDisplayPolicies() NullPolicies {
+	return NullPolicies{
+		Fields: map[string]NullPolicy{
+			"Res": DefaultValue(ResolutionDTO{}.AsResolution()),
+		},
+		Nested: map[string]NullPolicies{
+			"Res": DefaultResolutionPolicies(),
+		},
+	}
+}
+
+// AsDisplay converts the DTO with its nulls into a semantically valid application type.
+func (ddto DisplayDTO) AsDisplay() Display {
+	// As with AsResolution, the default policies can't fail.
+	result, _ := ddto.AsDisplayWith(DefaultDisplayPolicies())
+	return result
+}
+
+// AsDisplayWith converts the DTO applying the given null policies.
+func (ddto DisplayDTO) AsDisplayWith(policies NullPolicies) (Display, error) {
+	var result Display
+	err := ConvertDTO(&result, ddto, policies)
+	return result, err
+}
+
+// String to produce a human readable display.
+func (d Display) String() string {
+	return fmt.Sprintf("%s: %v", d.Label, d.Res)
+}
+
+// Foo is a row of the foo table, which postgres gives a composite type of the
+// same name.  The resolution can be null, so it is optional.
+type Foo struct {
+	ID  int                   `pg:"id,int4"`
+	Res Option[ResolutionDTO] `pg:"res,resolution"`
+}
+
+// Definitions are the composite types we map, described by field name and
+// postgres type name.  Order doesn't matter, nested types are registered
+// first.
+var Definitions = []TypeDefinition{
+	CompositeDefinition{
+		Name: "foo",
+		Fields: []CompositeField{
+			{Name: "id", Type: "int4"},
+			{Name: "res", Type: "resolution"},
+		},
+	},
+	CompositeDefinition{
+		Name: "display",
+		Fields: []CompositeField{
+			{Name: "res", Type: "resolution"},
+			{Name: "label", Type: "text"},
+		},
+	},
+	CompositeDefinition{
+		Name: "resolution",
+		Fields: []CompositeField{
+			{Name: "width", Type: "int4"},
+			{Name: "height", Type: "int4"},
+			{Name: "scan", Type: "bpchar"},
+		},
+	},
+}
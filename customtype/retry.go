@@ -0,0 +1,127 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// An application deployed alongside its migrations often starts before they
+// have run, and a connection made then finds the types missing.  Failing it
+// fails the pool, and the application with it, so the registry can retry
+// instead, waiting longer each time for the migrations to catch up.
+
+// MissingTypesError is registering types that aren't in the database.  Types
+// are their sanitized names, sorted.
+type MissingTypesError struct {
+	Types []string
+}
+
+func (e *MissingTypesError) Error() string {
+	return fmt.Sprintf("types not found in database: %s", strings.Join(e.Types, ", "))
+}
+
+// Is makes a MissingTypesError an ErrTypeNotFound.
+func (e *MissingTypesError) Is(target error) bool {
+	return target == ErrTypeNotFound
+}
+
+// Retry is how a registry retries registering the types when some of them
+// aren't in the database yet.  Other failures aren't retried.  The zero Retry
+// doesn't retry at all.
+type Retry struct {
+	// Attempts is how many times to try registering the types in all, so
+	// one or less means not retrying.
+	Attempts int `yaml:"attempts"`
+
+	// Wait keeps trying, however many attempts it takes, until the context
+	// is done: the one pgxpool connects with, for AfterConnect.
+	Wait bool `yaml:"wait"`
+
+	// InitialBackoff is the wait before the first retry, a tenth of a second
+	// if it's zero, which doubles each time up to MaxBackoff, 30 seconds if
+	// it's zero.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// again reports whether to try again after attempt failed.
+func (r Retry) again(attempt int) bool {
+	return r.Wait || attempt < r.Attempts
+}
+
+// register registers every type with the connection, whatever the mode,
+// retrying as the registry's Retry says.  retry is for the metrics and logs,
+// and says whether the types are being registered again, or for the first
+// time on a lazy connection.
+func (r *TypeRegistry) register(ctx context.Context, conn *pgx.Conn, retry bool) error {
+	log := r.logger()
+	wait := newBackoff(r.Retry.InitialBackoff, r.Retry.MaxBackoff)
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := r.registerOnce(ctx, conn, retry)
+		var missing *MissingTypesError
+		if err != nil && errors.As(err, &missing) && r.Retry.again(attempt) {
+			log.log(ctx, pgx.LogLevelWarn, "types not found in database, retrying", map[string]interface{}{
+				"types":   missing.Types,
+				"attempt": attempt,
+				"backoff": wait.next,
+			})
+			if wait.wait(ctx) {
+				continue
+			}
+			err = fmt.Errorf("gave up waiting for types: %w", errors.Join(err, ctx.Err()))
+		}
+
+		if err != nil {
+			log.log(ctx, pgx.LogLevelError, "failed to register types", map[string]interface{}{
+				"database": databaseIdentity(conn),
+				"retry":    retry,
+				"attempts": attempt,
+				"duration": time.Since(started),
+				"err":      err,
+			})
+		}
+		return err
+	}
+}
+
+// backoff is a wait that doubles each time, up to a limit.
+type backoff struct {
+	initial, max, next time.Duration
+}
+
+// newBackoff makes a backoff starting at initial, a tenth of a second if it's
+// zero, and going up to max, 30 seconds if it's zero.
+func newBackoff(initial, max time.Duration) *backoff {
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	return &backoff{initial: initial, max: max, next: initial}
+}
+
+// wait waits for the backoff, and doubles it for next time.  It reports
+// false if ctx was done first.
+func (b *backoff) wait(ctx context.Context) bool {
+	t := time.NewTimer(b.next)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	b.next = min(b.next*2, b.max)
+	return true
+}
+
+// reset starts the backoff over.
+func (b *backoff) reset() {
+	b.next = b.initial
+}
@@ -0,0 +1,141 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// An application reading many composites usually reads them from replicas
+// and writes them to the primary.  A Router holds a pool for each, with the
+// registry's types registered on every one, and is both: the typed read
+// helpers, which only need a Querier, run on a replica, and everything that
+// writes on the primary:
+//
+//	router, err := customtype.NewRouter(ctx, registry, primaryDSN, replicaDSN1, replicaDSN2)
+//	...
+//	res, err := customtype.QueryAll[customtype.Resolution](ctx, router, "SELECT res FROM foo")
+//	n, err := customtype.UpsertAll(ctx, router, pgx.Identifier{"foo"}, columns, conflict, rows)
+//
+// Query and QueryRow go to the replicas in turn, and Exec, CopyFrom,
+// SendBatch and transactions to the primary.  A query that writes, such as
+// an INSERT ... RETURNING, or a read that must see a write just made, which
+// a replica may not have yet, goes through Primary instead.  With no
+// replicas, everything goes to the primary.
+
+// Router sends reads to replica pools and writes to a primary one.  It is
+// safe to share between goroutines.
+type Router struct {
+	pools    *Pools
+	primary  *pgxpool.Pool
+	replicas []*pgxpool.Pool
+	next     atomic.Uint64
+}
+
+// NewRouter connects to the primary database at primary and to the replicas
+// at replicas, with registry's types registered on every pool.
+func NewRouter(ctx context.Context, registry *TypeRegistry, primary string, replicas ...string) (*Router, error) {
+	primaryConfig, err := pgxpool.ParseConfig(primary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config for the primary: %w", err)
+	}
+	replicaConfigs := make([]*pgxpool.Config, len(replicas))
+	for i, dsn := range replicas {
+		if replicaConfigs[i], err = pgxpool.ParseConfig(dsn); err != nil {
+			return nil, fmt.Errorf("failed to parse config for replica %d: %w", i+1, err)
+		}
+	}
+	return NewRouterConfig(ctx, registry, primaryConfig, replicaConfigs...)
+}
+
+// NewRouterConfig connects to the primary and replicas using their configs
+// in the same way as NewRouter.
+func NewRouterConfig(ctx context.Context, registry *TypeRegistry, primary *pgxpool.Config, replicas ...*pgxpool.Config) (*Router, error) {
+	pools := NewPools(registry)
+	pool, err := pools.ConnectConfig(ctx, "primary", primary)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Router{pools: pools, primary: pool}
+	for i, config := range replicas {
+		replica, err := pools.ConnectConfig(ctx, fmt.Sprintf("replica %d", i+1), config)
+		if err != nil {
+			pools.Close()
+			return nil, err
+		}
+		r.replicas = append(r.replicas, replica)
+	}
+	return r, nil
+}
+
+// Primary is the primary's pool.
+func (r *Router) Primary() *pgxpool.Pool {
+	return r.primary
+}
+
+// Replica is the pool of the replica whose turn it is, or the primary's if
+// there are no replicas.
+func (r *Router) Replica() *pgxpool.Pool {
+	if len(r.replicas) == 0 {
+		return r.primary
+	}
+	return r.replicas[(r.next.Add(1)-1)%uint64(len(r.replicas))]
+}
+
+// Refresh refreshes the types on the primary and every replica, for after
+// a migration, once it has reached the replicas as well.
+func (r *Router) Refresh(ctx context.Context) error {
+	return r.pools.Refresh(ctx)
+}
+
+// Query runs a query on a replica.
+func (r *Router) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return r.Replica().Query(ctx, sql, args...)
+}
+
+// QueryRow runs a query on a replica.
+func (r *Router) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return r.Replica().QueryRow(ctx, sql, args...)
+}
+
+// Exec runs a statement on the primary.
+func (r *Router) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return r.primary.Exec(ctx, sql, args...)
+}
+
+// CopyFrom copies rows into a table on the primary.
+func (r *Router) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return r.primary.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// SendBatch sends a batch to the primary, since it may write as well as
+// read.
+func (r *Router) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return r.primary.SendBatch(ctx, b)
+}
+
+// Begin starts a transaction on the primary.
+func (r *Router) Begin(ctx context.Context) (pgx.Tx, error) {
+	return r.primary.Begin(ctx)
+}
+
+// BeginTx starts a transaction on the primary.
+func (r *Router) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	return r.primary.BeginTx(ctx, txOptions)
+}
+
+// Close closes every pool.
+func (r *Router) Close() {
+	r.pools.Close()
+}
+
+// Shutdown shuts every pool down, waiting until ctx is done for the
+// connections in use to be released, as Pools' Shutdown does.
+func (r *Router) Shutdown(ctx context.Context) error {
+	return r.pools.Shutdown(ctx)
+}
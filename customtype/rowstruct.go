@@ -0,0 +1,195 @@
+package customtype
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// Composites aren't the only rows worth a struct: select id, created_at,
+// res from foo is a row of a table, with a column for each field.
+// RowToStruct maps the columns of any result onto a struct by name, a
+// column of a composite included, and null columns go through the same
+// NullPolicies a DTO's null fields do.
+
+// RowToStruct scans the current row of rows into a T, a struct, matching the
+// columns to its exported fields by name.  A column matches the field whose
+// pg tag names it, or otherwise the field whose name it is in snake_case, as
+// user_id is UserID's, compared without case or underscores.  Every column
+// must have a field; fields without a column are left at their zero value.
+//
+// A field that can hold a null itself, a pointer, a slice, a map, an Option
+// or an sql.Scanner, gets one as usual.  A null in any other field is
+// resolved by the field's policy in policies, by Go field name, so the
+// zero value unless it says otherwise.
+func RowToStruct[T any](rows pgx.Rows, policies NullPolicies) (T, error) {
+	var value T
+	m, err := newStructMapping(reflect.TypeOf(value), rows.FieldDescriptions())
+	if err != nil {
+		return value, err
+	}
+	err = m.scan(rows, reflect.ValueOf(&value).Elem(), policies)
+	return value, err
+}
+
+// CollectStructs collects every row into a slice with RowToStruct and closes
+// the rows.  The columns are matched to fields once, for the whole result.
+func CollectStructs[T any](rows pgx.Rows, policies NullPolicies) ([]T, error) {
+	defer rows.Close()
+
+	var zero T
+	m, err := newStructMapping(reflect.TypeOf(zero), rows.FieldDescriptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []T
+	for rows.Next() {
+		var value T
+		if err := m.scan(rows, reflect.ValueOf(&value).Elem(), policies); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+		results = append(results, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return results, nil
+}
+
+// structMapping is the field of a struct for each column of a result, and
+// how to scan into it.  The scans are the targets, or what decodes into them
+// for a field with an interval mode or a location.
+type structMapping struct {
+	t       reflect.Type
+	fields  []structField
+	kinds   []fieldKind
+	targets []interface{}
+	scans   []interface{}
+}
+
+// fieldKind is how a column is scanned into its field.
+type fieldKind int
+
+const (
+	// directField takes a null itself, and is scanned into directly.
+	directField fieldKind = iota
+
+	// policyField is scanned into through a pointer, and a null resolved by
+	// the policies.
+	policyField
+
+	// optionField is an Option, scanned into through a pointer to what it
+	// holds.
+	optionField
+)
+
+func newStructMapping(t reflect.Type, columns []pgproto3.FieldDescription) (*structMapping, error) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot map columns onto a %v, it must be a struct", t)
+	}
+
+	byName := make(map[string]structField)
+	byKey := make(map[string]structField)
+	for _, field := range exportedFields(t) {
+		if name, _, _ := strings.Cut(field.Tag.Get("pg"), ","); name != "" {
+			byName[field.prefix+name] = field
+		} else {
+			byKey[columnKey(field.prefix+field.Name)] = field
+		}
+	}
+
+	m := &structMapping{
+		t:       t,
+		fields:  make([]structField, len(columns)),
+		kinds:   make([]fieldKind, len(columns)),
+		targets: make([]interface{}, len(columns)),
+		scans:   make([]interface{}, len(columns)),
+	}
+	for i, fd := range columns {
+		field, ok := byName[string(fd.Name)]
+		if !ok {
+			field, ok = byKey[columnKey(string(fd.Name))]
+		}
+		if !ok {
+			return nil, fmt.Errorf("column %s has no field in %s", fd.Name, t)
+		}
+		if field.err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", field.Name, t, field.err)
+		}
+		m.fields[i] = field
+		m.kinds[i] = kindOfField(field.Type)
+	}
+	return m, nil
+}
+
+// columnKey is what a column and a field name are compared by.
+func columnKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+func kindOfField(t reflect.Type) fieldKind {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return directField
+	}
+	if _, ok := reflect.Zero(t).Interface().(optionSource); ok {
+		return optionField
+	}
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()) {
+		return directField
+	}
+	return policyField
+}
+
+// scan scans the current row into v, which is of the mapping's type, and
+// validates it.
+func (m *structMapping) scan(rows pgx.Rows, v reflect.Value, policies NullPolicies) error {
+	for i, f := range m.fields {
+		field := v.FieldByIndex(f.index)
+		// The others get a pointer to a pointer, which pgx leaves nil for a
+		// null.
+		switch m.kinds[i] {
+		case directField:
+			m.targets[i] = field.Addr().Interface()
+		case policyField:
+			m.targets[i] = reflect.New(field.Addr().Type()).Interface()
+		case optionField:
+			option := field.Interface().(optionSource)
+			m.targets[i] = reflect.New(reflect.PtrTo(option.optionType())).Interface()
+		}
+		m.scans[i] = f.scanTarget(m.targets[i])
+	}
+	if err := rows.Scan(m.scans...); err != nil {
+		return err
+	}
+
+	for i, f := range m.fields {
+		if m.kinds[i] == directField {
+			continue
+		}
+		field := v.FieldByIndex(f.index)
+		scanned := reflect.ValueOf(m.targets[i]).Elem()
+		switch {
+		case m.kinds[i] == optionField && scanned.IsNil():
+			field.Set(reflect.Zero(field.Type()))
+		case m.kinds[i] == optionField:
+			field.Addr().Interface().(optionSetter).setSome(scanned.Elem())
+		case scanned.IsNil():
+			if err := applyNullPolicy(field, m.t.Name(), f.Name, policies.forField(f.Name)); err != nil {
+				return err
+			}
+		default:
+			field.Set(scanned.Elem())
+		}
+		if f.trim {
+			trimChars(field)
+		}
+	}
+	return validate(v)
+}
@@ -0,0 +1,174 @@
+package customtype
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrTooManyRows is returned by ScanOne when the query returned more than one
+// row.
+var ErrTooManyRows = errors.New("too many rows")
+
+// ScanError is a failure to scan one of the rows of a result, numbered from
+// zero.
+type ScanError struct {
+	Row int
+	Err error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("failed to scan row %d: %v", e.Row, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// ScanAll collects every row into a slice and closes the rows.  A result with
+// a single column is scanned into a T, so T can be anything the column's type
+// can be assigned to, like a Resolution or *ResolutionDTO for a resolution
+// column.  A result with more than one column is scanned into the exported
+// fields of a struct T in order.
+func ScanAll[T any](rows pgx.Rows) ([]T, error) {
+	defer rows.Close()
+
+	var results []T
+	for rows.Next() {
+		var value T
+		if err := scanRow(rows, &value); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+		results = append(results, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return results, nil
+}
+
+// ScanOne scans the only row in the same way as ScanAll and closes the rows.
+// It returns pgx.ErrNoRows if there isn't a row, and ErrTooManyRows if there
+// is more than one.
+func ScanOne[T any](rows pgx.Rows) (T, error) {
+	defer rows.Close()
+
+	var value T
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return value, fmt.Errorf("query failed: %w", err)
+		}
+		return value, pgx.ErrNoRows
+	}
+
+	if err := scanRow(rows, &value); err != nil {
+		return value, &ScanError{Row: 0, Err: err}
+	}
+
+	if rows.Next() {
+		return value, ErrTooManyRows
+	}
+	if err := rows.Err(); err != nil {
+		return value, fmt.Errorf("query failed: %w", err)
+	}
+
+	return value, nil
+}
+
+// scanRow scans the current row into dst, a pointer, and validates it.
+func scanRow(rows pgx.Rows, dst interface{}) error {
+	if err := scanColumns(rows, dst); err != nil {
+		return err
+	}
+	return validate(reflect.ValueOf(dst).Elem())
+}
+
+func scanColumns(rows pgx.Rows, dst interface{}) error {
+	columns := len(rows.FieldDescriptions())
+	if columns == 1 {
+		return rows.Scan(dst)
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot scan %d columns into a %s", columns, v.Type())
+	}
+
+	var targets []interface{}
+	for _, field := range exportedFields(v.Type()) {
+		targets = append(targets, v.FieldByIndex(field.index).Addr().Interface())
+	}
+	if len(targets) != columns {
+		return fmt.Errorf("cannot scan %d columns into %s with %d exported fields: %w", columns, v.Type(), len(targets), ErrFieldCountMismatch)
+	}
+
+	return rows.Scan(targets...)
+}
+
+// ScanAllByName collects every row into a slice of structs and closes the
+// rows, as ScanAll does, but matches the columns to T's exported fields by
+// name rather than position: a field's name is the one in its pg tag, as
+// DefinitionFor has it, or the field's in lower case.  That's what a
+// composite's fields come back as when it's exploded into columns, as
+// select * from a function returning setof resolution does, so they scan
+// into a Resolution, or a ResolutionDTO where they can be null.  Every
+// column must have a field; fields without a column are left at their zero
+// value.
+func ScanAllByName[T any](rows pgx.Rows) ([]T, error) {
+	defer rows.Close()
+
+	var zero T
+	fields, err := fieldsByName(reflect.TypeOf(zero), rows.FieldDescriptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []T
+	targets := make([]interface{}, len(fields))
+	for rows.Next() {
+		var value T
+		v := reflect.ValueOf(&value).Elem()
+		for i, index := range fields {
+			targets[i] = v.FieldByIndex(index).Addr().Interface()
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+		if err := validate(v); err != nil {
+			return nil, &ScanError{Row: len(results), Err: err}
+		}
+		results = append(results, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return results, nil
+}
+
+// fieldsByName is the path in t to the field for each column.
+func fieldsByName(t reflect.Type, columns []pgproto3.FieldDescription) ([][]int, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot scan columns by name into a %s", t)
+	}
+
+	byName := make(map[string][]int)
+	for _, field := range exportedFields(t) {
+		name, _ := field.attribute()
+		byName[name] = field.index
+	}
+
+	fields := make([][]int, len(columns))
+	for i, fd := range columns {
+		index, ok := byName[string(fd.Name)]
+		if !ok {
+			return nil, fmt.Errorf("column %s has no field in %s", fd.Name, t)
+		}
+		fields[i] = index
+	}
+	return fields, nil
+}
@@ -0,0 +1,133 @@
+package customtype
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// FooHandler serves the rows of foo as JSON, which is every layer of the
+// package at once: a row decoded from its composite, a resolution that may be
+// NULL or have NULL fields, and JSON going both ways.
+//
+//	GET  /foos       every row, by id
+//	GET  /foos/{id}  one row, or 404
+//	POST /foos       a row such as {"id":6,"res":{"width":640,"height":480}}
+//
+// A row's resolution is written as DefaultJSONNulls says.  A posted
+// resolution has policies applied to its missing and null fields before it's
+// validated and inserted, so with DefaultResolutionPolicies the one above is
+// stored as (640,480,P), and with ErrorOnNull for Scan it's turned away.  A
+// missing or null resolution is inserted as NULL.  What was stored comes back
+// with 201, as it reads back from the database.
+//
+// Errors are {"error":"..."}: 400 for a body that isn't a row, 404, 409 for an
+// id that's taken, 422 for a resolution the policies or CheckedResolution
+// reject, and 500 for the rest.
+func FooHandler(q Querier, policies NullPolicies) http.Handler {
+	h := fooHandler{q: q, policies: policies}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /foos", h.list)
+	mux.HandleFunc("GET /foos/{id}", h.get)
+	mux.HandleFunc("POST /foos", h.create)
+	return mux
+}
+
+type fooHandler struct {
+	q        Querier
+	policies NullPolicies
+}
+
+// maxFooBody is more than any row of foo needs.
+const maxFooBody = 1 << 16
+
+func (h fooHandler) list(w http.ResponseWriter, req *http.Request) {
+	foos, err := QueryAll[Foo](req.Context(), h.q, "SELECT foo FROM foo ORDER BY id")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if foos == nil {
+		foos = []Foo{}
+	}
+	writeJSON(w, http.StatusOK, foos)
+}
+
+func (h fooHandler) get(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no foo %q", req.PathValue("id")))
+		return
+	}
+	foo, err := QueryOne[Foo](req.Context(), h.q, "SELECT foo FROM foo WHERE id = $1", id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no foo %d", id))
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, foo)
+}
+
+func (h fooHandler) create(w http.ResponseWriter, req *http.Request) {
+	var posted Foo
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxFooBody))
+	if err := dec.Decode(&posted); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("failed to read foo: %w", err))
+		return
+	}
+
+	// None goes in as NULL.
+	res := None[Resolution]()
+	if posted.Res.IsSome() {
+		resolved, err := posted.Res.Unwrap().AsResolutionWith(h.policies)
+		if err == nil {
+			err = CheckedResolution(resolved).Validate()
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, fmt.Errorf("invalid resolution: %w", err))
+			return
+		}
+		res = Some(resolved)
+	}
+
+	foo, err := QueryOne[Foo](req.Context(), h.q, "INSERT INTO foo (id, res) VALUES ($1, $2) RETURNING foo", posted.ID, res)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("foo %d already exists", posted.ID))
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("failed to insert foo %d: %w", posted.ID, err))
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/foos/%d", foo.ID))
+	writeJSON(w, http.StatusCreated, foo)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("failed to encode the response: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	body, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,140 @@
+package customtype
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+)
+
+// TestFooHandler checks the statuses and bodies FooHandler answers with, and
+// that what it turns away never reaches the database, against a Fake.
+func TestFooHandler(t *testing.T) {
+	const (
+		listSQL   = "SELECT foo FROM foo ORDER BY id"
+		getSQL    = "SELECT foo FROM foo WHERE id = $1"
+		insertSQL = "INSERT INTO foo (id, res) VALUES ($1, $2) RETURNING foo"
+	)
+	width, height := 640, 480
+	stored := Foo{ID: 6, Res: Some(ResolutionDTO{Width: &width, Height: &height, Scan: ptr('P')})}
+	strictScan := NullPolicies{Fields: map[string]NullPolicy{"Scan": ErrorOnNull}}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		policies   NullPolicies
+		setup      func(f *Fake)
+		wantStatus int
+		wantBody   string
+		wantCalls  int
+	}{
+		{
+			name: "list", method: "GET", path: "/foos",
+			setup:      func(f *Fake) { f.On(listSQL).Column("foo", "foo").Row(stored).Row(Foo{ID: 7}) },
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"id":6,"res":{"width":640,"height":480,"scan":"P"}},{"id":7,"res":null}]`,
+			wantCalls:  1,
+		},
+		{
+			name: "empty list", method: "GET", path: "/foos",
+			setup:      func(f *Fake) { f.On(listSQL).Column("foo", "foo") },
+			wantStatus: http.StatusOK, wantBody: `[]`, wantCalls: 1,
+		},
+		{
+			name: "list fails", method: "GET", path: "/foos",
+			setup:      func(f *Fake) { f.On(listSQL).Fails(errors.New("connection reset")) },
+			wantStatus: http.StatusInternalServerError, wantBody: `{"error":"query failed: connection reset"}`, wantCalls: 1,
+		},
+		{
+			name: "get", method: "GET", path: "/foos/6",
+			setup:      func(f *Fake) { f.On(getSQL).Column("foo", "foo").Row(stored) },
+			wantStatus: http.StatusOK, wantBody: `{"id":6,"res":{"width":640,"height":480,"scan":"P"}}`, wantCalls: 1,
+		},
+		{
+			name: "no such foo", method: "GET", path: "/foos/8",
+			setup:      func(f *Fake) { f.On(getSQL).Column("foo", "foo") },
+			wantStatus: http.StatusNotFound, wantBody: `{"error":"no foo 8"}`, wantCalls: 1,
+		},
+		{
+			name: "id not a number", method: "GET", path: "/foos/six",
+			wantStatus: http.StatusNotFound, wantBody: `{"error":"no foo \"six\""}`,
+		},
+		{
+			name: "create", method: "POST", path: "/foos", body: `{"id":6,"res":{"width":640,"height":480}}`,
+			policies:   DefaultResolutionPolicies(),
+			setup:      func(f *Fake) { f.On(insertSQL).Column("foo", "foo").Row(stored) },
+			wantStatus: http.StatusCreated, wantBody: `{"id":6,"res":{"width":640,"height":480,"scan":"P"}}`, wantCalls: 1,
+		},
+		{
+			name: "not json", method: "POST", path: "/foos", body: `id=6`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "too big", method: "POST", path: "/foos", body: `{"id":6,"res":{"width":640,"height":480},"pad":"` + strings.Repeat("x", maxFooBody) + `"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "negative width", method: "POST", path: "/foos", body: `{"id":6,"res":{"width":-640,"height":480,"scan":"P"}}`,
+			policies:   DefaultResolutionPolicies(),
+			wantStatus: http.StatusUnprocessableEntity, wantBody: `{"error":"invalid resolution: -640x480 has a negative side"}`,
+		},
+		{
+			name: "null scan", method: "POST", path: "/foos", body: `{"id":6,"res":{"width":640,"height":480}}`,
+			policies:   strictScan,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "taken id", method: "POST", path: "/foos", body: `{"id":6,"res":{"width":640,"height":480,"scan":"P"}}`,
+			policies:   DefaultResolutionPolicies(),
+			setup:      func(f *Fake) { f.On(insertSQL).Fails(&pgconn.PgError{Code: "23505", Message: "duplicate key value"}) },
+			wantStatus: http.StatusConflict, wantBody: `{"error":"foo 6 already exists"}`, wantCalls: 1,
+		},
+		{
+			name: "insert fails", method: "POST", path: "/foos", body: `{"id":6,"res":null}`,
+			setup:      func(f *Fake) { f.On(insertSQL).Fails(errors.New("connection reset")) },
+			wantStatus: http.StatusInternalServerError, wantBody: `{"error":"failed to insert foo 6: query failed: connection reset"}`, wantCalls: 1,
+		},
+		{
+			name: "no such method", method: "DELETE", path: "/foos/6",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	registry, err := NewTypeRegistry(Definitions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, err := NewFake(registry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+
+			w := httptest.NewRecorder()
+			FooHandler(fake, tt.policies).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if body := strings.TrimSuffix(w.Body.String(), "\n"); tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("got  %s\nwant %s", body, tt.wantBody)
+			}
+			if calls := fake.Calls(); len(calls) != tt.wantCalls {
+				t.Errorf("made %d calls, want %d: %v", len(calls), tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,307 @@
+package customtype
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/jackc/pgtype"
+)
+
+// The adapters in this file let the types be used through database/sql, e.g.
+// with the pgx stdlib driver, as well as natively.  Resolution can't be an
+// sql.Scanner itself, as its Scan field already has the name, so like pq.Array
+// the adapters wrap a pointer:
+//
+//	var res customtype.Resolution
+//	err := db.QueryRow("select res from foo where id = 1").Scan(customtype.SQLResolution(&res))
+//
+// database/sql doesn't know about composites, so they come and go in the text
+// format: (10,10,P).
+// SQLComposite, in sqlcomposite.go, does the same for any composite struct,
+// as a field for sqlx, Bun and GORM to scan into.
+//
+// Going the other way needs no adapter, the types are driver.Valuers.  pgx
+// only falls back on Value when the parameter's type isn't registered, so
+// with a registry the binary format is sent instead.
+
+// SQLValue is both a scan destination and a query argument.
+type SQLValue interface {
+	sql.Scanner
+	driver.Valuer
+}
+
+// SQLResolution adapts r for database/sql.  Null fields are resolved as by
+// AsResolution, a null resolution is an error.
+func SQLResolution(r *Resolution) SQLValue {
+	return sqlResolution{r}
+}
+
+// SQLResolutionDTO adapts r for database/sql.  A null resolution sets *r to
+// nil, and a nil *r is sent as a null.
+func SQLResolutionDTO(r **ResolutionDTO) SQLValue {
+	return sqlResolutionDTO{r}
+}
+
+// SQLDisplay adapts d for database/sql.  Null fields are resolved as by
+// AsDisplay, a null display is an error.
+func SQLDisplay(d *Display) SQLValue {
+	return sqlDisplay{d}
+}
+
+// SQLDisplayDTO adapts d for database/sql.  A null display sets *d to nil,
+// and a nil *d is sent as a null.
+func SQLDisplayDTO(d **DisplayDTO) SQLValue {
+	return sqlDisplayDTO{d}
+}
+
+type sqlResolution struct {
+	dst *Resolution
+}
+
+func (s sqlResolution) Scan(src interface{}) error {
+	if src == nil {
+		return fmt.Errorf("cannot scan NULL into *Resolution, use SQLResolutionDTO: %w", ErrNullComposite)
+	}
+
+	rdto, err := parseResolution(src)
+	if err != nil {
+		return err
+	}
+
+	*s.dst = rdto.AsResolution()
+	return nil
+}
+
+func (s sqlResolution) Value() (driver.Value, error) {
+	return s.dst.Value()
+}
+
+type sqlResolutionDTO struct {
+	dst **ResolutionDTO
+}
+
+func (s sqlResolutionDTO) Scan(src interface{}) error {
+	if src == nil {
+		*s.dst = nil
+		return nil
+	}
+
+	rdto, err := parseResolution(src)
+	if err != nil {
+		return err
+	}
+
+	*s.dst = &rdto
+	return nil
+}
+
+func (s sqlResolutionDTO) Value() (driver.Value, error) {
+	if *s.dst == nil {
+		return nil, nil
+	}
+	return (*s.dst).Value()
+}
+
+type sqlDisplay struct {
+	dst *Display
+}
+
+func (s sqlDisplay) Scan(src interface{}) error {
+	if src == nil {
+		return fmt.Errorf("cannot scan NULL into *Display, use SQLDisplayDTO: %w", ErrNullComposite)
+	}
+
+	ddto, err := parseDisplay(src)
+	if err != nil {
+		return err
+	}
+
+	*s.dst = ddto.AsDisplay()
+	return nil
+}
+
+func (s sqlDisplay) Value() (driver.Value, error) {
+	return s.dst.Value()
+}
+
+type sqlDisplayDTO struct {
+	dst **DisplayDTO
+}
+
+func (s sqlDisplayDTO) Scan(src interface{}) error {
+	if src == nil {
+		*s.dst = nil
+		return nil
+	}
+
+	ddto, err := parseDisplay(src)
+	if err != nil {
+		return err
+	}
+
+	*s.dst = &ddto
+	return nil
+}
+
+func (s sqlDisplayDTO) Value() (driver.Value, error) {
+	if *s.dst == nil {
+		return nil, nil
+	}
+	return (*s.dst).Value()
+}
+
+// Value sends the resolution in the text format.
+func (r Resolution) Value() (driver.Value, error) {
+	return textValue(r.asDTO().encodeText)
+}
+
+// Value sends the resolution in the text format, with nil fields as nulls.
+func (rdto ResolutionDTO) Value() (driver.Value, error) {
+	return textValue(rdto.encodeText)
+}
+
+// Value sends the display in the text format.
+func (d Display) Value() (driver.Value, error) {
+	res := d.Res.asDTO()
+	return textValue(DisplayDTO{Res: &res, Label: &d.Label}.encodeText)
+}
+
+// Value sends the display in the text format, with nil fields as nulls.
+func (ddto DisplayDTO) Value() (driver.Value, error) {
+	return textValue(ddto.encodeText)
+}
+
+func (r Resolution) asDTO() ResolutionDTO {
+	return ResolutionDTO{Width: &r.Width, Height: &r.Height, Scan: &r.Scan}
+}
+
+// parseResolution parses the text format of a resolution.
+func parseResolution(src interface{}) (ResolutionDTO, error) {
+	buf, err := compositeText(src)
+	if err != nil {
+		return ResolutionDTO{}, err
+	}
+
+	var width, height pgtype.Int4
+	var scan pgtype.BPChar
+	s := newCompositeTextScanner(buf)
+	s.ScanDecoder(&width)
+	s.ScanDecoder(&height)
+	s.ScanDecoder(&scan)
+	if err := s.Err(); err != nil {
+		return ResolutionDTO{}, fmt.Errorf("failed to scan resolution: %w", err)
+	}
+
+	var rdto ResolutionDTO
+	if err := width.AssignTo(&rdto.Width); err != nil {
+		return ResolutionDTO{}, err
+	}
+	if err := height.AssignTo(&rdto.Height); err != nil {
+		return ResolutionDTO{}, err
+	}
+	// The scan goes through assignChar, as it does on the native path, so
+	// that an empty char is the zero rune, and the padding is trimmed.
+	if err := assignField(&scan, &rdto.Scan); err != nil {
+		return ResolutionDTO{}, err
+	}
+	return rdto, nil
+}
+
+func (rdto ResolutionDTO) encodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	var width, height pgtype.Int4
+	var scan pgtype.BPChar
+	if err := width.Set(rdto.Width); err != nil {
+		return nil, err
+	}
+	if err := height.Set(rdto.Height); err != nil {
+		return nil, err
+	}
+	if rdto.Scan == nil {
+		scan.Status = pgtype.Null
+	} else if err := scan.Set(runeText(*rdto.Scan)); err != nil {
+		return nil, err
+	}
+
+	b := pgtype.NewCompositeTextBuilder(ci, buf)
+	b.AppendEncoder(&width)
+	b.AppendEncoder(&height)
+	b.AppendEncoder(&scan)
+	return b.Finish()
+}
+
+// parseDisplay parses the text format of a display, including the nested
+// resolution.
+func parseDisplay(src interface{}) (DisplayDTO, error) {
+	buf, err := compositeText(src)
+	if err != nil {
+		return DisplayDTO{}, err
+	}
+
+	var res, label pgtype.Text
+	s := newCompositeTextScanner(buf)
+	s.ScanDecoder(&res)
+	s.ScanDecoder(&label)
+	if err := s.Err(); err != nil {
+		return DisplayDTO{}, fmt.Errorf("failed to scan display: %w", err)
+	}
+
+	var ddto DisplayDTO
+	if res.Status == pgtype.Present {
+		rdto, err := parseResolution(res.String)
+		if err != nil {
+			return DisplayDTO{}, err
+		}
+		ddto.Res = &rdto
+	}
+	if err := label.AssignTo(&ddto.Label); err != nil {
+		return DisplayDTO{}, err
+	}
+	return ddto, nil
+}
+
+func (ddto DisplayDTO) encodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	var label pgtype.Text
+	if err := label.Set(ddto.Label); err != nil {
+		return nil, err
+	}
+
+	res := textEncoderFunc(func(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+		if ddto.Res == nil {
+			return nil, nil
+		}
+		return ddto.Res.encodeText(ci, buf)
+	})
+
+	b := pgtype.NewCompositeTextBuilder(ci, buf)
+	b.AppendEncoder(res)
+	b.AppendEncoder(&label)
+	return b.Finish()
+}
+
+// compositeText returns the text format of a composite handed to Scan.
+func compositeText(src interface{}) ([]byte, error) {
+	switch src := src.(type) {
+	case string:
+		return []byte(src), nil
+	case []byte:
+		return src, nil
+	default:
+		return nil, fmt.Errorf("cannot scan %T", src)
+	}
+}
+
+// textEncoderFunc lets a function be appended to a composite text builder.
+type textEncoderFunc func(ci *pgtype.ConnInfo, buf []byte) ([]byte, error)
+
+func (f textEncoderFunc) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	return f(ci, buf)
+}
+
+func textValue(encode textEncoderFunc) (driver.Value, error) {
+	buf, err := encode(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,54 @@
+package customtype
+
+import "testing"
+
+// TestSQLResolutionText checks the text format database/sql sends and scans a
+// resolution in, an empty char being the zero rune either way, as it is on
+// the native path.
+func TestSQLResolutionText(t *testing.T) {
+	values := []struct {
+		name string
+		res  Resolution
+		want string
+	}{
+		{"progressive", Resolution{Width: 10, Height: 10, Scan: 'P'}, "(10,10,P)"},
+		{"zero scan", Resolution{Width: 640, Height: 480}, `(640,480,"")`},
+	}
+	for _, tt := range values {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.res.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("sent %v as %q, want %q", tt.res, got, tt.want)
+			}
+		})
+	}
+
+	scans := []struct {
+		src     string
+		want    Resolution
+		wantErr bool
+	}{
+		{src: "(10,10,P)", want: Resolution{Width: 10, Height: 10, Scan: 'P'}},
+		{src: `(640,480,"")`, want: Resolution{Width: 640, Height: 480}},
+		{src: `(640,480,"I  ")`, want: Resolution{Width: 640, Height: 480, Scan: 'I'}},
+		{src: "(640,480,)", want: Resolution{Width: 640, Height: 480, Scan: 'P'}},
+		{src: "(640,480,PI)", wantErr: true},
+	}
+	for _, tt := range scans {
+		t.Run(tt.src, func(t *testing.T) {
+			var got Resolution
+			err := SQLResolution(&got).Scan(tt.src)
+			switch {
+			case tt.wantErr && err == nil:
+				t.Fatalf("scanned %s as %v, want an error", tt.src, got)
+			case !tt.wantErr && err != nil:
+				t.Fatalf("failed to scan %s: %v", tt.src, err)
+			case got != tt.want:
+				t.Errorf("scanned %s as %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package customtype
+
+import (
+	"errors"
+	"fmt"
+)
+
+// sqlc knows nothing of composites, and generates interface{} for a column of
+// one, which pgx then fills with a map of its fields, or with raw bytes once
+// the types aren't registered.  Its overrides, in sqlc.yaml, map a database
+// type to a Go type instead, so SqlcOverrides writes one for each of the
+// types Generate writes Go code for: sqlc's code then scans composites into
+// the DTOs, and enums into their string types, through the types registered
+// on the pool as usual.  sqlc must generate for pgx/v4, so that its queries
+// run on a pool the registry has configured:
+//
+//	sql:
+//	  - engine: postgresql
+//	    gen:
+//	      go:
+//	        sql_package: pgx/v4
+//	        overrides:
+//	          - db_type: resolution
+//	            go_type: {import: example.com/app/customtype, type: ResolutionDTO}
+//	          ...
+//
+// The sqlc command prints them for the config, ready to paste.
+
+// SqlcOverride is one of the overrides of sqlc.yaml.
+type SqlcOverride struct {
+	DBType   string     `yaml:"db_type" json:"db_type"`
+	GoType   SqlcGoType `yaml:"go_type" json:"go_type"`
+	Nullable bool       `yaml:"nullable,omitempty" json:"nullable,omitempty"`
+}
+
+// SqlcGoType is the Go type an override maps to.
+type SqlcGoType struct {
+	Import  string `yaml:"import" json:"import"`
+	Type    string `yaml:"type" json:"type"`
+	Pointer bool   `yaml:"pointer,omitempty" json:"pointer,omitempty"`
+}
+
+// SqlcOverrides are the overrides that make sqlc use the Go types Generate
+// writes for config, in the package at importPath.  A composite column maps
+// to the DTO, since even a column that isn't null can have null fields, and
+// to a pointer to it where the column can be null; an enum column maps to its
+// type, and to a pointer to it.  Arrays of them come out as slices without
+// overrides of their own.  Other types, domains included, are left to sqlc.
+func SqlcOverrides(config *Config, importPath string) ([]SqlcOverride, error) {
+	if importPath == "" {
+		return nil, errors.New("sqlc overrides need the import path of the generated code")
+	}
+
+	var overrides []SqlcOverride
+	for _, t := range config.Types {
+		def, err := t.definition()
+		if err != nil {
+			return nil, err
+		}
+
+		var goType string
+		switch def.(type) {
+		case CompositeDefinition:
+			goType = t.GoName() + "DTO"
+		case EnumDefinition:
+			goType = t.GoName()
+		default:
+			continue
+		}
+
+		tn, err := parseTypeName(t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot override %s: %w", t.Name, err)
+		}
+		dbType := tn.name
+		if tn.schema != "" {
+			dbType = tn.schema + "." + tn.name
+		}
+
+		overrides = append(overrides,
+			SqlcOverride{DBType: dbType, GoType: SqlcGoType{Import: importPath, Type: goType}},
+			SqlcOverride{DBType: dbType, GoType: SqlcGoType{Import: importPath, Type: goType, Pointer: true}, Nullable: true},
+		)
+	}
+	return overrides, nil
+}
@@ -0,0 +1,230 @@
+package customtype
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/jackc/pgtype"
+)
+
+// Libraries on top of database/sql, sqlx, Bun and GORM among them, scan a
+// column into a struct field through sql.Scanner, and write one through
+// driver.Valuer, and otherwise take a struct field for more columns, or for
+// JSON.  Resolution can't be a Scanner, as its Scan field already has the
+// name, and nor can any composite with a field called Scan or Value, so
+// SQLComposite wraps one, or any other composite struct:
+//
+//	type Monitor struct {
+//		ID  int
+//		Res customtype.SQLComposite[customtype.ResolutionDTO] `db:"res" bun:"res,type:resolution"`
+//	}
+//
+// sqlx's Get, Select and StructScan then fill Res from the res column, as
+// does Bun's Scan, and both send it back as a query argument.  Bun's
+// CreateTable takes the column type from the tag; GORM's, in gorm.go, from
+// the wrapper.
+//
+// As with the other database/sql adapters, composites come and go in the
+// text format, parsed and written by the struct's pg tags as DefinitionFor
+// reads them, nested composites included, rather than by the types a
+// registry has looked up.  A field of a type pgtype doesn't know, an enum
+// say, is read and written as text.
+
+// SQLComposite is a composite column, which may be null, for database/sql and
+// the libraries on top of it.
+type SQLComposite[T any] struct {
+	V     T
+	Valid bool
+}
+
+// NewSQLComposite is an SQLComposite holding v.
+func NewSQLComposite[T any](v T) SQLComposite[T] {
+	return SQLComposite[T]{V: v, Valid: true}
+}
+
+// Scan parses the text format of the composite into V.  A null sets V to its
+// zero value and Valid to false.
+func (c *SQLComposite[T]) Scan(src interface{}) error {
+	var zero T
+	c.V, c.Valid = zero, false
+	if src == nil {
+		return nil
+	}
+
+	buf, err := compositeText(src)
+	if err != nil {
+		return err
+	}
+	codec, err := compositeCodecFor(reflect.TypeOf(c.V))
+	if err != nil {
+		return err
+	}
+
+	value := codec.newValue()
+	if err := value.DecodeText(codec.ci, buf); err != nil {
+		return err
+	}
+	if err := value.AssignTo(&c.V); err != nil {
+		return err
+	}
+	c.Valid = value.status == pgtype.Present
+	return nil
+}
+
+// Value sends V in the text format, or a null if Valid is false.
+func (c SQLComposite[T]) Value() (driver.Value, error) {
+	if !c.Valid {
+		return nil, nil
+	}
+	codec, err := compositeCodecFor(reflect.TypeOf(c.V))
+	if err != nil {
+		return nil, err
+	}
+
+	value := codec.newValue()
+	if err := value.Set(c.V); err != nil {
+		return nil, err
+	}
+	return textValue(value.EncodeText)
+}
+
+// compositeTypeName is the composite a Go type is, by its GormDataType or
+// its name.
+func compositeTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if typer, ok := reflect.Zero(t).Interface().(gormDataTyper); ok {
+		return typer.GormDataType()
+	}
+	name, _ := postgresType(t)
+	return name
+}
+
+// compositeCodec is a ConnInfo with a Go type's composite registered on it, and
+// the composites and types of its fields.  The OIDs are our own, since the
+// text format doesn't carry any.
+type compositeCodec struct {
+	ci    *pgtype.ConnInfo
+	value *compositeValue
+}
+
+func (c *compositeCodec) newValue() *compositeValue {
+	return c.value.NewTypeValue().(*compositeValue)
+}
+
+// compositeCodecs caches a compositeCodec, or the error making it, per Go type.
+var compositeCodecs sync.Map
+
+type compositeCodecResult struct {
+	codec *compositeCodec
+	err   error
+}
+
+func compositeCodecFor(t reflect.Type) (*compositeCodec, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if result, ok := compositeCodecs.Load(t); ok {
+		result := result.(compositeCodecResult)
+		return result.codec, result.err
+	}
+
+	codec, err := newCompositeCodec(t)
+	result, _ := compositeCodecs.LoadOrStore(t, compositeCodecResult{codec, err})
+	return result.(compositeCodecResult).codec, result.(compositeCodecResult).err
+}
+
+func newCompositeCodec(t reflect.Type) (*compositeCodec, error) {
+	name := compositeTypeName(t)
+	if name == "" {
+		return nil, fmt.Errorf("cannot name the composite of %s, give it a GormDataType method", t)
+	}
+
+	ci := pgtype.NewConnInfo()
+	registerNetwork(ci)
+	registerTemporal(ci)
+	next := uint32(1 << 30)
+	oids := func() typeOIDs {
+		next += 2
+		return typeOIDs{oid: next, arrayOID: next + 1}
+	}
+
+	var defs []TypeDefinition
+	seen := map[string]bool{}
+	var define func(name string, t reflect.Type) error
+	define = func(name string, t reflect.Type) error {
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+
+		def, err := DefinitionFor(name, reflect.Zero(t).Interface())
+		if err != nil {
+			return err
+		}
+		defs = append(defs, def)
+
+		// The struct's fields say which Go types the composites among them
+		// are; anything else pgtype doesn't know is read as text.
+		for i, sf := range exportedFields(t) {
+			fieldType := def.Fields[i].Type
+			elemType, isArray := arrayElement(fieldType)
+			if !isArray {
+				elemType = fieldType
+			}
+			if _, ok := ci.DataTypeForName(elemType); ok || seen[elemType] || extensionTypes[elemType] != nil {
+				continue
+			}
+			if st, ok := structType(sf.Type); ok {
+				if err := define(elemType, st); err != nil {
+					return fmt.Errorf("cannot define %s.%s: %w", t.Name(), sf.Name, err)
+				}
+				continue
+			}
+			seen[elemType] = true
+			registerDataType(ci, elemType, &pgtype.Text{}, oids())
+		}
+		return nil
+	}
+	if err := define(name, t); err != nil {
+		return nil, err
+	}
+
+	// The registry puts nested composites before the composites they're in,
+	// and adds hstore or citext if there's a field of them.
+	registry, err := NewTypeRegistry(defs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, def := range registry.snapshot().definitions {
+		if err := def.register(ci, oids()); err != nil {
+			return nil, err
+		}
+	}
+
+	dt, ok := ci.DataTypeForName(name)
+	if !ok {
+		return nil, fmt.Errorf("failed to register %s", name)
+	}
+	return &compositeCodec{ci: ci, value: dt.Value.(*compositeValue)}, nil
+}
+
+// structType is the struct a field of type t holds, through pointers,
+// Options and slices, if it is one.
+func structType(t reflect.Type) (reflect.Type, bool) {
+	for {
+		if t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			t = t.Elem()
+			continue
+		}
+		if option, ok := reflect.Zero(t).Interface().(optionSource); ok {
+			t = option.optionType()
+			continue
+		}
+		break
+	}
+	return t, t.Kind() == reflect.Struct && !scalarStruct(t)
+}
@@ -0,0 +1,148 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// A statement with a composite parameter is described by the server with the
+// composite's OID, and planned with it.  Statements prepares each one once per
+// connection, so that a hot query isn't described or planned again on every
+// call, and prepares it afresh when the types are registered on the
+// connection with other OIDs, after a Refresh say, since the old statement
+// would still be expecting the old ones.
+
+// Statements caches the statements run through it on each connection.
+// It is safe to share between goroutines, each with a connection of its own.
+type Statements struct {
+	registry *TypeRegistry
+	next     atomic.Uint64
+
+	mu    sync.Mutex
+	conns map[*pgx.Conn]*connStatements
+}
+
+// connStatements are the statements prepared on one connection, and the OIDs
+// of the registry's types and its count of refreshes when they were.  Only
+// the goroutine using the connection touches them.
+type connStatements struct {
+	oids      []uint32
+	refreshes uint64
+	names     map[string]string
+}
+
+// NewStatements creates a statement cache for connections with the
+// registry's types.  In PgBouncer mode nothing is prepared, and the
+// statements are run as they are.
+func NewStatements(registry *TypeRegistry) *Statements {
+	return &Statements{registry: registry, conns: make(map[*pgx.Conn]*connStatements)}
+}
+
+// Query runs sql on conn as a prepared statement, preparing it first if conn
+// hasn't got it yet.
+func (s *Statements) Query(ctx context.Context, conn *pgx.Conn, sql string, args ...interface{}) (pgx.Rows, error) {
+	name, err := s.prepare(ctx, conn, sql)
+	if err != nil {
+		return nil, err
+	}
+	return conn.Query(ctx, name, args...)
+}
+
+// QueryRow is Query for a single row.  An error preparing the statement
+// comes back from Scan.
+func (s *Statements) QueryRow(ctx context.Context, conn *pgx.Conn, sql string, args ...interface{}) pgx.Row {
+	name, err := s.prepare(ctx, conn, sql)
+	if err != nil {
+		return errRow{err}
+	}
+	return conn.QueryRow(ctx, name, args...)
+}
+
+// Exec is Query for statements that return no rows.
+func (s *Statements) Exec(ctx context.Context, conn *pgx.Conn, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	name, err := s.prepare(ctx, conn, sql)
+	if err != nil {
+		return nil, err
+	}
+	return conn.Exec(ctx, name, args...)
+}
+
+// prepare gives the name sql is prepared under on conn, preparing it if need
+// be, or sql itself when nothing is to be prepared.  Statements prepared
+// before the types were registered again are deallocated first.
+func (s *Statements) prepare(ctx context.Context, conn *pgx.Conn, sql string) (string, error) {
+	if s.registry.PgBouncer {
+		return sql, nil
+	}
+
+	cs := s.statements(conn)
+	oids, refreshes := s.registeredOIDs(conn), s.registry.refreshes.Load()
+	if !slices.Equal(cs.oids, oids) || cs.refreshes != refreshes {
+		for sql, name := range cs.names {
+			if err := conn.Deallocate(ctx, name); err != nil {
+				return "", fmt.Errorf("failed to deallocate statement: %w", err)
+			}
+			delete(cs.names, sql)
+		}
+		cs.oids, cs.refreshes = oids, refreshes
+	}
+
+	if name, ok := cs.names[sql]; ok {
+		return name, nil
+	}
+	name := fmt.Sprintf("customtype_%d", s.next.Add(1))
+	if _, err := conn.Prepare(ctx, name, sql); err != nil {
+		return "", fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	cs.names[sql] = name
+	return name, nil
+}
+
+// statements are those prepared on conn.  Connections that have closed are
+// forgotten along the way.
+func (s *Statements) statements(conn *pgx.Conn) *connStatements {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		if c.IsClosed() {
+			delete(s.conns, c)
+		}
+	}
+
+	cs, ok := s.conns[conn]
+	if !ok {
+		cs = &connStatements{names: make(map[string]string)}
+		s.conns[conn] = cs
+	}
+	return cs
+}
+
+// registeredOIDs are the OIDs the registry's types have on conn, zero for
+// any not registered.
+func (s *Statements) registeredOIDs(conn *pgx.Conn) []uint32 {
+	ci := conn.ConnInfo()
+	names := s.registry.snapshot().names
+	oids := make([]uint32, len(names))
+	for i, name := range names {
+		if dt, ok := ci.DataTypeForName(name); ok {
+			oids[i] = dt.OID
+		}
+	}
+	return oids
+}
+
+// errRow is a pgx.Row that only fails.
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
@@ -0,0 +1,258 @@
+package customtype
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// An interval field is a time.Duration, which is what Go code wants of one,
+// but a postgres interval is months, days and microseconds kept apart,
+// since a month is 28 to 31 days and a day 23 to 25 hours across a change of
+// clocks.  A Duration is a fixed length, so what a field makes of the months
+// and days is up to its tag:
+//
+//	type Job struct {
+//		Timeout time.Duration `pg:"timeout,interval,exact"`
+//		Every   time.Duration `pg:"every,interval,days"`
+//		Keep    time.Duration `pg:"keep,interval"`
+//	}
+//
+// With exact, an interval with months or days is an error; with days, a day
+// is 24 hours and months are an error; and otherwise, as pgtype has it and
+// as postgres compares intervals, a month is 30 days as well.  An interval
+// too long for a Duration, which is about 292 years, is an error rather
+// than whatever it wraps around to.  A Duration is sent as microseconds.
+//
+// A timestamptz is an instant, and pgtype decodes one in the machine's zone
+// or at the offset the server wrote, depending on the format.  A field whose
+// tag has a location, as in pg:"at,timestamptz,location=UTC", gets it in
+// that location, whichever the format: UTC, Local or an IANA name like
+// Europe/Paris, which needs the zone database on the machine, or time/tzdata
+// imported.  In a config, a field's interval and location keys say the same.
+
+// intervalMode is what an interval field makes of months and days.
+type intervalMode string
+
+const (
+	// intervalMonths takes a month as 30 days and a day as 24 hours.  It's
+	// the mode without one in the tag.
+	intervalMonths intervalMode = "months"
+	// intervalDays takes a day as 24 hours, and months as an error.
+	intervalDays intervalMode = "days"
+	// intervalExact takes months or days as an error.
+	intervalExact intervalMode = "exact"
+)
+
+// intervalModes are the values of a field's interval key in a config.
+var intervalModes = []string{string(intervalMonths), string(intervalDays), string(intervalExact)}
+
+// checkTemporal makes sure a field's interval key is one of intervalModes
+// and its location one we can load, each only on a field of its type.
+func (f FieldConfig) checkTemporal(typeName string) error {
+	if f.Interval != "" {
+		if f.Type != "interval" {
+			return fmt.Errorf("field %s of %s has interval, but is %s rather than an interval", f.Name, typeName, f.Type)
+		}
+		if !(&fieldOptions{}).setInterval(f.Interval) {
+			return fmt.Errorf("field %s of %s has interval %s, which is not one of %s", f.Name, typeName, f.Interval, strings.Join(intervalModes, ", "))
+		}
+	}
+	if f.Location != "" {
+		if f.Type != "timestamptz" {
+			return fmt.Errorf("field %s of %s has location, but is %s rather than a timestamptz", f.Name, typeName, f.Type)
+		}
+		if _, err := time.LoadLocation(f.Location); err != nil {
+			return fmt.Errorf("field %s of %s has location %s: %w", f.Name, typeName, f.Location, err)
+		}
+	}
+	return nil
+}
+
+// intervalValue is a pgtype.Interval that assigns itself to a time.Duration
+// by its mode, without overflowing.
+type intervalValue struct {
+	pgtype.Interval
+	mode intervalMode
+}
+
+// intervalArrayOID is _interval's, which pgtype has no constant for, as it
+// doesn't register the array.
+const intervalArrayOID = 1187
+
+// registerTemporal replaces pgtype's interval with ours, and registers its
+// array, before the composites that have fields of them are registered.
+func registerTemporal(ci *pgtype.ConnInfo) {
+	registerDataType(ci, "interval", &intervalValue{}, typeOIDs{oid: pgtype.IntervalOID, arrayOID: intervalArrayOID})
+}
+
+func (v *intervalValue) AssignTo(dst interface{}) error {
+	target, ok := dst.(*time.Duration)
+	if !ok {
+		if v.Status == pgtype.Present {
+			if next, ok := pgtype.GetAssignToDstType(dst); ok {
+				return v.AssignTo(next)
+			}
+		}
+		return v.Interval.AssignTo(dst)
+	}
+
+	switch v.Status {
+	case pgtype.Null:
+		return pgtype.NullAssignTo(dst)
+	case pgtype.Undefined:
+		return fmt.Errorf("cannot assign undefined interval to %T", dst)
+	}
+	d, err := intervalDuration(v.Interval, v.mode)
+	if err != nil {
+		return err
+	}
+	*target = d
+	return nil
+}
+
+var (
+	microsecondsPerDay  = big.NewInt(24 * 60 * 60 * 1000 * 1000)
+	nanosPerMicrosecond = big.NewInt(1000)
+)
+
+// intervalDuration is iv as a time.Duration, with its months and days taken
+// as mode says.
+func intervalDuration(iv pgtype.Interval, mode intervalMode) (time.Duration, error) {
+	days := int64(iv.Days)
+	switch mode {
+	case intervalExact:
+		if iv.Months != 0 || iv.Days != 0 {
+			return 0, fmt.Errorf("cannot assign interval %s to a time.Duration exactly, it has months or days", intervalText(iv))
+		}
+	case intervalDays:
+		if iv.Months != 0 {
+			return 0, fmt.Errorf("cannot assign interval %s to a time.Duration by days, it has months", intervalText(iv))
+		}
+	default:
+		days += int64(iv.Months) * 30
+	}
+
+	// A month's worth of int32 days is more microseconds than an int64
+	// holds, so we add them up where they can't overflow.
+	total := new(big.Int).Mul(big.NewInt(days), microsecondsPerDay)
+	total.Add(total, big.NewInt(iv.Microseconds))
+	total.Mul(total, nanosPerMicrosecond)
+	if !total.IsInt64() {
+		return 0, fmt.Errorf("cannot assign interval %s to a time.Duration, it is too long", intervalText(iv))
+	}
+	return time.Duration(total.Int64()), nil
+}
+
+// intervalText is iv as postgres would write it, for an error.
+func intervalText(iv pgtype.Interval) string {
+	text, err := iv.EncodeText(nil, nil)
+	if err != nil {
+		return fmt.Sprintf("%+v", iv)
+	}
+	return "'" + string(text) + "'"
+}
+
+// setInterval sets the interval mode if option is one.
+func (o *fieldOptions) setInterval(option string) bool {
+	for _, mode := range intervalModes {
+		if option == mode {
+			o.interval = intervalMode(mode)
+			return true
+		}
+	}
+	return false
+}
+
+// setLocation sets the location if option is one, keeping the error if it
+// can't be loaded for when the field is used.
+func (o *fieldOptions) setLocation(option string) bool {
+	name, ok := strings.CutPrefix(option, "location=")
+	if !ok {
+		return false
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		o.err = fmt.Errorf("failed to load the location in its pg tag: %w", err)
+		return true
+	}
+	o.location = location
+	return true
+}
+
+// adapt is src, a field's value, with the field's interval mode or location
+// applied.
+func (o fieldOptions) adapt(src pgtype.Value) (pgtype.Value, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	switch {
+	case o.interval != "":
+		switch src := src.(type) {
+		case *intervalValue:
+			return &intervalValue{Interval: src.Interval, mode: o.interval}, nil
+		case *pgtype.Interval:
+			return &intervalValue{Interval: *src, mode: o.interval}, nil
+		}
+		return nil, fmt.Errorf("cannot take %T as interval %s, it is not an interval", src, o.interval)
+	case o.location != nil:
+		ts, ok := src.(*pgtype.Timestamptz)
+		if !ok {
+			return nil, fmt.Errorf("cannot take %T in %s, it is not a timestamptz", src, o.location)
+		}
+		adapted := *ts
+		if adapted.Status == pgtype.Present && adapted.InfinityModifier == pgtype.None {
+			adapted.Time = adapted.Time.In(o.location)
+		}
+		return &adapted, nil
+	}
+	return src, nil
+}
+
+// scanTarget is what to scan a column into for the field dst points to, which
+// is dst itself unless the field has an interval mode or a location.
+func (o fieldOptions) scanTarget(dst interface{}) interface{} {
+	var value pgtype.Value
+	switch {
+	case o.interval != "":
+		value = &intervalValue{}
+	case o.location != nil:
+		value = &pgtype.Timestamptz{}
+	default:
+		return dst
+	}
+	return &adaptedScan{options: o, value: value, dst: dst}
+}
+
+// adaptedScan decodes a column into value, and assigns it to dst with the
+// field's options applied.
+type adaptedScan struct {
+	options fieldOptions
+	value   pgtype.Value
+	dst     interface{}
+}
+
+func (s *adaptedScan) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	if err := s.value.(pgtype.BinaryDecoder).DecodeBinary(ci, src); err != nil {
+		return err
+	}
+	return s.assign()
+}
+
+func (s *adaptedScan) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	if err := s.value.(pgtype.TextDecoder).DecodeText(ci, src); err != nil {
+		return err
+	}
+	return s.assign()
+}
+
+func (s *adaptedScan) assign() error {
+	adapted, err := s.options.adapt(s.value)
+	if err != nil {
+		return err
+	}
+	return assignField(adapted, s.dst)
+}
@@ -0,0 +1,118 @@
+package customtype
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// TestIntervalDuration checks an interval as a time.Duration in each mode,
+// and that one too long for a Duration is an error rather than wrapping.
+func TestIntervalDuration(t *testing.T) {
+	const day = 24 * time.Hour
+	// The longest Duration is 106751 days, 23:47:16.854775807.
+	const maxDays, maxMicroseconds = 106751, 85636854775
+
+	tests := []struct {
+		name    string
+		iv      pgtype.Interval
+		mode    intervalMode
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "months", iv: pgtype.Interval{Months: 1, Days: 1, Microseconds: 1}, mode: intervalMonths, want: 31*day + time.Microsecond},
+		{name: "no mode", iv: pgtype.Interval{Months: 1}, want: 30 * day},
+		{name: "negative", iv: pgtype.Interval{Months: -1, Microseconds: -1}, mode: intervalMonths, want: -30*day - time.Microsecond},
+		{name: "days", iv: pgtype.Interval{Days: 2, Microseconds: 1000}, mode: intervalDays, want: 2*day + time.Millisecond},
+		{name: "days with months", iv: pgtype.Interval{Months: 1}, mode: intervalDays, wantErr: true},
+		{name: "exact", iv: pgtype.Interval{Microseconds: 90_000_000}, mode: intervalExact, want: 90 * time.Second},
+		{name: "exact with days", iv: pgtype.Interval{Days: 1}, mode: intervalExact, wantErr: true},
+		{name: "exact with months", iv: pgtype.Interval{Months: 1}, mode: intervalExact, wantErr: true},
+		{name: "longest", iv: pgtype.Interval{Days: maxDays, Microseconds: maxMicroseconds}, mode: intervalDays, want: time.Duration(math.MaxInt64 / 1000 * 1000)},
+		{name: "just too long", iv: pgtype.Interval{Days: maxDays, Microseconds: maxMicroseconds + 1}, mode: intervalDays, wantErr: true},
+		{name: "just too short", iv: pgtype.Interval{Days: -maxDays, Microseconds: -maxMicroseconds - 1}, mode: intervalDays, wantErr: true},
+		{name: "most months", iv: pgtype.Interval{Months: math.MaxInt32}, mode: intervalMonths, wantErr: true},
+		{name: "fewest months", iv: pgtype.Interval{Months: math.MinInt32}, mode: intervalMonths, wantErr: true},
+		{name: "most days", iv: pgtype.Interval{Days: math.MaxInt32}, mode: intervalDays, wantErr: true},
+		{name: "most microseconds", iv: pgtype.Interval{Microseconds: math.MaxInt64}, mode: intervalExact, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := intervalDuration(tt.iv, tt.mode)
+			switch {
+			case tt.wantErr && err == nil:
+				t.Fatalf("got %v, want an error", got)
+			case !tt.wantErr && err != nil:
+				t.Fatalf("got %v, want %v", err, tt.want)
+			case got != tt.want:
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFieldOptionsAdapt checks a field's value with its interval mode or
+// location applied, and the values each can't be applied to.
+func TestFieldOptionsAdapt(t *testing.T) {
+	paris := time.FixedZone("CEST", 2*60*60)
+	noon := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	iv := pgtype.Interval{Days: 1, Status: pgtype.Present}
+
+	tests := []struct {
+		name    string
+		options fieldOptions
+		src     pgtype.Value
+		want    pgtype.Value
+		wantErr bool
+	}{
+		{name: "no options", src: &pgtype.Int4{Int: 1, Status: pgtype.Present}, want: &pgtype.Int4{Int: 1, Status: pgtype.Present}},
+		{name: "interval", options: fieldOptions{interval: intervalDays}, src: &iv, want: &intervalValue{Interval: iv, mode: intervalDays}},
+		{
+			name: "our interval", options: fieldOptions{interval: intervalExact},
+			src:  &intervalValue{Interval: iv, mode: intervalMonths},
+			want: &intervalValue{Interval: iv, mode: intervalExact},
+		},
+		{name: "interval of a timestamptz", options: fieldOptions{interval: intervalDays}, src: &pgtype.Timestamptz{Time: noon, Status: pgtype.Present}, wantErr: true},
+		{
+			name: "location", options: fieldOptions{location: paris},
+			src:  &pgtype.Timestamptz{Time: noon, Status: pgtype.Present},
+			want: &pgtype.Timestamptz{Time: noon.In(paris), Status: pgtype.Present},
+		},
+		{
+			name: "infinity", options: fieldOptions{location: paris},
+			src:  &pgtype.Timestamptz{Status: pgtype.Present, InfinityModifier: pgtype.Infinity},
+			want: &pgtype.Timestamptz{Status: pgtype.Present, InfinityModifier: pgtype.Infinity},
+		},
+		{name: "null", options: fieldOptions{location: paris}, src: &pgtype.Timestamptz{Status: pgtype.Null}, want: &pgtype.Timestamptz{Status: pgtype.Null}},
+		{name: "location of an int4", options: fieldOptions{location: paris}, src: &pgtype.Int4{Int: 1, Status: pgtype.Present}, wantErr: true},
+		{name: "kept error", options: fieldOptions{location: paris, err: errors.New("unknown time zone Mars/Olympus")}, src: &pgtype.Timestamptz{Time: noon, Status: pgtype.Present}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.adapt(tt.src)
+			switch {
+			case tt.wantErr && err == nil:
+				t.Fatalf("got %#v, want an error", got)
+			case !tt.wantErr && err != nil:
+				t.Fatalf("got %v, want %#v", err, tt.want)
+			}
+			if ts, ok := got.(*pgtype.Timestamptz); ok {
+				want := tt.want.(*pgtype.Timestamptz)
+				if !ts.Time.Equal(want.Time) || ts.Time.Location() != want.Time.Location() || ts.Status != want.Status || ts.InfinityModifier != want.InfinityModifier {
+					t.Errorf("got %v, want %v", ts, want)
+				}
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if tt.src == got && tt.options != (fieldOptions{}) {
+				t.Error("adapted the value in place")
+			}
+		})
+	}
+}
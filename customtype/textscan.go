@@ -0,0 +1,123 @@
+package customtype
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgtype"
+)
+
+// compositeTextScanner reads the fields of a composite in the text format, as
+// pgtype's CompositeTextScanner does, but fails on a field that runs off the
+// end where that would read past it: an unterminated quote, or a backslash
+// with nothing after it.  It's a value rather than a pointer, so that
+// scanning a composite needn't allocate one.
+type compositeTextScanner struct {
+	src        []byte
+	rp         int
+	fieldBytes []byte
+	err        error
+
+	// buf is where quoted fields are unescaped, one after another, so that
+	// a field stays as it was while the next is read.  It can be given the
+	// buf of a scanner before, once its fields are no longer needed, to
+	// save allocating another.
+	buf []byte
+}
+
+func newCompositeTextScanner(src []byte) compositeTextScanner {
+	switch {
+	case len(src) < 2:
+		return compositeTextScanner{err: fmt.Errorf("record incomplete %v", src)}
+	case src[0] != '(':
+		return compositeTextScanner{err: errors.New("composite text format must start with '('")}
+	case src[len(src)-1] != ')':
+		return compositeTextScanner{err: errors.New("composite text format must end with ')'")}
+	}
+	return compositeTextScanner{src: src, rp: 1}
+}
+
+// Next reads the next field, reporting false once there are none left or
+// the text is malformed, which Err tells apart.  A null field's Bytes are
+// nil.
+func (s *compositeTextScanner) Next() bool {
+	if s.err != nil || s.rp >= len(s.src) {
+		return false
+	}
+
+	switch s.src[s.rp] {
+	case ',', ')':
+		s.rp++
+		s.fieldBytes = nil
+		return true
+
+	case '"':
+		s.rp++
+		if s.buf == nil {
+			s.buf = make([]byte, 0, 16)
+		}
+		start := len(s.buf)
+		for {
+			if s.rp >= len(s.src) {
+				s.err = errors.New("unterminated quoted field in composite")
+				return false
+			}
+			ch := s.src[s.rp]
+			s.rp++
+			switch {
+			case ch == '"' && s.rp < len(s.src) && s.src[s.rp] == '"':
+				s.buf = append(s.buf, '"')
+				s.rp++
+			case ch == '"':
+				// Past the closing quote is the comma or parenthesis
+				// after the field.  The field is capped, so that
+				// appending to it can't overwrite the one after.
+				s.rp++
+				s.fieldBytes = s.buf[start:len(s.buf):len(s.buf)]
+				return true
+			case ch == '\\':
+				if s.rp >= len(s.src) {
+					s.err = errors.New("unterminated escape in composite")
+					return false
+				}
+				s.buf = append(s.buf, s.src[s.rp])
+				s.rp++
+			default:
+				s.buf = append(s.buf, ch)
+			}
+		}
+
+	default:
+		// The closing parenthesis ends an unquoted field at the latest.
+		start := s.rp
+		for s.src[s.rp] != ',' && s.src[s.rp] != ')' {
+			s.rp++
+		}
+		s.fieldBytes = s.src[start:s.rp]
+		s.rp++
+		return true
+	}
+}
+
+// ScanDecoder reads the next field into d, which mustn't need a ConnInfo to
+// decode, as pgtype's own types don't.
+func (s *compositeTextScanner) ScanDecoder(d pgtype.TextDecoder) {
+	if s.err != nil {
+		return
+	}
+	if s.Next() {
+		s.err = d.DecodeText(nil, s.fieldBytes)
+	} else if s.err == nil {
+		s.err = errors.New("read past end of composite")
+	}
+}
+
+// Bytes are the field Next read.
+func (s *compositeTextScanner) Bytes() []byte {
+	return s.fieldBytes
+}
+
+// Err is why Next stopped, if it wasn't the end of the fields.
+func (s *compositeTextScanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,66 @@
+package customtype
+
+import (
+	"context"
+	"reflect"
+
+	"go.opentelemetry.io/otel"
+	otelattribute "go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Registering the types adds a catalog query to every new connection that
+// finds the OID cache empty, and decoding composites costs more than decoding
+// the built in types, so both show up in OpenTelemetry traces: a span for
+// registering the types on a connection, one inside it for looking up their
+// OIDs, and one for each query run through the helpers that take a context,
+// QueryAll, QueryOne, ForEach, ForEachInPlace, CallFunc, CallFuncColumns,
+// CallProcedure and QueryJSON.  ScanAll, ScanOne, ScanAllByName and ScanEach
+// have no context to put a span in.
+//
+// Spans go to the registry's TracerProvider, or the global one, which does
+// nothing until the application sets one up.
+
+// tracerName is the name our spans are recorded under.
+var tracerName = packagePath
+
+// Attributes of our spans.  The package is renamed since we have an
+// attribute type of our own.
+const (
+	attrTypes     = otelattribute.Key("customtype.types")
+	attrCached    = otelattribute.Key("customtype.oids_cached")
+	attrGoType    = otelattribute.Key("customtype.go_type")
+	attrFields    = otelattribute.Key("customtype.fields")
+	attrRows      = otelattribute.Key("customtype.rows")
+	attrSQL       = otelattribute.Key("db.statement")
+	attrDatabase  = otelattribute.Key("customtype.database")
+	attrTypeCount = otelattribute.Key("customtype.type_count")
+)
+
+func (r *TypeRegistry) tracer() trace.Tracer {
+	if r.TracerProvider != nil {
+		return r.TracerProvider.Tracer(tracerName)
+	}
+	return otel.Tracer(tracerName)
+}
+
+// startQuerySpan starts the span of a query decoded into T.
+func startQuerySpan[T any](ctx context.Context, name, sql string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrGoType.String(reflect.TypeOf((*T)(nil)).Elem().String()),
+			attrSQL.String(sql),
+		))
+}
+
+// endSpan records err on span, if there is one, and ends it.  It returns err
+// so that it can wrap a return.
+func endSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	return err
+}
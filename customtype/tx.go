@@ -0,0 +1,93 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Tx is a transaction for the typed helpers.  It is a Querier, a CopyFromer
+// and a Batcher, so QueryAll, ForEach, CallFunc, CopyRows, UpsertAll and the
+// rest run in it, and its Exec takes composites as parameters like any other
+// value.  It has no Commit or Rollback: BeginFunc does those.
+type Tx struct {
+	tx pgx.Tx
+}
+
+// TxBeginner is what BeginFunc needs to start a transaction.  It is
+// satisfied by *pgxpool.Pool, *pgxpool.Conn and *pgx.Conn.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// BeginFunc runs fn in a transaction on db, which is committed if fn returns
+// nil and rolled back if it returns an error or panics.
+func BeginFunc(ctx context.Context, db TxBeginner, fn func(Tx) error) error {
+	return BeginTxFunc(ctx, db, pgx.TxOptions{}, fn)
+}
+
+// BeginTxFunc is BeginFunc with the transaction's isolation level and access
+// mode given by txOptions.
+func BeginTxFunc(ctx context.Context, db TxBeginner, txOptions pgx.TxOptions, fn func(Tx) error) error {
+	tx, err := db.BeginTx(ctx, txOptions)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Rolling back a transaction that has been committed does nothing, so
+	// this only matters when fn fails or panics.
+	defer tx.Rollback(ctx)
+
+	if err := fn(Tx{tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Query runs sql in the transaction.
+func (t Tx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return t.tx.Query(ctx, sql, args...)
+}
+
+// QueryRow runs sql in the transaction for a single row.
+func (t Tx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return t.tx.QueryRow(ctx, sql, args...)
+}
+
+// Exec runs sql in the transaction for its command tag.
+func (t Tx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return t.tx.Exec(ctx, sql, args...)
+}
+
+// CopyFrom bulk loads a table in the transaction.
+func (t Tx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return t.tx.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// SendBatch sends a batch of statements in the transaction, as UpsertAll
+// does.
+func (t Tx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return t.tx.SendBatch(ctx, b)
+}
+
+// BeginFunc runs fn in a nested transaction, a savepoint, which is released
+// if fn returns nil and rolled back to otherwise, leaving t to carry on.
+func (t Tx) BeginFunc(ctx context.Context, fn func(Tx) error) error {
+	nested, err := t.tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	defer nested.Rollback(ctx)
+
+	if err := fn(Tx{tx: nested}); err != nil {
+		return err
+	}
+	if err := nested.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package customtype
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// typeName is a possibly schema-qualified type name, split into its parts with
+// any quoting removed.  As in postgres, unquoted identifiers are folded to
+// lower case, so MySchema.Resolution and myschema.resolution are the same
+// type while "MySchema".resolution is not.
+type typeName struct {
+	schema, name string
+}
+
+// parseTypeName parses names such as resolution, myschema.resolution and
+// "My Schema"."Resolution".
+func parseTypeName(s string) (typeName, error) {
+	var parts []string
+	var part strings.Builder
+	quoted, inQuotes := false, false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuotes && c == '"':
+			if i+1 < len(s) && s[i+1] == '"' {
+				part.WriteByte('"')
+				i++
+			} else {
+				inQuotes = false
+			}
+		case inQuotes:
+			part.WriteByte(c)
+		case c == '"':
+			inQuotes, quoted = true, true
+		case c == '.':
+			parts = append(parts, identifier(part.String(), quoted))
+			part.Reset()
+			quoted = false
+		default:
+			part.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return typeName{}, fmt.Errorf("unterminated quote in type name %s", s)
+	}
+	parts = append(parts, identifier(part.String(), quoted))
+
+	for _, p := range parts {
+		if p == "" {
+			return typeName{}, fmt.Errorf("invalid type name %s", s)
+		}
+	}
+
+	switch len(parts) {
+	case 1:
+		return typeName{name: parts[0]}, nil
+	case 2:
+		return typeName{schema: parts[0], name: parts[1]}, nil
+	default:
+		return typeName{}, fmt.Errorf("invalid type name %s", s)
+	}
+}
+
+func identifier(s string, quoted bool) string {
+	if quoted {
+		return s
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// Sanitize quotes the name so that it can be used in SQL, e.g. in a ::regtype
+// cast.
+func (tn typeName) Sanitize() string {
+	if tn.schema == "" {
+		return pgx.Identifier{tn.name}.Sanitize()
+	}
+	return pgx.Identifier{tn.schema, tn.name}.Sanitize()
+}
+
+// ArrayTypeName is the name postgres gives to the array of a type, which is
+// the element's name with a leading underscore, i.e. resolution[] is
+// _resolution.  The schema is kept as written, so myschema.resolution[] is
+// myschema._resolution.
+func ArrayTypeName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i+1] + "_" + name[i+1:]
+	}
+	return "_" + name
+}
+
+// arrayElement is the element type of an array type written either as _elem
+// or elem[], the reverse of ArrayTypeName.
+func arrayElement(name string) (string, bool) {
+	if strings.HasSuffix(name, "[]") {
+		return strings.TrimSuffix(name, "[]"), true
+	}
+
+	schema, base := "", name
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		schema, base = name[:i+1], name[i+1:]
+	}
+	if strings.HasPrefix(base, "_") {
+		return schema + strings.TrimPrefix(base, "_"), true
+	}
+	return "", false
+}
@@ -0,0 +1,230 @@
+package customtype
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// A registry is usually made once at startup and shared by every pool
+// there is, but its types can change while it's in use: a plugin loaded
+// later may bring types of its own, and a feature switched off takes its
+// away, and a migration may change one that a long running service can't
+// be restarted for.  Add, Replace and Remove change them from any goroutine,
+// while connections are being registered on others.  Registering reads the
+// types once, as they are then, so a connection never has half of a change.
+//
+// A connection made after a change has it.  One registered before is
+// brought up to date the next time it's acquired from a pool RegisterTypes
+// set up: the types are registered on it again, with the ones added and
+// replaced, and its prepared statements forgotten.  pgx can't forget a
+// type, so a connection with one that has since been removed is closed
+// instead, and the pool makes a new one in its place as it needs to.  A
+// type's OIDs are looked up again once it's replaced, so that the new
+// definition is checked against the database; after a migration that
+// recreates a type, Refresh is still what finds its new OID.
+
+// typeSet is the registry's definitions at one moment, in dependency order,
+// with their names and their names parsed.  A set is never changed once
+// the registry has it; a change makes a new one.
+type typeSet struct {
+	definitions []TypeDefinition
+	names       []string
+	parsed      []typeName
+}
+
+func newTypeSet(defs []TypeDefinition) (*typeSet, error) {
+	sorted, err := sortDefinitions(withExtensions(defs))
+	if err != nil {
+		return nil, err
+	}
+
+	types := &typeSet{
+		definitions: sorted,
+		names:       make([]string, len(sorted)),
+		parsed:      make([]typeName, len(sorted)),
+	}
+	for i, def := range sorted {
+		types.names[i] = def.TypeName()
+		if types.parsed[i], err = parseTypeName(def.TypeName()); err != nil {
+			return nil, err
+		}
+	}
+	return types, nil
+}
+
+// definition is the definition called name, if there is one.
+func (s *typeSet) definition(name string) (TypeDefinition, bool) {
+	for i, n := range s.names {
+		if n == name {
+			return s.definitions[i], true
+		}
+	}
+	return nil, false
+}
+
+// snapshot is the registry's types as they are now.
+func (r *TypeRegistry) snapshot() *typeSet {
+	if types := r.types.Load(); types != nil {
+		return types
+	}
+	return &typeSet{}
+}
+
+// Types are the names of the registry's types, in the order they are
+// registered, which has every type after the types it uses.
+func (r *TypeRegistry) Types() []string {
+	return append([]string(nil), r.snapshot().names...)
+}
+
+// Definition is the definition of the type called name, as it was given to
+// the registry.
+func (r *TypeRegistry) Definition(name string) (TypeDefinition, bool) {
+	return r.snapshot().definition(name)
+}
+
+// Add adds definitions to the registry, for the connections registered from
+// now on, and for those of a pool ready to be registered when they are next
+// acquired.  A type the registry has already can't be added again.
+func (r *TypeRegistry) Add(defs ...TypeDefinition) error {
+	return r.change(func(current []TypeDefinition) ([]TypeDefinition, error) {
+		changed := append([]TypeDefinition(nil), current...)
+		for _, def := range defs {
+			for _, known := range changed {
+				if known.TypeName() == def.TypeName() {
+					return nil, fmt.Errorf("cannot add %s, the registry has it already", def.TypeName())
+				}
+			}
+			changed = append(changed, def)
+		}
+		return changed, nil
+	})
+}
+
+// Replace replaces the definitions of types the registry has with defs,
+// matched by name.
+func (r *TypeRegistry) Replace(defs ...TypeDefinition) error {
+	names := make([]string, len(defs))
+	for i, def := range defs {
+		names[i] = def.TypeName()
+	}
+
+	err := r.change(func(current []TypeDefinition) ([]TypeDefinition, error) {
+		changed := append([]TypeDefinition(nil), current...)
+		for _, def := range defs {
+			i := slices.IndexFunc(changed, func(known TypeDefinition) bool {
+				return known.TypeName() == def.TypeName()
+			})
+			if i < 0 {
+				return nil, fmt.Errorf("cannot replace %s, the registry doesn't have it", def.TypeName())
+			}
+			changed[i] = def
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return err
+	}
+	sharedOIDCache.forgetEverywhere(names)
+	return nil
+}
+
+// Remove takes the types called names out of the registry, so that the
+// connections registered from now on don't have them.  A type another of
+// the registry's types uses can't be removed without it.
+func (r *TypeRegistry) Remove(names ...string) error {
+	return r.change(func(current []TypeDefinition) ([]TypeDefinition, error) {
+		removed := make(map[string]bool, len(names))
+		for _, name := range names {
+			removed[name] = true
+		}
+
+		var changed []TypeDefinition
+		for _, def := range current {
+			if removed[def.TypeName()] {
+				delete(removed, def.TypeName())
+				continue
+			}
+			changed = append(changed, def)
+		}
+		if len(removed) > 0 {
+			missing := make([]string, 0, len(removed))
+			for _, name := range names {
+				if removed[name] {
+					missing = append(missing, name)
+				}
+			}
+			return nil, fmt.Errorf("cannot remove %s, the registry doesn't have it", strings.Join(missing, ", "))
+		}
+
+		for _, def := range changed {
+			for _, dep := range def.dependencies() {
+				if elem, isArray := arrayElement(dep); isArray {
+					dep = elem
+				}
+				if slices.Contains(names, dep) {
+					return nil, fmt.Errorf("cannot remove %s, %s uses it", dep, def.TypeName())
+				}
+			}
+		}
+		return changed, nil
+	})
+}
+
+// change replaces the registry's definitions with what fn makes of them, one
+// change at a time.
+func (r *TypeRegistry) change(fn func(current []TypeDefinition) ([]TypeDefinition, error)) error {
+	r.typesMu.Lock()
+	defer r.typesMu.Unlock()
+
+	defs, err := fn(r.snapshot().definitions)
+	if err != nil {
+		return err
+	}
+	types, err := newTypeSet(defs)
+	if err != nil {
+		return err
+	}
+	r.types.Store(types)
+	r.refreshes.Add(1)
+	return nil
+}
+
+// recordRegistered notes that types were registered on conn.  Connections
+// that have closed are forgotten along the way.
+func (r *TypeRegistry) recordRegistered(conn *pgx.Conn, types *typeSet) {
+	r.registeredMu.Lock()
+	defer r.registeredMu.Unlock()
+
+	if r.registered == nil {
+		r.registered = make(map[*pgx.Conn]*typeSet)
+	}
+	for c := range r.registered {
+		if c.IsClosed() {
+			delete(r.registered, c)
+		}
+	}
+	r.registered[conn] = types
+}
+
+// registeredTypes is the set of types last registered on conn, if any have
+// been.
+func (r *TypeRegistry) registeredTypes(conn *pgx.Conn) (*typeSet, bool) {
+	r.registeredMu.Lock()
+	defer r.registeredMu.Unlock()
+	types, ok := r.registered[conn]
+	return types, ok
+}
+
+// removed are the names in s that aren't in current.
+func (s *typeSet) removed(current *typeSet) []string {
+	var removed []string
+	for _, name := range s.names {
+		if !slices.Contains(current.names, name) {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
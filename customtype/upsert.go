@@ -0,0 +1,132 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Batcher is what UpsertAll needs to send its statements in one round trip.
+// It is satisfied by *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn and pgx.Tx.
+type Batcher interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// maxParameters is the most parameters postgres takes in one statement.
+const maxParameters = 65535
+
+// upsertRowsPerStatement is the most rows UpsertAll puts in one statement,
+// since a statement with as many parameters as postgres takes is slow to
+// plan.
+const upsertRowsPerStatement = 1000
+
+// UpsertAll inserts rows into a table, updating the row already there for
+// any that conflict on the conflict columns.  Each row is a struct with an
+// exported field per column in order, as for CopyRows, so a composite column
+// is a field of its Go type:
+//
+//	type fooRow struct {
+//		ID  int
+//		Res customtype.Resolution
+//	}
+//
+//	n, err := customtype.UpsertAll(ctx, pool, pgx.Identifier{"foo"}, []string{"id", "res"}, []string{"id"}, rows)
+//
+// The rows go in multi-row INSERT ... ON CONFLICT DO UPDATE statements of up
+// to a thousand rows each, sent together in one batch, and the count is of
+// the rows inserted or updated.  The columns that aren't conflict columns
+// are set from the new row; with none left a conflicting row is left alone.
+// The conflict columns need a unique index, and no two rows in one call
+// should have the same values in them, since postgres can't update a row
+// twice in one statement.  Without a transaction around it, a failure part
+// way leaves the statements before it done.
+func UpsertAll[T any](ctx context.Context, b Batcher, table pgx.Identifier, columns, conflict []string, rows []T) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if len(columns) == 0 || len(conflict) == 0 {
+		return 0, fmt.Errorf("cannot upsert into %s without columns and conflict columns", table.Sanitize())
+	}
+
+	perStatement := min(upsertRowsPerStatement, maxParameters/len(columns))
+	batch := &pgx.Batch{}
+	for start := 0; start < len(rows); start += perStatement {
+		end := min(start+perStatement, len(rows))
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for i := start; i < end; i++ {
+			values, err := rowValues(reflect.ValueOf(rows[i]))
+			if err != nil {
+				return 0, fmt.Errorf("failed to upsert row %d into %s: %w", i, table.Sanitize(), err)
+			}
+			if len(values) != len(columns) {
+				return 0, fmt.Errorf("cannot upsert row %d into %s, it has %d fields for %d columns: %w", i, table.Sanitize(), len(values), len(columns), ErrFieldCountMismatch)
+			}
+			args = append(args, values...)
+		}
+		batch.Queue(upsertSQL(table, columns, conflict, end-start), args...)
+	}
+
+	results := b.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var n int64
+	for start := 0; start < len(rows); start += perStatement {
+		tag, err := results.Exec()
+		if err != nil {
+			end := min(start+perStatement, len(rows))
+			return n, fmt.Errorf("failed to upsert rows %d to %d into %s: %w", start, end-1, table.Sanitize(), err)
+		}
+		n += tag.RowsAffected()
+	}
+	if err := results.Close(); err != nil {
+		return n, fmt.Errorf("failed to upsert rows into %s: %w", table.Sanitize(), err)
+	}
+	return n, nil
+}
+
+// upsertSQL is the statement upserting count rows.
+func upsertSQL(table pgx.Identifier, columns, conflict []string, count int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", table.Sanitize(), identifierList(columns))
+	for row := 0; row < count; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for column := range columns {
+			if column > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", row*len(columns)+column+1)
+		}
+		b.WriteByte(')')
+	}
+
+	fmt.Fprintf(&b, " ON CONFLICT (%s) DO ", identifierList(conflict))
+	var updates []string
+	for _, column := range columns {
+		if !slices.Contains(conflict, column) {
+			name := pgx.Identifier{column}.Sanitize()
+			updates = append(updates, name+" = EXCLUDED."+name)
+		}
+	}
+	if len(updates) == 0 {
+		b.WriteString("NOTHING")
+	} else {
+		b.WriteString("UPDATE SET " + strings.Join(updates, ", "))
+	}
+	return b.String()
+}
+
+// identifierList is names quoted and separated by commas.
+func identifierList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pgx.Identifier{name}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
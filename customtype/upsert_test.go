@@ -0,0 +1,168 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// TestUpsertSQL checks the statement upserting a number of rows: a
+// parameter per column of each row, and an update of the columns that
+// aren't conflict columns, or nothing with none.
+func TestUpsertSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    pgx.Identifier
+		columns  []string
+		conflict []string
+		count    int
+		want     string
+	}{
+		{
+			name:     "one row",
+			table:    pgx.Identifier{"foo"},
+			columns:  []string{"id", "res"},
+			conflict: []string{"id"},
+			count:    1,
+			want:     `INSERT INTO "foo" ("id", "res") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "res" = EXCLUDED."res"`,
+		},
+		{
+			name:     "rows",
+			table:    pgx.Identifier{"foo"},
+			columns:  []string{"id", "res"},
+			conflict: []string{"id"},
+			count:    3,
+			want:     `INSERT INTO "foo" ("id", "res") VALUES ($1, $2), ($3, $4), ($5, $6) ON CONFLICT ("id") DO UPDATE SET "res" = EXCLUDED."res"`,
+		},
+		{
+			name:     "conflict columns only",
+			table:    pgx.Identifier{"foo"},
+			columns:  []string{"id"},
+			conflict: []string{"id"},
+			count:    2,
+			want:     `INSERT INTO "foo" ("id") VALUES ($1), ($2) ON CONFLICT ("id") DO NOTHING`,
+		},
+		{
+			name:     "composite key",
+			table:    pgx.Identifier{"app", "screens"},
+			columns:  []string{"maker", "model", "res", "Label"},
+			conflict: []string{"maker", "model"},
+			count:    1,
+			want:     `INSERT INTO "app"."screens" ("maker", "model", "res", "Label") VALUES ($1, $2, $3, $4) ON CONFLICT ("maker", "model") DO UPDATE SET "res" = EXCLUDED."res", "Label" = EXCLUDED."Label"`,
+		},
+		{
+			name:     "quoted",
+			table:    pgx.Identifier{`odd"table`},
+			columns:  []string{"id", `odd"column`},
+			conflict: []string{"id"},
+			count:    1,
+			want:     `INSERT INTO "odd""table" ("id", "odd""column") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "odd""column" = EXCLUDED."odd""column"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upsertSQL(tt.table, tt.columns, tt.conflict, tt.count); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUpsertAll checks how UpsertAll splits rows into statements, and what
+// it turns away before sending any.
+func TestUpsertAll(t *testing.T) {
+	type fooRow struct {
+		ID  int
+		Res Resolution
+	}
+	rows := func(n int) []fooRow {
+		r := make([]fooRow, n)
+		for i := range r {
+			r[i] = fooRow{ID: i, Res: Resolution{Width: 640, Height: 480, Scan: 'P'}}
+		}
+		return r
+	}
+	columns, conflict := []string{"id", "res"}, []string{"id"}
+
+	tests := []struct {
+		name           string
+		columns        []string
+		conflict       []string
+		rows           []fooRow
+		tags           []string
+		failOn         int
+		wantStatements int
+		wantN          int64
+		wantErr        string
+	}{
+		{name: "no rows", columns: columns, conflict: conflict},
+		{name: "one statement", columns: columns, conflict: conflict, rows: rows(10), tags: []string{"INSERT 0 10"}, wantStatements: 1, wantN: 10},
+		{
+			name: "statements", columns: columns, conflict: conflict, rows: rows(2500),
+			tags:           []string{"INSERT 0 1000", "INSERT 0 1000", "INSERT 0 500"},
+			wantStatements: 3, wantN: 2500,
+		},
+		{
+			name: "failed statement", columns: columns, conflict: conflict, rows: rows(2500),
+			tags: []string{"INSERT 0 1000"}, failOn: 2,
+			wantStatements: 3, wantN: 1000,
+			wantErr: `failed to upsert rows 1000 to 1999 into "foo": duplicate key`,
+		},
+		{name: "no columns", conflict: conflict, rows: rows(1), wantErr: `cannot upsert into "foo" without columns and conflict columns`},
+		{name: "no conflict columns", columns: columns, rows: rows(1), wantErr: `cannot upsert into "foo" without columns and conflict columns`},
+		{
+			name: "fields for columns", columns: []string{"id"}, conflict: conflict, rows: rows(1),
+			wantErr: `cannot upsert row 0 into "foo", it has 2 fields for 1 columns: field count mismatch`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &upsertBatcher{tags: tt.tags, failOn: tt.failOn}
+			n, err := UpsertAll(context.Background(), b, pgx.Identifier{"foo"}, tt.columns, tt.conflict, tt.rows)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("got %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("got %v, want %s", err, tt.wantErr)
+			}
+			if b.statements != tt.wantStatements || n != tt.wantN {
+				t.Errorf("sent %d statements upserting %d rows, want %d upserting %d", b.statements, n, tt.wantStatements, tt.wantN)
+			}
+		})
+	}
+}
+
+// upsertBatcher answers the statements of a batch with tags in turn, and
+// fails the one numbered failOn, counting from 1.
+type upsertBatcher struct {
+	tags       []string
+	failOn     int
+	statements int
+	exec       int
+}
+
+func (b *upsertBatcher) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
+	b.statements = batch.Len()
+	return b
+}
+
+func (b *upsertBatcher) Exec() (pgconn.CommandTag, error) {
+	b.exec++
+	if b.exec == b.failOn {
+		return nil, errors.New("duplicate key")
+	}
+	if b.exec > len(b.tags) {
+		return nil, fmt.Errorf("statement %d has no tag", b.exec)
+	}
+	return pgconn.CommandTag(b.tags[b.exec-1]), nil
+}
+
+func (b *upsertBatcher) Query() (pgx.Rows, error) { return nil, errors.New("not a query") }
+func (b *upsertBatcher) QueryRow() pgx.Row        { return nil }
+func (b *upsertBatcher) Close() error             { return nil }
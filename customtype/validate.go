@@ -0,0 +1,200 @@
+package customtype
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Validator is implemented by types that check themselves once they've been
+// decoded, say a CheckedResolution with a negative width.  ScanAll, ScanOne and
+// ScanAllValid call Validate on every Validator in a row once it is scanned,
+// nested composites and the elements of arrays included, innermost first.
+// pgx gives up on the rest of the rows when a Scan fails, so the check comes
+// after the Scan rather than in it.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is a value that decoded but failed its Validate.
+type ValidationError struct {
+	Type string
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Type, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// hasValidators caches whether a type has a Validator anywhere in it, so that
+// rows without any aren't walked.
+var hasValidators sync.Map
+
+func mayValidate(t reflect.Type) bool {
+	if known, ok := hasValidators.Load(t); ok {
+		return known.(bool)
+	}
+	found := findValidator(t, make(map[reflect.Type]bool))
+	hasValidators.Store(t, found)
+	return found
+}
+
+// findValidator reports whether t has a Validator anywhere in it.  The types
+// being looked at are in looking, and a type that contains itself is taken
+// to add nothing the first time round, which is only an answer for t as a
+// whole, so nothing underneath is cached.
+func findValidator(t reflect.Type, looking map[reflect.Type]bool) bool {
+	if known, ok := hasValidators.Load(t); ok {
+		return known.(bool)
+	}
+	if looking[t] {
+		return false
+	}
+	looking[t] = true
+
+	if t.Implements(validatorType) || reflect.PtrTo(t).Implements(validatorType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return findValidator(t.Elem(), looking)
+	case reflect.Struct:
+		if option, ok := reflect.Zero(t).Interface().(optionSource); ok {
+			return findValidator(option.optionType(), looking)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" && findValidator(t.Field(i).Type, looking) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validate calls Validate on every Validator in v.
+func validate(v reflect.Value) error {
+	if !v.IsValid() || !mayValidate(v.Type()) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return validate(v.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validate(v.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return nil
+	case reflect.Struct:
+		if option, ok := v.Interface().(optionSource); ok {
+			if value, some := option.optionValue(); some {
+				return validate(addressable(reflect.ValueOf(value)))
+			}
+			return nil
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				if err := validate(v.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	v = addressable(v)
+	if validator, ok := v.Addr().Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return &ValidationError{Type: v.Type().String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// addressable is v, or a copy of it that can be addressed, so that Validate
+// methods on pointers are found.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	return copied
+}
+
+// ValidationPolicy is what ScanAllValid does with a row that fails
+// validation.
+type ValidationPolicy int
+
+const (
+	// FailOnInvalid fails the whole scan, as ScanAll does.
+	FailOnInvalid ValidationPolicy = iota
+
+	// SkipInvalid leaves the row out.
+	SkipInvalid
+
+	// CollectInvalid leaves the row out, and reports it in an
+	// InvalidRowsError along with the valid rows.
+	CollectInvalid
+)
+
+// InvalidRowsError holds the rows that failed validation under
+// CollectInvalid, each a ScanError wrapping a ValidationError.
+type InvalidRowsError struct {
+	Rows []*ScanError
+}
+
+func (e *InvalidRowsError) Error() string {
+	if len(e.Rows) == 1 {
+		return e.Rows[0].Error()
+	}
+	return fmt.Sprintf("%d rows failed validation, the first: %v", len(e.Rows), e.Rows[0])
+}
+
+// ScanAllValid is ScanAll with a choice of what to do with rows that fail
+// validation.  Under CollectInvalid it returns the valid rows and, if there
+// were any others, an *InvalidRowsError.  A row that fails to scan for any
+// other reason still fails the whole scan.
+func ScanAllValid[T any](rows pgx.Rows, policy ValidationPolicy) ([]T, error) {
+	defer rows.Close()
+
+	var results []T
+	var invalid []*ScanError
+	for row := 0; rows.Next(); row++ {
+		var value T
+		err := scanRow(rows, &value)
+		if err == nil {
+			results = append(results, value)
+			continue
+		}
+
+		var validationErr *ValidationError
+		if policy == FailOnInvalid || !errors.As(err, &validationErr) {
+			return nil, &ScanError{Row: row, Err: err}
+		}
+		if policy == CollectInvalid {
+			invalid = append(invalid, &ScanError{Row: row, Err: err})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	if len(invalid) > 0 {
+		return results, &InvalidRowsError{Rows: invalid}
+	}
+	return results, nil
+}
@@ -0,0 +1,122 @@
+package customtype
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestValidate checks which values validate finds a Validator in, through
+// pointers, Options, slices and the fields of a struct, and that a plain
+// Resolution isn't one.
+func TestValidate(t *testing.T) {
+	good := CheckedResolution{Width: 640, Height: 480, Scan: 'P'}
+	bad := CheckedResolution{Width: -10, Height: 10, Scan: 'P'}
+	type display struct {
+		Name string            `pg:"name"`
+		Res  CheckedResolution `pg:"res"`
+	}
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		wantErr bool
+	}{
+		{name: "valid", value: good},
+		{name: "invalid", value: bad, wantErr: true},
+		{name: "plain resolution", value: Resolution(bad)},
+		{name: "pointer", value: &bad, wantErr: true},
+		{name: "nil pointer", value: (*CheckedResolution)(nil)},
+		{name: "some", value: Some(bad), wantErr: true},
+		{name: "none", value: None[CheckedResolution]()},
+		{name: "element", value: []CheckedResolution{good, bad}, wantErr: true},
+		{name: "field", value: display{Name: "crt", Res: bad}, wantErr: true},
+		{name: "valid field", value: display{Name: "crt", Res: good}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(reflect.ValueOf(tt.value))
+			var validationErr *ValidationError
+			switch {
+			case tt.wantErr && !errors.As(err, &validationErr):
+				t.Fatalf("got %v, want a ValidationError", err)
+			case !tt.wantErr && err != nil:
+				t.Fatalf("got %v, want no error", err)
+			}
+		})
+	}
+}
+
+// TestValidateRecursive checks that a type containing itself is walked into
+// for the Validators in it, rather than taken to have none while it's being
+// looked at.
+func TestValidateRecursive(t *testing.T) {
+	type chain struct {
+		Next *chain            `pg:"next"`
+		Res  CheckedResolution `pg:"res"`
+	}
+	type plain struct {
+		Next *plain     `pg:"next"`
+		Res  Resolution `pg:"res"`
+	}
+	bad := CheckedResolution{Width: -10, Height: 10, Scan: 'P'}
+
+	// The struct first, which is what looks at its pointer part way.
+	if !mayValidate(reflect.TypeOf(chain{})) || !mayValidate(reflect.TypeOf(&chain{})) {
+		t.Error("a chain of checked resolutions has no Validator")
+	}
+	if mayValidate(reflect.TypeOf(plain{})) || mayValidate(reflect.TypeOf(&plain{})) {
+		t.Error("a chain of plain resolutions has a Validator")
+	}
+
+	nested := &chain{Next: &chain{Res: bad}, Res: CheckedResolution{Width: 640, Height: 480}}
+	var validationErr *ValidationError
+	if err := validate(reflect.ValueOf(nested)); !errors.As(err, &validationErr) {
+		t.Errorf("got %v, want a ValidationError from the second link", err)
+	}
+}
+
+// TestValidateParallel checks that queries scanning a type for the first
+// time all at once each validate it, which is best run with -race.
+func TestValidateParallel(t *testing.T) {
+	type checkedRow struct {
+		ID  int
+		Res CheckedResolution
+	}
+
+	registry, err := NewTypeRegistry(Definitions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fake decodes into the values of its one ConnInfo, as a connection
+	// does, so each query has one of its own, and only the cache is shared.
+	fakes := make([]*Fake, 64)
+	for i := range fakes {
+		if fakes[i], err = NewFake(registry); err != nil {
+			t.Fatal(err)
+		}
+		fakes[i].On("SELECT id, res FROM foo").Column("id", "int4").Column("res", "resolution").
+			Row(3, Resolution{Width: -10, Height: 10, Scan: 'P'})
+	}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, fake := range fakes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			rows, err := QueryAll[checkedRow](context.Background(), fake, "SELECT id, res FROM foo")
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Errorf("got %v, %v, want a ValidationError", rows, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
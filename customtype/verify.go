@@ -0,0 +1,224 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// Drift is a difference between a definition and its type in the database.
+type Drift struct {
+	Type string
+
+	// Field is the composite field the drift is in, if it is in one.
+	Field string
+
+	Problem string
+}
+
+func (d Drift) String() string {
+	if d.Field == "" {
+		return fmt.Sprintf("%s %s", d.Type, d.Problem)
+	}
+	return fmt.Sprintf("%s.%s %s", d.Type, d.Field, d.Problem)
+}
+
+func sortDrift(drift []Drift) {
+	sort.SliceStable(drift, func(i, j int) bool {
+		if drift[i].Type != drift[j].Type {
+			return drift[i].Type < drift[j].Type
+		}
+		return drift[i].Field < drift[j].Field
+	})
+}
+
+// Verify compares every definition with its type in the database conn is
+// connected to, and reports where they differ: types that are missing,
+// composite fields with the wrong name, position or type, domains over a
+// different base type, and enum labels missing on either side.  It's meant to
+// be run in CI against a database with every migration applied, so that the
+// Go code and the schema can't drift apart unnoticed.
+//
+// Unlike AfterConnect, Verify always asks the server, and registers nothing.
+func (r *TypeRegistry) Verify(ctx context.Context, conn *pgx.Conn) ([]Drift, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	types := r.snapshot()
+	oids, missing, err := r.findOIDs(ctx, conn, types)
+	if err != nil {
+		return nil, err
+	}
+
+	ci := conn.ConnInfo()
+	var drift []Drift
+	for _, name := range missing {
+		drift = append(drift, Drift{Type: name, Problem: "is not in the database"})
+	}
+
+	composites, err := r.compositeDrift(ctx, conn, types, oids)
+	if err != nil {
+		return nil, err
+	}
+	drift = append(drift, composites...)
+
+	for _, def := range types.definitions {
+		domain, ok := def.(DomainDefinition)
+		if !ok || domain.BaseType == "" {
+			continue
+		}
+		o, found := oids[domain.Name]
+		if !found {
+			continue
+		}
+		if base, ok := fieldTypeOID(ci, oids, domain.BaseType); ok && base != o.baseOID {
+			drift = append(drift, Drift{
+				Type:    domain.Name,
+				Problem: fmt.Sprintf("is over oid %d in the database, not %s", o.baseOID, domain.BaseType),
+			})
+		}
+	}
+
+	enums, err := r.enumDrift(ctx, conn, types, oids)
+	if err != nil {
+		return nil, err
+	}
+	drift = append(drift, enums...)
+
+	sortDrift(drift)
+	return drift, nil
+}
+
+// attribute is a field of a composite as the database has it.
+type attribute struct {
+	name    string
+	typeOID uint32
+	typ     string
+}
+
+// compositeDrift compares the fields of every composite definition with
+// pg_attribute, in one query for all of them.
+func (r *TypeRegistry) compositeDrift(ctx context.Context, conn *pgx.Conn, types *typeSet, oids map[string]typeOIDs) ([]Drift, error) {
+	composites := make(map[uint32]CompositeDefinition)
+	for _, def := range types.definitions {
+		if composite, ok := def.(CompositeDefinition); ok {
+			if o, ok := oids[composite.Name]; ok {
+				composites[o.oid] = composite
+			}
+		}
+	}
+	if len(composites) == 0 {
+		return nil, nil
+	}
+
+	attributes, err := readAttributes(ctx, conn, composites)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Drift
+	for oid, def := range composites {
+		drift = append(drift, fieldDrift(conn.ConnInfo(), oids, def, attributes[oid])...)
+	}
+	return drift, nil
+}
+
+// readAttributes reads the attributes of the composites, by OID, in order.
+func readAttributes(ctx context.Context, conn *pgx.Conn, composites map[uint32]CompositeDefinition) (map[uint32][]attribute, error) {
+	compositeOIDs := make([]uint32, 0, len(composites))
+	for oid := range composites {
+		compositeOIDs = append(compositeOIDs, oid)
+	}
+
+	rows, err := conn.Query(ctx, `select t.oid, a.attname, a.atttypid, format_type(a.atttypid, a.atttypmod)
+		from pg_type t join pg_attribute a on a.attrelid = t.typrelid
+		where t.oid = any($1) and a.attnum > 0 and not a.attisdropped
+		order by t.oid, a.attnum`, compositeOIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up composite fields: %w", err)
+	}
+	defer rows.Close()
+
+	attributes := make(map[uint32][]attribute, len(composites))
+	for rows.Next() {
+		var oid uint32
+		var a attribute
+		if err := rows.Scan(&oid, &a.name, &a.typeOID, &a.typ); err != nil {
+			return nil, fmt.Errorf("failed to scan composite fields: %w", err)
+		}
+		attributes[oid] = append(attributes[oid], a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up composite fields: %w", err)
+	}
+	return attributes, nil
+}
+
+// fieldDrift compares a composite's fields position by position.  A field
+// that is somewhere else in the database is reported as out of place rather
+// than as a wrong name.
+func fieldDrift(ci *pgtype.ConnInfo, oids map[string]typeOIDs, def CompositeDefinition, attributes []attribute) []Drift {
+	position := make(map[string]int, len(attributes))
+	for i, a := range attributes {
+		position[a.name] = i
+	}
+
+	var drift []Drift
+	for i, f := range def.Fields {
+		actual, found := position[f.Name]
+		switch {
+		case !found:
+			drift = append(drift, Drift{Type: def.Name, Field: f.Name, Problem: "is not in the database"})
+			continue
+		case actual != i:
+			drift = append(drift, Drift{
+				Type:    def.Name,
+				Field:   f.Name,
+				Problem: fmt.Sprintf("is field %d in the database, not %d", actual+1, i+1),
+			})
+		}
+
+		a := attributes[actual]
+		expected, known := fieldTypeOID(ci, oids, f.Type)
+		switch {
+		case !known:
+			drift = append(drift, Drift{Type: def.Name, Field: f.Name, Problem: fmt.Sprintf("has unknown type %s", f.Type)})
+		case expected != a.typeOID:
+			drift = append(drift, Drift{
+				Type:    def.Name,
+				Field:   f.Name,
+				Problem: fmt.Sprintf("is %s in the database, not %s", a.typ, f.Type),
+			})
+		}
+	}
+
+	defined := make(map[string]bool, len(def.Fields))
+	for _, f := range def.Fields {
+		defined[f.Name] = true
+	}
+	for _, a := range attributes {
+		if !defined[a.name] {
+			drift = append(drift, Drift{Type: def.Name, Field: a.name, Problem: "is not in the definition"})
+		}
+	}
+
+	return drift
+}
+
+// fieldTypeOID is the OID of a type a definition refers to, which is either
+// one of the registry's own types or one pgx knows about.
+func fieldTypeOID(ci *pgtype.ConnInfo, oids map[string]typeOIDs, name string) (uint32, bool) {
+	if o, ok := oids[name]; ok {
+		return o.oid, true
+	}
+	if dt, ok := ci.DataTypeForName(name); ok {
+		return dt.OID, true
+	}
+	return 0, false
+}
@@ -0,0 +1,273 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// During a rolling upgrade the same binary runs against databases before and
+// after a migration that changes a composite, say adds scan to resolution.
+// A definition lists the layouts the composite had before in Versions:
+//
+//	CompositeDefinition{
+//		Name:     "resolution",
+//		Fields:   []CompositeField{{"width", "int4"}, {"height", "int4"}, {"scan", "bpchar"}},
+//		Versions: [][]CompositeField{{{"width", "int4"}, {"height", "int4"}}},
+//	}
+//
+// Fields is still the layout the Go struct has.  A value in one of the older
+// layouts is decoded into it by name, with the fields it doesn't have left
+// null, and so zero in a struct, and fields that have since gone ignored.
+// Which layout a value is in is told from what it says of itself: the number
+// of fields, and in the binary format their OIDs too.  The text format only
+// has the count, so two layouts with as many fields can only be told apart
+// in binary.
+//
+// Values sent to the database have to be in its layout, so registering the
+// types reads the attributes of a composite with versions, and picks the
+// layout that has them, which Verify would find no drift in.  A database
+// with none of them is sent the latest, and fails as it would without
+// versions.
+
+// compositeLayout is an older layout of a composite: its fields, and where
+// each is in the latest layout, or -1 where it has gone.
+type compositeLayout struct {
+	fields    []pgtype.CompositeTypeField
+	positions []int
+}
+
+// layouts are the definition's older layouts, with the OIDs of their fields.
+func (def CompositeDefinition) layouts(ci *pgtype.ConnInfo) ([]*compositeLayout, error) {
+	latest := make(map[string]int, len(def.Fields))
+	for i, f := range def.Fields {
+		latest[f.Name] = i
+	}
+
+	layouts := make([]*compositeLayout, len(def.Versions))
+	for v, fields := range def.Versions {
+		layout := &compositeLayout{
+			fields:    make([]pgtype.CompositeTypeField, len(fields)),
+			positions: make([]int, len(fields)),
+		}
+		for i, f := range fields {
+			dt, ok := ci.DataTypeForName(f.Type)
+			if !ok {
+				return nil, fmt.Errorf("field %s of version %d of %s has type %s: %w", f.Name, v+1, def.Name, f.Type, ErrTypeNotFound)
+			}
+			layout.fields[i] = pgtype.CompositeTypeField{Name: f.Name, OID: dt.OID}
+
+			position, ok := latest[f.Name]
+			if !ok {
+				layout.positions[i] = -1
+				continue
+			}
+			if f.Type != def.Fields[position].Type {
+				return nil, fmt.Errorf("field %s of %s is %s in version %d but %s now, and a field can't change type between versions",
+					f.Name, def.Name, f.Type, v+1, def.Fields[position].Type)
+			}
+			layout.positions[i] = position
+		}
+		layouts[v] = layout
+	}
+	return layouts, nil
+}
+
+// pickVersions sets the version of each composite with versions in oids to
+// the one whose fields the database has, reading their attributes in one
+// query for all of them.
+func (r *TypeRegistry) pickVersions(ctx context.Context, conn *pgx.Conn, types *typeSet, oids map[string]typeOIDs) error {
+	composites := make(map[uint32]CompositeDefinition)
+	for _, def := range types.definitions {
+		if composite, ok := def.(CompositeDefinition); ok && len(composite.Versions) > 0 {
+			if o, ok := oids[composite.Name]; ok {
+				composites[o.oid] = composite
+			}
+		}
+	}
+	if len(composites) == 0 {
+		return nil
+	}
+
+	attributes, err := readAttributes(ctx, conn, composites)
+	if err != nil {
+		return err
+	}
+	for oid, def := range composites {
+		o := oids[def.Name]
+		o.version = 0
+		for v := len(def.Versions) - 1; v >= 0; v-- {
+			old := CompositeDefinition{Name: def.Name, Fields: def.Versions[v]}
+			if len(fieldDrift(conn.ConnInfo(), oids, old, attributes[oid])) == 0 {
+				o.version = v + 1
+				break
+			}
+		}
+		oids[def.Name] = o
+	}
+	return nil
+}
+
+// binaryLayout is the older layout whose fields the composite in src has, or
+// nil if it's the latest or none of them.
+func (cv *compositeValue) binaryLayout(src []byte) *compositeLayout {
+	if binaryFieldsAre(src, cv.fields) {
+		return nil
+	}
+	for _, layout := range cv.layouts {
+		if binaryFieldsAre(src, layout.fields) {
+			return layout
+		}
+	}
+	return nil
+}
+
+// binaryFieldsAre reports whether the composite in src has fields of the
+// same types as fields.
+func binaryFieldsAre(src []byte, fields []pgtype.CompositeTypeField) bool {
+	s := newCompositeBinaryScanner(src)
+	if s.Err() != nil || s.FieldCount() != len(fields) {
+		return false
+	}
+	for i := 0; s.Next(); i++ {
+		if s.OID() != fields[i].OID {
+			return false
+		}
+	}
+	return s.Err() == nil
+}
+
+// textLayout is the older layout with as many fields as the composite in
+// src, or nil if the latest has as many or none of them do.
+func (cv *compositeValue) textLayout(src []byte) *compositeLayout {
+	s := newCompositeTextScanner(src)
+	s.buf = cv.textBuf[:0]
+	count := 0
+	for s.Next() {
+		count++
+	}
+	cv.textBuf = s.buf
+	if s.Err() != nil || count == len(cv.fields) {
+		return nil
+	}
+	for _, layout := range cv.layouts {
+		if count == len(layout.fields) {
+			return layout
+		}
+	}
+	return nil
+}
+
+// startLayout gets ready to decode a value in layout, with every field absent
+// until it's decoded.
+func (cv *compositeValue) startLayout() {
+	if cap(cv.absent) < len(cv.values) {
+		cv.absent = make([]bool, len(cv.values))
+	}
+	cv.absent = cv.absent[:len(cv.values)]
+	for i := range cv.absent {
+		cv.absent[i] = true
+	}
+	cv.status = pgtype.Undefined
+}
+
+// finishLayout makes the fields the value didn't have null.
+func (cv *compositeValue) finishLayout(ci *pgtype.ConnInfo, binary bool) error {
+	for i, absent := range cv.absent {
+		if !absent {
+			continue
+		}
+		var err error
+		if binary {
+			err = cv.values[i].DecodeBinary(ci, nil)
+		} else {
+			err = cv.values[i].DecodeText(ci, nil)
+		}
+		if err != nil {
+			return cv.fieldError(i, err)
+		}
+	}
+	cv.received = len(cv.values)
+	cv.status = pgtype.Present
+	cv.recordDecoded(false)
+	return nil
+}
+
+func (cv *compositeValue) decodeLayoutBinary(ci *pgtype.ConnInfo, src []byte, layout *compositeLayout) error {
+	cv.startLayout()
+	s := newCompositeBinaryScanner(src)
+	for i := 0; s.Next(); i++ {
+		position := layout.positions[i]
+		if position < 0 {
+			continue
+		}
+		if err := cv.values[position].DecodeBinary(ci, s.Bytes()); err != nil {
+			return cv.fieldError(position, err)
+		}
+		cv.absent[position] = false
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", cv.typeName, err)
+	}
+	return cv.finishLayout(ci, true)
+}
+
+func (cv *compositeValue) decodeLayoutText(ci *pgtype.ConnInfo, src []byte, layout *compositeLayout) error {
+	cv.startLayout()
+	s := newCompositeTextScanner(src)
+	s.buf = cv.textBuf[:0]
+	for i := 0; s.Next(); i++ {
+		position := layout.positions[i]
+		if position < 0 {
+			continue
+		}
+		if err := cv.values[position].DecodeText(ci, s.Bytes()); err != nil {
+			return cv.fieldError(position, err)
+		}
+		cv.absent[position] = false
+	}
+	cv.textBuf = s.buf
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", cv.typeName, err)
+	}
+	return cv.finishLayout(ci, false)
+}
+
+// encodeLayoutBinary encodes the value in the layout the database has, with
+// a null for each field the latest doesn't have.
+func (cv *compositeValue) encodeLayoutBinary(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	b := pgtype.NewCompositeBinaryBuilder(ci, buf)
+	for i, position := range cv.sent.positions {
+		if position < 0 {
+			b.AppendEncoder(cv.sent.fields[i].OID, nullEncoder{})
+			continue
+		}
+		b.AppendEncoder(cv.sent.fields[i].OID, cv.values[position])
+	}
+	return b.Finish()
+}
+
+func (cv *compositeValue) encodeLayoutText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	b := pgtype.NewCompositeTextBuilder(ci, buf)
+	for _, position := range cv.sent.positions {
+		if position < 0 {
+			b.AppendEncoder(nullEncoder{})
+			continue
+		}
+		b.AppendEncoder(cv.values[position])
+	}
+	return b.Finish()
+}
+
+// nullEncoder encodes a null in either format.
+type nullEncoder struct{}
+
+func (nullEncoder) EncodeBinary(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (nullEncoder) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,161 @@
+package customtype
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Refresh has to be called after a migration that changes the types, or the
+// application restarted.  A Watcher calls it for us when the types change,
+// either when told to by an event trigger, or when it sees the change in the
+// catalog itself.
+
+// WatchTriggerSQL creates an event trigger that notifies the channel
+// customtype_ddl whenever a type or domain is created, altered or dropped,
+// for a Watcher with that Channel.  Creating an event trigger takes a
+// superuser; a Watcher with an Interval needs nothing but the catalog.
+const WatchTriggerSQL = `create or replace function customtype_notify_ddl() returns event_trigger
+    language plpgsql as $$
+begin
+    perform pg_notify('customtype_ddl', to_json(tg_tag)::text);
+end $$;
+
+create event trigger customtype_ddl on ddl_command_end
+    when tag in ('CREATE TYPE', 'ALTER TYPE', 'DROP TYPE', 'CREATE DOMAIN', 'ALTER DOMAIN', 'DROP DOMAIN')
+    execute procedure customtype_notify_ddl();`
+
+// Watcher is how Watch finds out about changes to the types.  It needs a
+// Channel, an Interval or both.
+type Watcher struct {
+	// Channel is listened on for notifications like those of
+	// WatchTriggerSQL, each of which refreshes the types.
+	Channel string
+
+	// Interval is how often to look at the registry's types in the catalog,
+	// refreshing them when their OIDs, attributes or labels have changed.
+	Interval time.Duration
+
+	// OnRefresh, if set, is called after each refresh, with the error if it
+	// failed, and with the errors from watching as well.
+	OnRefresh func(err error)
+}
+
+// check makes sure w has a way of finding out about changes.
+func (w Watcher) check() error {
+	if w.Channel == "" && w.Interval <= 0 {
+		return fmt.Errorf("a watcher needs a channel or an interval")
+	}
+	return nil
+}
+
+// Watch refreshes the types on pool's connections whenever w sees them
+// change, until ctx is done.
+func (r *TypeRegistry) Watch(ctx context.Context, pool *pgxpool.Pool, w Watcher) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	log := r.logger()
+	report := func(err error) {
+		if err != nil {
+			log.log(ctx, pgx.LogLevelWarn, "failed to watch types", map[string]interface{}{"err": err})
+		}
+		if w.OnRefresh != nil {
+			w.OnRefresh(err)
+		}
+	}
+
+	var notifications <-chan Notification[string]
+	if w.Channel != "" {
+		notifications = Listen[string](ctx, pool, Subscription{Channel: w.Channel})
+	}
+
+	var tick <-chan time.Time
+	var signature string
+	if w.Interval > 0 {
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+
+		var err error
+		if signature, err = r.catalogSignature(ctx, pool); err != nil {
+			report(err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case n, ok := <-notifications:
+			if !ok {
+				return ctx.Err()
+			}
+			if n.Err != nil {
+				report(n.Err)
+				continue
+			}
+			log.log(ctx, pgx.LogLevelInfo, "types changed", map[string]interface{}{"channel": n.Channel, "payload": n.Value})
+			report(r.Refresh(ctx, pool))
+			if tick != nil {
+				// Save the next tick refreshing again for the same change.
+				if s, err := r.catalogSignature(ctx, pool); err == nil {
+					signature = s
+				}
+			}
+
+		case <-tick:
+			s, err := r.catalogSignature(ctx, pool)
+			if err != nil {
+				report(err)
+				continue
+			}
+			if s != signature {
+				signature = s
+				log.log(ctx, pgx.LogLevelInfo, "types changed", map[string]interface{}{"catalog": true})
+				report(r.Refresh(ctx, pool))
+			}
+		}
+	}
+}
+
+// catalogSignature sums up what the catalog says about the registry's types:
+// which are missing, and the OIDs, attributes and labels of the rest.  It
+// changes whenever something that needs a refresh does.
+func (r *TypeRegistry) catalogSignature(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to acquire a connection: %w", err)
+	}
+	defer c.Release()
+
+	oids, missing, err := r.findOIDs(ctx, c.Conn(), r.snapshot())
+	if err != nil {
+		return "", err
+	}
+	found := make([]int64, 0, len(oids))
+	for _, o := range oids {
+		found = append(found, int64(o.oid))
+	}
+
+	rows, err := c.Conn().Query(ctx, `select t.oid::text || '(' ||
+			coalesce((select string_agg(a.attname || ' ' || a.atttypid || ' ' || a.atttypmod, ',' order by a.attnum)
+				from pg_attribute a where a.attrelid = t.typrelid and a.attnum > 0 and not a.attisdropped), '') ||
+			coalesce((select string_agg(e.enumlabel, ',' order by e.enumsortorder)
+				from pg_enum e where e.enumtypid = t.oid), '') || ')'
+		from pg_type t where t.oid::int8 = any($1) order by t.oid`, found)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up types: %w", err)
+	}
+	types, err := ScanAll[string](rows)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up types: %w", err)
+	}
+
+	return strings.Join(types, ";") + " missing " + strings.Join(missing, ","), nil
+}
@@ -0,0 +1,65 @@
+package customtype_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+
+	"testCustomType/customtype"
+	"testCustomType/customtype/pgwire"
+)
+
+// TestWireReplay runs the demo's queries against what postgres sends for
+// them, NULL composites and NULL fields among it, without postgres.  The
+// types' OIDs come from metadata, as a locked down database would have them,
+// so that the fixture is only the queries.
+func TestWireReplay(t *testing.T) {
+	ctx := context.Background()
+	registry, err := customtype.NewTypeRegistry(customtype.Definitions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Metadata = &customtype.Metadata{Types: []customtype.TypeMetadata{
+		{Name: "resolution", OID: 16386, ArrayOID: 16385},
+		{Name: "foo", OID: 16394, ArrayOID: 16393},
+		{Name: "display", OID: 16401, ArrayOID: 16400},
+	}}
+
+	conn, err := pgx.ConnectConfig(ctx, pgwire.Replay(t, "testdata/wire/composites.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	if err := registry.AfterConnect(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := customtype.QueryResolutions(ctx, conn, "SELECT res FROM foo ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRes := []*customtype.Resolution{
+		{Width: 10, Height: 10, Scan: 'P'},
+		nil,
+		{Width: -10, Height: 10, Scan: 'P'},
+		{Width: 10, Height: 10, Scan: 'P'},
+		{Width: 0, Height: 0, Scan: 'P'},
+	}
+	if !reflect.DeepEqual(res, wantRes) {
+		t.Errorf("got %v, want %v", res, wantRes)
+	}
+
+	disp, err := customtype.QueryDisplays(ctx, conn, "SELECT disp FROM bar ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDisp := []*customtype.Display{
+		{Res: customtype.Resolution{Width: 1920, Height: 1080, Scan: 'P'}, Label: "HD"},
+		{Res: customtype.Resolution{Scan: 'P'}, Label: "unknown"},
+	}
+	if !reflect.DeepEqual(disp, wantDisp) {
+		t.Errorf("got %v, want %v", disp, wantDisp)
+	}
+}
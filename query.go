@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"testCustomType/customtype"
+)
+
+// query runs the demo: the resolutions and displays in the tables created by
+// customtype/pgtest/schema.sql, every way we can read them.
+// With -query it runs that instead, and prints what comes back, or with
+// -dump the bytes the server sent, a field at a time, for when a composite
+// doesn't decode.
+func query(ctx context.Context, args []string) error {
+	f := newFlags("query")
+	sql := f.String("query", "", "a query to run and print the rows of, instead of the demo")
+	dump := f.Bool("dump", false, "print the bytes of every column of the -query, a field at a time, rather than decoding them")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+	connString, err := f.connString()
+	if err != nil {
+		return err
+	}
+
+	// Step 1: Describe the types to register on every connection.  The
+	// registry looks up every OID in one query per database.
+	registry, err := f.registry()
+	if err != nil {
+		return err
+	}
+
+	// Step 2: Create the pool
+	pool, err := customtype.Connect(ctx, connString, registry)
+	if err != nil {
+		return fmt.Errorf("no database connection: %w", err)
+	}
+	defer pool.Close()
+
+	if *sql != "" {
+		return printQuery(ctx, pool, *sql, *dump)
+	}
+
+	// Step 3: Profit
+	resolutions, err := customtype.QueryResolutions(ctx, pool, "SELECT res FROM foo")
+	if err != nil {
+		return err
+	}
+	for _, res := range resolutions {
+		if res != nil {
+			slog.Info("Got a resolution", "resolution", *res)
+		} else {
+			slog.Info("No defined resolution")
+		}
+	}
+
+	// A whole column's worth of resolutions comes back as a resolution[], which
+	// scans into a slice of optional DTOs; a []Resolution works as well when
+	// there are no nulls.
+	var all []customtype.Option[customtype.ResolutionDTO]
+	if err := pool.QueryRow(ctx, "SELECT array_agg(res) FROM foo").Scan(&all); err != nil {
+		return fmt.Errorf("array query failed: %w", err)
+	}
+	slog.Info("Got resolutions in an array", "count", len(all))
+
+	// A null resolution is None, which isn't the same as a resolution with
+	// every field null.
+	for i, res := range all {
+		switch {
+		case !res.IsSome():
+			slog.Info("Resolution is null", "index", i)
+		case res.Unwrap().AllNull():
+			slog.Info("Resolution has only null fields", "index", i)
+		}
+	}
+
+	// Going the other way, a Resolution is a query parameter like any other.
+	// A nil *ResolutionDTO, nil DTO fields and None are all sent as nulls.
+	progressive := customtype.Resolution{Width: 10, Height: 10, Scan: 'P'}
+	rows, err := pool.Query(ctx, "SELECT id FROM foo WHERE res = $1 ORDER BY id LIMIT 1", progressive)
+	if err != nil {
+		return fmt.Errorf("parameter query failed: %w", err)
+	}
+	id, err := customtype.ScanOne[int](rows)
+	if err != nil {
+		return fmt.Errorf("parameter query failed: %w", err)
+	}
+	slog.Info("Found a resolution", "resolution", progressive, "id", id)
+
+	// The helpers work in a transaction too, and an error rolls it back, so
+	// the row we add here doesn't stay.
+	errRollback := errors.New("rolled back on purpose")
+	err = customtype.BeginFunc(ctx, pool, func(tx customtype.Tx) error {
+		if _, err := tx.Exec(ctx, "INSERT INTO foo VALUES ($1, $2)", 100, progressive); err != nil {
+			return fmt.Errorf("insert failed: %w", err)
+		}
+		n, err := customtype.QueryOne[int](ctx, tx, "SELECT count(*) FROM foo WHERE res = $1", progressive)
+		if err != nil {
+			return err
+		}
+		slog.Info("In the transaction", "rows", n, "resolution", progressive)
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		return fmt.Errorf("transaction failed: %w", err)
+	}
+
+	// Scanning into a CheckedResolution validates it, and foo has one with a
+	// negative width.  We keep the good ones and log the others.
+	// The builder works out the parentheses of (res).scan for us.
+	res := customtype.Column[customtype.Resolution]("res")
+	validSQL, validArgs, err := customtype.NewQuery("SELECT res FROM foo").
+		WhereNotNull(res.Field("Scan")).
+		OrderBy(customtype.Column[int]("id")).
+		Build()
+	if err != nil {
+		return err
+	}
+	rows, err = pool.Query(ctx, validSQL, validArgs...)
+	if err != nil {
+		return fmt.Errorf("validated query failed: %w", err)
+	}
+	valid, err := customtype.ScanAllValid[customtype.CheckedResolution](rows, customtype.CollectInvalid)
+	var invalid *customtype.InvalidRowsError
+	if errors.As(err, &invalid) {
+		for _, row := range invalid.Rows {
+			slog.Warn("Skipped an invalid row", "row", row)
+		}
+	} else if err != nil {
+		return fmt.Errorf("validated query failed: %w", err)
+	}
+	slog.Info("Got valid resolutions", "count", len(valid))
+
+	// With defaults in the config, the registry read resolution's from
+	// resolution_defaults, and a null field gets what the database says.
+	if policies, ok := registry.NullPolicies("resolution"); ok {
+		rows, err = pool.Query(ctx, "SELECT res FROM foo WHERE res IS NOT NULL ORDER BY id")
+		if err != nil {
+			return fmt.Errorf("defaults query failed: %w", err)
+		}
+		dtos, err := customtype.ScanAll[customtype.ResolutionDTO](rows)
+		if err != nil {
+			return fmt.Errorf("defaults query failed: %w", err)
+		}
+		for _, dto := range dtos {
+			res, err := dto.AsResolutionWith(policies)
+			if err != nil {
+				return err
+			}
+			slog.Info("With the database's defaults", "resolution", res)
+		}
+	}
+
+	// A whole row of foo is a composite as well.
+	rows, err = pool.Query(ctx, "SELECT foo FROM foo ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("row query failed: %w", err)
+	}
+	foos, err := customtype.ScanAll[customtype.Foo](rows)
+	if err != nil {
+		return fmt.Errorf("row query failed: %w", err)
+	}
+	for _, foo := range foos {
+		if foo.Res.IsSome() {
+			slog.Info("Got a row", "id", foo.ID, "resolution", foo.Res.Unwrap().AsResolution())
+		} else {
+			slog.Info("Row has no resolution", "id", foo.ID)
+		}
+	}
+
+	// Functions that return composites come back the same way.
+	wide, err := customtype.CallFunc[customtype.ResolutionDTO](ctx, pool, "wider_than", 5)
+	if err != nil {
+		return err
+	}
+	for _, res := range wide {
+		slog.Info("Wider than 5", "resolution", res.AsResolution())
+	}
+
+	// Selecting from the function instead gives a column per field, which
+	// scan into the DTO's fields by name.
+	exploded, err := customtype.CallFuncColumns[customtype.ResolutionDTO](ctx, pool, "wider_than", 5)
+	if err != nil {
+		return err
+	}
+	slog.Info("Wider than 5, a column per field", "count", len(exploded))
+
+	displays, err := customtype.QueryDisplays(ctx, pool, "SELECT disp FROM bar")
+	if err != nil {
+		return err
+	}
+	for _, disp := range displays {
+		if disp != nil {
+			slog.Info("Got a display", "display", *disp)
+		} else {
+			slog.Info("No defined display")
+		}
+	}
+
+	return nil
+}
+
+// printQuery runs sql and prints every row, a column to a line, with the
+// column's type.  The registry's composites come out as maps of their fields.
+// With dump it prints every column with customtype.DumpValue instead, which
+// needn't decode.
+func printQuery(ctx context.Context, pool *pgxpool.Pool, sql string, dump bool) error {
+	// The types are registered on each connection, so we name them from the
+	// one that runs the query.
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("no database connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, sql)
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	ci := conn.Conn().ConnInfo()
+	n := 0
+	for rows.Next() {
+		if dump {
+			n++
+			for i, fd := range rows.FieldDescriptions() {
+				fmt.Printf("Row %d, %s\n", n, fd.Name)
+				if err := customtype.DumpValue(os.Stdout, ci, fd.DataTypeOID, fd.Format, rows.RawValues()[i]); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		values, err := rows.Values()
+		if err != nil {
+			return fmt.Errorf("failed to read row %d: %w", n+1, err)
+		}
+
+		n++
+		fmt.Printf("Row %d\n", n)
+		for i, fd := range rows.FieldDescriptions() {
+			typ := fmt.Sprintf("oid %d", fd.DataTypeOID)
+			if dt, ok := ci.DataTypeForOID(fd.DataTypeOID); ok {
+				typ = dt.Name
+			}
+			fmt.Printf("  %s (%s): %v\n", fd.Name, typ, values[i])
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+
+	fmt.Printf("%d rows\n", n)
+	return nil
+}
@@ -2,151 +2,285 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
-	"log"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
 
-	"github.com/jackc/pgtype"
+	"testCustomType/customtype"
 )
 
-/*
-create type resolution as (
-    width int,
-    height int,
-    scan char
-);
-
-create table foo (id int primary key, res resolution);
-insert into foo values (1, (10, 10, 'P'));
-insert into foo values (2, null);
-insert into foo values (3, (-10, 10, 'P'));
-insert into foo values (4, (10, 10, null));
-
-select * from foo;
-*/
-
-// Resolution is a custom type defined in postgres.  We want to map it to
-// a struct in Go.  Except... we might need to handle nulls.  In which case
-// we'll go through a data transfer object (DTO).
-type Resolution struct {
-	Width, Height int
-	Scan          rune
+// The demo runs against the schema in customtype/pgtest/schema.sql, which
+// psql -f applies to a database of our own, and pgtest to the ones it starts
+// for the integration tests.
+
+// command is a subcommand of testCustomType.  run gets the arguments after
+// the command's name.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, args []string) error
 }
 
-// This has nullable fields where deal with the database possibly returning
-// null.  If you can guarantee the fields will not be null, then you don't
-// need the DTO and you would just have the type above.
-type resolutionDTO struct {
-	Width, Height *int
-	Scan          *rune
+// commands is filled in by init, since help looks commands up.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"describe", "describe [flags] <type>...", "print the server's definition of a type and its OIDs", describe},
+		{"query", "query [flags]", "run the demo queries", query},
+		{"generate", "generate [flags]", "write Go code for the types", generate},
+		{"sqlc", "sqlc [flags]", "print the sqlc.yaml overrides that use the generated Go code", sqlc},
+		{"verify", "verify [flags]", "check the definitions against the database, for CI", verify},
+		{"health", "health [flags]", "check the database and its types, as a readiness probe would", health},
+		{"listen", "listen [flags]", "print the resolutions notified on a channel", listen},
+		{"serve", "serve [flags]", "serve the rows of foo over HTTP as JSON", serve},
+		{"help", "help [command]", "show how to use a command", help},
+	}
 }
 
-// AsResolution converts the DTO with its nulls into a semantically valid application type.
-func (rdto resolutionDTO) AsResolution() Resolution {
-	var result Resolution
+// errDrift is what verify returns when it finds drift, so that main can tell
+// drift from not being able to check.
+var errDrift = errors.New("the definitions and the database have drifted apart")
 
-	if rdto.Width == nil {
-		result.Width = 0
-	} else {
-		result.Width = *rdto.Width
+func main() {
+	ctx := context.Background()
+
+	// Without a command we run the demo, as we always have.
+	args := os.Args[1:]
+	name := "query"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
 	}
 
-	if rdto.Height == nil {
-		result.Height = 0
-	} else {
-		result.Height = *rdto.Height
+	cmd, ok := lookup(name)
+	if !ok {
+		slog.Error("Unknown command", "command", name)
+		usage()
+		os.Exit(2)
 	}
 
-	if rdto.Scan == nil {
-		result.Scan = 'P'
-	} else {
-		result.Scan = *rdto.Scan
+	err := cmd.run(ctx, args)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.Is(err, errDrift):
+		slog.Error(err.Error())
+		os.Exit(1)
+	default:
+		slog.Error("Bailing", "err", err)
+		os.Exit(2)
 	}
+}
 
-	return result
+func lookup(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
 }
 
-// String to produce a human readable resolution.
-func (r Resolution) String() string {
-	return fmt.Sprintf("[%d, %d] at %c", r.Width, r.Height, r.Scan)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: testCustomType <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
 }
 
-func main() {
-	DBURI := os.Getenv("DB_URI")
+func help(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		usage()
+		return nil
+	}
 
-	// Step 1: Create pool configuration
-	poolConfig, err := pgxpool.ParseConfig(DBURI)
-	if err != nil {
-		log.Fatalf("Failed to parse config: %v", err)
+	cmd, ok := lookup(args[0])
+	if !ok {
+		return fmt.Errorf("unknown command %s", args[0])
 	}
+	_, err := newFlags(cmd.name).parse([]string{"-h"})
+	return err
+}
 
-	// Step 2: Set the function to register the type
-	poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
-		// We retrieve the OID for our custom type.
-		var oid uint32
-		row := conn.QueryRow(context.Background(), "select 'resolution'::regtype::oid")
-		if err := row.Scan(&oid); err != nil {
-			log.Printf("Failed to scan oid: %v", err)
-			return err
-		}
+// flags are the flags every command has, along with its own.
+type flags struct {
+	*flag.FlagSet
+	config string
+	dsn    string
+	host   string
+	port   string
+	user   string
+	dbname string
+
+	logLevel slog.Level
+	wait     bool
+	create   bool
+}
 
-		// Create the custom type
-		ctype, err := pgtype.NewCompositeType("resolution", []pgtype.CompositeTypeField{
-			{"width", pgtype.Int4OID},
-			{"height", pgtype.Int4OID},
-			{"scan", pgtype.BPCharOID},
-		}, conn.ConnInfo())
+// newFlags creates the flags of the command called name.
+func newFlags(name string) *flags {
+	cmd, _ := lookup(name)
+	f := &flags{FlagSet: flag.NewFlagSet(cmd.name, flag.ContinueOnError)}
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "Usage: testCustomType %s\n\n%s%s.\n\n", cmd.usage, strings.ToUpper(cmd.summary[:1]), cmd.summary[1:])
+		f.PrintDefaults()
+	}
+	f.StringVar(&f.config, "config", os.Getenv("TYPES_CONFIG"), "a types.yaml to take the types from instead of the compiled in definitions")
+	f.StringVar(&f.dsn, "dsn", os.Getenv("DB_URI"), "the database to connect to, as a URL or keyword/value pairs")
+	f.StringVar(&f.host, "host", "", "the database server's host, instead of the one in -dsn")
+	f.StringVar(&f.port, "port", "", "the database server's port, instead of the one in -dsn")
+	f.StringVar(&f.user, "user", "", "the user to connect as, instead of the one in -dsn")
+	f.StringVar(&f.dbname, "dbname", "", "the database to connect to, instead of the one in -dsn")
+	f.BoolVar(&f.wait, "wait", false, "wait for the types to be created, as the migrations of a deployment starting alongside us would")
+	f.BoolVar(&f.create, "create", false, "create the types that aren't in the database, for a scratch database")
+	f.TextVar(&f.logLevel, "log-level", slog.LevelInfo, "the least severe messages to log: debug, info, warn or error")
+	return f
+}
+
+// connString is the connection string the flags describe.  It's -dsn, or
+// DB_URI, with -host, -port, -user and -dbname in place of what it says.
+// Whatever is left out is found the way libpq would find it, from the PG*
+// environment variables such as PGHOST and PGPASSWORD, then from .pgpass (or
+// PGPASSFILE) for the password, so an empty connection string is fine.
+func (f *flags) connString() (string, error) {
+	overrides := []struct{ key, value string }{
+		{"host", f.host},
+		{"port", f.port},
+		{"user", f.user},
+		{"dbname", f.dbname},
+	}
+
+	if strings.HasPrefix(f.dsn, "postgres://") || strings.HasPrefix(f.dsn, "postgresql://") {
+		u, err := url.Parse(f.dsn)
 		if err != nil {
-			log.Printf("Failed to register new type: %v", err)
-			return err
+			return "", fmt.Errorf("failed to parse -dsn: %w", err)
+		}
+		for _, o := range overrides {
+			if o.value == "" {
+				continue
+			}
+			switch o.key {
+			case "host":
+				if port := u.Port(); port != "" {
+					u.Host = net.JoinHostPort(o.value, port)
+				} else {
+					u.Host = o.value
+				}
+			case "port":
+				u.Host = net.JoinHostPort(u.Hostname(), o.value)
+			case "user":
+				password, ok := u.User.Password()
+				if ok {
+					u.User = url.UserPassword(o.value, password)
+				} else {
+					u.User = url.User(o.value)
+				}
+			case "dbname":
+				u.Path = "/" + o.value
+			}
 		}
+		return u.String(), nil
+	}
 
-		// Register the custom type with our connection.
-		conn.ConnInfo().RegisterDataType(pgtype.DataType{
-			Value: ctype,
-			Name:  ctype.TypeName(),
-			OID:   oid,
-		})
+	// In the keyword/value form a later setting wins over an earlier one.
+	settings := []string{f.dsn}
+	for _, o := range overrides {
+		if o.value != "" {
+			settings = append(settings, fmt.Sprintf("%s='%s'", o.key, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(o.value)))
+		}
+	}
+	return strings.TrimSpace(strings.Join(settings, " ")), nil
+}
 
-		return nil
+// parse parses args, and returns what's left after the flags.
+func (f *flags) parse(args []string) ([]string, error) {
+	if err := f.Parse(args); err != nil {
+		return nil, err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: f.logLevel})))
+	return f.Args(), nil
+}
+
+// connect connects to the database the flags describe, without registering
+// any types.
+func (f *flags) connect(ctx context.Context) (*pgx.Conn, error) {
+	connString, err := f.connString()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("no database connection: %w", err)
 	}
+	return conn, nil
+}
 
-	// Step 3: Create the pool
-	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+// registry creates the registry from the config file, or from
+// customtype.Definitions if there isn't one.  It logs to slog's default
+// logger, at the level of -log-level.  With -wait it retries registering the
+// types until they're there, and with -create it creates them itself.
+func (f *flags) registry() (*customtype.TypeRegistry, error) {
+	registry, err := f.newRegistry()
 	if err != nil {
-		log.Fatalf("Bailing - no database connection: %v", err)
+		return nil, err
+	}
+	registry.Logger = customtype.NewSlogLogger(slog.Default())
+	registry.LogLevel = pgxLogLevel(f.logLevel)
+	if f.wait {
+		registry.Retry.Wait = true
 	}
-	defer pool.Close()
+	if f.create {
+		registry.CreateMissing = true
+	}
+	return registry, nil
+}
 
-	// Step 4: Profit
-	conn, err := pool.Acquire(context.Background())
+func (f *flags) newRegistry() (*customtype.TypeRegistry, error) {
+	config, err := f.typesConfig()
 	if err != nil {
-		log.Fatalf("Failed to acquire a connection from the pool: %v", err)
+		return nil, err
+	}
+	if f.config != "" {
+		return config.Registry()
 	}
-	defer conn.Release()
 
-	rows, err := conn.Query(context.Background(), "SELECT res FROM foo")
+	registry, err := customtype.NewTypeRegistry(customtype.Definitions...)
 	if err != nil {
-		log.Fatalf("Bailing - query failed: %v", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		// This is a pointer to the DTO - because our value might be null, in
-		// which case, `some` would be set to nil.  If you can guarantee the
-		// fields in the resulting object will never be null, you can use a
-		// pointer to the Resolution type instead of the DTO.
-		var some *resolutionDTO
-		if err := rows.Scan(&some); err != nil {
-			log.Printf("Failed to scan: %v", err)
-		} else {
-			if some != nil {
-				log.Printf("Got %v", some.AsResolution())
-			} else {
-				log.Printf("No defined resolution")
-			}
-		}
+		return nil, fmt.Errorf("failed to create type registry: %w", err)
+	}
+	registry.Timeout = 5 * time.Second
+	return registry, nil
+}
+
+// pgxLogLevel is the pgx level that logs what level does in slog, so the
+// registry doesn't make up messages the handler would throw away.
+func pgxLogLevel(level slog.Level) pgx.LogLevel {
+	switch {
+	case level <= slog.LevelDebug:
+		return pgx.LogLevelDebug
+	case level <= slog.LevelInfo:
+		return pgx.LogLevelInfo
+	case level <= slog.LevelWarn:
+		return pgx.LogLevelWarn
+	}
+	return pgx.LogLevelError
+}
+
+// typesConfig is the config file, or the config of customtype.Definitions if
+// there isn't one.
+func (f *flags) typesConfig() (*customtype.Config, error) {
+	if f.config == "" {
+		return customtype.ConfigFor(customtype.Definitions...), nil
 	}
+	return customtype.LoadConfig(f.config)
 }